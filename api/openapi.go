@@ -0,0 +1,12 @@
+// Package api holds the definitions of the APIs of the delivr daemon: the
+// OpenAPI document of the HTTP API and the protobuf definitions of the gRPC
+// API, whose generated code is in the delivr/v1 package.
+package api
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI 3 document of the HTTP API, in YAML, with the
+// default paths of the endpoints
+//
+//go:embed openapi.yaml
+var OpenAPI []byte
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/server"
+)
+
+// loadServerConfig loads the configuration and checks that the daemon can
+// be reached through its HTTP server
+func loadServerConfig(configPath string) (*config.Config, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if cfg.Server == nil {
+		return nil, fmt.Errorf("no server configured in %s, the daemon can't be controlled", cfg.Source())
+	}
+	return cfg, nil
+}
+
+// callDaemon posts a request to an endpoint of the HTTP server of the running
+// daemon and returns the response body. suffix is appended to the path of the
+// endpoint, e.g. "/name?force=true".
+func callDaemon(cfg *config.Config, endpoint, suffix, token string, body interface{}) ([]byte, error) {
+	path, err := server.EndpointPath(cfg.Server, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	path += suffix
+
+	// Reach a daemon listening on all interfaces through the loopback
+	address := cfg.Server.Address
+	if address == "" {
+		address = server.DefaultAddress
+	}
+	if host, port, err := net.SplitHostPort(address); err == nil && (host == "" || host == "0.0.0.0" || host == "::") {
+		address = net.JoinHostPort("127.0.0.1", port)
+	}
+
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://"+address+path, payload)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		if cfg.Server.TokenHeader != "" {
+			req.Header.Set(cfg.Server.TokenHeader, token)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the daemon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("daemon answered HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, nil
+}
+
+// sendControl sends a control request (pause, resume) to the running daemon
+func sendControl(action, configPath string) error {
+	cfg, err := loadServerConfig(configPath)
+	if err != nil {
+		return err
+	}
+	_, err = callDaemon(cfg, action, "", cfg.Server.Token, nil)
+	return err
+}
+
+// sendPromote starts a release of a workflow on the running daemon and
+// returns its ID. args are the command line arguments following "promote".
+func sendPromote(args []string, configPath string) (string, error) {
+	flags := flag.NewFlagSet("promote", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", configPath, "Path to the configuration file")
+	force := flags.Bool("force", false, "Run the protected commands during a freeze period")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: delivr promote [flags] <workflow>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := loadServerConfig(configPath)
+	if err != nil {
+		return "", err
+	}
+	suffix := "/" + url.PathEscape(flags.Arg(0))
+	if *force {
+		suffix += "?force=true"
+	}
+	body, err := callDaemon(cfg, "workflows", suffix, cfg.Server.Token, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(body, &resp)
+	return resp.ID, nil
+}
+
+// sendDecision approves or rejects a release waiting on the running daemon.
+// args are the command line arguments following the action.
+func sendDecision(action string, args []string, configPath string) error {
+	flags := flag.NewFlagSet(action, flag.ExitOnError)
+	flags.StringVar(&configPath, "config", configPath, "Path to the configuration file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: delivr %s [flags] <release>\n", action)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := loadServerConfig(configPath)
+	if err != nil {
+		return err
+	}
+	req := server.DecisionRequest{By: currentUser()}
+	_, err = callDaemon(cfg, action, "/"+url.PathEscape(flags.Arg(0)), cfg.Server.Token, req)
+	return err
+}
+
+// sendReplay asks the running daemon to replay a recorded run, and returns
+// the ID of the job and the warning of the daemon, if any
+func sendReplay(args []string, configPath string) (string, string, error) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", configPath, "Path to the configuration file")
+	force := flags.Bool("force", false, "Run the protected commands during a freeze period")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: delivr replay [flags] <run>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := loadServerConfig(configPath)
+	if err != nil {
+		return "", "", err
+	}
+	suffix := "/" + url.PathEscape(flags.Arg(0))
+	if *force {
+		suffix += "?force=true"
+	}
+	body, err := callDaemon(cfg, "replay", suffix, cfg.Server.Token, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	var resp struct {
+		ID      string `json:"id"`
+		Warning string `json:"warning"`
+	}
+	json.Unmarshal(body, &resp)
+	return resp.ID, resp.Warning, nil
+}
+
+// sendAdhoc submits an ad-hoc command to the running daemon. args are the
+// command line arguments following "adhoc".
+func sendAdhoc(args []string, configPath string) (string, error) {
+	flags := flag.NewFlagSet("adhoc", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", configPath, "Path to the configuration file")
+	template := flags.String("template", "", "Configured command used as a template")
+	name := flags.String("name", "", "Name of the command, shown in notifications and logs")
+	description := flags.String("description", "", "Description of the command")
+	dir := flags.String("dir", "", "Working directory of the command")
+	timeout := flags.Duration("timeout", 0, "Maximum execution time of the command")
+	shell := flags.String("shell", "", "Shell script run instead of a command")
+	force := flags.Bool("force", false, "Run a protected template during a freeze period")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: delivr adhoc [flags] [--shell script | [--] command [args...]]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	req := server.AdhocRequest{
+		Template:    *template,
+		Name:        *name,
+		Description: *description,
+		Dir:         *dir,
+		Timeout:     config.Duration(*timeout),
+		Shell:       *shell,
+		RequestedBy: currentUser(),
+		Force:       *force,
+	}
+	if flags.NArg() > 0 {
+		req.Command = flags.Arg(0)
+		req.Args = flags.Args()[1:]
+	}
+
+	cfg, err := loadServerConfig(configPath)
+	if err != nil {
+		return "", err
+	}
+	body, err := callDaemon(cfg, "adhoc", "", cfg.Server.AdminToken, req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(body, &resp)
+	return resp.ID, nil
+}
+
+// currentUser returns the name of the user running delivr, for notifications
+func currentUser() string {
+	host, _ := os.Hostname()
+	for _, name := range []string{"SUDO_USER", "USER", "USERNAME"} {
+		if user := os.Getenv(name); user != "" {
+			return user + "@" + host
+		}
+	}
+	return host
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/freeze"
+	"github.com/ndious/delivr/internal/history"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/imagepoll"
+	"github.com/ndious/delivr/internal/logger"
+	"github.com/ndious/delivr/internal/notifier"
+	"github.com/ndious/delivr/internal/output"
+	"github.com/ndious/delivr/internal/preflight"
+	"github.com/ndious/delivr/internal/redact"
+	"github.com/ndious/delivr/internal/remote"
+	"github.com/ndious/delivr/internal/report"
+	"github.com/ndious/delivr/internal/secrets"
+	"github.com/ndious/delivr/internal/server"
+	"github.com/ndious/delivr/internal/tagging"
+	"github.com/ndious/delivr/internal/watch"
+	"github.com/ndious/delivr/internal/window"
+	"github.com/ndious/delivr/internal/workflow"
+)
+
+// setupOptions are the settings of the components that don't come from the
+// configuration, kept when it is reloaded
+type setupOptions struct {
+	logger   *logger.CommandLogger
+	history  *history.Store
+	failFast bool
+	simulate bool
+	// configRefresh is the interval between two fetches of a remote
+	// configuration, and reloadOnChange reloads the configuration when it
+	// changes instead of reporting the drift
+	configRefresh  time.Duration
+	reloadOnChange bool
+}
+
+// instance holds the components set up from a configuration, replaced as a
+// whole when the configuration is reloaded
+type instance struct {
+	cfg     *config.Config
+	notify  notifier.Multi
+	runner  *command.Runner
+	freezes *freeze.Calendar
+	reports []report.Schedule
+	watcher *watch.Watcher
+	poller  *imagepoll.Poller
+	tagger  *tagging.Tagger
+	ssh     *remote.Client
+}
+
+// configError is an invalid setting of the configuration found while setting
+// up the components
+type configError struct {
+	msg string
+	err error
+}
+
+func (e *configError) Error() string {
+	return fmt.Sprintf("%s: %v", e.msg, e.err)
+}
+
+func (e *configError) Unwrap() error {
+	return e.err
+}
+
+// newNotifiers creates the notifiers of the configuration, or those printing
+// the notifications in a simulation
+func newNotifiers(cfg *config.Config, simulate bool) (notifier.Multi, error) {
+	if simulate {
+		return notifier.NewConsole(cfg, os.Stdout)
+	}
+	return notifier.New(cfg)
+}
+
+// setup checks the configuration and creates the components running its
+// commands. An invalid setting is returned as a *configError.
+func setup(cfg *config.Config, notify notifier.Multi, opts setupOptions) (*instance, error) {
+	inst := &instance{cfg: cfg, notify: notify}
+
+	// Only keep the commands of this host when the configuration is shared
+	// between servers
+	host := notifier.HostFromConfig(cfg.Host)
+	if err := cfg.ValidateHosts(); err != nil {
+		return nil, &configError{"Failed to configure hosts", err}
+	}
+	if removed := cfg.ScopeToHost(host.Name); len(removed) > 0 {
+		log.Printf("Ignoring %d commands of other hosts than %s: %s", len(removed), host.Name, strings.Join(removed, ", "))
+	}
+
+	// Initialize Docker runner with the global working directory and docker host
+	cmdRunner := command.NewRunner(notify, opts.logger, cfg.WorkingDir, dockerHost(cfg))
+	cmdRunner.SetHost(host)
+	cmdRunner.SetQuota(cfg.Quota)
+	cmdRunner.SetInterpreter(cfg.Interpreter)
+	cmdRunner.SetFailurePolicy(cfg.FailurePolicy)
+	cmdRunner.SetANSI(cfg.ANSI)
+	cmdRunner.SetFailFast(opts.failFast)
+	if cfg.ShutdownGracePeriod > 0 {
+		cmdRunner.SetGracePeriod(cfg.ShutdownGracePeriod.Std())
+	}
+	if cfg.CaptureLimit > 0 {
+		cmdRunner.SetCaptureLimit(cfg.CaptureLimit)
+	}
+	if opts.simulate {
+		cmdRunner.SetSimulation(cfg.Simulate)
+	}
+	cmdRunner.SetHistory(opts.history)
+	cmdRunner.SetConfigFile(cfg.Source(), cfg.Hash())
+	inst.runner = cmdRunner
+
+	// Customize the messages of the runs with the configured templates
+	var templatesCfg *config.TemplatesConfig
+	if cfg.Notifications != nil {
+		templatesCfg = cfg.Notifications.Templates
+	}
+	templates, err := notifier.ParseTemplates(templatesCfg)
+	if err != nil {
+		return nil, &configError{"Failed to configure notification templates", err}
+	}
+	cmdRunner.SetTemplates(templates)
+
+	// Resolve secret:// references of commands from the configured providers
+	secretResolver, err := secrets.New(cfg.Secrets)
+	if err != nil {
+		return nil, &configError{"Failed to initialize secrets", err}
+	}
+	cmdRunner.SetSecrets(secretResolver)
+
+	// Mask sensitive values in the output of the commands
+	redactor, err := redact.New(cfg.Redaction)
+	if err != nil {
+		return nil, &configError{"Failed to initialize redaction", err}
+	}
+	if cfg.Redaction != nil {
+		for _, name := range cfg.Redaction.Secrets {
+			if _, ok := cfg.Secrets[name]; !ok {
+				return nil, &configError{"Failed to initialize redaction", fmt.Errorf("unknown secret '%s'", name)}
+			}
+		}
+		cmdRunner.SetRedaction(redactor, cfg.Redaction.Secrets)
+	}
+	if decrypted := cfg.DecryptedValues(); len(decrypted) > 0 {
+		var secretNames []string
+		if cfg.Redaction != nil {
+			secretNames = cfg.Redaction.Secrets
+		}
+		cmdRunner.SetRedaction(redactor.With(decrypted...), secretNames)
+	}
+
+	// Workflows are only started in daemon mode, but a mistake is reported at once
+	if err := workflow.Validate(cfg); err != nil {
+		return nil, &configError{"Failed to configure workflows", err}
+	}
+
+	// Check the allowed windows of the commands, enforced on triggered runs
+	for _, cmd := range cfg.Commands {
+		if _, err := window.Parse(cmd.AllowedWindows); err != nil {
+			return nil, &configError{fmt.Sprintf("Invalid allowed windows of '%s'", cmd.Name), err}
+		}
+		if err := window.ValidatePolicy(cmd.OutsideWindow); err != nil {
+			return nil, &configError{fmt.Sprintf("Invalid allowed windows of '%s'", cmd.Name), err}
+		}
+	}
+
+	// Protected commands only run during freeze periods when forced
+	inst.freezes, err = freeze.New(cfg.Freezes)
+	if err != nil {
+		return nil, &configError{"Failed to configure freeze periods", err}
+	}
+
+	// Reports are only posted in daemon mode, but a mistake is reported at once
+	inst.reports, err = report.Parse(cfg.Reports)
+	if err != nil {
+		return nil, &configError{"Failed to configure reports", err}
+	}
+
+	// Pipelines are run with "delivr run" and referenced by the triggers
+	checks := []struct {
+		msg   string
+		check func() error
+	}{
+		{"Failed to configure pipelines", cfg.ValidatePipelines},
+		{"Failed to configure failure policies", cfg.ValidateFailurePolicies},
+		{"Failed to configure retries", cfg.ValidateRetries},
+		{"Failed to configure superseded status messages", cfg.ValidateSupersede},
+		{"Failed to configure approvals", cfg.ValidateApprovals},
+		{"Failed to configure the Discord access list", cfg.ValidateDiscordACL},
+		{"Invalid paths in the configuration", cfg.ValidatePaths},
+		{"Failed to configure outputs", cfg.ValidateOutputs},
+		{"Failed to configure the success and failure patterns", cfg.ValidateOutputPatterns},
+		{"Failed to configure the standard input of the commands", cfg.ValidateStdin},
+		{"Failed to configure parameters", cfg.ValidateParams},
+		{"Failed to configure live output throttling", cfg.ValidateStreamThrottles},
+		{"Failed to configure the shutdown grace period", cfg.ValidateShutdownGracePeriod},
+		{"Failed to configure simulated outcomes", cfg.ValidateSimulate},
+		{"Failed to configure the startup dependencies", func() error { return preflight.ValidateWaitFor(cfg.WaitFor) }},
+		{"Failed to configure the output of the notifications", func() error { return output.Validate(cfg) }},
+	}
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			return nil, &configError{c.msg, err}
+		}
+	}
+
+	// Watched paths only trigger commands in daemon mode
+	inst.watcher, err = watch.New(cfg)
+	if err != nil {
+		return nil, &configError{"Failed to configure watch", err}
+	}
+
+	// Polled images only trigger commands in daemon mode
+	inst.poller, err = imagepoll.New(cfg, notify)
+	if err != nil {
+		return nil, &configError{"Failed to configure image polls", err}
+	}
+
+	// Tag the repository after the successful deployments
+	inst.tagger, err = tagging.New(cfg, notify)
+	if err != nil {
+		return nil, &configError{"Failed to configure tagging", err}
+	}
+	if opts.simulate {
+		inst.tagger = nil
+	}
+
+	// Connect to the remote hosts of the commands over SSH, last so that the
+	// connection isn't left open when the configuration is invalid
+	if err := remote.Validate(cfg); err != nil {
+		return nil, &configError{"Failed to configure remote hosts", err}
+	}
+	if remote.Needed(cfg) && opts.simulate {
+		cmdRunner.SetHostGroups(cfg.HostGroups)
+	} else if remote.Needed(cfg) {
+		inst.ssh, err = remote.New(cfg.SSH)
+		if err != nil {
+			return nil, &configError{"Failed to configure SSH", err}
+		}
+		cmdRunner.SetRemote(inst.ssh)
+		cmdRunner.SetHostGroups(cfg.HostGroups)
+	}
+
+	if err := inst.freezes.Refresh(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	return inst, nil
+}
+
+// close releases the connections of the instance
+func (inst *instance) close() {
+	if inst.ssh != nil {
+		inst.ssh.Close()
+	}
+}
+
+// dockerHost returns the Docker host of the configuration, the default one
+// when empty
+func dockerHost(cfg *config.Config) string {
+	if cfg.Docker != nil {
+		return cfg.Docker.Host
+	}
+	return ""
+}
+
+// runnerSet are the runners of the successive configurations, which receive
+// the termination signals since the jobs started before a reload may still
+// be running
+type runnerSet struct {
+	mu      sync.Mutex
+	runners []*command.Runner
+}
+
+// add adds the runner of a new configuration
+func (s *runnerSet) add(runner *command.Runner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runners = append(s.runners, runner)
+}
+
+// signal forwards a signal to the commands of all the runners
+func (s *runnerSet) signal(sig os.Signal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, runner := range s.runners {
+		runner.Signal(sig)
+	}
+}
+
+// interrupted returns the commands of all the runners cancelled because
+// delivr is stopping
+func (s *runnerSet) interrupted() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for _, runner := range s.runners {
+		names = append(names, runner.Interrupted()...)
+	}
+	return names
+}
+
+// daemon runs the triggers of the commands in daemon mode. The queue and the
+// workflows outlive the reloads of the configuration, while the triggers are
+// stopped and started again with the new one.
+type daemon struct {
+	opts      setupOptions
+	queue     *command.Queue
+	workflows *workflow.Manager
+	srv       *server.Server
+	// stop stops the triggers started from the current configuration, and
+	// triggers tracks those submitting jobs from their own goroutines, so
+	// that none submits once the queue is stopped
+	stop     chan struct{}
+	triggers sync.WaitGroup
+	// reload receives the requests to reload the configuration when it
+	// changed
+	reload chan struct{}
+}
+
+// newDaemon creates a daemon running the jobs with the runner of inst
+func newDaemon(inst *instance, opts setupOptions) *daemon {
+	queue := command.NewQueue(inst.runner, 16)
+	queue.SetFreezes(inst.freezes)
+	queue.Start()
+	return &daemon{opts: opts, queue: queue, reload: make(chan struct{}, 1)}
+}
+
+// start starts the triggers of a configuration: the HTTP server, the drift
+// detection, the reports, the file watches and the image polls
+func (d *daemon) start(inst *instance) error {
+	cfg, notify := inst.cfg, inst.notify
+	d.srv = nil
+	d.stop = make(chan struct{})
+	d.queue.SetApprover(nil, 0)
+	if cfg.Server != nil {
+		srv, err := server.New(cfg, d.queue, d.opts.history, notify)
+		if err != nil {
+			return &configError{"Failed to configure HTTP server", err}
+		}
+		if d.workflows == nil {
+			d.workflows, err = workflow.New(cfg, d.queue, notify)
+		} else {
+			err = d.workflows.Reconfigure(cfg, notify)
+		}
+		if err != nil {
+			return &configError{"Failed to configure workflows", err}
+		}
+		d.workflows.SetTagger(inst.tagger)
+		srv.SetWorkflows(d.workflows)
+		srv.SetTagger(inst.tagger)
+		feed := command.NewOutputFeed()
+		inst.runner.SetOutputFeed(feed)
+		srv.SetOutputFeed(feed)
+		if err := srv.Start(); err != nil {
+			return fmt.Errorf("failed to start HTTP server: %w", err)
+		}
+		d.srv = srv
+		// The jobs awaiting an approval keep the request of the server that
+		// posted it, the decision being received by any of them
+		if bot := cfg.Discord.Bot; bot != nil && bot.PublicKey != "" && !d.opts.simulate {
+			d.queue.SetApprover(srv, bot.ApprovalTimeout.Std())
+		}
+		if bot := cfg.Discord.Bot; bot != nil && bot.ApplicationID != "" && !d.opts.simulate {
+			if err := server.RegisterSlashCommand(bot.Token, bot.ApplicationID, cfg); err != nil {
+				log.Printf("Warning: Could not register the Discord slash command: %v", err)
+			}
+		}
+	}
+
+	// Warn when the configuration file is edited without reloading it
+	var reload chan<- struct{}
+	if d.opts.reloadOnChange {
+		reload = d.reload
+	}
+	go watchConfigDrift(config.NewDriftChecker(cfg), notify, reload, d.stop)
+	if source := cfg.Source(); config.IsRemote(source) && d.opts.configRefresh > 0 {
+		go refreshRemoteConfig(source, d.opts.configRefresh, notify, d.stop)
+	}
+
+	// Post the history reports when they are due
+	go report.Run(inst.reports, d.opts.history, notify, d.stop)
+	go inst.freezes.Watch(d.stop)
+
+	// Run the commands of the watched paths when they change
+	d.triggers.Add(1)
+	go func(stop <-chan struct{}) {
+		defer d.triggers.Done()
+		if err := inst.watcher.Run(d.queue, stop); err != nil {
+			log.Printf("Warning: File watcher stopped: %v", err)
+			if nerr := notify.SendMessage(i18n.T("⚠️ Watched paths no longer trigger commands: %v", err)); nerr != nil {
+				log.Printf("Warning: Could not send watch message: %v", nerr)
+			}
+		}
+	}(d.stop)
+
+	// Run the commands of the polled images when their digest changes
+	d.triggers.Add(1)
+	go func(stop <-chan struct{}) {
+		defer d.triggers.Done()
+		inst.poller.Run(d.queue, stop)
+	}(d.stop)
+	return nil
+}
+
+// stopTriggers stops the triggers of the current configuration, letting the
+// requests, the image checks and the watch runs in progress complete
+func (d *daemon) stopTriggers() {
+	close(d.stop)
+	d.triggers.Wait()
+	if d.srv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := d.srv.Shutdown(ctx); err != nil {
+			log.Printf("Warning: HTTP server shutdown failed: %v", err)
+		}
+		cancel()
+	}
+}
+
+// reloadConfig loads the configuration again and sets up its components,
+// replacing those of current once they are all valid. The triggers are
+// restarted with the new configuration, and the queued jobs run with its
+// runner. An invalid configuration is notified and the current one is kept.
+func (d *daemon) reloadConfig(path string, current *instance, runners *runnerSet) *instance {
+	log.Printf("Reloading the configuration")
+	fail := func(err error) *instance {
+		log.Printf("Configuration reload failed, keeping the running configuration: %v", err)
+		msg := i18n.T("❌ Could not reload the configuration of `%s`, the running configuration is kept:\n```\n%v\n```", current.cfg.Source(), err)
+		if nerr := current.notify.SendMessage(msg); nerr != nil {
+			log.Printf("Warning: Could not send configuration reload message: %v", nerr)
+		}
+		return current
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		return fail(err)
+	}
+	notify, err := newNotifiers(cfg, d.opts.simulate)
+	if err != nil {
+		return fail(fmt.Errorf("failed to initialize notifiers: %w", err))
+	}
+	next, err := setup(cfg, notify, d.opts)
+	if err != nil {
+		return fail(err)
+	}
+
+	d.stopTriggers()
+	d.queue.Reconfigure(next.runner, next.freezes)
+	if err := d.start(next); err != nil {
+		// Go on with the previous configuration rather than without triggers
+		d.stopTriggers()
+		d.queue.Reconfigure(current.runner, current.freezes)
+		next.close()
+		if serr := d.start(current); serr != nil {
+			log.Printf("Warning: Could not restart the triggers: %v", serr)
+		}
+		return fail(err)
+	}
+	runners.add(next.runner)
+	config.SetLoaded(cfg)
+	// The language is switched once the configuration is running, the
+	// notifiers having checked it
+	if err := i18n.SetLanguage(cfg.Language); err != nil {
+		log.Printf("Warning: Could not set the language of the messages: %v", err)
+	}
+	if !d.opts.simulate {
+		selfCheck(next.runner, cfg.Commands, notify)
+	}
+
+	msg := i18n.T("🔄 Configuration reloaded")
+	if cfg.Version != "" {
+		msg += i18n.T(" (version %s)", cfg.Version)
+	}
+	log.Println(msg)
+	if err := notify.SendMessage(msg); err != nil {
+		log.Printf("Warning: Could not send configuration reload message: %v", err)
+	}
+	// The jobs started with the previous configuration may still use its
+	// connections, which are closed at exit. Its digests are sent now
+	// rather than kept waiting for their window.
+	current.notify.Close()
+	return next
+}
+
+// reportSetupError notifies an invalid configuration found at startup and
+// exits
+func reportSetupError(notify notifier.Multi, err error) {
+	var cfgErr *configError
+	if errors.As(err, &cfgErr) {
+		exitConfigError(notify, cfgErr.msg, cfgErr.err)
+	}
+	log.Fatalf("%v", err)
+}
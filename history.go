@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/history"
+	"github.com/ndious/delivr/internal/logger"
+)
+
+// showHistory prints the runs of the history selected by the flags, most
+// recent first, or the steps of the run given as argument
+func showHistory(args []string, configPath string) error {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", configPath, "Path to the configuration file")
+	command := flags.String("command", "", "Only the runs of this command")
+	status := flags.String("status", "", "Only the runs with this status, e.g. failure")
+	trigger := flags.String("trigger", "", "Only the runs of this trigger, e.g. http")
+	since := flags.String("since", "", "Only the runs started since, e.g. 24h or 2024-05-01")
+	limit := flags.Int("limit", 20, "Maximum number of runs listed, 0 for all")
+	asJSON := flags.Bool("json", false, "Print the runs as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: delivr history [flags] [run]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	query := history.Query{Command: *command, Status: *status, Trigger: *trigger, Limit: *limit}
+	if *since != "" {
+		t, err := history.ParseSince(*since, time.Now())
+		if err != nil {
+			return err
+		}
+		query.Since = t
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	dir, err := logger.LogDirectory(cfg.Logs)
+	if err != nil {
+		return err
+	}
+	store, err := history.Open(cfg.History, dir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if flags.NArg() == 1 {
+		run, ok, err := store.Find(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("unknown run '%s'", flags.Arg(0))
+		}
+		if *asJSON {
+			return printJSON(run)
+		}
+		printRun(run)
+		return nil
+	}
+
+	runs, err := store.Query(query)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(runs)
+	}
+	if len(runs) == 0 {
+		fmt.Println("No runs found")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tSTARTED\tDURATION\tSTATUS\tTRIGGER\tCOMMANDS")
+	for _, run := range runs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", run.ID, run.StartedAt.Local().Format("2006-01-02 15:04:05"),
+			run.Duration.Round(time.Millisecond), run.Status, valueOr(run.Trigger, "-"), strings.Join(stepNames(run), ", "))
+	}
+	return w.Flush()
+}
+
+// printRun prints a run and its steps
+func printRun(run history.Run) {
+	fmt.Printf("Run %s (%s)\n", run.ID, run.Source)
+	fmt.Printf("Started:  %s\n", run.StartedAt.Local().Format(time.RFC3339))
+	fmt.Printf("Ended:    %s\n", run.EndedAt().Local().Format(time.RFC3339))
+	fmt.Printf("Status:   %s\n", run.Status)
+	if run.Trigger != "" {
+		fmt.Printf("Trigger:  %s\n", run.Trigger)
+	}
+	if run.Host != "" {
+		fmt.Printf("Host:     %s\n", run.Host)
+	}
+	if run.ReplayOf != "" {
+		fmt.Printf("Replay of %s\n", run.ReplayOf)
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tSTATUS\tEXIT\tDURATION\tLOG")
+	for _, step := range run.Steps {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", step.Name, step.Status, step.ExitCode,
+			step.Duration.Round(time.Millisecond), valueOr(step.LogPath, "-"))
+	}
+	w.Flush()
+}
+
+// stepNames returns the names of the commands a run ran
+func stepNames(run history.Run) []string {
+	names := make([]string, 0, len(run.Steps))
+	for _, step := range run.Steps {
+		names = append(names, step.Name)
+	}
+	return names
+}
+
+// valueOr returns value, or fallback when it's empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// printJSON prints a value as indented JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
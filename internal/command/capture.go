@@ -0,0 +1,84 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/i18n"
+)
+
+// DefaultCaptureLimit is the output of each stream of a command kept in
+// memory when captureLimit isn't configured
+const DefaultCaptureLimit = config.Size(1 << 20)
+
+// capture keeps the head and the tail of an output stream in memory, half of
+// the limit each, so that commands writing gigabytes don't exhaust the
+// memory of delivr. The output in between is only written to the log.
+type capture struct {
+	head []byte
+	// tail is a ring buffer of the last bytes, next being the position of
+	// the oldest one once it is full
+	tail []byte
+	next int
+	// headLimit and tailLimit are the sizes of the head and of the tail
+	headLimit int
+	tailLimit int
+	// size is the size of the whole output
+	size int64
+}
+
+// newCapture returns a capture keeping up to limit bytes of the output
+func newCapture(limit config.Size) capture {
+	headLimit := int(limit / 2)
+	return capture{headLimit: headLimit, tailLimit: int(limit) - headLimit}
+}
+
+// Write keeps p in the head while it isn't full, then in the tail
+func (c *capture) Write(p []byte) (int, error) {
+	n := len(p)
+	c.size += int64(n)
+	if free := c.headLimit - len(c.head); free > 0 {
+		kept := min(free, len(p))
+		c.head = append(c.head, p[:kept]...)
+		p = p[kept:]
+	}
+	if c.tailLimit == 0 || len(p) == 0 {
+		return n, nil
+	}
+	// Only the end of large writes can be kept
+	if len(p) >= c.tailLimit {
+		c.tail = append(c.tail[:0], p[len(p)-c.tailLimit:]...)
+		c.next = 0
+		return n, nil
+	}
+	if free := c.tailLimit - len(c.tail); free > 0 {
+		kept := min(free, len(p))
+		c.tail = append(c.tail, p[:kept]...)
+		p = p[kept:]
+	}
+	for len(p) > 0 {
+		copied := copy(c.tail[c.next:], p)
+		c.next = (c.next + copied) % c.tailLimit
+		p = p[copied:]
+	}
+	return n, nil
+}
+
+// Len returns the size of the whole output, the dropped part included
+func (c *capture) Len() int64 {
+	return c.size
+}
+
+// String returns the output kept in memory. When some of it was dropped, a
+// note replaces it between the head and the tail.
+func (c *capture) String() string {
+	head, tail := string(c.head), string(c.tail[c.next:])+string(c.tail[:c.next])
+	omitted := c.size - int64(len(c.head)+len(c.tail))
+	if omitted == 0 {
+		return head + tail
+	}
+	// The cuts may split characters
+	return strings.ToValidUTF8(head, "") +
+		i18n.T("\n[… %d bytes omitted, see the log …]\n", omitted) +
+		strings.ToValidUTF8(tail, "")
+}
@@ -0,0 +1,87 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/metrics"
+	"github.com/ndious/delivr/internal/notifier"
+)
+
+// ErrSkipped is returned when a command doesn't run because its conditions
+// aren't met. It isn't a failure.
+var ErrSkipped = errors.New("command skipped")
+
+// conditionTimeout is the maximum execution time of a condition
+const conditionTimeout = time.Minute
+
+// checkConditions evaluates the onlyIf and skipIf conditions of a command and
+// returns why it's skipped, if it is. A condition that can't be evaluated,
+// e.g. that timed out, is returned as an error.
+func (r *Runner) checkConditions(cmd config.Command, logWriter io.Writer) (string, error) {
+	if r.Simulating() && (cmd.OnlyIf != "" || cmd.SkipIf != "") {
+		fmt.Fprintf(logWriter, "Conditions of %s not evaluated in a simulation\n", cmd.Name)
+		return "", nil
+	}
+	if cmd.OnlyIf != "" {
+		met, err := r.evaluate(cmd, "onlyIf condition", cmd.OnlyIf, logWriter)
+		if err != nil {
+			return "", err
+		}
+		if !met {
+			return i18n.T("onlyIf condition `%s` failed", cmd.OnlyIf), nil
+		}
+	}
+	if cmd.SkipIf != "" {
+		met, err := r.evaluate(cmd, "skipIf condition", cmd.SkipIf, logWriter)
+		if err != nil {
+			return "", err
+		}
+		if met {
+			return i18n.T("skipIf condition `%s` succeeded", cmd.SkipIf), nil
+		}
+	}
+	return "", nil
+}
+
+// evaluate runs a condition like a hook of the command and reports whether
+// it exited with 0
+func (r *Runner) evaluate(cmd config.Command, label, condition string, logWriter io.Writer) (bool, error) {
+	hook := config.Hook{Shell: condition, Timeout: config.Duration(conditionTimeout)}
+	err := r.runHook(cmd, hook, label, nil, logWriter)
+	if err == nil {
+		return true, nil
+	}
+	if exitCode(err) > 0 {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to evaluate the %s: %w", label, err)
+}
+
+// skip reports a command skipped because of its conditions
+func (r *Runner) skip(cmd config.Command, notify Notifier, reason, logPath string, duration time.Duration, logWriter io.Writer) (bool, error) {
+	fmt.Fprintf(logWriter, "Command %s skipped: %s\n", cmd.Name, reason)
+	log.Printf("Skipping command '%s': %s", cmd.Name, reason)
+
+	metrics.RecordSkip(cmd.Name)
+	res := notifier.Result{
+		Command:     cmd.Name,
+		Description: cmd.Description,
+		Status:      notifier.StatusSkipped,
+		Duration:    duration,
+		LogPath:     logPath,
+		WorkingDir:  r.commandDir(cmd),
+		Error:       reason,
+	}
+	notificationFailed := false
+	if err := notify.SendResult(res); err != nil {
+		log.Printf("Warning: Notification failure, could not send result message for '%s': %v", cmd.Name, err)
+		notificationFailed = true
+	}
+	return notificationFailed, fmt.Errorf("%w: %s", ErrSkipped, reason)
+}
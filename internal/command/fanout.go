@@ -0,0 +1,163 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/notifier"
+)
+
+// runRemotes runs a command on its remote hosts. A command with several
+// hosts runs on each of them, and the outcome on each host is returned.
+func (r *Runner) runRemotes(ctx context.Context, cmd config.Command, stdout, stderr io.Writer) ([]notifier.RemoteResult, error) {
+	hosts := cmd.RemoteHosts(r.hostGroups)
+	if len(hosts) == 1 {
+		cmd.Host = hosts[0]
+		return nil, r.runRemote(ctx, cmd, stdout, stderr)
+	}
+	return r.runFanOut(ctx, cmd, hosts, stdout, stderr)
+}
+
+// runFanOut runs a command on several hosts, one at a time unless the fan-out
+// is parallel. After a failure, the hosts that didn't start are skipped
+// unless the fan-out continues on errors. The output lines are prefixed with
+// the host they come from.
+func (r *Runner) runFanOut(ctx context.Context, cmd config.Command, hosts []string, stdout, stderr io.Writer) ([]notifier.RemoteResult, error) {
+	parallel := 1
+	continueOnError := false
+	if cmd.FanOut != nil {
+		if cmd.FanOut.Parallel > 0 {
+			parallel = cmd.FanOut.Parallel
+		}
+		continueOnError = cmd.FanOut.ContinueOnError
+	}
+
+	// The hosts running at once share the writers
+	var mu sync.Mutex
+	stdout, stderr = &lockedWriter{mu: &mu, w: stdout}, &lockedWriter{mu: &mu, w: stderr}
+
+	results := make([]notifier.RemoteResult, len(hosts))
+	errs := make([]error, len(hosts))
+	var failed bool
+	var failedMu sync.Mutex
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		slots <- struct{}{}
+		failedMu.Lock()
+		stop := failed && !continueOnError
+		failedMu.Unlock()
+		if stop || ctx.Err() != nil {
+			<-slots
+			reason := "not run after a failure"
+			if ctx.Err() != nil {
+				reason = "not run, the command was interrupted"
+			}
+			results[i] = notifier.RemoteResult{Host: host, Status: notifier.StatusSkipped, ExitCode: -1, Error: reason}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			prefix := "[" + host + "] "
+			out, errOut := &prefixWriter{prefix: prefix, w: stdout}, &prefixWriter{prefix: prefix, w: stderr}
+			hostCmd := cmd
+			hostCmd.Host = host
+			start := time.Now()
+			err := r.runRemote(ctx, hostCmd, out, errOut)
+			out.Flush()
+			errOut.Flush()
+
+			results[i] = notifier.RemoteResult{Host: host, Status: notifier.StatusSuccess, Duration: time.Since(start), ExitCode: exitCode(err)}
+			if err != nil {
+				results[i].Status = notifier.StatusFailure
+				if errors.Is(err, ErrSpawn) {
+					results[i].Status = notifier.StatusSpawnError
+				}
+				results[i].Error = err.Error()
+				errs[i] = err
+				failedMu.Lock()
+				failed = true
+				failedMu.Unlock()
+			}
+		}(i, host)
+	}
+	wg.Wait()
+
+	var failedHosts []string
+	var first error
+	for i, err := range errs {
+		if err != nil {
+			failedHosts = append(failedHosts, hosts[i])
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	if errors.Is(first, ErrSpawn) {
+		// An unreachable host doesn't mean the command couldn't be started
+		return results, fmt.Errorf("failed on %d of %d hosts (%s): %v", len(failedHosts), len(hosts), strings.Join(failedHosts, ", "), first)
+	}
+	if first != nil {
+		return results, fmt.Errorf("failed on %d of %d hosts (%s): %w", len(failedHosts), len(hosts), strings.Join(failedHosts, ", "), first)
+	}
+	return results, nil
+}
+
+// lockedWriter serializes the writes of concurrent runs
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// prefixWriter prefixes each complete line with the host it comes from, so
+// that the output of the hosts can be told apart
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	line   bytes.Buffer
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	for _, c := range b {
+		p.line.WriteByte(c)
+		if c == '\n' {
+			if err := p.writeLine(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(b), nil
+}
+
+// Flush writes the last line when it doesn't end with a newline
+func (p *prefixWriter) Flush() error {
+	if p.line.Len() == 0 {
+		return nil
+	}
+	p.line.WriteByte('\n')
+	return p.writeLine()
+}
+
+// writeLine writes the buffered line with its prefix, in a single write
+func (p *prefixWriter) writeLine() error {
+	_, err := p.w.Write(append([]byte(p.prefix), p.line.Bytes()...))
+	p.line.Reset()
+	return err
+}
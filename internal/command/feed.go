@@ -0,0 +1,83 @@
+package command
+
+import (
+	"sync"
+)
+
+// feedBuffer is the number of chunks buffered for each subscriber. The chunks
+// of a subscriber that doesn't keep up are dropped rather than slowing the
+// commands down.
+const feedBuffer = 256
+
+// OutputChunk is a piece of the output of a running command
+type OutputChunk struct {
+	// Job is the ID of the job the command runs for, empty for the commands
+	// run at startup
+	Job     string
+	Command string
+	Data    []byte
+}
+
+// OutputFeed publishes the output of the commands to its subscribers as it is
+// written. It is safe for concurrent use.
+type OutputFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan OutputChunk]struct{}
+}
+
+// NewOutputFeed creates a feed without subscribers
+func NewOutputFeed() *OutputFeed {
+	return &OutputFeed{subscribers: make(map[chan OutputChunk]struct{})}
+}
+
+// Subscribe returns the channel receiving the chunks written from now on,
+// and the function to call once done with it
+func (f *OutputFeed) Subscribe() (<-chan OutputChunk, func()) {
+	ch := make(chan OutputChunk, feedBuffer)
+	f.mu.Lock()
+	f.subscribers[ch] = struct{}{}
+	f.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			delete(f.subscribers, ch)
+			f.mu.Unlock()
+		})
+	}
+}
+
+// publish sends a chunk to the subscribers whose buffer isn't full
+func (f *OutputFeed) publish(chunk OutputChunk) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subscribers {
+		select {
+		case ch <- chunk:
+		default:
+		}
+	}
+}
+
+// writer returns a writer publishing the output of a command of a job
+func (f *OutputFeed) writer(job, command string) *feedWriter {
+	return &feedWriter{feed: f, job: job, command: command}
+}
+
+// feedWriter publishes what is written to it as chunks of a command output
+type feedWriter struct {
+	feed    *OutputFeed
+	job     string
+	command string
+}
+
+// Write publishes a copy of p, since the caller may reuse it
+func (w *feedWriter) Write(p []byte) (int, error) {
+	w.feed.publish(OutputChunk{
+		Job:     w.job,
+		Command: w.command,
+		Data:    append([]byte(nil), p...),
+	})
+	return len(p), nil
+}
@@ -0,0 +1,117 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/notifier"
+	"github.com/ndious/delivr/internal/redact"
+)
+
+// runPreHooks runs the pre hooks of a command in order, stopping at the
+// first failure
+func (r *Runner) runPreHooks(cmd config.Command, logWriter io.Writer) error {
+	for i, hook := range cmd.PreHooks {
+		label := fmt.Sprintf("Pre hook %d", i+1)
+		if err := r.runHook(cmd, hook, label, nil, logWriter); err != nil {
+			return fmt.Errorf("%s failed: %w", strings.ToLower(label), err)
+		}
+	}
+	return nil
+}
+
+// runPostHooks runs the post hooks of a command matching its status, and
+// returns their failures. They all run, even when one fails.
+func (r *Runner) runPostHooks(cmd config.Command, status notifier.Status, logWriter io.Writer) []error {
+	var errs []error
+	for i, hook := range cmd.PostHooks {
+		if !hookMatches(hook.On, status) {
+			continue
+		}
+		label := fmt.Sprintf("Post hook %d", i+1)
+		if err := r.runHook(cmd, hook, label, []string{"DELIVR_STATUS=" + string(status)}, logWriter); err != nil {
+			errs = append(errs, fmt.Errorf("%s failed: %w", strings.ToLower(label), err))
+		}
+	}
+	return errs
+}
+
+// hookMatches reports whether a post hook runs after a command with the
+// given status
+func hookMatches(on string, status notifier.Status) bool {
+	switch on {
+	case config.HookOnSuccess:
+		return status == notifier.StatusSuccess
+	case config.HookOnFailure:
+		return status != notifier.StatusSuccess
+	default:
+		return true
+	}
+}
+
+// runHook runs a hook of a command in the working directory, with the
+// environment and on the remote host of the command, logging its output to
+// logWriter. The hooks of the commands run on several hosts run locally.
+func (r *Runner) runHook(cmd config.Command, hook config.Hook, label string, env []string, logWriter io.Writer) error {
+	hookCmd := config.Command{
+		Name:        cmd.Name,
+		Type:        config.CommandTypeExec,
+		Command:     hook.Command,
+		Args:        hook.Args,
+		Shell:       hook.Shell,
+		Interpreter: cmd.Interpreter,
+		Dir:         cmd.Dir,
+		EnvVars:     append(append(append([]string{}, cmd.EnvVars...), "DELIVR_COMMAND="+cmd.Name), env...),
+	}
+
+	if hosts := cmd.RemoteHosts(r.hostGroups); len(hosts) == 1 {
+		hookCmd.Host = hosts[0]
+	}
+
+	ctx := r.ctx
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout.Std())
+		defer cancel()
+	}
+
+	program, args := r.commandLine(hookCmd)
+	fmt.Fprintf(logWriter, "\n--- %s: %s ---\n", label, strings.Join(append([]string{program}, args...), " "))
+	if r.Simulating() {
+		fmt.Fprintf(logWriter, "--- %s not run in a simulation ---\n", label)
+		return nil
+	}
+
+	// Mask sensitive values as in the output of the command
+	output := logWriter
+	var redacted *redact.Writer
+	if redactor := r.attemptRedactor(); !redactor.Empty() {
+		redacted = redact.NewWriter(logWriter, redactor)
+		output = redacted
+	}
+
+	resolved, err := r.resolveSecrets(hookCmd)
+	switch {
+	case err != nil:
+	case hookCmd.Host != "":
+		err = r.runRemote(ctx, resolved, output, output)
+	default:
+		err = r.runExec(ctx, resolved, output, output)
+	}
+	if redacted != nil {
+		redacted.Flush()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("%w after %s", ErrTimeout, hook.Timeout)
+	}
+
+	if err != nil {
+		fmt.Fprintf(logWriter, "--- %s failed: %v ---\n", label, err)
+		return err
+	}
+	fmt.Fprintf(logWriter, "--- %s completed successfully ---\n", label)
+	return nil
+}
@@ -0,0 +1,167 @@
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// outputFileEnv is the environment variable naming the file a command writes
+// its outputs to, as NAME=value lines
+const outputFileEnv = "DELIVR_OUTPUT"
+
+// outputRefPattern matches the {{ .outputs.NAME }} and
+// {{ .steps.STEP.outputs.NAME }} references to the outputs of the previous
+// steps of a pipeline
+var outputRefPattern = regexp.MustCompile(`\{\{\s*\.(?:steps\.([^.{}\s]+)\.)?outputs\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// stepOutputs are the outputs exported by the steps of a pipeline run
+type stepOutputs struct {
+	// latest holds each output of the last step exporting it
+	latest map[string]string
+	// steps holds the outputs of each step
+	steps map[string]map[string]string
+}
+
+// add records the outputs of a step
+func (o *stepOutputs) add(step string, outputs map[string]string) {
+	if len(outputs) == 0 {
+		return
+	}
+	if o.latest == nil {
+		o.latest = make(map[string]string)
+		o.steps = make(map[string]map[string]string)
+	}
+	for name, value := range outputs {
+		o.latest[name] = value
+	}
+	o.steps[step] = outputs
+}
+
+// substitute returns a copy of the command with the references to the
+// outputs of the previous steps replaced by their values. References to
+// outputs that weren't exported are an error.
+func (o *stepOutputs) substitute(cmd config.Command) (config.Command, error) {
+	undefined := make(map[string]bool)
+	cmd = cmd.Expand(func(s string) string {
+		if !strings.Contains(s, "{{") {
+			return s
+		}
+		return outputRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+			match := outputRefPattern.FindStringSubmatch(ref)
+			outputs, name := o.latest, ".outputs."+match[2]
+			if match[1] != "" {
+				outputs, name = o.steps[match[1]], ".steps."+match[1]+name
+			}
+			value, ok := outputs[match[2]]
+			if !ok {
+				undefined[name] = true
+			}
+			return value
+		})
+	})
+	if len(undefined) == 0 {
+		return cmd, nil
+	}
+	names := make([]string, 0, len(undefined))
+	for name := range undefined {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return cmd, fmt.Errorf("outputs not exported by the previous steps: %s", strings.Join(names, ", "))
+}
+
+// createOutputFile creates the empty file a local command writes its
+// outputs to, and adds its path to the environment of the command
+func createOutputFile(cmd *config.Command) (string, error) {
+	file, err := os.CreateTemp("", "delivr-output-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create the output file: %w", err)
+	}
+	file.Close()
+	cmd.EnvVars = append(append([]string{}, cmd.EnvVars...), outputFileEnv+"="+file.Name())
+	return file.Name(), nil
+}
+
+// readOutputFile reads the NAME=value lines of an output file, skipping
+// blank lines and # comments, and removes it. Invalid lines are reported to
+// logWriter.
+func readOutputFile(path string, logWriter io.Writer) map[string]string {
+	defer os.Remove(path)
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(logWriter, "Warning: Could not read the outputs: %v\n", err)
+		return nil
+	}
+	defer file.Close()
+
+	outputs := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !config.ValidOutputName(name) {
+			fmt.Fprintf(logWriter, "Warning: Ignoring invalid output line %q, must be NAME=value\n", line)
+			continue
+		}
+		outputs[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(logWriter, "Warning: Could not read the outputs: %v\n", err)
+	}
+	return outputs
+}
+
+// matchOutputs adds the outputs of a command matched in its output to
+// outputs: the first group of the last match of each regular expression.
+// The expressions that don't match are reported to logWriter.
+func matchOutputs(cmd config.Command, output string, outputs map[string]string, logWriter io.Writer) map[string]string {
+	if len(cmd.Outputs) == 0 {
+		return outputs
+	}
+	if outputs == nil {
+		outputs = make(map[string]string)
+	}
+	for name, pattern := range cmd.Outputs {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			fmt.Fprintf(logWriter, "Warning: Invalid regular expression of output %s: %v\n", name, err)
+			continue
+		}
+		matches := re.FindAllStringSubmatch(output, -1)
+		if len(matches) == 0 || len(matches[len(matches)-1]) < 2 {
+			fmt.Fprintf(logWriter, "Warning: Output %s not found in the output of the command\n", name)
+			continue
+		}
+		outputs[name] = matches[len(matches)-1][1]
+	}
+	return outputs
+}
+
+// logOutputs writes the outputs of a command to its log, sorted by name
+func logOutputs(outputs map[string]string, logWriter io.Writer) {
+	if len(outputs) == 0 {
+		return
+	}
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var report strings.Builder
+	report.WriteString("Outputs:\n")
+	for _, name := range names {
+		fmt.Fprintf(&report, "  %s=%s\n", name, outputs[name])
+	}
+	io.WriteString(logWriter, report.String())
+}
@@ -0,0 +1,197 @@
+package command
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// ErrFailurePattern is returned when a command exited successfully but its
+// output matched its failure pattern
+var ErrFailurePattern = errors.New("the output matched the failure pattern")
+
+// maxPatternMatch is the length of the match kept in the error of a failure
+// pattern
+const maxPatternMatch = 200
+
+// maxPatternLine is the beginning of the long lines matched against the
+// patterns, the rest of the line being ignored
+const maxPatternLine = 64 << 10
+
+// patternError is the failure of a command whose output matched its failure
+// pattern. The command itself exited successfully.
+type patternError struct {
+	match string
+}
+
+func (e *patternError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrFailurePattern, e.match)
+}
+
+func (e *patternError) Unwrap() error {
+	return ErrFailurePattern
+}
+
+// ExitCode returns the exit code of the command
+func (e *patternError) ExitCode() int {
+	return 0
+}
+
+// classify applies the success and failure patterns of a command to the
+// output of an attempt: a successful attempt matching the failure pattern
+// fails, and a failed one matching the success pattern succeeds, unless it
+// matched the failure pattern too. Only the exit code is overridden: attempts
+// that timed out, exceeded their quota, couldn't start or were cancelled keep
+// their outcome. The patterns were matched line by line against stdout and
+// stderr as they were written, the lines dropped from the output kept in
+// memory included.
+func (r *Runner) classify(result *attempt, logWriter io.Writer) {
+	if result.patterns == nil || r.Simulating() {
+		return
+	}
+	result.patterns.flush()
+	var exitErr interface{ ExitCode() int }
+	switch {
+	case result.timedOut, result.quotaExceeded != "", r.Stopping():
+		return
+	case result.err != nil && !errors.As(result.err, &exitErr):
+		return
+	case errors.Is(result.err, ErrSpawn):
+		return
+	}
+
+	patterns := result.patterns
+	if patterns.failed {
+		if result.err == nil {
+			fmt.Fprintf(logWriter, "The output matched the failure pattern: %s\n", patterns.failureMatch)
+			result.err = &patternError{match: patterns.failureMatch}
+		}
+		return
+	}
+	if patterns.succeeded && result.err != nil {
+		fmt.Fprintf(logWriter, "The output matched the success pattern, ignoring the exit code %d\n", exitErr.ExitCode())
+		result.err = nil
+	}
+}
+
+// patternScanner matches the success and failure patterns of a command
+// against the lines of its output as they are written, so that a line in
+// the middle of a large output isn't missed
+type patternScanner struct {
+	failure *regexp.Regexp
+	success *regexp.Regexp
+	streams []*patternStream
+
+	mu sync.Mutex
+	// failed and succeeded are set once a line matched the failure or the
+	// success pattern, failureMatch being the first match of the former
+	failed       bool
+	succeeded    bool
+	failureMatch string
+}
+
+// newPatternScanner compiles the patterns of a command, and returns nil when
+// it has none
+func newPatternScanner(cmd config.Command, logWriter io.Writer) *patternScanner {
+	if cmd.SuccessPattern == "" && cmd.FailurePattern == "" {
+		return nil
+	}
+	return &patternScanner{
+		failure: compilePattern(cmd.FailurePattern, "failure", logWriter),
+		success: compilePattern(cmd.SuccessPattern, "success", logWriter),
+	}
+}
+
+// compilePattern compiles a pattern, nil when it is empty or invalid
+func compilePattern(pattern, kind string, logWriter io.Writer) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		fmt.Fprintf(logWriter, "Warning: Invalid regular expression of the %s pattern: %v\n", kind, err)
+		return nil
+	}
+	return re
+}
+
+// stream returns a writer matching the lines of an output stream
+func (s *patternScanner) stream() io.Writer {
+	w := &patternStream{scanner: s}
+	s.streams = append(s.streams, w)
+	return w
+}
+
+// match matches a line against the patterns it didn't match yet
+func (s *patternScanner) match(line []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failure != nil && !s.failed {
+		if loc := s.failure.FindIndex(line); loc != nil {
+			s.failed = true
+			s.failureMatch = shortenMatch(string(line[loc[0]:loc[1]]))
+		}
+	}
+	if s.success != nil && !s.succeeded && s.success.Match(line) {
+		s.succeeded = true
+	}
+}
+
+// flush matches the last lines of the streams, written without newline
+func (s *patternScanner) flush() {
+	for _, w := range s.streams {
+		if len(w.line) > 0 {
+			s.match(w.line)
+			w.line = nil
+		}
+	}
+}
+
+// shortenMatch trims a match and shortens it to the length kept in errors
+func shortenMatch(match string) string {
+	match = strings.TrimSpace(match)
+	if len(match) > maxPatternMatch {
+		i := maxPatternMatch
+		for i > 0 && !utf8.RuneStart(match[i]) {
+			i--
+		}
+		match = match[:i] + "..."
+	}
+	return match
+}
+
+// patternStream splits an output stream into the lines matched by a
+// patternScanner
+type patternStream struct {
+	scanner *patternScanner
+	// line is the beginning of the line being written
+	line []byte
+}
+
+// Write matches the lines completed by p, and keeps the beginning of the
+// last one
+func (w *patternStream) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		end := bytes.IndexByte(p, '\n')
+		chunk := p
+		if end >= 0 {
+			chunk = p[:end]
+		}
+		w.line = append(w.line, chunk[:min(len(chunk), maxPatternLine-len(w.line))]...)
+		if end < 0 {
+			break
+		}
+		w.scanner.match(w.line)
+		w.line = w.line[:0]
+		p = p[end+1:]
+	}
+	return n, nil
+}
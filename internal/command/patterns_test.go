@@ -0,0 +1,172 @@
+package command
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/notifier"
+)
+
+// TestPatterns checks the outcome of the commands with success and failure
+// patterns
+func TestPatterns(t *testing.T) {
+	// filler writes lines of 100 bytes, far more than the capture limit
+	filler := `i=0; while [ $i -lt 200 ]; do printf '%099d\n' $i; i=$((i+1)); done`
+	tests := []struct {
+		name    string
+		shell   string
+		success string
+		failure string
+		status  notifier.Status
+		// patternErr is whether the command failed on its failure pattern
+		patternErr bool
+	}{
+		{
+			name:    "no match",
+			shell:   "echo done",
+			failure: "FATAL",
+			status:  notifier.StatusSuccess,
+		},
+		{
+			name:       "failure match",
+			shell:      "echo 'FATAL: disk full'",
+			failure:    "FATAL: .*",
+			status:     notifier.StatusFailure,
+			patternErr: true,
+		},
+		{
+			name:       "failure match beyond the capture limit",
+			shell:      filler + "; echo 'FATAL: disk full'; " + filler,
+			failure:    "FATAL: .*",
+			status:     notifier.StatusFailure,
+			patternErr: true,
+		},
+		{
+			name:       "failure match on stderr",
+			shell:      "echo 'FATAL: disk full' >&2",
+			failure:    "FATAL",
+			status:     notifier.StatusFailure,
+			patternErr: true,
+		},
+		{
+			name:       "last line without newline",
+			shell:      "printf 'building\\nBUILD FAILED'",
+			failure:    "^BUILD FAILED$",
+			status:     notifier.StatusFailure,
+			patternErr: true,
+		},
+		{
+			name:    "success overriding the exit code",
+			shell:   "echo 'tests passed with warnings'; exit 3",
+			success: "tests passed",
+			status:  notifier.StatusSuccess,
+		},
+		{
+			name:    "success not matching",
+			shell:   "echo 'tests failed'; exit 3",
+			success: "tests passed",
+			status:  notifier.StatusFailure,
+		},
+		{
+			name:       "both matching",
+			shell:      "echo 'tests passed'; echo 'FATAL: leak detected'",
+			success:    "tests passed",
+			failure:    "FATAL",
+			status:     notifier.StatusFailure,
+			patternErr: true,
+		},
+		{
+			name:    "both matching with an exit code",
+			shell:   "echo 'tests passed'; echo 'FATAL: leak detected'; exit 3",
+			success: "tests passed",
+			failure: "FATAL",
+			status:  notifier.StatusFailure,
+		},
+		{
+			name:    "patterns matching across lines",
+			shell:   "echo 'BUILD'; echo 'FAILED'",
+			failure: "BUILD\\s+FAILED",
+			status:  notifier.StatusSuccess,
+		},
+		{
+			name:    "invalid pattern",
+			shell:   "echo 'FATAL'",
+			failure: "FATAL(",
+			status:  notifier.StatusSuccess,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newLoggedRunner(t, &bufferLogger{})
+			r.SetCaptureLimit(1024)
+			result, err := r.Execute(config.Command{
+				Name:           "check",
+				Shell:          tt.shell,
+				SuccessPattern: tt.success,
+				FailurePattern: tt.failure,
+			})
+			if result.Status != tt.status {
+				t.Errorf("status %s, want %s (%v)", result.Status, tt.status, err)
+			}
+			if got := errors.Is(err, ErrFailurePattern); got != tt.patternErr {
+				t.Errorf("Execute returned %v, failure pattern error: %v, want %v", err, got, tt.patternErr)
+			}
+			// The command itself exited successfully
+			if tt.patternErr && result.ExitCode != 0 {
+				t.Errorf("exit code %d, want 0 for a failure pattern", result.ExitCode)
+			}
+		})
+	}
+}
+
+// TestPatternScannerLines checks the lines split from the writes of the
+// output, whatever their sizes
+func TestPatternScannerLines(t *testing.T) {
+	long := strings.Repeat("a", maxPatternLine)
+	tests := []struct {
+		name   string
+		writes []string
+		failed bool
+		match  string
+	}{
+		{"line split across writes", []string{"compil", "ation ERR", "OR: missing\nok\n"}, true, "ERROR: missing"},
+		{"last line without newline", []string{"ok\n", "ERROR: late"}, true, "ERROR: late"},
+		{"beginning of a long line", []string{"ERROR: first\n" + long + "\n"}, true, "ERROR: first"},
+		{"start of a line longer than the limit", []string{"ERROR " + long, long + "\n"}, true, "ERROR"},
+		{"end of a line longer than the limit", []string{long, "ERROR\n"}, false, ""},
+		{"line after a long one", []string{long + long + "\nERROR\n"}, true, "ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := newPatternScanner(config.Command{FailurePattern: "ERROR(: \\w+)?"}, io.Discard)
+			stream := scanner.stream()
+			for _, w := range tt.writes {
+				if n, err := stream.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write returned %d, %v, want %d", n, err, len(w))
+				}
+			}
+			scanner.flush()
+			if scanner.failed != tt.failed || scanner.failureMatch != tt.match {
+				t.Errorf("failed %v on %q, want %v on %q", scanner.failed, scanner.failureMatch, tt.failed, tt.match)
+			}
+		})
+	}
+}
+
+// TestPatternScannerShortensMatch checks that the long matches are cut
+// between characters
+func TestPatternScannerShortensMatch(t *testing.T) {
+	scanner := newPatternScanner(config.Command{FailurePattern: "FATAL.*"}, io.Discard)
+	scanner.stream().Write([]byte("FATAL " + strings.Repeat("é", maxPatternMatch) + "\n"))
+	match := scanner.failureMatch
+	if !strings.HasSuffix(match, "...") || len(match) > maxPatternMatch+len("...") {
+		t.Errorf("match of %d bytes not shortened: %q", len(match), match)
+	}
+	if !strings.HasPrefix(match, "FATAL ") || !utf8.ValidString(match) {
+		t.Errorf("match cut within a character: %q", match)
+	}
+}
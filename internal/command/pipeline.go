@@ -0,0 +1,371 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/history"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/notifier"
+)
+
+// maxSummaryDescription is the size of the command lines of the summary,
+// within the limit of the Discord embed descriptions
+const maxSummaryDescription = 4000
+
+// trendRuns is the number of previous runs a step duration is compared to
+const trendRuns = 5
+
+// Stage identifies the release and environment of a workflow a pipeline
+// runs for
+type Stage struct {
+	Release     string
+	Environment string
+}
+
+// RunPipeline runs a sequence of commands with the values of their
+// parameters, reporting failures and a per-step duration breakdown, and
+// records the run in the history. When stopOnError is set, the remaining
+// commands are skipped after a failure unless the failure policy of the
+// command or of the configuration says otherwise.
+func (r *Runner) RunPipeline(source string, commands []config.Command, params map[string]string, stopOnError bool) []history.Step {
+	return r.runPipeline(Job{Source: source, Trigger: "startup", Commands: commands, Params: params}, commands, stopOnError)
+}
+
+// runPipeline runs the commands of a job, recording its input and workflow
+// stage in the history
+func (r *Runner) runPipeline(job Job, commands []config.Command, stopOnError bool) []history.Step {
+	source := job.Source
+	startedAt := time.Now()
+	steps := make([]history.Step, 0, len(commands))
+	status := notifier.StatusSuccess
+	stopped := false
+	// The outputs of the steps are substituted in the next ones
+	var outputs stepOutputs
+
+	r.setJob(job.ID)
+	defer r.setJob("")
+
+	for i, cmd := range commands {
+		if r.Stopping() {
+			log.Printf("Delivr is stopping, skipping %d remaining commands from %s", len(commands)-i, source)
+			status = notifier.StatusFailure
+			break
+		}
+
+		stepStart := time.Now()
+		cmd, err := outputs.substitute(cmd.WithParams(job.Params))
+		var run execution
+		if err == nil {
+			run, err = r.execute(cmd)
+		}
+		outputs.add(cmd.Name, run.outputs)
+		step := history.Step{
+			Name:               cmd.Name,
+			Status:             string(notifier.StatusSuccess),
+			Duration:           time.Since(stepStart),
+			Budget:             cmd.Budget.Std(),
+			Environment:        r.snapshot(cmd),
+			NotificationFailed: run.failed,
+			Messages:           run.messages,
+			Outputs:            run.outputs,
+			ExitCode:           run.ExitCode,
+			LogPath:            run.LogPath,
+			Attempts:           run.Attempts,
+			StdoutSize:         run.StdoutSize,
+			StderrSize:         run.StderrSize,
+		}
+		if errors.Is(err, ErrSkipped) {
+			step.Status = string(notifier.StatusSkipped)
+			err = nil
+		}
+		if err != nil {
+			// The run has its status, unless the outputs of the previous
+			// steps couldn't be substituted in the command
+			step.Status = string(notifier.StatusFailure)
+			if run.Status != "" {
+				step.Status = string(run.Status)
+			}
+			policy := r.commandFailurePolicy(cmd, stopOnError)
+			step.Tolerated = policy == config.FailureContinue
+			if !step.Tolerated {
+				status = notifier.StatusFailure
+			}
+			if policy == config.FailureStop {
+				stopped = true
+			}
+
+			log.Printf("Error executing command '%s': %v", cmd.Name, err)
+			if err := r.notifier.SendMessage(i18n.T("❌ Error executing command '%s' (triggered by %s): %v", cmd.Name, source, err)); err != nil {
+				log.Printf("Failed to send error message: %v", err)
+			}
+		}
+		r.supersede(cmd, step)
+		steps = append(steps, step)
+
+		if stopped {
+			break
+		}
+	}
+
+	if len(steps) > 1 || overBudget(steps) {
+		if err := r.notifier.SendMessage(r.formatBreakdown(steps, time.Since(startedAt))); err != nil {
+			log.Printf("Failed to send duration breakdown: %v", err)
+		}
+	}
+	// A single command is already summed up by its result
+	if len(commands) > 1 {
+		if err := r.sendSummary(source, commands, steps, time.Since(startedAt)); err != nil {
+			log.Printf("Failed to send pipeline summary: %v", err)
+		}
+	}
+
+	if r.history != nil {
+		run := history.Run{
+			ID:          history.NewID(startedAt),
+			Source:      source,
+			StartedAt:   startedAt,
+			Duration:    time.Since(startedAt),
+			Status:      string(status),
+			Steps:       steps,
+			ConfigFile:  r.configFile,
+			ConfigHash:  r.configHash,
+			Host:        r.host.Name,
+			Release:     job.Stage.Release,
+			Environment: job.Stage.Environment,
+			Trigger:     job.Trigger,
+			EnvVars:     job.EnvVars,
+			Params:      job.Params,
+			ReplayOf:    job.ReplayOf,
+		}
+		for _, cmd := range job.Commands {
+			run.Commands = append(run.Commands, cmd.Name)
+		}
+		if err := r.history.Append(run); err != nil {
+			log.Printf("Failed to record run in history: %v", err)
+		}
+	}
+
+	return steps
+}
+
+// commandFailurePolicy returns the failure policy of a command, defaulting
+// to stop or continue-but-mark depending on stopOnError. With fail fast,
+// only the tolerated failures don't stop.
+func (r *Runner) commandFailurePolicy(cmd config.Command, stopOnError bool) string {
+	policy := r.configuredFailurePolicy(cmd, stopOnError)
+	if r.failFast && policy == config.FailureContinueButMark {
+		return config.FailureStop
+	}
+	return policy
+}
+
+// configuredFailurePolicy returns the failure policy of a command without
+// fail fast
+func (r *Runner) configuredFailurePolicy(cmd config.Command, stopOnError bool) string {
+	switch {
+	case cmd.FailurePolicy != "":
+		return cmd.FailurePolicy
+	case r.failurePolicy != "":
+		return r.failurePolicy
+	case stopOnError:
+		return config.FailureStop
+	default:
+		return config.FailureContinueButMark
+	}
+}
+
+// sendSummary sends the summary of a pipeline, rendered with the summary
+// template if any
+func (r *Runner) sendSummary(source string, commands []config.Command, steps []history.Step, total time.Duration) error {
+	msg, err := r.templates.Summary(summaryData(source, commands, steps, total, r.host))
+	if err != nil {
+		log.Printf("Warning: %v, sending the default pipeline summary", err)
+	}
+	if msg != "" {
+		return r.notifier.SendMessage(msg)
+	}
+	return r.sendEmbed(summaryEmbed(source, commands, steps, total))
+}
+
+// summaryData returns the data of the summary template of a pipeline
+func summaryData(source string, commands []config.Command, steps []history.Step, total time.Duration, host notifier.Host) notifier.SummaryData {
+	data := notifier.SummaryData{
+		Source:   source,
+		Host:     host.Name,
+		Commands: len(commands),
+		NotRun:   len(commands) - len(steps),
+		Duration: total.Round(time.Millisecond),
+	}
+	for _, step := range steps {
+		switch {
+		case step.Status == string(notifier.StatusSuccess):
+			data.Succeeded++
+		case step.Status == string(notifier.StatusSkipped):
+			data.Skipped++
+		case step.Tolerated:
+			data.Tolerated++
+		default:
+			data.Failed++
+		}
+		data.Steps = append(data.Steps, notifier.SummaryStep{
+			Name:      step.Name,
+			Status:    notifier.Status(step.Status),
+			Duration:  step.Duration.Round(time.Millisecond),
+			Tolerated: step.Tolerated,
+			ExitCode:  step.ExitCode,
+			Attempts:  step.Attempts,
+		})
+	}
+	for _, cmd := range commands[len(steps):] {
+		data.Steps = append(data.Steps, notifier.SummaryStep{Name: cmd.Name})
+	}
+	return data
+}
+
+// summaryEmbed renders the outcome of the commands of a pipeline: the
+// counts, the total duration and a line per command, including those that
+// didn't run
+func summaryEmbed(source string, commands []config.Command, steps []history.Step, total time.Duration) notifier.Embed {
+	var succeeded, failed, tolerated, skipped int
+	var lines []string
+	for _, step := range steps {
+		line := i18n.T("%s **%s** %s in %.2fs", notifier.StatusIcon(notifier.Status(step.Status)), step.Name, notifier.Status(step.Status).Label(), step.Duration.Seconds())
+		switch {
+		case step.Status == string(notifier.StatusSuccess):
+			succeeded++
+		case step.Status == string(notifier.StatusSkipped):
+			skipped++
+		case step.Tolerated:
+			tolerated++
+			line += i18n.T(" (tolerated)")
+		default:
+			failed++
+		}
+		if step.ExitCode > 0 {
+			line += i18n.T(" (exit code %d)", step.ExitCode)
+		}
+		lines = append(lines, line)
+	}
+	notRun := commands[len(steps):]
+	for _, cmd := range notRun {
+		lines = append(lines, i18n.T("🚫 **%s** not run", cmd.Name))
+	}
+
+	embed := notifier.Embed{
+		Title: i18n.T("📋 Summary of %s", source),
+		Color: notifier.ColorSuccess,
+	}
+	switch {
+	case failed > 0:
+		embed.Color = notifier.ColorFailure
+	case tolerated > 0 || len(notRun) > 0:
+		embed.Color = notifier.ColorWarning
+	}
+
+	// Keep the lines within the size of the description
+	var description strings.Builder
+	for i, line := range lines {
+		if description.Len()+len(line) > maxSummaryDescription {
+			description.WriteString(i18n.T("… and %d more", len(lines)-i))
+			break
+		}
+		description.WriteString(line + "\n")
+	}
+	embed.Description = strings.TrimSuffix(description.String(), "\n")
+
+	embed.Fields = []notifier.EmbedField{
+		{Name: i18n.Text("Commands"), Value: fmt.Sprintf("%d", len(commands)), Inline: true},
+		{Name: i18n.Text("Succeeded"), Value: fmt.Sprintf("%d", succeeded), Inline: true},
+		{Name: i18n.Text("Failed"), Value: fmt.Sprintf("%d", failed+tolerated), Inline: true},
+		{Name: i18n.Text("Skipped"), Value: fmt.Sprintf("%d", skipped), Inline: true},
+		{Name: i18n.Text("Duration"), Value: i18n.T("%.2f seconds", total.Seconds()), Inline: true},
+	}
+	if len(notRun) > 0 {
+		embed.Fields = append(embed.Fields, notifier.EmbedField{Name: i18n.Text("Not run"), Value: fmt.Sprintf("%d", len(notRun)), Inline: true})
+	}
+	return embed
+}
+
+// sendEmbed sends an embed to the notifier, as a message when it doesn't
+// render embeds
+func (r *Runner) sendEmbed(embed notifier.Embed) error {
+	if sender, ok := r.notifier.(notifier.EmbedSender); ok {
+		return sender.SendEmbed(embed)
+	}
+	return r.notifier.SendMessage(notifier.FormatEmbed(embed))
+}
+
+// overBudget reports whether any step took longer than its budget
+func overBudget(steps []history.Step) bool {
+	for _, step := range steps {
+		if step.Budget > 0 && step.Duration > step.Budget {
+			return true
+		}
+	}
+	return false
+}
+
+// formatBreakdown renders the per-step durations as a table, comparing each
+// step with its average duration over the previous runs
+func (r *Runner) formatBreakdown(steps []history.Step, total time.Duration) string {
+	nameWidth := utf8.RuneCountInString(i18n.Text("Step"))
+	for _, step := range steps {
+		if n := utf8.RuneCountInString(step.Name); n > nameWidth {
+			nameWidth = n
+		}
+	}
+
+	var table strings.Builder
+	fmt.Fprintf(&table, "%-*s  %9s  %9s  %5s  %s\n", nameWidth, i18n.Text("Step"), i18n.Text("Duration"), i18n.Text("Budget"), i18n.Text("Share"), i18n.Text("Trend"))
+	for _, step := range steps {
+		budget := "-"
+		if step.Budget > 0 {
+			budget = step.Budget.String()
+			if step.Duration > step.Budget {
+				budget += "!"
+			}
+		}
+
+		share := 0.0
+		if total > 0 {
+			share = float64(step.Duration) / float64(total) * 100
+		}
+
+		fmt.Fprintf(&table, "%-*s  %8.2fs  %9s  %4.0f%%  %s\n",
+			nameWidth, step.Name, step.Duration.Seconds(), budget, share, r.trend(step))
+	}
+
+	msg := i18n.T("📊 Duration breakdown (total %.2f seconds)\n```\n%s```", total.Seconds(), table.String())
+	if overBudget(steps) {
+		msg += i18n.T("\n⚠️ Some steps exceeded their budget (marked with !)")
+	}
+	return msg
+}
+
+// trend compares a step duration with its average over the previous runs
+func (r *Runner) trend(step history.Step) string {
+	if r.history == nil || step.Status != string(notifier.StatusSuccess) {
+		return "-"
+	}
+	previous, err := r.history.StepDurations(step.Name, trendRuns)
+	if err != nil || len(previous) == 0 {
+		return "-"
+	}
+
+	var sum time.Duration
+	for _, d := range previous {
+		sum += d
+	}
+	average := sum / time.Duration(len(previous))
+	if average <= 0 {
+		return "-"
+	}
+	change := (float64(step.Duration) - float64(average)) / float64(average) * 100
+	return i18n.T("%+.0f%% vs avg of last %d", change, len(previous))
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package command
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup does nothing since process groups aren't supported on this platform
+func setProcessGroup(command *exec.Cmd) {}
+
+// signalGroup sends a signal to the process of a started command only
+func signalGroup(command *exec.Cmd, sig os.Signal) error {
+	return command.Process.Signal(sig)
+}
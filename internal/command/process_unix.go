@@ -0,0 +1,24 @@
+//go:build unix
+
+package command
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes the command start in its own process group, so that
+// signals can be sent to its children as well
+func setProcessGroup(command *exec.Cmd) {
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalGroup sends a signal to the process group of a started command
+func signalGroup(command *exec.Cmd, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return command.Process.Signal(sig)
+	}
+	return syscall.Kill(-command.Process.Pid, s)
+}
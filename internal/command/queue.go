@@ -0,0 +1,810 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/freeze"
+	"github.com/ndious/delivr/internal/history"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/metrics"
+	"github.com/ndious/delivr/internal/notifier"
+	"github.com/ndious/delivr/internal/window"
+)
+
+// ErrQueueFull is returned when a job is submitted while the queue is full
+var ErrQueueFull = errors.New("job queue is full")
+
+// ErrQueuePaused is returned when a job is submitted while the queue is paused
+var ErrQueuePaused = errors.New("job queue is paused")
+
+// ErrQueueStopping is returned when a job is submitted once the queue is
+// stopping
+var ErrQueueStopping = errors.New("job queue is stopping")
+
+// ErrInvalidParams is returned when a job doesn't supply the parameters its
+// commands declare
+var ErrInvalidParams = errors.New("invalid parameters")
+
+// ErrOutsideWindow is returned when a job is submitted outside of the allowed
+// windows of a command that rejects such jobs
+var ErrOutsideWindow = errors.New("outside of the allowed windows")
+
+// ErrFrozen is returned when a job with a protected command is submitted
+// during a freeze period without being forced
+var ErrFrozen = errors.New("protected command during a freeze period")
+
+// ErrApprovalUnavailable is returned when a job whose commands require an
+// approval is submitted while approvals can't be requested
+var ErrApprovalUnavailable = errors.New("approvals are not available")
+
+// ErrNotAwaitingApproval is returned when approving or rejecting a job that
+// isn't awaiting an approval
+var ErrNotAwaitingApproval = errors.New("job isn't awaiting approval")
+
+// recentJobs is the number of finished jobs kept for the status
+const recentJobs = 10
+
+// defaultApprovalTimeout is the time given to approve a job, when the
+// approver doesn't set one
+const defaultApprovalTimeout = 15 * time.Minute
+
+// Job is a list of commands submitted for execution by a trigger
+type Job struct {
+	// ID is assigned by the queue when the job is submitted
+	ID string
+	// Source describes what submitted the job (e.g. "image update of nginx")
+	Source string
+	// Trigger is the kind of trigger that submitted the job (e.g. "http")
+	Trigger string
+	// Commands are executed in order, stopping at the first failure
+	Commands []config.Command
+	// EnvVars are added to the environment of every command of the job
+	EnvVars []string
+	// Params are the values of the parameters declared by the commands
+	Params map[string]string
+	// Preflight holds the checks to run before the commands
+	Preflight *config.PreflightConfig
+	// Force runs the protected commands during a freeze period
+	Force bool
+	// Stage is the workflow stage the job runs, if any
+	Stage Stage
+	// ReplayOf is the ID of the recorded run the job replays, if any
+	ReplayOf string
+	// Done is called with the final state of the job once it ran or was
+	// aborted
+	Done func(state string)
+}
+
+// Job states, in addition to the final statuses of notifier.Status
+const (
+	JobQueued           = "queued"
+	JobWaiting          = "waiting"
+	JobAwaitingApproval = "awaitingApproval"
+	JobRunning          = "running"
+	JobAborted          = "aborted"
+	JobRejected         = "rejected"
+)
+
+// JobStatus describes a job for status reports
+type JobStatus struct {
+	ID          string    `json:"id"`
+	Source      string    `json:"source"`
+	Commands    []string  `json:"commands"`
+	State       string    `json:"state"`
+	SubmittedAt time.Time `json:"submittedAt"`
+	// RunAfter is the opening of the window a waiting job waits for
+	RunAfter *time.Time `json:"runAfter,omitempty"`
+	// ApprovalExpiresAt is when a job awaiting an approval is aborted
+	ApprovalExpiresAt *time.Time     `json:"approvalExpiresAt,omitempty"`
+	StartedAt         *time.Time     `json:"startedAt,omitempty"`
+	FinishedAt        *time.Time     `json:"finishedAt,omitempty"`
+	Steps             []history.Step `json:"steps,omitempty"`
+}
+
+// QueueStatus is a snapshot of the queue
+type QueueStatus struct {
+	Paused  bool        `json:"paused"`
+	Running *JobStatus  `json:"running"`
+	Queued  []JobStatus `json:"queued"`
+	Recent  []JobStatus `json:"recent"`
+}
+
+// Queue runs submitted jobs one at a time so that triggered runs never
+// overlap each other
+type Queue struct {
+	runner *Runner
+	jobs   chan Job
+	done   chan struct{}
+
+	mu       sync.Mutex
+	resumed  *sync.Cond
+	paused   bool
+	stopping bool
+	nextID   int
+	running  *JobStatus
+	queued   []*JobStatus
+	recent   []JobStatus
+	// waiting holds the timers of the jobs waiting for an allowed window
+	waiting map[string]*time.Timer
+	freezes *freeze.Calendar
+	// approvals holds the jobs awaiting an approval requested from approver
+	approvals       map[string]*pendingApproval
+	approver        Approver
+	approvalTimeout time.Duration
+}
+
+// Approver asks for the approval of the jobs whose commands require one, the
+// decision being given with Approve or Reject
+type Approver interface {
+	// RequestApproval asks for the approval of a job before it expires. The
+	// returned function is called with the outcome when the job stops
+	// awaiting the approval without a decision, e.g. once expired.
+	RequestApproval(job JobStatus, expires time.Time) (func(outcome string), error)
+}
+
+// pendingApproval is a job awaiting an approval
+type pendingApproval struct {
+	job    Job
+	status *JobStatus
+	timer  *time.Timer
+	// close reports the outcome to the approver, once requested
+	close func(outcome string)
+}
+
+// NewQueue creates a queue holding at most size pending jobs
+func NewQueue(runner *Runner, size int) *Queue {
+	q := &Queue{
+		runner:    runner,
+		jobs:      make(chan Job, size),
+		done:      make(chan struct{}),
+		waiting:   make(map[string]*time.Timer),
+		approvals: make(map[string]*pendingApproval),
+	}
+	q.resumed = sync.NewCond(&q.mu)
+	return q
+}
+
+// SetFreezes sets the freeze periods during which the jobs with protected
+// commands are rejected unless forced
+func (q *Queue) SetFreezes(calendar *freeze.Calendar) {
+	q.freezes = calendar
+}
+
+// SetApprover sets what requests the approvals of the jobs whose commands
+// require one, and the time given to approve them, 15 minutes when 0. The
+// jobs already awaiting an approval keep their request.
+func (q *Queue) SetApprover(approver Approver, timeout time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if timeout <= 0 {
+		timeout = defaultApprovalTimeout
+	}
+	q.approver = approver
+	q.approvalTimeout = timeout
+}
+
+// Reconfigure replaces the runner and the freeze periods of the jobs, once
+// the configuration was reloaded. The running job finishes with the previous
+// runner, and the queued ones run with the new one.
+func (q *Queue) Reconfigure(runner *Runner, calendar *freeze.Calendar) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.runner = runner
+	q.freezes = calendar
+}
+
+// current returns the runner and the freeze periods of the next jobs
+func (q *Queue) current() (*Runner, *freeze.Calendar) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.runner, q.freezes
+}
+
+// checkFreeze returns an error when the job has a protected command during a
+// freeze period and isn't forced, and the message to notify
+func (q *Queue) checkFreeze(job Job) (string, error) {
+	if q.freezes == nil {
+		return "", nil
+	}
+	name, period, frozen := q.freezes.Blocks(job.Commands, time.Now())
+	if !frozen {
+		return "", nil
+	}
+	if job.Force {
+		log.Printf("Job from %s forced during the freeze period (%s)", job.Source, period)
+		return i18n.T("⚠️ Job from %s forced for the protected command **%s** during the freeze period (%s)", job.Source, name, period), nil
+	}
+	err := fmt.Errorf("%w: '%s' is %s", ErrFrozen, name, period)
+	return i18n.T("🧊 Job from %s rejected: '%s' is protected and %s", job.Source, name, period), err
+}
+
+// Pause stops accepting jobs and holds the queued ones once the running job
+// completes, until Resume is called. It reports whether the queue was running.
+func (q *Queue) Pause() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.paused {
+		return false
+	}
+	q.paused = true
+	log.Printf("Job queue paused (%d queued jobs held)", len(q.queued))
+	return true
+}
+
+// Resume accepts jobs again and runs the held ones. It reports whether the
+// queue was paused.
+func (q *Queue) Resume() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.paused {
+		return false
+	}
+	q.paused = false
+	q.resumed.Broadcast()
+	log.Printf("Job queue resumed (%d queued jobs)", len(q.queued))
+	return true
+}
+
+// Stopping reports whether the queue stopped accepting jobs
+func (q *Queue) Stopping() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stopping
+}
+
+// waitResumed blocks while the queue is paused. It reports false when the
+// queue is stopped while paused, in which case held jobs are dropped.
+func (q *Queue) waitResumed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.paused && !q.stopping {
+		q.resumed.Wait()
+	}
+	return !q.paused
+}
+
+// Submit adds a job to the queue without waiting for it to run, and returns
+// the ID assigned to the job. Jobs submitted outside of the allowed windows
+// of their commands wait for the next window or are rejected.
+func (q *Queue) Submit(job Job) (string, error) {
+	q.mu.Lock()
+	id, msg, err := q.submit(job)
+	var request *JobStatus
+	approver := q.approver
+	if pending, ok := q.approvals[id]; ok && err == nil {
+		status := *pending.status
+		request = &status
+	}
+	q.mu.Unlock()
+
+	if msg != "" {
+		q.notify(msg)
+	}
+	if request != nil {
+		if err := q.requestApproval(approver, *request); err != nil {
+			return "", err
+		}
+	}
+	return id, err
+}
+
+// submit adds a job to the queue and returns the message to notify, if any.
+// The caller must hold q.mu.
+func (q *Queue) submit(job Job) (string, string, error) {
+	// The jobs channel is closed once stopping
+	if q.stopping {
+		return "", "", ErrQueueStopping
+	}
+	if q.paused {
+		return "", "", ErrQueuePaused
+	}
+
+	if err := config.CheckParams(job.Commands, job.Params); err != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidParams, err)
+		log.Printf("Rejected job from %s: %v", job.Source, err)
+		return "", "", err
+	}
+
+	freezeMsg, err := q.checkFreeze(job)
+	if err != nil {
+		log.Printf("Rejected job from %s: %v", job.Source, err)
+		return "", freezeMsg, err
+	}
+
+	now := time.Now()
+	opens, rejectedBy := jobWindow(job, now)
+	if rejectedBy != "" {
+		err := fmt.Errorf("%w of '%s', next window opens %s", ErrOutsideWindow, rejectedBy, opens.Format("Mon 2006-01-02 15:04"))
+		log.Printf("Rejected job from %s: %v", job.Source, err)
+		return "", i18n.T("⛔ Job from %s rejected: %v", job.Source, err), err
+	}
+
+	approval := requiresApproval(job)
+	if approval != "" && q.approver == nil {
+		err := fmt.Errorf("%w: '%s' requires an approval", ErrApprovalUnavailable, approval)
+		log.Printf("Rejected job from %s: %v", job.Source, err)
+		return "", "", err
+	}
+
+	q.nextID++
+	job.ID = fmt.Sprintf("%s-%d", time.Now().UTC().Format("20060102T150405"), q.nextID)
+
+	names := make([]string, 0, len(job.Commands))
+	for _, cmd := range job.Commands {
+		names = append(names, cmd.Name)
+	}
+	status := &JobStatus{
+		ID:          job.ID,
+		Source:      job.Source,
+		Commands:    names,
+		State:       JobQueued,
+		SubmittedAt: now,
+	}
+
+	if approval != "" {
+		expires := now.Add(q.approvalTimeout)
+		status.State = JobAwaitingApproval
+		status.ApprovalExpiresAt = &expires
+		q.queued = append(q.queued, status)
+		q.approvals[job.ID] = &pendingApproval{
+			job:    job,
+			status: status,
+			timer:  time.AfterFunc(q.approvalTimeout, func() { q.expire(job.ID) }),
+		}
+		metrics.RecordTrigger(job.Trigger)
+		log.Printf("Job %s from %s awaits approval for '%s' until %s", job.ID, job.Source, approval, expires.Format(time.RFC3339))
+		return job.ID, freezeMsg, nil
+	}
+
+	if opens.After(now) {
+		q.queued = append(q.queued, status)
+		q.wait(job, status, opens)
+		metrics.RecordTrigger(job.Trigger)
+		msg := i18n.T("🕒 Job from %s held until %s, outside of the allowed windows", job.Source, opens.Format("Mon 2006-01-02 15:04"))
+		return job.ID, strings.TrimSpace(freezeMsg + "\n" + msg), nil
+	}
+
+	select {
+	case q.jobs <- job:
+	default:
+		return "", "", ErrQueueFull
+	}
+	q.queued = append(q.queued, status)
+	metrics.RecordTrigger(job.Trigger)
+
+	log.Printf("Queued job %s from %s (%d commands)", job.ID, job.Source, len(job.Commands))
+	return job.ID, freezeMsg, nil
+}
+
+// requiresApproval returns the name of the first command of the job that
+// requires an approval, if any
+func requiresApproval(job Job) string {
+	for _, cmd := range job.Commands {
+		if cmd.RequireApproval {
+			return cmd.Name
+		}
+	}
+	return ""
+}
+
+// requestApproval asks the approver for the approval of a job just
+// submitted. The job is aborted when the request fails.
+func (q *Queue) requestApproval(approver Approver, status JobStatus) error {
+	closeRequest, err := approver.RequestApproval(status, *status.ApprovalExpiresAt)
+	if err != nil {
+		log.Printf("Job %s from %s aborted: could not request its approval: %v", status.ID, status.Source, err)
+		if pending, _ := q.take(status.ID, JobAborted); pending != nil && pending.job.Done != nil {
+			pending.job.Done(JobAborted)
+		}
+		return fmt.Errorf("%w: could not request the approval: %v", ErrApprovalUnavailable, err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if pending, ok := q.approvals[status.ID]; ok {
+		pending.close = closeRequest
+	}
+	return nil
+}
+
+// Approve queues a job awaiting an approval, approved by the given user. The
+// job still waits for the allowed windows of its commands.
+func (q *Queue) Approve(id, by string) error {
+	q.mu.Lock()
+	pending, ok := q.approvals[id]
+	if ok {
+		delete(q.approvals, id)
+		pending.timer.Stop()
+	}
+	q.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotAwaitingApproval, id)
+	}
+
+	// Announce the approval before the job starts
+	log.Printf("Job %s from %s approved by %s", id, pending.job.Source, by)
+	q.notify(i18n.T("✅ Job from %s approved by %s", pending.job.Source, by))
+
+	q.mu.Lock()
+	if q.stopping {
+		q.discard(pending.status, JobAborted)
+		q.mu.Unlock()
+		if pending.job.Done != nil {
+			pending.job.Done(JobAborted)
+		}
+		return nil
+	}
+	q.enqueue(pending.job, pending.status)
+	q.mu.Unlock()
+	return nil
+}
+
+// Reject aborts a job awaiting an approval, rejected by the given user
+func (q *Queue) Reject(id, by string) error {
+	pending, status := q.take(id, JobRejected)
+	if pending == nil {
+		return fmt.Errorf("%w: %s", ErrNotAwaitingApproval, id)
+	}
+	if pending.job.Done != nil {
+		defer pending.job.Done(JobRejected)
+	}
+
+	log.Printf("Job %s from %s rejected by %s", id, status.Source, by)
+	q.notify(i18n.T("🚫 Job from %s rejected by %s", status.Source, by))
+	return nil
+}
+
+// expire aborts a job whose approval wasn't given in time
+func (q *Queue) expire(id string) {
+	pending, status := q.take(id, JobAborted)
+	if pending == nil {
+		return
+	}
+	if pending.job.Done != nil {
+		defer pending.job.Done(JobAborted)
+	}
+
+	timeout := status.ApprovalExpiresAt.Sub(status.SubmittedAt).Round(time.Second)
+	log.Printf("Job %s from %s aborted: not approved within %s", id, status.Source, timeout)
+	if pending.close != nil {
+		pending.close(i18n.T("⌛ Not approved within %s", timeout))
+	}
+	q.notify(i18n.T("⌛ Job from %s aborted: not approved within %s", status.Source, timeout))
+}
+
+// take removes a job awaiting an approval from the queue, finished in the
+// given state, and returns it with its final status. It returns nil when the
+// job isn't awaiting an approval.
+func (q *Queue) take(id, state string) (*pendingApproval, JobStatus) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending, ok := q.approvals[id]
+	if !ok {
+		return nil, JobStatus{}
+	}
+	delete(q.approvals, id)
+	pending.timer.Stop()
+	q.discard(pending.status, state)
+	return pending, *pending.status
+}
+
+// enqueue sends a job to the worker, or has it wait for the next allowed
+// window of its commands. The caller must hold q.mu.
+func (q *Queue) enqueue(job Job, status *JobStatus) {
+	status.ApprovalExpiresAt = nil
+	now := time.Now()
+	if opens, _ := jobWindow(job, now); opens.After(now) {
+		q.wait(job, status, opens)
+		return
+	}
+	select {
+	case q.jobs <- job:
+		status.State = JobQueued
+		log.Printf("Queued job %s from %s (%d commands)", job.ID, job.Source, len(job.Commands))
+	default:
+		// Try again later rather than losing the job
+		q.wait(job, status, now.Add(time.Minute))
+	}
+}
+
+// discard removes a job that won't run from the queued ones, and records it
+// among the recent jobs in the given state. The caller must hold q.mu.
+func (q *Queue) discard(status *JobStatus, state string) {
+	for i, queued := range q.queued {
+		if queued == status {
+			q.queued = append(q.queued[:i], q.queued[i+1:]...)
+			break
+		}
+	}
+	now := time.Now()
+	status.State = state
+	status.FinishedAt = &now
+	q.recent = append([]JobStatus{*status}, q.recent...)
+	if len(q.recent) > recentJobs {
+		q.recent = q.recent[:recentJobs]
+	}
+}
+
+// notify sends a message about the queue to the notifiers
+func (q *Queue) notify(msg string) {
+	runner, _ := q.current()
+	if err := runner.notifier.SendMessage(msg); err != nil {
+		log.Printf("Warning: Could not send queue message: %v", err)
+	}
+}
+
+// jobWindow returns when the job may start: now when every command is in one
+// of its allowed windows, the next time they all are otherwise. rejectedBy
+// is the name of a command outside of its windows that rejects such jobs.
+func jobWindow(job Job, now time.Time) (opens time.Time, rejectedBy string) {
+	sets := make([]window.Set, 0, len(job.Commands))
+	for _, cmd := range job.Commands {
+		// The windows are validated when the configuration is loaded
+		set, _ := window.Parse(cmd.AllowedWindows)
+		sets = append(sets, set)
+		if cmd.OutsideWindow == window.PolicyReject && !set.Contains(now) && rejectedBy == "" {
+			rejectedBy = cmd.Name
+		}
+	}
+
+	// Move forward until the windows of all commands are open at once, in a
+	// bounded number of steps in case they never are
+	opens = now
+	for i := 0; i < 100; i++ {
+		next := opens
+		for _, set := range sets {
+			if t := set.Next(next); t.After(next) {
+				next = t
+			}
+		}
+		if next.Equal(opens) {
+			break
+		}
+		opens = next
+	}
+	return opens, rejectedBy
+}
+
+// wait holds a job until the given time. The caller must hold q.mu.
+func (q *Queue) wait(job Job, status *JobStatus, until time.Time) {
+	status.State = JobWaiting
+	status.RunAfter = &until
+	q.waiting[job.ID] = time.AfterFunc(time.Until(until), func() { q.release(job) })
+	log.Printf("Job %s from %s waits for the allowed window opening %s", job.ID, job.Source, until.Format(time.RFC3339))
+}
+
+// release queues a job whose window opened
+func (q *Queue) release(job Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stopping {
+		return
+	}
+	delete(q.waiting, job.ID)
+	for _, status := range q.queued {
+		if status.ID != job.ID {
+			continue
+		}
+		select {
+		case q.jobs <- job:
+			status.State = JobQueued
+			status.RunAfter = nil
+			log.Printf("Allowed window open, queued job %s from %s", job.ID, job.Source)
+		default:
+			// Try again later rather than losing the job
+			q.wait(job, status, time.Now().Add(time.Minute))
+		}
+		return
+	}
+}
+
+// Status returns a snapshot of the running, queued and recently finished jobs
+func (q *Queue) Status() QueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := QueueStatus{
+		Paused: q.paused,
+		Queued: make([]JobStatus, 0, len(q.queued)),
+		Recent: append([]JobStatus{}, q.recent...),
+	}
+	if q.running != nil {
+		running := *q.running
+		status.Running = &running
+	}
+	for _, job := range q.queued {
+		status.Queued = append(status.Queued, *job)
+	}
+	return status
+}
+
+// Start processes jobs in the background until Stop is called
+func (q *Queue) Start() {
+	go func() {
+		defer close(q.done)
+		for job := range q.jobs {
+			if !q.waitResumed() {
+				q.drop(job)
+				continue
+			}
+			if !q.inWindow(job) || !q.unfrozen(job) {
+				continue
+			}
+			q.run(job)
+		}
+	}()
+}
+
+// inWindow checks again the windows of a job about to run, since they may
+// have closed while it was queued. Outside of the windows, the job waits for
+// the next one or is aborted, and false is returned.
+func (q *Queue) inWindow(job Job) bool {
+	now := time.Now()
+	opens, rejectedBy := jobWindow(job, now)
+	if !opens.After(now) {
+		return true
+	}
+
+	if rejectedBy != "" {
+		log.Printf("Job %s from %s aborted: the allowed windows of '%s' closed", job.ID, job.Source, rejectedBy)
+		q.begin(job)
+		q.finish(job, JobAborted, nil)
+		q.notify(i18n.T("⛔ Job from %s aborted: the allowed windows of '%s' closed before it could run", job.Source, rejectedBy))
+		return false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, status := range q.queued {
+		if status.ID == job.ID {
+			q.wait(job, status, opens)
+		}
+	}
+	return false
+}
+
+// unfrozen checks again the freeze periods for a job about to run, since one
+// may have started while it was queued. A frozen job is aborted and false is
+// returned.
+func (q *Queue) unfrozen(job Job) bool {
+	_, freezes := q.current()
+	if freezes == nil || job.Force {
+		return true
+	}
+	name, period, frozen := freezes.Blocks(job.Commands, time.Now())
+	if !frozen {
+		return true
+	}
+	log.Printf("Job %s from %s aborted: '%s' is %s", job.ID, job.Source, name, period)
+	q.begin(job)
+	q.finish(job, JobAborted, nil)
+	q.notify(i18n.T("🧊 Job from %s aborted: '%s' is protected and %s", job.Source, name, period))
+	return false
+}
+
+// Stop stops accepting jobs and waits for the pending ones to complete. Jobs
+// held by a pause, waiting for a window or awaiting an approval are dropped.
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	q.stopping = true
+	q.resumed.Broadcast()
+	for id, timer := range q.waiting {
+		timer.Stop()
+		delete(q.waiting, id)
+	}
+	var closeRequests []func(string)
+	for id, pending := range q.approvals {
+		pending.timer.Stop()
+		if pending.close != nil {
+			closeRequests = append(closeRequests, pending.close)
+		}
+		delete(q.approvals, id)
+	}
+	for _, status := range append([]*JobStatus{}, q.queued...) {
+		switch status.State {
+		case JobWaiting:
+			log.Printf("Dropping job %s from %s waiting for its window", status.ID, status.Source)
+			q.discard(status, JobAborted)
+		case JobAwaitingApproval:
+			log.Printf("Dropping job %s from %s awaiting approval", status.ID, status.Source)
+			q.discard(status, JobAborted)
+		}
+	}
+	q.mu.Unlock()
+
+	for _, closeRequest := range closeRequests {
+		closeRequest(i18n.Text("🛑 Delivr stopped before the job was approved"))
+	}
+
+	close(q.jobs)
+	<-q.done
+}
+
+// drop removes a held job from the queue without running it
+func (q *Queue) drop(job Job) {
+	log.Printf("Dropping job %s from %s held by the pause", job.ID, job.Source)
+	q.begin(job)
+	q.finish(job, JobAborted, nil)
+}
+
+// begin moves a job from the queued list to the running slot
+func (q *Queue) begin(job Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, status := range q.queued {
+		if status.ID == job.ID {
+			now := time.Now()
+			status.State = JobRunning
+			status.StartedAt = &now
+			q.running = status
+			q.queued = append(q.queued[:i], q.queued[i+1:]...)
+			return
+		}
+	}
+}
+
+// finish records the outcome of the running job and calls its Done function
+func (q *Queue) finish(job Job, state string, steps []history.Step) {
+	if job.Done != nil {
+		defer job.Done(state)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.running == nil {
+		return
+	}
+	now := time.Now()
+	q.running.State = state
+	q.running.FinishedAt = &now
+	q.running.Steps = steps
+
+	q.recent = append([]JobStatus{*q.running}, q.recent...)
+	if len(q.recent) > recentJobs {
+		q.recent = q.recent[:recentJobs]
+	}
+	q.running = nil
+}
+
+// run executes the commands of a job and reports failures to the notifiers
+func (q *Queue) run(job Job) {
+	log.Printf("Running job %s from %s", job.ID, job.Source)
+	q.begin(job)
+	runner, _ := q.current()
+
+	release, err := runner.Preflight(job.Preflight)
+	defer release()
+	if err != nil {
+		log.Printf("Job %s from %s aborted: %v", job.ID, job.Source, err)
+		q.finish(job, JobAborted, nil)
+		return
+	}
+
+	commands := make([]config.Command, 0, len(job.Commands))
+	for _, cmd := range job.Commands {
+		cmd.EnvVars = append(append([]string{}, cmd.EnvVars...), job.EnvVars...)
+		commands = append(commands, cmd)
+	}
+	steps := runner.runPipeline(job, commands, true)
+
+	state := string(notifier.StatusSuccess)
+	for _, step := range steps {
+		if step.Failed() {
+			state = string(notifier.StatusFailure)
+		}
+	}
+	q.finish(job, state, steps)
+}
@@ -0,0 +1,508 @@
+package command
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/freeze"
+	"github.com/ndious/delivr/internal/notifier"
+	"github.com/ndious/delivr/internal/window"
+)
+
+// testNotifier records the messages and results sent by the tests
+type testNotifier struct {
+	mu       sync.Mutex
+	messages []string
+	results  []notifier.Result
+}
+
+func (n *testNotifier) SendMessage(content string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.messages = append(n.messages, content)
+	return nil
+}
+
+func (n *testNotifier) SendResult(result notifier.Result) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.results = append(n.results, result)
+	return nil
+}
+
+// discardLogger drops the run logs of the tests
+type discardLogger struct{}
+
+func (discardLogger) OpenRun(string) (io.WriteCloser, string) {
+	return nopCloser{io.Discard}, ""
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// newTestRunner returns a runner running the commands in a temporary
+// directory, and the notifier receiving its messages
+func newTestRunner(t *testing.T) (*Runner, *testNotifier) {
+	t.Helper()
+	notify := &testNotifier{}
+	return NewRunner(notify, discardLogger{}, t.TempDir(), ""), notify
+}
+
+// TestQueueSubmitAfterStop checks that a job submitted once the queue
+// stopped, here by the Done callback of the last job, is rejected rather
+// than sent on the closed channel
+func TestQueueSubmitAfterStop(t *testing.T) {
+	runner, _ := newTestRunner(t)
+	q := NewQueue(runner, 5)
+	q.Start()
+
+	cmd := config.Command{Name: "noop", Command: "true"}
+	released := make(chan struct{})
+	resubmitted := make(chan error, 1)
+	_, err := q.Submit(Job{
+		Source:   "test",
+		Commands: []config.Command{cmd},
+		Done: func(string) {
+			<-released
+			_, err := q.Submit(Job{Source: "test", Commands: []config.Command{cmd}})
+			resubmitted <- err
+		},
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		q.Stop()
+		close(stopped)
+	}()
+	// Let Stop mark the queue as stopping before the callback submits
+	for {
+		q.mu.Lock()
+		stopping := q.stopping
+		q.mu.Unlock()
+		if stopping {
+			break
+		}
+		runtime.Gosched()
+	}
+	close(released)
+	<-stopped
+
+	if err := <-resubmitted; !errors.Is(err, ErrQueueStopping) {
+		t.Errorf("Submit from the Done callback returned %v, want %v", err, ErrQueueStopping)
+	}
+	if _, err := q.Submit(Job{Source: "test", Commands: []config.Command{cmd}}); !errors.Is(err, ErrQueueStopping) {
+		t.Errorf("Submit after Stop returned %v, want %v", err, ErrQueueStopping)
+	}
+}
+
+// testApprover records the approval requests of the queue and the outcomes
+// it reports when the jobs stop awaiting them
+type testApprover struct {
+	mu       sync.Mutex
+	requests []JobStatus
+	outcomes []string
+	err      error
+}
+
+func (a *testApprover) RequestApproval(job JobStatus, _ time.Time) (func(string), error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return nil, a.err
+	}
+	a.requests = append(a.requests, job)
+	return func(outcome string) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.outcomes = append(a.outcomes, outcome)
+	}, nil
+}
+
+func (a *testApprover) closed() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string{}, a.outcomes...)
+}
+
+// doneRecorder records the final states passed to the Done callbacks
+type doneRecorder struct {
+	mu     sync.Mutex
+	states []string
+}
+
+func (d *doneRecorder) done(state string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.states = append(d.states, state)
+}
+
+func (d *doneRecorder) recorded() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string{}, d.states...)
+}
+
+// jobState returns the state of a job in the status of the queue, or "" when
+// the queue doesn't know it
+func jobState(q *Queue, id string) string {
+	status := q.Status()
+	for _, job := range append(status.Queued, status.Recent...) {
+		if job.ID == id {
+			return job.State
+		}
+	}
+	return ""
+}
+
+// TestQueueApprovals checks the decisions on the jobs awaiting an approval.
+// The queue isn't started, so the approved jobs stay queued.
+func TestQueueApprovals(t *testing.T) {
+	tests := []struct {
+		name string
+		// timeout is the time given to approve the job
+		timeout time.Duration
+		// decide acts on the submitted job, and returns the error of the
+		// decision
+		decide func(q *Queue, id string) error
+		err    error
+		// state is the state of the job once decided, and done the state
+		// passed to its Done callback, if called
+		state string
+		done  []string
+		// outcomes are the outcomes reported to the approver
+		outcomes int
+	}{
+		{
+			name:   "approved",
+			decide: func(q *Queue, id string) error { return q.Approve(id, "alice") },
+			state:  JobQueued,
+		},
+		{
+			name:   "rejected",
+			decide: func(q *Queue, id string) error { return q.Reject(id, "alice") },
+			state:  JobRejected,
+			done:   []string{JobRejected},
+		},
+		{
+			name:   "unknown job",
+			decide: func(q *Queue, id string) error { return q.Approve("unknown", "alice") },
+			err:    ErrNotAwaitingApproval,
+			state:  JobAwaitingApproval,
+		},
+		{
+			name: "approved twice",
+			decide: func(q *Queue, id string) error {
+				if err := q.Approve(id, "alice"); err != nil {
+					return err
+				}
+				return q.Approve(id, "bob")
+			},
+			err:   ErrNotAwaitingApproval,
+			state: JobQueued,
+		},
+		{
+			name: "rejected once approved",
+			decide: func(q *Queue, id string) error {
+				if err := q.Approve(id, "alice"); err != nil {
+					return err
+				}
+				return q.Reject(id, "bob")
+			},
+			err:   ErrNotAwaitingApproval,
+			state: JobQueued,
+		},
+		{
+			name:    "expired",
+			timeout: 20 * time.Millisecond,
+			decide: func(q *Queue, id string) error {
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			},
+			state:    JobAborted,
+			done:     []string{JobAborted},
+			outcomes: 1,
+		},
+		{
+			name:    "approved once expired",
+			timeout: 20 * time.Millisecond,
+			decide: func(q *Queue, id string) error {
+				time.Sleep(100 * time.Millisecond)
+				return q.Approve(id, "alice")
+			},
+			err:      ErrNotAwaitingApproval,
+			state:    JobAborted,
+			done:     []string{JobAborted},
+			outcomes: 1,
+		},
+		{
+			name: "approved while stopping",
+			decide: func(q *Queue, id string) error {
+				// Stop marks the queue as stopping before dropping the jobs
+				// awaiting an approval
+				q.mu.Lock()
+				q.stopping = true
+				q.mu.Unlock()
+				return q.Approve(id, "alice")
+			},
+			state: JobAborted,
+			done:  []string{JobAborted},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner, _ := newTestRunner(t)
+			q := NewQueue(runner, 5)
+			approver := &testApprover{}
+			q.SetApprover(approver, tt.timeout)
+			done := &doneRecorder{}
+
+			id, err := q.Submit(Job{
+				Source:   "test",
+				Commands: []config.Command{{Name: "deploy", Command: "true", RequireApproval: true}},
+				Done:     done.done,
+			})
+			if err != nil {
+				t.Fatalf("Submit: %v", err)
+			}
+			if state := jobState(q, id); state != JobAwaitingApproval {
+				t.Fatalf("submitted job is %s, want %s", state, JobAwaitingApproval)
+			}
+			if len(approver.requests) != 1 || approver.requests[0].ID != id {
+				t.Fatalf("approval requests %v, want one for %s", approver.requests, id)
+			}
+
+			err = tt.decide(q, id)
+			if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+				t.Errorf("decision returned %v, want %v", err, tt.err)
+			}
+			if state := jobState(q, id); state != tt.state {
+				t.Errorf("job is %s, want %s", state, tt.state)
+			}
+			if got := done.recorded(); !slices.Equal(got, tt.done) {
+				t.Errorf("Done called with %v, want %v", got, tt.done)
+			}
+			if got := approver.closed(); len(got) != tt.outcomes {
+				t.Errorf("outcomes %v reported to the approver, want %d", got, tt.outcomes)
+			}
+		})
+	}
+}
+
+// TestQueueApprovalUnavailable checks that the jobs requiring an approval
+// are rejected when it can't be requested
+func TestQueueApprovalUnavailable(t *testing.T) {
+	cmd := config.Command{Name: "deploy", Command: "true", RequireApproval: true}
+
+	runner, _ := newTestRunner(t)
+	q := NewQueue(runner, 5)
+	if _, err := q.Submit(Job{Source: "test", Commands: []config.Command{cmd}}); !errors.Is(err, ErrApprovalUnavailable) {
+		t.Errorf("Submit without approver returned %v, want %v", err, ErrApprovalUnavailable)
+	}
+
+	q.SetApprover(&testApprover{err: errors.New("no channel")}, 0)
+	done := &doneRecorder{}
+	if _, err := q.Submit(Job{Source: "test", Commands: []config.Command{cmd}, Done: done.done}); !errors.Is(err, ErrApprovalUnavailable) {
+		t.Errorf("Submit with a failing approver returned %v, want %v", err, ErrApprovalUnavailable)
+	}
+	if got := done.recorded(); !slices.Equal(got, []string{JobAborted}) {
+		t.Errorf("Done called with %v, want the job aborted", got)
+	}
+	if status := q.Status(); len(status.Queued) != 0 {
+		t.Errorf("%d jobs still queued", len(status.Queued))
+	}
+}
+
+// TestQueueStopDropsAwaitingApproval checks that stopping the queue aborts
+// the jobs awaiting an approval and closes their requests
+func TestQueueStopDropsAwaitingApproval(t *testing.T) {
+	runner, _ := newTestRunner(t)
+	q := NewQueue(runner, 5)
+	approver := &testApprover{}
+	q.SetApprover(approver, 0)
+	q.Start()
+
+	id, err := q.Submit(Job{
+		Source:   "test",
+		Commands: []config.Command{{Name: "deploy", Command: "true", RequireApproval: true}},
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	q.Stop()
+
+	if state := jobState(q, id); state != JobAborted {
+		t.Errorf("job is %s once stopped, want %s", state, JobAborted)
+	}
+	if got := approver.closed(); len(got) != 1 {
+		t.Errorf("outcomes %v reported to the approver, want 1", got)
+	}
+	if err := q.Approve(id, "alice"); !errors.Is(err, ErrNotAwaitingApproval) {
+		t.Errorf("Approve once stopped returned %v, want %v", err, ErrNotAwaitingApproval)
+	}
+}
+
+// TestQueuePause checks that a paused queue rejects the new jobs and holds
+// the queued ones until resumed
+func TestQueuePause(t *testing.T) {
+	runner, _ := newTestRunner(t)
+	q := NewQueue(runner, 5)
+	done := make(chan string, 2)
+	job := Job{
+		Source:   "test",
+		Commands: []config.Command{{Name: "noop", Command: "true"}},
+		Done:     func(state string) { done <- state },
+	}
+	if _, err := q.Submit(job); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	if !q.Pause() {
+		t.Errorf("Pause of a running queue returned false")
+	}
+	if q.Pause() {
+		t.Errorf("Pause of a paused queue returned true")
+	}
+	if !q.Status().Paused {
+		t.Errorf("the status of a paused queue isn't paused")
+	}
+	if _, err := q.Submit(job); !errors.Is(err, ErrQueuePaused) {
+		t.Errorf("Submit while paused returned %v, want %v", err, ErrQueuePaused)
+	}
+
+	q.Start()
+	select {
+	case state := <-done:
+		t.Fatalf("held job finished %s while paused", state)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if !q.Resume() {
+		t.Errorf("Resume of a paused queue returned false")
+	}
+	if q.Resume() {
+		t.Errorf("Resume of a running queue returned true")
+	}
+	select {
+	case state := <-done:
+		if state != string(notifier.StatusSuccess) {
+			t.Errorf("resumed job finished %s, want %s", state, notifier.StatusSuccess)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("held job didn't run once resumed")
+	}
+
+	// Stopping a paused queue drops the held jobs
+	if _, err := q.Submit(job); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	q.Pause()
+	q.Stop()
+	if state := <-done; state != JobAborted {
+		t.Errorf("job held while stopping finished %s, want %s", state, JobAborted)
+	}
+}
+
+// windowAround returns a window opening at now plus from and closing at now
+// plus to, as times of day
+func windowAround(now time.Time, from, to time.Duration) []config.TimeWindow {
+	return []config.TimeWindow{{From: now.Add(from).Format("15:04"), To: now.Add(to).Format("15:04")}}
+}
+
+// TestQueueWindows checks the jobs submitted in and out of the allowed
+// windows of their commands, the held ones waiting for the next window
+func TestQueueWindows(t *testing.T) {
+	now := time.Now()
+	open := windowAround(now, -time.Hour, time.Hour)
+	closed := windowAround(now, 2*time.Hour, 3*time.Hour)
+	tests := []struct {
+		name  string
+		cmd   config.Command
+		err   error
+		state string
+	}{
+		{"no windows", config.Command{Name: "deploy"}, nil, JobQueued},
+		{"open window", config.Command{Name: "deploy", AllowedWindows: open}, nil, JobQueued},
+		{"closed window", config.Command{Name: "deploy", AllowedWindows: closed}, nil, JobWaiting},
+		{"closed window held", config.Command{Name: "deploy", AllowedWindows: closed, OutsideWindow: window.PolicyQueue}, nil, JobWaiting},
+		{"closed window rejecting", config.Command{Name: "deploy", AllowedWindows: closed, OutsideWindow: window.PolicyReject}, ErrOutsideWindow, ""},
+		{"open window rejecting", config.Command{Name: "deploy", AllowedWindows: open, OutsideWindow: window.PolicyReject}, nil, JobQueued},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The queue isn't started, so the jobs stay queued
+			runner, _ := newTestRunner(t)
+			q := NewQueue(runner, 5)
+			tt.cmd.Command = "true"
+			id, err := q.Submit(Job{Source: "test", Commands: []config.Command{tt.cmd}})
+			if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+				t.Fatalf("Submit returned %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			status := q.Status()
+			if len(status.Queued) != 1 || status.Queued[0].ID != id || status.Queued[0].State != tt.state {
+				t.Fatalf("queued %+v, want %s %s", status.Queued, id, tt.state)
+			}
+			if tt.state == JobWaiting && (status.Queued[0].RunAfter == nil || !status.Queued[0].RunAfter.After(now)) {
+				t.Errorf("waiting job runs after %v, want the opening of the window", status.Queued[0].RunAfter)
+			}
+		})
+	}
+}
+
+// TestQueueFreezes checks the jobs submitted during a freeze period
+func TestQueueFreezes(t *testing.T) {
+	now := time.Now()
+	calendar, err := freeze.New(&config.FreezeConfig{Periods: []config.FreezePeriod{{
+		From:   now.Add(-time.Hour).Format(time.RFC3339),
+		To:     now.Add(time.Hour).Format(time.RFC3339),
+		Reason: "release week",
+	}}})
+	if err != nil {
+		t.Fatalf("freeze.New: %v", err)
+	}
+	tests := []struct {
+		name  string
+		cmd   config.Command
+		force bool
+		err   error
+		// notified is whether a message is sent about the freeze
+		notified bool
+	}{
+		{name: "unprotected", cmd: config.Command{Name: "build"}},
+		{name: "protected", cmd: config.Command{Name: "deploy", Protected: true}, err: ErrFrozen, notified: true},
+		{name: "protected and forced", cmd: config.Command{Name: "deploy", Protected: true}, force: true, notified: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner, notify := newTestRunner(t)
+			q := NewQueue(runner, 5)
+			q.SetFreezes(calendar)
+			tt.cmd.Command = "true"
+			_, err := q.Submit(Job{Source: "test", Commands: []config.Command{tt.cmd}, Force: tt.force})
+			if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+				t.Fatalf("Submit returned %v, want %v", err, tt.err)
+			}
+			queued := len(q.Status().Queued)
+			if (err == nil) != (queued == 1) {
+				t.Errorf("%d jobs queued", queued)
+			}
+			notify.mu.Lock()
+			defer notify.mu.Unlock()
+			if (len(notify.messages) > 0) != tt.notified {
+				t.Errorf("messages %q sent, want a message about the freeze: %v", notify.messages, tt.notified)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// ErrQuotaExceeded is returned when a command is killed because its output
+// exceeded its quota
+var ErrQuotaExceeded = errors.New("command exceeded its quota")
+
+// quota enforces the output quota of a run. The output beyond the quota is
+// discarded and the current attempt is cancelled.
+type quota struct {
+	maxOutput    config.Size
+	maxLogGrowth config.Size
+
+	mu sync.Mutex
+	// attempt and run count the output of the current attempt and of the run
+	attempt  config.Size
+	run      config.Size
+	exceeded string
+	cancel   context.CancelFunc
+}
+
+// newQuota returns the quota of a run, or nil when no limit is configured
+func newQuota(cfg *config.QuotaConfig) *quota {
+	if cfg == nil || (cfg.MaxOutput <= 0 && cfg.MaxLogGrowth <= 0) {
+		return nil
+	}
+	return &quota{maxOutput: cfg.MaxOutput, maxLogGrowth: cfg.MaxLogGrowth}
+}
+
+// start resets the output of the attempt, which cancel aborts on exceeding
+// the quota
+func (q *quota) start(cancel context.CancelFunc) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.attempt = 0
+	q.exceeded = ""
+	q.cancel = cancel
+}
+
+// Exceeded returns the limit exceeded by the current attempt, if any
+func (q *quota) Exceeded() string {
+	if q == nil {
+		return ""
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.exceeded
+}
+
+// writer returns a writer counting the output written to w against the quota
+func (q *quota) writer(w io.Writer) io.Writer {
+	if q == nil {
+		return w
+	}
+	return &quotaWriter{w: w, quota: q}
+}
+
+// allow returns how much of n bytes may still be written and records them,
+// cancelling the attempt when a limit is reached
+func (q *quota) allow(n int) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.exceeded != "" {
+		return 0
+	}
+
+	allowed := config.Size(n)
+	if q.maxOutput > 0 && q.attempt+allowed > q.maxOutput {
+		allowed = q.maxOutput - q.attempt
+		q.exceeded = fmt.Sprintf("output exceeded %s", q.maxOutput)
+	}
+	if q.maxLogGrowth > 0 && q.run+allowed > q.maxLogGrowth {
+		allowed = q.maxLogGrowth - q.run
+		q.exceeded = fmt.Sprintf("log growth exceeded %s", q.maxLogGrowth)
+	}
+	q.attempt += allowed
+	q.run += allowed
+	if q.exceeded != "" && q.cancel != nil {
+		q.cancel()
+	}
+	return int(allowed)
+}
+
+// quotaWriter writes the output allowed by a quota
+type quotaWriter struct {
+	w     io.Writer
+	quota *quota
+}
+
+func (w *quotaWriter) Write(p []byte) (int, error) {
+	allowed := w.quota.allow(len(p))
+	if allowed > 0 {
+		if _, err := w.w.Write(p[:allowed]); err != nil {
+			return 0, err
+		}
+	}
+	// Report the discarded output as written so that the copy from the
+	// process doesn't fail before it's killed
+	return len(p), nil
+}
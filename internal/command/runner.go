@@ -1,163 +1,1163 @@
 package command
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/docker"
+	"github.com/ndious/delivr/internal/history"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/k8s"
+	"github.com/ndious/delivr/internal/metrics"
+	"github.com/ndious/delivr/internal/notifier"
+	"github.com/ndious/delivr/internal/output"
+	"github.com/ndious/delivr/internal/preflight"
+	"github.com/ndious/delivr/internal/redact"
+	"github.com/ndious/delivr/internal/remote"
+	"github.com/ndious/delivr/internal/secrets"
 )
 
-// Discord interface defines the methods required for discord integration
-type Discord interface {
+// Notifier interface defines the methods required to send notifications
+type Notifier interface {
 	SendMessage(content string) error
+	SendResult(result notifier.Result) error
 }
 
 // Logger interface defines the methods required for logging
 type Logger interface {
-	GetLogWriter(commandName string) io.Writer
-	GetLogPath(commandName string) string
+	OpenRun(commandName string) (io.WriteCloser, string)
+}
+
+// streamLog is implemented by run logs that record the output streams and
+// the exit code of each execution separately, e.g. as structured records
+type streamLog interface {
+	Stream(name string) io.Writer
+	Exit(code int) error
 }
 
 // Runner executes commands
 type Runner struct {
-	discord    Discord
+	notifier   Notifier
 	logger     Logger
 	workingDir string
 	dockerHost string
+	history    *history.Store
+	// configFile and configHash identify the configuration recorded with
+	// the runs
+	configFile string
+	configHash string
+	secrets    *secrets.Resolver
+	host       notifier.Host
+	redactor   *redact.Redactor
+	// redactSecrets are the names of the secrets masked in the output
+	redactSecrets []string
+	// quota is the output quota of the commands without their own
+	quota *config.QuotaConfig
+	// interpreter runs the shell scripts of the commands without their own
+	interpreter string
+	// failurePolicy applies to the commands without their own
+	failurePolicy string
+	// ansi is the handling of the escape sequences of the commands without
+	// their own
+	ansi string
+	// failFast stops the runs at their first failure that isn't tolerated
+	failFast bool
+	// feed publishes the output of the commands while they run
+	feed *OutputFeed
+	// remote runs the commands of remote hosts, and hostGroups are the named
+	// lists of hosts they may run on
+	remote     *remote.Client
+	hostGroups map[string][]string
+	// simulation is the default fake outcome of the commands when they are
+	// replaced with fake runs, nil otherwise
+	simulation *config.SimulateConfig
+	// templates customize the messages of the runs, nil to keep the defaults
+	templates *notifier.Templates
+
+	mu sync.Mutex
+	// job is the ID of the job whose commands are running
+	job string
+	// processes are the commands currently running, and sessions those
+	// running on remote hosts
+	processes map[*exec.Cmd]struct{}
+	sessions  map[*remote.Session]struct{}
+	stopping  bool
+	// stopped is closed when delivr starts stopping, to interrupt the
+	// delays between the attempts of the commands
+	stopped chan struct{}
+	// interrupted are the commands cancelled because delivr is stopping
+	interrupted []string
+
+	// ctx is the context of the commands, cancelled to kill them when they
+	// didn't stop within the grace period after a signal
+	ctx         context.Context
+	cancel      context.CancelFunc
+	gracePeriod time.Duration
+
+	// captureLimit is the output of each stream kept in memory
+	captureLimit config.Size
 }
 
+// DefaultGracePeriod is the time the running commands have to stop after a
+// signal before they are killed
+const DefaultGracePeriod = 30 * time.Second
+
 // NewRunner creates a new command runner
-func NewRunner(discord Discord, logger Logger, workingDir string, dockerHost string) *Runner {
+func NewRunner(notifier Notifier, logger Logger, workingDir string, dockerHost string) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Runner{
-		discord:    discord,
-		logger:     logger,
-		workingDir: workingDir,
-		dockerHost: dockerHost,
+		notifier:     notifier,
+		logger:       logger,
+		workingDir:   workingDir,
+		dockerHost:   dockerHost,
+		processes:    make(map[*exec.Cmd]struct{}),
+		sessions:     make(map[*remote.Session]struct{}),
+		stopped:      make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+		gracePeriod:  DefaultGracePeriod,
+		captureLimit: DefaultCaptureLimit,
+	}
+}
+
+// ErrStopping is returned when a command isn't run because delivr is stopping
+var ErrStopping = errors.New("delivr is stopping")
+
+// Signal forwards a signal to the process groups of the running commands and
+// prevents new commands from starting. The commands still running at the end
+// of the grace period following the first signal are killed.
+func (r *Runner) Signal(sig os.Signal) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.stopping {
+		time.AfterFunc(r.gracePeriod, r.kill)
+		close(r.stopped)
+	}
+	r.stopping = true
+	for command := range r.processes {
+		if err := signalGroup(command, sig); err != nil {
+			log.Printf("Warning: Could not forward %v to process %d: %v", sig, command.Process.Pid, err)
+		}
+	}
+	for session := range r.sessions {
+		if err := session.Signal(sig); err != nil {
+			log.Printf("Warning: Could not forward %v to a remote command: %v", sig, err)
+		}
+	}
+}
+
+// kill cancels the context of the commands, killing those still running
+func (r *Runner) kill() {
+	r.mu.Lock()
+	running := len(r.processes) + len(r.sessions)
+	r.mu.Unlock()
+	if running > 0 {
+		log.Printf("The grace period of %s expired, killing %d running commands", r.gracePeriod, running)
+	}
+	r.cancel()
+}
+
+// SetGracePeriod sets the time the running commands have to stop after a
+// signal before they are killed
+func (r *Runner) SetGracePeriod(period time.Duration) {
+	r.gracePeriod = period
+}
+
+// SetCaptureLimit sets the output of each stream of the commands kept in
+// memory, the rest being only written to the log
+func (r *Runner) SetCaptureLimit(limit config.Size) {
+	r.captureLimit = limit
+}
+
+// Interrupted returns the commands cancelled because delivr is stopping
+func (r *Runner) Interrupted() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.interrupted)
+}
+
+// Stopping reports whether a signal was received and no new command should start
+func (r *Runner) Stopping() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stopping
+}
+
+// sleep waits for d, and reports false without waiting longer when delivr
+// starts stopping
+func (r *Runner) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.stopped:
+		return false
+	}
+}
+
+// start starts a command and tracks it until it completes, so that signals
+// can be forwarded to it
+func (r *Runner) start(command *exec.Cmd) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopping {
+		return ErrStopping
+	}
+	if err := command.Start(); err != nil {
+		return err
 	}
+	r.processes[command] = struct{}{}
+	return nil
+}
+
+// wait waits for a started command to complete and stops tracking it
+func (r *Runner) wait(command *exec.Cmd) error {
+	err := command.Wait()
+	r.mu.Lock()
+	delete(r.processes, command)
+	r.mu.Unlock()
+	return err
+}
+
+// ErrTimeout is returned when a command is killed after its timeout
+var ErrTimeout = errors.New("command timed out")
+
+// ErrCancelled is returned when a command is interrupted because delivr is
+// stopping
+var ErrCancelled = errors.New("command cancelled, delivr is stopping")
+
+// ErrSpawn is returned when a command could not be started, e.g. because its
+// program doesn't exist or its secrets can't be read
+var ErrSpawn = errors.New("command could not be started")
+
+// SetHistory sets the store in which pipeline runs are recorded
+func (r *Runner) SetHistory(store *history.Store) {
+	r.history = store
+}
+
+// SetConfigFile sets the source and the hash of the configuration the runs
+// are recorded with in the history
+func (r *Runner) SetConfigFile(source, hash string) {
+	r.configFile = source
+	r.configHash = hash
+}
+
+// SetHost sets the identity of the server written in the log headers and
+// recorded in the history
+func (r *Runner) SetHost(host notifier.Host) {
+	r.host = host
+}
+
+// SetSecrets sets the resolver of the secret:// references of commands
+func (r *Runner) SetSecrets(resolver *secrets.Resolver) {
+	r.secrets = resolver
+}
+
+// SetRedaction sets the redactor masking sensitive values in the output of
+// commands, in addition to the values of the named secrets
+func (r *Runner) SetRedaction(redactor *redact.Redactor, secretNames []string) {
+	r.redactor = redactor
+	r.redactSecrets = secretNames
 }
 
-// Execute runs a command and sends its output to Discord
-func (r *Runner) Execute(cmd config.Command) error {
+// SetQuota sets the output quota of the commands that don't define one
+func (r *Runner) SetQuota(quota *config.QuotaConfig) {
+	r.quota = quota
+}
+
+// SetInterpreter sets the shell running the scripts of the commands that
+// don't define one
+func (r *Runner) SetInterpreter(interpreter string) {
+	r.interpreter = interpreter
+}
+
+// SetFailurePolicy sets the failure policy of the commands that don't define
+// one. Without policy, pipelines use the default of their caller.
+func (r *Runner) SetFailurePolicy(policy string) {
+	r.failurePolicy = policy
+}
+
+// SetANSI sets what happens to the ANSI escape sequences of the output of the
+// commands that don't define it, stripped when empty
+func (r *Runner) SetANSI(mode string) {
+	r.ansi = mode
+}
+
+// SetFailFast makes the runs stop at their first failure, whatever the
+// failure policies, unless the failure is tolerated
+func (r *Runner) SetFailFast(failFast bool) {
+	r.failFast = failFast
+}
+
+// SetRemote sets the SSH client running the commands of remote hosts
+func (r *Runner) SetRemote(client *remote.Client) {
+	r.remote = client
+}
+
+// SetHostGroups sets the named lists of hosts the commands may run on
+func (r *Runner) SetHostGroups(groups map[string][]string) {
+	r.hostGroups = groups
+}
+
+// SetOutputFeed sets the feed publishing the output of the commands while
+// they run
+func (r *Runner) SetOutputFeed(feed *OutputFeed) {
+	r.feed = feed
+}
+
+// SetTemplates sets the templates of the start, result and summary messages
+func (r *Runner) SetTemplates(templates *notifier.Templates) {
+	r.templates = templates
+}
+
+// setJob records the ID of the job whose commands are running
+func (r *Runner) setJob(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.job = id
+}
+
+// feedWriter returns the writer publishing the output of a command to the
+// feed, or nil without feed
+func (r *Runner) feedWriter(cmd config.Command) io.Writer {
+	if r.feed == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.feed.writer(r.job, cmd.Name)
+}
+
+// commandQuota returns the output quota of a command
+func (r *Runner) commandQuota(cmd config.Command) *config.QuotaConfig {
+	if cmd.Quota != nil {
+		return cmd.Quota
+	}
+	return r.quota
+}
+
+// attemptRedactor returns the redactor of an execution, with the current
+// values of the redacted secrets
+func (r *Runner) attemptRedactor() *redact.Redactor {
+	if r.redactor == nil {
+		return nil
+	}
+	if r.secrets == nil || len(r.redactSecrets) == 0 {
+		return r.redactor
+	}
+
+	values := make([]string, 0, len(r.redactSecrets))
+	for _, name := range r.redactSecrets {
+		// Unreadable secrets make the commands referencing them fail anyway
+		if value, err := r.secrets.Resolve("secret://" + name); err == nil {
+			values = append(values, value)
+		}
+	}
+	return r.redactor.With(values...)
+}
+
+// resolveSecrets returns a copy of a command with its secret references
+// replaced with their values
+func (r *Runner) resolveSecrets(cmd config.Command) (config.Command, error) {
+	if r.secrets == nil {
+		return cmd, nil
+	}
+
+	var err error
+	if cmd.Shell, err = r.secrets.Resolve(cmd.Shell); err != nil {
+		return cmd, err
+	}
+	if cmd.Args, err = r.secrets.ResolveAll(cmd.Args); err != nil {
+		return cmd, err
+	}
+	if cmd.EnvVars, err = r.secrets.ResolveAll(cmd.EnvVars); err != nil {
+		return cmd, err
+	}
+	if cmd.Stdin != nil {
+		stdin := *cmd.Stdin
+		if stdin.Text, err = r.secrets.Resolve(stdin.Text); err != nil {
+			return cmd, err
+		}
+		cmd.Stdin = &stdin
+	}
+	if cmd.Docker != nil {
+		action := *cmd.Docker
+		if action.Env, err = r.secrets.ResolveAll(action.Env); err != nil {
+			return cmd, err
+		}
+		if action.Cmd, err = r.secrets.ResolveAll(action.Cmd); err != nil {
+			return cmd, err
+		}
+		cmd.Docker = &action
+	}
+	return cmd, nil
+}
+
+// attempt holds the outcome of a single execution of a command
+type attempt struct {
+	stdout capture
+	stderr capture
+	// patterns matches the success and failure patterns of the command
+	// against its output, nil without patterns
+	patterns *patternScanner
+	err      error
+	timedOut bool
+	// quotaExceeded is the quota limit exceeded, if any
+	quotaExceeded string
+	// remotes is the outcome on each host of a command run on several
+	remotes []notifier.RemoteResult
+	// rollouts is the state of the rollouts after a k8s command
+	rollouts []notifier.RolloutStatus
+	// outputs are the outputs the command wrote to its output file
+	outputs map[string]string
+}
+
+// status classifies the outcome of the last attempt of a command
+func (a *attempt) status(stopping bool) notifier.Status {
+	switch {
+	case a.err == nil:
+		return notifier.StatusSuccess
+	case a.timedOut:
+		return notifier.StatusTimeout
+	case a.quotaExceeded != "":
+		return notifier.StatusQuota
+	case stopping:
+		return notifier.StatusCancelled
+	case errors.Is(a.err, ErrSpawn):
+		return notifier.StatusSpawnError
+	default:
+		return notifier.StatusFailure
+	}
+}
+
+// RunResult describes the outcome of a command run
+type RunResult struct {
+	Command string
+	Status  notifier.Status
+	// ExitCode is the exit code of the command, -1 when it couldn't start
+	// or was killed by a signal
+	ExitCode int
+	Duration time.Duration
+	// StdoutSize and StderrSize are the sizes in bytes of the output of the
+	// last attempt, redacted
+	StdoutSize int64
+	StderrSize int64
+	// LogPath is the log file the output of the run was written to
+	LogPath  string
+	Attempts int
+}
+
+// Execute runs a command and sends its output to the notifiers. The result
+// describes the run even when it failed or was skipped.
+func (r *Runner) Execute(cmd config.Command) (RunResult, error) {
+	run, err := r.execute(cmd)
+	return run.RunResult, err
+}
+
+// execution describes a command run beyond its outcome
+type execution struct {
+	RunResult
+	// failed is set when one of its notifications couldn't be sent, which
+	// doesn't change the outcome of the command
+	failed bool
+	// messages are the messages sent whose ID the notifiers reported
+	messages []history.Message
+	// outputs are the values exported to the next steps of the pipeline
+	outputs map[string]string
+}
+
+// execute runs a command like Execute, and also describes its notifications
+// and outputs
+func (r *Runner) execute(cmd config.Command) (run execution, err error) {
 	startTime := time.Now()
 
+	// Group the notifications of this run when the notifiers support it
+	notify := r.notifier
+	if scoper, ok := notify.(notifier.RunScoper); ok {
+		notify = scoper.ForRun(cmd.Name)
+	}
+	defer func() {
+		run.messages = sentMessages(notify)
+	}()
+
+	// Get log writer for this command
+	logWriter, logPath := r.logger.OpenRun(cmd.Name)
+	defer logWriter.Close()
+	run.Command, run.LogPath = cmd.Name, logPath
+
+	// Skip the command when its conditions aren't met
+	skipped, conditionErr := r.checkConditions(cmd, logWriter)
+	if skipped != "" {
+		run.Status, run.Duration = notifier.StatusSkipped, time.Since(startTime)
+		run.failed, err = r.skip(cmd, notify, skipped, logPath, run.Duration, logWriter)
+		return run, err
+	}
+
 	// Prepare notification message
-	startMsg := fmt.Sprintf("🏃 Running command: **%s**\n> %s", cmd.Name, cmd.Description)
-	if err := r.discord.SendMessage(startMsg); err != nil {
-		return fmt.Errorf("failed to send start message: %w", err)
+	startMsg := i18n.T("🏃 Running command: **%s**\n> %s", cmd.Name, cmd.Description)
+	custom, renderErr := r.templates.Start(notifier.TemplateData{
+		Command:     cmd.Name,
+		Description: cmd.Description,
+		Tags:        cmd.Tags,
+		Host:        r.host.Name,
+	})
+	if renderErr != nil {
+		log.Printf("Warning: Command '%s': %v, sending the default start message", cmd.Name, renderErr)
+	} else if custom != "" {
+		startMsg = custom
+	}
+	if err := notify.SendMessage(startMsg); err != nil {
+		// A notification failure doesn't prevent the command from running
+		log.Printf("Warning: Notification failure, could not send start message for '%s': %v", cmd.Name, err)
+		run.failed = true
+	}
+
+	// Show the output while the command runs if requested
+	var live *liveOutput
+	var liveWriter io.Writer
+	if cmd.Stream {
+		live = startLiveOutput(notify, cmd.Name, cmd.StreamThrottle)
+		if live != nil {
+			liveWriter = live.tail
+		}
+	}
+	if feed := r.feedWriter(cmd); feed != nil {
+		if liveWriter != nil {
+			liveWriter = io.MultiWriter(liveWriter, feed)
+		} else {
+			liveWriter = feed
+		}
+	}
+
+	// Run the command, retrying on failure if a retry policy is configured.
+	// A command exceeding its quota isn't retried.
+	quota := newQuota(r.commandQuota(cmd))
+	maxAttempts := max(cmd.Retries+1, 1)
+	delay := cmd.RetryDelay.Std()
+	var result *attempt
+	attempts := 0
+	if conditionErr != nil {
+		result = &attempt{err: conditionErr}
+		maxAttempts = 0
+	} else if err := r.runPreHooks(cmd, logWriter); err != nil {
+		// The command doesn't run when its preparation failed
+		result = &attempt{err: err}
+		maxAttempts = 0
+	}
+	for attempts < maxAttempts {
+		attempts++
+		result = r.runAttempt(cmd, logWriter, liveWriter, quota, attempts, maxAttempts)
+		if result.err == nil || result.quotaExceeded != "" || attempts == maxAttempts || r.Stopping() {
+			break
+		}
+
+		fmt.Fprintf(logWriter, "Retrying in %s (attempt %d of %d)\n", delay, attempts+1, maxAttempts)
+		if !r.sleep(delay) {
+			fmt.Fprintf(logWriter, "Retry abandoned, delivr is stopping\n")
+			break
+		}
+		if cmd.RetryBackoff > 1 {
+			delay = time.Duration(float64(delay) * cmd.RetryBackoff)
+		}
+	}
+	err = result.err
+	stdout, stderr := &result.stdout, &result.stderr
+	if live != nil {
+		live.finish()
+	}
+
+	// Build the result notification
+	res := notifier.Result{
+		Command:     cmd.Name,
+		Description: cmd.Description,
+		Status:      notifier.StatusSuccess,
+		Duration:    time.Since(startTime),
+		Timeout:     cmd.Timeout.Std(),
+		ExitCode:    exitCode(err),
+		LogPath:     logPath,
+		WorkingDir:  r.commandDir(cmd),
+		Attempts:    attempts,
+		MaxAttempts: maxAttempts,
+	}
+	run.ExitCode, run.Duration, run.Attempts = res.ExitCode, res.Duration, attempts
+	run.StdoutSize, run.StderrSize = stdout.Len(), stderr.Len()
+	// Show stdout on success and stderr on failure, shaped by the processors.
+	// Commands failing on their failure pattern exited successfully, their
+	// stdout is shown as well.
+	shown := stdout.String()
+	if err != nil && !errors.Is(err, ErrFailurePattern) {
+		shown = stderr.String()
+	}
+	shown = r.processOutput(cmd, shown, logWriter)
+	// The output mode selects how much of it the notifications include, the
+	// verbose profiles showing the tail
+	switch cmd.OutputMode {
+	case config.OutputModeNone:
+	case config.OutputModeSummary:
+		res.Output, res.Tail = notifier.TruncateOutput(shown), notifier.TailExcerpt(shown)
+	case config.OutputModeTail:
+		res.Output, res.Tail = notifier.TailExcerpt(shown), notifier.TailExcerpt(shown)
+	default:
+		res.Output, res.Tail = notifier.TruncateOutput(shown), notifier.TailOutput(shown)
+		res.FullOutput = notifier.FullOutput(shown)
+	}
+	if cmd.Type == config.CommandTypeCompose && !r.Simulating() {
+		res.Services = r.composeServices(cmd, logWriter)
+	}
+	res.Rollouts = result.rollouts
+	res.Remotes = result.remotes
+	if err != nil {
+		res.Status = result.status(r.Stopping())
+		res.Error = err.Error()
+		if result.quotaExceeded != "" {
+			res.Error = result.quotaExceeded
+		}
+	}
+	run.Status = res.Status
+	if res.Status == notifier.StatusCancelled {
+		r.mu.Lock()
+		r.interrupted = append(r.interrupted, cmd.Name)
+		r.mu.Unlock()
+	}
+
+	// Export the outputs of a successful run to the next steps
+	if err == nil {
+		run.outputs = matchOutputs(cmd, stdout.String(), result.outputs, logWriter)
+		logOutputs(run.outputs, logWriter)
+	}
+
+	// Run the post hooks matching the outcome, e.g. cleanup or rollback
+	// steps. Their failures are reported without changing the outcome.
+	hookErrs := r.runPostHooks(cmd, res.Status, logWriter)
+	if sized, ok := logWriter.(interface{ Size() int64 }); ok {
+		res.LogSize = sized.Size()
+	}
+
+	metrics.RecordRun(cmd.Name, string(res.Status), res.Duration, attempts)
+
+	// Render the result with the template of its outcome, if any
+	data := notifier.ResultData(res, cmd.Tags)
+	data.Host = r.host.Name
+	if res.Message, renderErr = r.templates.Result(data); renderErr != nil {
+		log.Printf("Warning: Command '%s': %v, sending the default result message", cmd.Name, renderErr)
+	}
+
+	// Send result notification. Failed notifications are retried by the
+	// notifiers and don't change the outcome of the command.
+	if err := notify.SendResult(res); err != nil {
+		log.Printf("Warning: Notification failure, could not send result message for '%s': %v", cmd.Name, err)
+		run.failed = true
+	}
+	for _, hookErr := range hookErrs {
+		log.Printf("Warning: Command '%s': %v", cmd.Name, hookErr)
+		if err := notify.SendMessage(i18n.T("⚠️ Command **%s**: %v", cmd.Name, hookErr)); err != nil {
+			log.Printf("Warning: Notification failure, could not send hook message for '%s': %v", cmd.Name, err)
+			run.failed = true
+		}
+	}
+
+	switch res.Status {
+	case notifier.StatusTimeout:
+		return run, fmt.Errorf("%w after %s", ErrTimeout, cmd.Timeout)
+	case notifier.StatusQuota:
+		return run, fmt.Errorf("%w: %s", ErrQuotaExceeded, result.quotaExceeded)
+	case notifier.StatusCancelled:
+		return run, fmt.Errorf("%w: %v", ErrCancelled, err)
+	}
+	if err != nil && attempts > 1 {
+		return run, fmt.Errorf("failed after %d attempts: %w", attempts, err)
+	}
+	return run, err
+}
+
+// sentMessages returns the messages of a run reported by the notifiers
+func sentMessages(notify Notifier) []history.Message {
+	receipter, ok := notify.(notifier.Receipter)
+	if !ok {
+		return nil
+	}
+	var messages []history.Message
+	for _, receipt := range receipter.Receipts() {
+		messages = append(messages, history.Message{
+			Notifier:  receipt.Notifier,
+			Kind:      receipt.Kind,
+			ChannelID: receipt.ChannelID,
+			MessageID: receipt.MessageID,
+		})
 	}
+	return messages
+}
 
-	// Prepare command
-	command := exec.Command(cmd.Command, cmd.Args...)
+// processOutput applies the output processors of a command to the output
+// shown in its notifications. A processor failure is logged, and the output
+// is shown as processed until then.
+func (r *Runner) processOutput(cmd config.Command, shown string, logWriter io.Writer) string {
+	if len(cmd.Output) == 0 {
+		return shown
+	}
+	chain, err := output.New(cmd.Output)
+	if err == nil {
+		shown, err = chain.Apply(shown)
+	}
+	if err != nil {
+		fmt.Fprintf(logWriter, "Warning: Could not process the output for the notification: %v\n", err)
+		log.Printf("Warning: Command '%s': %v", cmd.Name, err)
+	}
+	return shown
+}
 
-	// Set Docker host if specified
-	if r.dockerHost != "" && cmd.Command == "docker" {
-		env := os.Environ()
+// commandANSI returns what happens to the ANSI escape sequences of the output
+// of a command
+func (r *Runner) commandANSI(cmd config.Command) string {
+	if cmd.ANSI != "" {
+		return cmd.ANSI
+	}
+	return r.ansi
+}
+
+// commandDir returns the working directory of a command based on priority:
+// 1. Command-specific directory if specified
+// 2. Global working directory if specified
+// 3. Current directory otherwise (empty string)
+//
+// The global working directory being local, remote commands run in the home
+// directory of their user without a directory of their own.
+func (r *Runner) commandDir(cmd config.Command) string {
+	if cmd.Dir != "" || cmd.Remote() {
+		return cmd.Dir
+	}
+	return r.workingDir
+}
+
+// commandEnv returns the environment variables added to the environment of
+// delivr for a command
+func (r *Runner) commandEnv(cmd config.Command) []string {
+	var env []string
+	// Shell scripts may call the docker CLI as well
+	if program, _ := r.commandLine(cmd); r.dockerHost != "" && (program == "docker" || cmd.Shell != "") && cmd.Type != config.CommandTypeDocker {
 		env = append(env, "DOCKER_HOST="+r.dockerHost)
-		command.Env = env
 	}
+	return append(env, cmd.EnvVars...)
+}
+
+// exitCode returns the exit code of a finished command or container, 0 on
+// success and -1 when the command could not be started or was killed by a signal
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
 
-	// Set working directory based on priority:
-	// 1. Command-specific directory if specified
-	// 2. Global working directory if specified
-	// 3. Current directory otherwise
-	if cmd.Dir != "" {
-		command.Dir = cmd.Dir
-	} else if r.workingDir != "" {
-		command.Dir = r.workingDir
+// runAttempt executes the command once, logging its output to logWriter and
+// copying it to liveWriter when set. The attempt is killed when its output
+// exceeds the quota.
+func (r *Runner) runAttempt(cmd config.Command, logWriter, liveWriter io.Writer, quota *quota, number, maxAttempts int) *attempt {
+	result := &attempt{
+		stdout:   newCapture(r.captureLimit),
+		stderr:   newCapture(r.captureLimit),
+		patterns: newPatternScanner(cmd, logWriter),
 	}
 
-	// Set environment variables if specified
-	if len(cmd.EnvVars) > 0 {
-		command.Env = append(os.Environ(), cmd.EnvVars...)
+	// Apply the command timeout if one is configured
+	ctx, cancel := context.WithCancel(r.ctx)
+	defer cancel()
+	if cmd.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, cmd.Timeout.Std())
+		defer cancelTimeout()
 	}
+	quota.start(cancel)
 
-	// Get log writer for this command
-	logWriter := r.logger.GetLogWriter(cmd.Name)
+	// Log the output streams separately when the log supports it
+	logOut, logErr := logWriter, logWriter
+	streams, structured := logWriter.(streamLog)
+	if structured {
+		logOut, logErr = streams.Stream("stdout"), streams.Stream("stderr")
+	}
 
 	// Create multi-writers to capture output in memory and log to file
-	var stdout, stderr bytes.Buffer
-	multiStdout := io.MultiWriter(&stdout, logWriter)
-	multiStderr := io.MultiWriter(&stderr, logWriter)
-
-	// Write command metadata to log file
-	fmt.Fprintf(logWriter, "\n\n==================================================\n")
-	fmt.Fprintf(logWriter, "Command: %s\n", cmd.Name)
-	fmt.Fprintf(logWriter, "Description: %s\n", cmd.Description)
-	fmt.Fprintf(logWriter, "Executed at: %s\n", time.Now().Format(time.RFC3339))
-	fmt.Fprintf(logWriter, "Working Directory: %s\n", command.Dir)
-	fmt.Fprintf(logWriter, "Full Command: %s %s\n", cmd.Command, strings.Join(cmd.Args, " "))
-	fmt.Fprintf(logWriter, "==================================================\n\n")
-
-	// Set output writers
-	command.Stdout = multiStdout
-	command.Stderr = multiStderr
-
-	// Execute the command
-	err := command.Run()
+	outWriters, errWriters := []io.Writer{&result.stdout, logOut}, []io.Writer{&result.stderr, logErr}
+	if liveWriter != nil {
+		outWriters, errWriters = append(outWriters, liveWriter), append(errWriters, liveWriter)
+	}
+	// The patterns are matched before the output is cut to the capture limit
+	if result.patterns != nil {
+		outWriters, errWriters = append(outWriters, result.patterns.stream()), append(errWriters, result.patterns.stream())
+	}
+	stdout, stderr := io.MultiWriter(outWriters...), io.MultiWriter(errWriters...)
 
-	// Log completion status
-	if err != nil {
-		fmt.Fprintf(logWriter, "\n\n==================================================\n")
-		fmt.Fprintf(logWriter, "Command failed with error: %v\n", err)
-		fmt.Fprintf(logWriter, "==================================================\n\n")
-	} else {
-		fmt.Fprintf(logWriter, "\n\n==================================================\n")
-		fmt.Fprintf(logWriter, "Command completed successfully\n")
-		fmt.Fprintf(logWriter, "==================================================\n\n")
+	// Mask sensitive values before the output is logged or notified
+	var redacted []*redact.Writer
+	redactor := r.attemptRedactor()
+	if !redactor.Empty() {
+		redactedOut, redactedErr := redact.NewWriter(stdout, redactor), redact.NewWriter(stderr, redactor)
+		redacted = append(redacted, redactedOut, redactedErr)
+		stdout, stderr = redactedOut, redactedErr
 	}
 
-	// Calculate execution time
-	duration := time.Since(startTime)
-	durationStr := fmt.Sprintf("%.2f seconds", duration.Seconds())
+	// Strip the escape sequences first, so that the values to mask aren't
+	// split by colors
+	var normalized []*output.Normalizer
+	if r.commandANSI(cmd) != config.ANSIKeep {
+		normalizedOut, normalizedErr := output.NewNormalizer(stdout), output.NewNormalizer(stderr)
+		normalized = append(normalized, normalizedOut, normalizedErr)
+		stdout, stderr = normalizedOut, normalizedErr
+	}
 
-	// Prepare output for Discord
-	var resultMsg strings.Builder
-	if err != nil {
-		resultMsg.WriteString(fmt.Sprintf("❌ Command **%s** failed (took %s)\n", cmd.Name, durationStr))
-		if stderr.Len() > 0 {
-			errText := stderr.String()
-			// Truncate if too long
-			if len(errText) > 1500 {
-				errText = errText[:1500] + "... (truncated)"
-			}
-			resultMsg.WriteString(fmt.Sprintf("```\n%s\n```", errText))
+	// Count the raw output against the quota, discarding what exceeds it
+	stdout, stderr = quota.writer(stdout), quota.writer(stderr)
+
+	// Write command metadata to log file in a single write so that it isn't
+	// interleaved with the output of concurrent runs
+	var header strings.Builder
+	fmt.Fprintf(&header, "\n\n==================================================\n")
+	fmt.Fprintf(&header, "Command: %s\n", cmd.Name)
+	fmt.Fprintf(&header, "Description: %s\n", cmd.Description)
+	if !r.host.IsZero() {
+		fmt.Fprintf(&header, "Host: %s\n", r.host)
+	}
+	fmt.Fprintf(&header, "Executed at: %s\n", time.Now().Format(time.RFC3339))
+	if cmd.Remote() {
+		fmt.Fprintf(&header, "Remote Hosts: %s\n", strings.Join(cmd.RemoteHosts(r.hostGroups), ", "))
+	}
+	if cmd.Type != config.CommandTypeDocker {
+		fmt.Fprintf(&header, "Working Directory: %s\n", r.commandDir(cmd))
+	}
+	program, args := r.commandLine(cmd)
+	fmt.Fprintf(&header, "Full Command: %s %s\n", program, strings.Join(args, " "))
+	if cmd.Stdin != nil {
+		if cmd.Stdin.File != "" {
+			fmt.Fprintf(&header, "Standard Input: %s\n", cmd.Stdin.File)
 		} else {
-			resultMsg.WriteString(fmt.Sprintf("Error: %v", err))
+			fmt.Fprintf(&header, "Standard Input: inline text\n")
 		}
-	} else {
-		resultMsg.WriteString(fmt.Sprintf("✅ Command **%s** completed successfully (took %s)\n", cmd.Name, durationStr))
-		if stdout.Len() > 0 {
-			outText := stdout.String()
-			// Truncate if too long
-			if len(outText) > 1500 {
-				outText = outText[:1500] + "... (truncated)"
+	}
+	if cmd.Timeout > 0 {
+		fmt.Fprintf(&header, "Timeout: %s\n", cmd.Timeout)
+	}
+	if maxAttempts > 1 {
+		fmt.Fprintf(&header, "Attempt: %d of %d\n", number, maxAttempts)
+	}
+	fmt.Fprintf(&header, "==================================================\n\n")
+	io.WriteString(logWriter, redactor.String(header.String()))
+
+	// Execute the command, with the secret references resolved only now so
+	// that they don't appear in logs and history. Fake runs don't need them.
+	resolved, err := cmd, error(nil)
+	if !r.Simulating() {
+		resolved, err = r.resolveSecrets(cmd)
+	}
+	switch {
+	case r.Simulating():
+		result.outputs, result.err = r.runSimulated(ctx, cmd, stdout, stderr)
+	case err != nil:
+		result.err = fmt.Errorf("%w: %w", ErrSpawn, err)
+	case cmd.Type == config.CommandTypeDocker:
+		result.err = r.runDocker(ctx, resolved, stdout, stderr)
+	case cmd.Type == config.CommandTypeK8s:
+		result.rollouts, result.err = r.runK8s(ctx, resolved, stdout)
+	case cmd.Remote():
+		result.remotes, result.err = r.runRemotes(ctx, resolved, stdout, stderr)
+	default:
+		// Local programs and scripts may write outputs to a file
+		var outputFile string
+		if cmd.Type != config.CommandTypeCompose {
+			if outputFile, err = createOutputFile(&resolved); err != nil {
+				result.err = fmt.Errorf("%w: %w", ErrSpawn, err)
+				break
 			}
-			resultMsg.WriteString(fmt.Sprintf("```\n%s\n```", outText))
 		}
+		result.err = r.runExec(ctx, resolved, stdout, stderr)
+		if outputFile != "" {
+			result.outputs = readOutputFile(outputFile, logWriter)
+		}
+	}
+	for _, w := range normalized {
+		w.Flush()
+	}
+	for _, w := range redacted {
+		w.Flush()
 	}
+	result.timedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	result.quotaExceeded = quota.Exceeded()
+	r.classify(result, logWriter)
+	if structured {
+		streams.Exit(exitCode(result.err))
+	}
+
+	// Log completion status
+	var footer strings.Builder
+	fmt.Fprintf(&footer, "\n\n==================================================\n")
+	if result.timedOut {
+		fmt.Fprintf(&footer, "Command timed out after %s and was killed\n", cmd.Timeout)
+	} else if result.quotaExceeded != "" {
+		fmt.Fprintf(&footer, "Command exceeded its quota (%s) and was killed\n", result.quotaExceeded)
+	} else if result.err != nil {
+		fmt.Fprintf(&footer, "Command failed with error: %v\n", result.err)
+	} else {
+		fmt.Fprintf(&footer, "Command completed successfully\n")
+	}
+	fmt.Fprintf(&footer, "==================================================\n\n")
+	io.WriteString(logWriter, footer.String())
 
-	// Add log file info to result
-	logPath := r.logger.GetLogPath(cmd.Name)
-	resultMsg.WriteString(fmt.Sprintf("\n📄 Log file: `%s`", logPath))
+	return result
+}
 
-	// Send result to Discord
-	if err := r.discord.SendMessage(resultMsg.String()); err != nil {
-		return fmt.Errorf("failed to send result message: %w", err)
+// runExec runs the program of a command of type exec, or the docker CLI for
+// a command of type compose
+func (r *Runner) runExec(ctx context.Context, cmd config.Command, stdout, stderr io.Writer) error {
+	if cmd.Type == config.CommandTypeCompose {
+		if err := docker.ValidateCompose(cmd.Compose); err != nil {
+			return err
+		}
 	}
 
+	program, args := r.commandLine(cmd)
+	command := exec.CommandContext(ctx, program, args...)
+	// Run in a separate process group so that the children (e.g. of docker
+	// compose) receive the forwarded signals and are killed on timeout
+	setProcessGroup(command)
+	command.Cancel = func() error {
+		return signalGroup(command, os.Kill)
+	}
+	// Don't wait forever on children that keep the output pipes open after a kill
+	command.WaitDelay = 5 * time.Second
+
+	command.Dir = r.commandDir(cmd)
+	if command.Dir != "" {
+		// Report a missing directory rather than the failure to change to it
+		if err := config.CheckDirectory(command.Dir); err != nil {
+			return fmt.Errorf("%w: working directory: %w", ErrSpawn, err)
+		}
+	}
+
+	// Set Docker host and environment variables if specified
+	env := r.commandEnv(cmd)
+	if len(env) > 0 {
+		command.Env = append(os.Environ(), env...)
+	}
+
+	stdin, err := openStdin(cmd)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSpawn, err)
+	}
+	if stdin != nil {
+		defer stdin.Close()
+		command.Stdin = stdin
+	}
+	command.Stdout = stdout
+	command.Stderr = stderr
+	if err := r.start(command); err != nil {
+		if errors.Is(err, ErrStopping) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", ErrSpawn, err)
+	}
+	return r.wait(command)
+}
+
+// runRemote runs the program or shell script of a command on its host over
+// SSH. The remote command is killed with the context, and receives the
+// signals forwarded by Signal.
+func (r *Runner) runRemote(ctx context.Context, cmd config.Command, stdout, stderr io.Writer) error {
+	if r.remote == nil {
+		return fmt.Errorf("%w: SSH is not configured", ErrSpawn)
+	}
+	target, err := r.remote.Target(cmd.Host)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSpawn, err)
+	}
+	if r.Stopping() {
+		return ErrStopping
+	}
+
+	stdin, err := openStdin(cmd)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSpawn, err)
+	}
+	if stdin != nil {
+		defer stdin.Close()
+	}
+
+	program, args := r.commandLine(cmd)
+	session, err := r.remote.Start(target, remote.CommandLine(cmd.Dir, cmd.EnvVars, program, args), stdin, stdout, stderr)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSpawn, err)
+	}
+
+	// Track the session like a local process, unless a signal was received
+	// while connecting
+	r.mu.Lock()
+	if r.stopping {
+		r.mu.Unlock()
+		session.Kill()
+		return ErrStopping
+	}
+	r.sessions[session] = struct{}{}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Kill()
+		case <-done:
+		}
+	}()
+	err = session.Wait()
+	close(done)
+
+	r.mu.Lock()
+	delete(r.sessions, session)
+	r.mu.Unlock()
 	return err
 }
 
+// openStdin opens the standard input of a command, nil without one. Each
+// attempt and each remote host reads it from the start.
+func openStdin(cmd config.Command) (io.ReadCloser, error) {
+	switch {
+	case cmd.Stdin == nil:
+		return nil, nil
+	case cmd.Stdin.File != "":
+		file, err := os.Open(cmd.Stdin.File)
+		if err != nil {
+			return nil, fmt.Errorf("standard input: %w", err)
+		}
+		return file, nil
+	default:
+		return io.NopCloser(strings.NewReader(cmd.Stdin.Text)), nil
+	}
+}
+
+// runDocker performs the action of a command of type docker through the
+// Docker Engine API
+func (r *Runner) runDocker(ctx context.Context, cmd config.Command, stdout, stderr io.Writer) error {
+	client, err := docker.NewClient(r.dockerHost)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSpawn, err)
+	}
+	defer client.Close()
+	return client.Run(ctx, cmd.Docker, cmd.EnvVars, stdout, stderr)
+}
+
+// runK8s performs the action of a command of type k8s through the
+// Kubernetes API, and returns the state of the rollouts it waited for
+func (r *Runner) runK8s(ctx context.Context, cmd config.Command, stdout io.Writer) ([]notifier.RolloutStatus, error) {
+	client, err := k8s.NewClient(cmd.K8s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSpawn, err)
+	}
+	rollouts, err := client.Run(ctx, cmd.K8s, r.commandDir(cmd), stdout)
+	statuses := make([]notifier.RolloutStatus, 0, len(rollouts))
+	for _, rollout := range rollouts {
+		statuses = append(statuses, notifier.RolloutStatus{Name: rollout.Name, Ready: rollout.Ready, State: rollout.State})
+	}
+	return statuses, err
+}
+
+// commandLine returns the program and arguments of a command. Commands of
+// type docker and k8s are described by the equivalent docker and kubectl CLI
+// arguments.
+func (r *Runner) commandLine(cmd config.Command) (string, []string) {
+	switch cmd.Type {
+	case config.CommandTypeDocker:
+		return "docker", docker.CommandLine(cmd.Docker)
+	case config.CommandTypeCompose:
+		return "docker", docker.ComposeArgs(cmd.Compose)
+	case config.CommandTypeK8s:
+		return "kubectl", k8s.CommandLine(cmd.K8s)
+	}
+	if cmd.Shell != "" {
+		interpreter := cmd.Interpreter
+		if interpreter == "" {
+			interpreter = r.interpreter
+		}
+		if interpreter == "" {
+			interpreter = "sh"
+		}
+		return interpreter, []string{"-c", cmd.Shell}
+	}
+	return cmd.Command, cmd.Args
+}
+
+// composeServices returns the state of the services of the project of a
+// compose command, or nil when it can't be retrieved
+func (r *Runner) composeServices(cmd config.Command, logWriter io.Writer) []notifier.ServiceStatus {
+	if cmd.Compose == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	command := exec.CommandContext(ctx, "docker", docker.ComposeStatusArgs(cmd.Compose)...)
+	command.Dir = r.commandDir(cmd)
+	if env := r.commandEnv(cmd); len(env) > 0 {
+		command.Env = append(os.Environ(), env...)
+	}
+	output, err := command.Output()
+	if err != nil {
+		fmt.Fprintf(logWriter, "Failed to get the state of the compose services: %v\n", err)
+		return nil
+	}
+	services, err := docker.ParseComposeStatus(output)
+	if err != nil {
+		fmt.Fprintf(logWriter, "%v\n", err)
+		return nil
+	}
+
+	statuses := make([]notifier.ServiceStatus, 0, len(services))
+	var report strings.Builder
+	report.WriteString("Services:\n")
+	for _, service := range services {
+		statuses = append(statuses, notifier.ServiceStatus{Name: service.Service, State: service.State, Health: service.Health})
+		fmt.Fprintf(&report, "  %s: %s %s\n", service.Service, service.State, service.Health)
+	}
+	io.WriteString(logWriter, report.String())
+	return statuses
+}
+
+// Preflight runs the pre-flight checks and reports failures to the notifiers. The
+// returned release function must be called once the commands have run.
+func (r *Runner) Preflight(cfg *config.PreflightConfig) (func(), error) {
+	release, err := preflight.Check(cfg, r.workingDir, r.dockerHost)
+	if err != nil {
+		var pfErr *preflight.Error
+		msg := i18n.T("🛑 Pre-flight failed, no command was run\n%v", err)
+		if errors.As(err, &pfErr) {
+			msg = i18n.T("🛑 Pre-flight failed, no command was run\n%v", "- "+strings.Join(pfErr.Failures, "\n- "))
+		}
+		if sendErr := r.notifier.SendMessage(msg); sendErr != nil {
+			return release, fmt.Errorf("%w (failed to send pre-flight message: %v)", err, sendErr)
+		}
+		return release, err
+	}
+	return release, nil
+}
+
 // ExecuteAll runs all commands in sequence
 func (r *Runner) ExecuteAll(commands []config.Command) error {
 	for _, cmd := range commands {
-		err := r.Execute(cmd)
-		if err != nil {
+		_, err := r.Execute(cmd)
+		if err != nil && !errors.Is(err, ErrSkipped) {
 			return fmt.Errorf("command '%s' failed: %w", cmd.Name, err)
 		}
 	}
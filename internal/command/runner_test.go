@@ -0,0 +1,163 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/notifier"
+)
+
+// bufferLogger keeps the run logs of the tests in memory
+type bufferLogger struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	// written is sent the lines containing watch, when set
+	watch   string
+	written chan string
+}
+
+func (l *bufferLogger) OpenRun(string) (io.WriteCloser, string) {
+	return nopCloser{l}, ""
+}
+
+func (l *bufferLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	l.buf.Write(p)
+	l.mu.Unlock()
+	if l.watch != "" && bytes.Contains(p, []byte(l.watch)) {
+		l.written <- string(p)
+	}
+	return len(p), nil
+}
+
+func (l *bufferLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
+
+// newLoggedRunner returns a runner writing its run logs to logs
+func newLoggedRunner(t *testing.T, logs *bufferLogger) *Runner {
+	t.Helper()
+	return NewRunner(&testNotifier{}, logs, t.TempDir(), "")
+}
+
+// TestRunnerRetries checks the number of attempts of the failing commands
+func TestRunnerRetries(t *testing.T) {
+	// succeedAt fails until its attempt number, counted in a file
+	succeedAt := func(n int) string {
+		return `n=$(($(cat attempts 2>/dev/null || echo 0) + 1)); echo $n > attempts; [ $n -ge ` + strconv.Itoa(n) + ` ]`
+	}
+	tests := []struct {
+		name     string
+		cmd      config.Command
+		attempts int
+		status   notifier.Status
+	}{
+		{"success", config.Command{Shell: "true", Retries: 2}, 1, notifier.StatusSuccess},
+		{"failure without retries", config.Command{Shell: "false"}, 1, notifier.StatusFailure},
+		{"failure with retries", config.Command{Shell: "false", Retries: 2}, 3, notifier.StatusFailure},
+		{"success on a retry", config.Command{Shell: succeedAt(2), Retries: 3}, 2, notifier.StatusSuccess},
+		{"success on the last retry", config.Command{Shell: succeedAt(3), Retries: 2}, 3, notifier.StatusSuccess},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newLoggedRunner(t, &bufferLogger{})
+			tt.cmd.Name = "flaky"
+			result, err := r.Execute(tt.cmd)
+			if result.Attempts != tt.attempts {
+				t.Errorf("%d attempts, want %d", result.Attempts, tt.attempts)
+			}
+			if result.Status != tt.status {
+				t.Errorf("status %s, want %s", result.Status, tt.status)
+			}
+			if (err == nil) != (tt.status == notifier.StatusSuccess) {
+				t.Errorf("Execute returned %v", err)
+			}
+			if tt.attempts > 1 && err != nil && !strings.Contains(err.Error(), fmt.Sprintf("failed after %d attempts", tt.attempts)) {
+				t.Errorf("Execute returned %v, want the number of attempts", err)
+			}
+		})
+	}
+}
+
+// TestRunnerRetryBackoff checks that the delay between the attempts grows
+// with the backoff
+func TestRunnerRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff float64
+		delays  []string
+	}{
+		{"no backoff", 0, []string{"10ms", "10ms", "10ms"}},
+		{"constant", 1, []string{"10ms", "10ms", "10ms"}},
+		{"doubling", 2, []string{"10ms", "20ms", "40ms"}},
+		{"fractional", 1.5, []string{"10ms", "15ms", "22.5ms"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := &bufferLogger{}
+			r := newLoggedRunner(t, logs)
+			cmd := config.Command{
+				Name:         "flaky",
+				Shell:        "false",
+				Retries:      3,
+				RetryDelay:   config.Duration(10 * time.Millisecond),
+				RetryBackoff: tt.backoff,
+			}
+			if _, err := r.Execute(cmd); err == nil {
+				t.Fatalf("Execute of a failing command succeeded")
+			}
+
+			var delays []string
+			for _, line := range strings.Split(logs.String(), "\n") {
+				if rest, ok := strings.CutPrefix(line, "Retrying in "); ok {
+					delays = append(delays, strings.Fields(rest)[0])
+				}
+			}
+			if strings.Join(delays, " ") != strings.Join(tt.delays, " ") {
+				t.Errorf("retried after %v, want %v", delays, tt.delays)
+			}
+		})
+	}
+}
+
+// TestRunnerRetryStopping checks that the retries are abandoned when delivr
+// starts stopping during their delay
+func TestRunnerRetryStopping(t *testing.T) {
+	logs := &bufferLogger{watch: "Retrying in", written: make(chan string, 1)}
+	r := newLoggedRunner(t, logs)
+	cmd := config.Command{
+		Name:       "flaky",
+		Shell:      "false",
+		Retries:    3,
+		RetryDelay: config.Duration(time.Hour),
+	}
+
+	go func() {
+		<-logs.written
+		r.Signal(syscall.SIGTERM)
+	}()
+	start := time.Now()
+	result, err := r.Execute(cmd)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Execute took %s, the retry delay wasn't interrupted", elapsed)
+	}
+	if err == nil {
+		t.Fatalf("Execute of a failing command succeeded")
+	}
+	if result.Attempts != 1 {
+		t.Errorf("%d attempts, want 1", result.Attempts)
+	}
+	if !strings.Contains(logs.String(), "Retry abandoned, delivr is stopping") {
+		t.Errorf("the log doesn't tell the retry was abandoned:\n%s", logs.String())
+	}
+}
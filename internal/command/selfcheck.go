@@ -0,0 +1,98 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/k8s"
+	"github.com/ndious/delivr/internal/preflight"
+)
+
+// SelfCheck checks that the commands can be started, so that a missing
+// program is reported at startup rather than when a scheduled run fails: the
+// program or shell interpreter of each command and of its hooks must resolve,
+// the Docker daemon must answer for the docker and compose commands, and the
+// Kubernetes configuration must load for the k8s commands. The programs of
+// remote commands aren't checked. It returns a problem per line, prefixed
+// with the name of the command.
+func (r *Runner) SelfCheck(commands []config.Command) []string {
+	var problems []string
+	var dockerErr error
+	dockerChecked := false
+	report := func(cmd config.Command, err error) {
+		problems = append(problems, fmt.Sprintf("%s: %v", cmd.Name, err))
+	}
+
+	for _, cmd := range commands {
+		switch cmd.Type {
+		case config.CommandTypeDocker, config.CommandTypeCompose:
+			if !dockerChecked {
+				dockerErr, dockerChecked = preflight.PingDocker(r.dockerHost), true
+			}
+			if dockerErr != nil {
+				report(cmd, fmt.Errorf("the Docker daemon is unreachable: %w", dockerErr))
+			}
+			if cmd.Type == config.CommandTypeCompose {
+				if err := checkProgram("docker", ""); err != nil {
+					report(cmd, err)
+				}
+			}
+		case config.CommandTypeK8s:
+			if _, err := k8s.NewClient(cmd.K8s); err != nil {
+				report(cmd, err)
+			}
+		default:
+			if !cmd.Remote() {
+				program, _ := r.commandLine(cmd)
+				if err := checkProgram(program, r.commandDir(cmd)); err != nil {
+					report(cmd, err)
+				}
+			}
+		}
+
+		// The hooks of the commands run on several hosts run locally
+		if len(cmd.RemoteHosts(r.hostGroups)) == 1 {
+			continue
+		}
+		for _, hook := range append(append([]config.Hook{}, cmd.PreHooks...), cmd.PostHooks...) {
+			hookCmd := config.Command{Command: hook.Command, Args: hook.Args, Shell: hook.Shell, Interpreter: cmd.Interpreter}
+			program, _ := r.commandLine(hookCmd)
+			if err := checkProgram(program, r.commandDir(cmd)); err != nil {
+				report(cmd, fmt.Errorf("hook: %w", err))
+			}
+		}
+	}
+	return problems
+}
+
+// checkProgram checks that a program can be executed: a program given by name
+// must be found in PATH, and a path, relative to the working directory dir,
+// must be an executable file
+func checkProgram(program, dir string) error {
+	if program == "" {
+		return errors.New("no program to run")
+	}
+	if !strings.ContainsRune(program, filepath.Separator) {
+		if _, err := exec.LookPath(program); err != nil {
+			return fmt.Errorf("program '%s' not found in PATH", program)
+		}
+		return nil
+	}
+	path := program
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("program '%s' not found", program)
+	}
+	if info.IsDir() || info.Mode()&0o111 == 0 {
+		return fmt.Errorf("program '%s' is not executable", program)
+	}
+	return nil
+}
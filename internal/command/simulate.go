@@ -0,0 +1,98 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// defaultSlowDuration is the duration of the slow simulated runs without one
+const defaultSlowDuration = time.Minute
+
+// simulatedExit is the error of a failed simulated run, carrying its exit code
+type simulatedExit struct {
+	code int
+}
+
+func (e simulatedExit) Error() string {
+	return fmt.Sprintf("exit status %d (simulated)", e.code)
+}
+
+// ExitCode returns the exit code of the simulated run
+func (e simulatedExit) ExitCode() int {
+	return e.code
+}
+
+// SetSimulation replaces the commands with fake runs, whose outcome is that
+// of their simulate setting or the given default one. The hooks and
+// conditions of the commands aren't run either.
+func (r *Runner) SetSimulation(defaults *config.SimulateConfig) {
+	if defaults == nil {
+		defaults = &config.SimulateConfig{}
+	}
+	r.simulation = defaults
+}
+
+// Simulating reports whether the commands are replaced with fake runs
+func (r *Runner) Simulating() bool {
+	return r.simulation != nil
+}
+
+// runSimulated fakes a run of the command: it waits for the duration of its
+// outcome, prints its output and fails when the outcome is fail. The run is
+// interrupted by the timeout of the command and when delivr is stopping.
+func (r *Runner) runSimulated(ctx context.Context, cmd config.Command, stdout, stderr io.Writer) (map[string]string, error) {
+	sim := cmd.Simulate
+	if sim == nil {
+		sim = r.simulation
+	}
+	duration := sim.Duration.Std()
+	if duration == 0 && sim.Outcome == config.SimulateSlow {
+		duration = defaultSlowDuration
+	}
+
+	fmt.Fprintf(stdout, "Simulated run of %s: %s after %s\n", cmd.Name, outcomeName(sim.Outcome), duration)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(duration)
+wait:
+	for {
+		select {
+		case <-deadline:
+			break wait
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+			if r.Stopping() {
+				return nil, ErrStopping
+			}
+		}
+	}
+
+	if sim.Outcome == config.SimulateFail {
+		if sim.Output != "" {
+			fmt.Fprintln(stderr, sim.Output)
+		}
+		code := sim.ExitCode
+		if code == 0 {
+			code = 1
+		}
+		return nil, simulatedExit{code: code}
+	}
+	if sim.Output != "" {
+		fmt.Fprintln(stdout, sim.Output)
+	}
+	return maps.Clone(sim.Outputs), nil
+}
+
+// outcomeName returns the name of a simulated outcome, success by default
+func outcomeName(outcome string) string {
+	if outcome == "" {
+		return config.SimulateSuccess
+	}
+	return outcome
+}
@@ -0,0 +1,62 @@
+package command
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/history"
+)
+
+// maskedValue replaces secrets in recorded command lines
+const maskedValue = "****"
+
+// secretNamePattern matches flag and variable names that usually hold secrets
+var secretNamePattern = regexp.MustCompile(`(?i)(pass|secret|token|api[-_]?key|credential|auth)`)
+
+// snapshot records what exactly runs for a command, with secrets masked
+func (r *Runner) snapshot(cmd config.Command) history.Environment {
+	env := r.commandEnv(cmd)
+	names := make([]string, 0, len(env))
+	for _, entry := range env {
+		name, _, _ := strings.Cut(entry, "=")
+		names = append(names, name)
+	}
+
+	program, args := r.commandLine(cmd)
+	return history.Environment{
+		CommandLine: strings.Join(append([]string{program}, maskArgs(args)...), " "),
+		EnvVars:     names,
+		WorkingDir:  r.commandDir(cmd),
+	}
+}
+
+// maskArgs hides the values of arguments that look like secrets: values of
+// secret-like flags, secret-like key=value pairs and URL passwords
+func maskArgs(args []string) []string {
+	masked := make([]string, len(args))
+	for i, arg := range args {
+		masked[i] = maskArg(arg)
+
+		// Value of the previous flag, e.g. --password xxx
+		if i > 0 && strings.HasPrefix(args[i-1], "-") && !strings.Contains(args[i-1], "=") &&
+			secretNamePattern.MatchString(args[i-1]) && !strings.HasPrefix(arg, "-") {
+			masked[i] = maskedValue
+		}
+	}
+	return masked
+}
+
+// maskArg hides the secret part of a single argument
+func maskArg(arg string) string {
+	if name, _, ok := strings.Cut(arg, "="); ok && secretNamePattern.MatchString(name) {
+		return name + "=" + maskedValue
+	}
+	if u, err := url.Parse(arg); err == nil && u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			return u.Redacted()
+		}
+	}
+	return arg
+}
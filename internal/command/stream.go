@@ -0,0 +1,154 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/notifier"
+)
+
+const (
+	// streamInterval is the default delay between two updates of the live
+	// output
+	streamInterval = 5 * time.Second
+	// streamTailSize is the number of output bytes shown in the live output,
+	// small enough to fit a Discord message
+	streamTailSize = 1700
+)
+
+// tailBuffer keeps the last bytes written to it. It is safe for concurrent use.
+type tailBuffer struct {
+	mu      sync.Mutex
+	data    []byte
+	size    int
+	version int
+}
+
+// Write appends data, dropping the oldest bytes beyond the buffer size
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.data = append(t.data, p...)
+	if len(t.data) > t.size {
+		t.data = append([]byte(nil), t.data[len(t.data)-t.size:]...)
+	}
+	t.version++
+	return len(p), nil
+}
+
+// snapshot returns the buffered data and a counter incremented on each write
+func (t *tailBuffer) snapshot() (string, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.data), t.version
+}
+
+// liveOutput periodically publishes the output of a running command
+type liveOutput struct {
+	stream   notifier.Stream
+	tail     *tailBuffer
+	name     string
+	start    time.Time
+	interval time.Duration
+	// maxEdits bounds the updates of the run, the final one included, when
+	// positive
+	maxEdits int
+	edits    int
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// startLiveOutput starts streaming the command output if one of the
+// notifiers supports it, and returns nil otherwise. throttle, which may be
+// nil, limits the updates.
+func startLiveOutput(n Notifier, name string, throttle *config.StreamThrottle) *liveOutput {
+	streamer, ok := n.(notifier.Streamer)
+	if !ok {
+		return nil
+	}
+	stream, err := streamer.StartStream()
+	if err != nil {
+		log.Printf("Warning: Could not start live output for '%s': %v", name, err)
+	}
+	if stream == nil {
+		return nil
+	}
+
+	l := &liveOutput{
+		stream:   stream,
+		tail:     &tailBuffer{size: streamTailSize},
+		name:     name,
+		start:    time.Now(),
+		interval: streamInterval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if throttle != nil {
+		if throttle.MinInterval > 0 {
+			l.interval = throttle.MinInterval.Std()
+		}
+		l.maxEdits = throttle.MaxEdits
+	}
+	go l.run()
+	return l
+}
+
+// run publishes the output whenever it changed since the last update, until
+// only the final update is left
+func (l *liveOutput) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	lastVersion := 0
+	for {
+		select {
+		case <-ticker.C:
+			if l.maxEdits > 0 && l.edits >= l.maxEdits-1 {
+				continue
+			}
+			output, version := l.tail.snapshot()
+			if version == lastVersion {
+				continue
+			}
+			lastVersion = version
+			status := i18n.T("⏳ **%s** running for %s", l.name, time.Since(l.start).Round(time.Second))
+			if l.maxEdits > 0 && l.edits == l.maxEdits-2 {
+				status += ", live updates paused until it finishes"
+			}
+			l.publish(status, output)
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// publish updates the stream with a status line and the output tail
+func (l *liveOutput) publish(status, output string) {
+	content := status
+	if output != "" {
+		content += fmt.Sprintf("\n```\n%s\n```", output)
+	}
+	l.edits++
+	if err := l.stream.Update(content); err != nil {
+		log.Printf("Warning: Could not update live output for '%s': %v", l.name, err)
+	}
+}
+
+// finish stops the updates and publishes the final output
+func (l *liveOutput) finish() {
+	close(l.stop)
+	<-l.done
+
+	output, version := l.tail.snapshot()
+	if version > 0 {
+		l.publish(i18n.T("⏹️ **%s** finished after %s", l.name, time.Since(l.start).Round(time.Second)), output)
+	}
+	if err := l.stream.Close(); err != nil {
+		log.Printf("Warning: Could not close live output for '%s': %v", l.name, err)
+	}
+}
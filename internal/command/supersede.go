@@ -0,0 +1,68 @@
+package command
+
+import (
+	"log"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/history"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/notifier"
+)
+
+// supersede deletes or collapses the status message of the previous run of a
+// monitor-style command once a new run posted its own. The previous message
+// is kept when its run changed the status of the command, so that the
+// channel shows the latest state of each command and the transitions.
+func (r *Runner) supersede(cmd config.Command, step history.Step) {
+	if cmd.Supersede == "" || r.history == nil || len(step.Messages) == 0 {
+		return
+	}
+	editor, ok := r.notifier.(notifier.MessageEditor)
+	if !ok {
+		return
+	}
+
+	previous, err := r.history.CommandSteps(cmd.Name, 2)
+	if err != nil {
+		log.Printf("Warning: Could not read the previous runs of '%s': %v", cmd.Name, err)
+		return
+	}
+	if len(previous) < 2 || previous[0].Status != previous[1].Status {
+		return
+	}
+	last := previous[0]
+
+	// The status message is the first one of the run, in the channel. The
+	// other messages of the run are in its thread, unless it couldn't be
+	// created.
+	var status *history.Message
+	for i, msg := range last.Messages {
+		if msg.Kind == notifier.MessageText {
+			status = &last.Messages[i]
+			break
+		}
+	}
+	if status == nil {
+		return
+	}
+	for _, msg := range last.Messages {
+		if msg.ChannelID != status.ChannelID {
+			continue
+		}
+		receipt := notifier.Receipt{Notifier: msg.Notifier, Kind: msg.Kind, ChannelID: msg.ChannelID, MessageID: msg.MessageID}
+		if cmd.Supersede == config.SupersedeCollapse && msg.MessageID == status.MessageID {
+			err = editor.EditSent(receipt, collapsedStatus(last))
+		} else {
+			err = editor.DeleteSent(receipt)
+		}
+		if err != nil {
+			log.Printf("Warning: Could not clean up the superseded message of '%s': %v", cmd.Name, err)
+		}
+	}
+}
+
+// collapsedStatus is the one-line summary replacing a superseded status
+// message, in the small text of Discord
+func collapsedStatus(step history.Step) string {
+	return i18n.T("-# %s %s: %s, superseded by a later run", notifier.StatusIcon(notifier.Status(step.Status)), step.Name, notifier.Status(step.Status).Label())
+}
@@ -2,26 +2,340 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the main configuration structure
 type Config struct {
-	Discord    DiscordConfig `json:"discord" yaml:"discord"`
-	Docker     *DockerConfig `json:"docker,omitempty" yaml:"docker,omitempty"`
-	Logs       *LogConfig    `json:"logs,omitempty" yaml:"logs,omitempty"`
-	Commands   []Command     `json:"commands" yaml:"commands"`
-	WorkingDir string        `json:"workingDir,omitempty" yaml:"workingDir,omitempty"`
+	Version       string               `json:"version,omitempty" yaml:"version,omitempty"` // Version of the configuration, shown in notifications
+	Discord       DiscordConfig        `json:"discord,omitempty" yaml:"discord,omitempty"`
+	Docker        *DockerConfig        `json:"docker,omitempty" yaml:"docker,omitempty"`
+	Logs          *LogConfig           `json:"logs,omitempty" yaml:"logs,omitempty"`
+	Commands      []Command            `json:"commands" yaml:"commands"`
+	WorkingDir    string               `json:"workingDir,omitempty" yaml:"workingDir,omitempty"`
+	Server        *ServerConfig        `json:"server,omitempty" yaml:"server,omitempty"`
+	ImageUpdates  []ImageUpdate        `json:"imageUpdates,omitempty" yaml:"imageUpdates,omitempty"`
+	GitPushes     []GitPush            `json:"gitPushes,omitempty" yaml:"gitPushes,omitempty"`
+	ImagePolls    []ImagePoll          `json:"imagePolls,omitempty" yaml:"imagePolls,omitempty"`
+	Preflight     *PreflightConfig     `json:"preflight,omitempty" yaml:"preflight,omitempty"`
+	Notifications *NotificationsConfig `json:"notifications,omitempty" yaml:"notifications,omitempty"`
+	History       *HistoryConfig       `json:"history,omitempty" yaml:"history,omitempty"`
+	// Secrets are referenced as secret://<name> in commands and resolved when
+	// the commands run
+	Secrets   map[string]SecretConfig `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+	Redaction *RedactionConfig        `json:"redaction,omitempty" yaml:"redaction,omitempty"`
+	Host      *HostConfig             `json:"host,omitempty" yaml:"host,omitempty"`
+	// Language of the built-in messages of the notifications: en (default)
+	// or fr
+	Language string `json:"language,omitempty" yaml:"language,omitempty"`
+	// StrictEnv makes loading fail when a ${VAR} reference has no value
+	StrictEnv bool `json:"strictEnv,omitempty" yaml:"strictEnv,omitempty"`
+	// Reports are summaries of the history posted on a schedule in daemon mode
+	Reports []ReportConfig `json:"reports,omitempty" yaml:"reports,omitempty"`
+	// Freezes are the periods during which protected commands only run when
+	// forced
+	Freezes *FreezeConfig `json:"freezes,omitempty" yaml:"freezes,omitempty"`
+	// Workflows promote the same commands through environments, e.g.
+	// staging then production, as one release
+	Workflows []Workflow `json:"workflows,omitempty" yaml:"workflows,omitempty"`
+	// Pipelines are named lists of commands, run with "delivr run <name>" and
+	// usable wherever command names are expected
+	Pipelines map[string][]string `json:"pipelines,omitempty" yaml:"pipelines,omitempty"`
+	// Tagging creates a git tag after successful deployments
+	Tagging *TaggingConfig `json:"tagging,omitempty" yaml:"tagging,omitempty"`
+	// Quota is the output quota of the commands without their own
+	Quota *QuotaConfig `json:"quota,omitempty" yaml:"quota,omitempty"`
+	// Simulate is the fake outcome of the commands without their own when
+	// running with --simulate
+	Simulate *SimulateConfig `json:"simulate,omitempty" yaml:"simulate,omitempty"`
+	// Interpreter is the shell running the shell scripts of the commands
+	// without their own, sh by default
+	Interpreter string `json:"interpreter,omitempty" yaml:"interpreter,omitempty"`
+
+	// FailurePolicy is what a failed command does to the next commands of a
+	// pipeline, for the commands without their own: stop, continue or
+	// continue-but-mark
+	FailurePolicy string `json:"failurePolicy,omitempty" yaml:"failurePolicy,omitempty"`
+	// ANSI is what happens to the ANSI escape sequences and the control
+	// characters of the output of the commands without their own, before it
+	// is logged and notified: strip (default) or keep
+	ANSI string `json:"ansi,omitempty" yaml:"ansi,omitempty"`
+	// WaitFor are the services the startup commands wait for, e.g. after a
+	// reboot: docker, network or url:<URL>, for at most WaitForTimeout
+	WaitFor        []string `json:"waitFor,omitempty" yaml:"waitFor,omitempty"`
+	WaitForTimeout Duration `json:"waitForTimeout,omitempty" yaml:"waitForTimeout,omitempty"`
+	// ShutdownGracePeriod is the time the running commands have to stop
+	// after SIGINT or SIGTERM before they are killed, 30s by default
+	ShutdownGracePeriod Duration `json:"shutdownGracePeriod,omitempty" yaml:"shutdownGracePeriod,omitempty"`
+	// CaptureLimit is the output of each stream of a command kept in memory
+	// for the notifications and the outputs, its head and its tail, 1MB by
+	// default. The whole output is written to the log.
+	CaptureLimit Size `json:"captureLimit,omitempty" yaml:"captureLimit,omitempty"`
+	// Watch runs commands in daemon mode when files or directories change
+	Watch []WatchConfig `json:"watch,omitempty" yaml:"watch,omitempty"`
+	// SSH configures the connections of the commands run on remote hosts
+	SSH *SSHConfig `json:"ssh,omitempty" yaml:"ssh,omitempty"`
+	// HostGroups are named lists of remote hosts, usable wherever the remote
+	// host of a command is expected
+	HostGroups map[string][]string `json:"hostGroups,omitempty" yaml:"hostGroups,omitempty"`
+	// Vars are substituted for the {{ .vars.NAME }} references of the
+	// commands, overridden by the variables of the environment selected
+	// with --env
+	Vars         map[string]string      `json:"vars,omitempty" yaml:"vars,omitempty"`
+	Environments map[string]Environment `json:"environments,omitempty" yaml:"environments,omitempty"`
+	// Include lists the files, directories and glob patterns, relative to
+	// the configuration file, whose commands, pipelines, host groups, secrets
+	// and variables are merged into the configuration
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+
+	// environment is the name of the environment applied when loading
+	environment string
+	// includedFiles are the paths of the files merged by Include
+	includedFiles []string
+	// otherHosts are the names of the commands removed by ScopeToHost
+	otherHosts map[string]bool
+	// decrypted are the plain values of the encrypted values
+	decrypted []string
+	// path is the file the configuration was loaded from, source the URL it
+	// was fetched from, empty for a local file, and hash the SHA-256 hash of
+	// the file and its included files
+	path   string
+	source string
+	hash   string
+}
+
+// TaggingConfig creates and pushes a git tag, and optionally a GitHub
+// release, with a changelog once a pipeline or a workflow succeeded
+type TaggingConfig struct {
+	After   []string             `json:"after" yaml:"after"`                         // Pipelines, commands run with "delivr run" and workflows whose success is tagged
+	Dir     string               `json:"dir,omitempty" yaml:"dir,omitempty"`         // Git repository, defaults to the working directory
+	Name    string               `json:"name,omitempty" yaml:"name,omitempty"`       // Tag name with {version}, {date} and {time}, defaults to deploy-{date}-{time}
+	Version string               `json:"version,omitempty" yaml:"version,omitempty"` // Deployed version, defaults to the short hash of HEAD
+	Push    bool                 `json:"push,omitempty" yaml:"push,omitempty"`       // Whether to push the tag
+	Remote  string               `json:"remote,omitempty" yaml:"remote,omitempty"`   // Remote the tag is pushed to, defaults to origin
+	GitHub  *GitHubReleaseConfig `json:"github,omitempty" yaml:"github,omitempty"`
+}
+
+// GitHubReleaseConfig creates a GitHub release for the pushed tags
+type GitHubReleaseConfig struct {
+	Repository string `json:"repository" yaml:"repository"` // owner/name
+	Token      string `json:"token" yaml:"token"`
+}
+
+// Workflow runs a pipeline once per stage, in order, each stage waiting for
+// the previous one to succeed and, when required, for an approval
+type Workflow struct {
+	Name     string   `json:"name" yaml:"name"`
+	Commands []string `json:"commands" yaml:"commands"` // Names of the commands of the pipeline, in order
+	Stages   []Stage  `json:"stages" yaml:"stages"`
+}
+
+// Stage is an environment a workflow promotes the release to
+type Stage struct {
+	Environment string   `json:"environment" yaml:"environment"`               // Name of the environment, e.g. staging
+	EnvVars     []string `json:"envVars,omitempty" yaml:"envVars,omitempty"`   // Added to the environment of the commands, e.g. TARGET=staging
+	Approval    bool     `json:"approval,omitempty" yaml:"approval,omitempty"` // Whether the stage waits for an approval once the previous one succeeded
+}
+
+// FreezeConfig lists the freeze periods, given as date ranges or as the
+// events of an iCalendar feed
+type FreezeConfig struct {
+	Periods []FreezePeriod `json:"periods,omitempty" yaml:"periods,omitempty"`
+	ICal    string         `json:"ical,omitempty" yaml:"ical,omitempty"`       // URL of an iCalendar feed whose events are freeze periods
+	Refresh Duration       `json:"refresh,omitempty" yaml:"refresh,omitempty"` // Delay between two downloads of the feed, defaults to 1h
+}
+
+// FreezePeriod is a date range during which protected commands are frozen
+type FreezePeriod struct {
+	From   string `json:"from" yaml:"from"`                         // First day as YYYY-MM-DD, or an RFC 3339 time
+	To     string `json:"to" yaml:"to"`                             // Last day as YYYY-MM-DD (included), or an RFC 3339 time
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"` // Shown in the rejection messages
+}
+
+// ReportConfig schedules a summary of the runs of the previous period
+type ReportConfig struct {
+	Period string `json:"period" yaml:"period"`               // weekly (on Mondays) or monthly (on the 1st)
+	At     string `json:"at,omitempty" yaml:"at,omitempty"`   // Time of day as HH:MM, defaults to 09:00
+	Top    int    `json:"top,omitempty" yaml:"top,omitempty"` // Number of flaky commands listed, defaults to 5
 }
 
 // DiscordConfig holds Discord integration settings
 type DiscordConfig struct {
-	ChannelID string `json:"channelId" yaml:"channelId"`
+	ChannelID string            `json:"channelId" yaml:"channelId"`                     // Webhook URL
+	Bot       *DiscordBotConfig `json:"bot,omitempty" yaml:"bot,omitempty"`             // Bot mode, used instead of the webhook when set
+	Format    string            `json:"format,omitempty" yaml:"format,omitempty"`       // Result message format: compact, normal or verbose
+	AttachLog string            `json:"attachLog,omitempty" yaml:"attachLog,omitempty"` // When to attach the run log to results: failure (default), always or never
+	Style     string            `json:"style,omitempty" yaml:"style,omitempty"`         // Result message style: embed (default) or plain
+	// MaxMessages is the number of messages the output of a result is split
+	// between, 3 by default and 1 to truncate it
+	MaxMessages int `json:"maxMessages,omitempty" yaml:"maxMessages,omitempty"`
+	// Routes send the notifications of the runs of some commands to other
+	// channels, the first route matching the tags of a command applying
+	Routes []DiscordRoute `json:"routes,omitempty" yaml:"routes,omitempty"`
+	// Channels are named channels, webhook URLs or channel IDs in bot mode,
+	// that the commands send their runs to
+	Channels map[string]string `json:"channels,omitempty" yaml:"channels,omitempty"`
+	// FailureChannel is the named channel also receiving the results of the
+	// failed runs
+	FailureChannel string `json:"failureChannel,omitempty" yaml:"failureChannel,omitempty"`
+}
+
+// DiscordRoute sends the notifications of the runs of the commands having
+// one of its tags to another channel
+type DiscordRoute struct {
+	Tags      []string `json:"tags" yaml:"tags"`
+	ChannelID string   `json:"channelId" yaml:"channelId"` // Webhook URL, or ID of the channel in bot mode
+}
+
+// DiscordBotConfig holds the settings of the Discord bot mode
+type DiscordBotConfig struct {
+	Token     string `json:"token" yaml:"token"`         // Bot token
+	ChannelID string `json:"channelId" yaml:"channelId"` // ID of the channel to post in
+	// ApplicationID and PublicKey enable the /delivr slash command, received
+	// on the interactions endpoint of the HTTP server
+	ApplicationID string `json:"applicationId,omitempty" yaml:"applicationId,omitempty"`
+	PublicKey     string `json:"publicKey,omitempty" yaml:"publicKey,omitempty"`
+	// Approvers are the IDs of the users and roles allowed to approve the
+	// runs of the commands requiring an approval
+	Approvers []string `json:"approvers,omitempty" yaml:"approvers,omitempty"`
+	// ApprovalTimeout aborts the runs not approved in time, 15m by default
+	ApprovalTimeout Duration `json:"approvalTimeout,omitempty" yaml:"approvalTimeout,omitempty"`
+	// ACL restricts which users and roles may run the commands from Discord.
+	// Anyone who can use the slash command may run them when empty.
+	ACL []DiscordACLRule `json:"acl,omitempty" yaml:"acl,omitempty"`
+}
+
+// DiscordACLRule allows Discord users and roles to run some commands from
+// Discord
+type DiscordACLRule struct {
+	// Commands are names of commands or pipelines, "*" matching all of them
+	Commands []string `json:"commands,omitempty" yaml:"commands,omitempty"`
+	// Tags match the commands having one of them
+	Tags  []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Users []string `json:"users,omitempty" yaml:"users,omitempty"` // IDs of the allowed users
+	Roles []string `json:"roles,omitempty" yaml:"roles,omitempty"` // IDs of the allowed roles
+}
+
+// Matches reports whether the rule applies to a command, requested by name
+// or through the pipeline named name
+func (r DiscordACLRule) Matches(name string, cmd Command) bool {
+	for _, allowed := range r.Commands {
+		if allowed == "*" || allowed == cmd.Name || (name != "" && allowed == name) {
+			return true
+		}
+	}
+	for _, tag := range r.Tags {
+		for _, cmdTag := range cmd.Tags {
+			if tag == cmdTag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NotificationsConfig holds the settings of the notifiers other than Discord
+type NotificationsConfig struct {
+	Slack      *SlackConfig      `json:"slack,omitempty" yaml:"slack,omitempty"`
+	Webhooks   []WebhookConfig   `json:"webhooks,omitempty" yaml:"webhooks,omitempty"`
+	Email      *EmailConfig      `json:"email,omitempty" yaml:"email,omitempty"`
+	Telegram   *TelegramConfig   `json:"telegram,omitempty" yaml:"telegram,omitempty"`
+	Mattermost *MattermostConfig `json:"mattermost,omitempty" yaml:"mattermost,omitempty"`
+	Ntfy       *NtfyConfig       `json:"ntfy,omitempty" yaml:"ntfy,omitempty"`
+	Gotify     *GotifyConfig     `json:"gotify,omitempty" yaml:"gotify,omitempty"`
+	// Templates customize the messages of the runs
+	Templates *TemplatesConfig `json:"templates,omitempty" yaml:"templates,omitempty"`
+	// Digest batches the notifications sent during this window (e.g. 10m) in
+	// a single message per notifier
+	Digest Duration `json:"digest,omitempty" yaml:"digest,omitempty"`
+	// Batch combines the notifications sent in a burst, within this window
+	// (e.g. 5s) of the first one, in a single message per notifier
+	Batch Duration `json:"batch,omitempty" yaml:"batch,omitempty"`
+}
+
+// SlackConfig holds Slack integration settings
+type SlackConfig struct {
+	WebhookURL string `json:"webhookUrl" yaml:"webhookUrl"`
+	Format     string `json:"format,omitempty" yaml:"format,omitempty"` // Result message format: compact, normal or verbose
+}
+
+// WebhookConfig holds the settings of a generic webhook notifier
+type WebhookConfig struct {
+	URL    string `json:"url" yaml:"url"`
+	Format string `json:"format,omitempty" yaml:"format,omitempty"` // Output included in results: compact (none), normal or verbose (tail)
+	// Headers are added to every request, e.g. for gateway authentication or tracing
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+}
+
+// TelegramConfig sends the notifications to a Telegram chat with a bot
+type TelegramConfig struct {
+	BotToken string `json:"botToken" yaml:"botToken"`
+	ChatID   string `json:"chatId" yaml:"chatId"`                     // ID of the chat, or @username of a channel
+	Format   string `json:"format,omitempty" yaml:"format,omitempty"` // Result message format: compact, normal or verbose
+}
+
+// MattermostConfig sends the notifications through a Mattermost incoming
+// webhook
+type MattermostConfig struct {
+	WebhookURL string `json:"webhookUrl" yaml:"webhookUrl"`
+	Channel    string `json:"channel,omitempty" yaml:"channel,omitempty"`   // Overrides the channel of the webhook
+	Username   string `json:"username,omitempty" yaml:"username,omitempty"` // Overrides the name of the webhook
+	Format     string `json:"format,omitempty" yaml:"format,omitempty"`     // Result message format: compact, normal or verbose
+}
+
+// NtfyConfig sends the results of the runs as push notifications to a topic
+// of an ntfy server
+type NtfyConfig struct {
+	Server   string `json:"server,omitempty" yaml:"server,omitempty"` // https://ntfy.sh by default
+	Topic    string `json:"topic" yaml:"topic"`
+	Token    string `json:"token,omitempty" yaml:"token,omitempty"` // Access token, or username and password
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	On       string `json:"on,omitempty" yaml:"on,omitempty"`         // Results pushed: failure (default) or always
+	Format   string `json:"format,omitempty" yaml:"format,omitempty"` // Result message format: compact, normal or verbose
+}
+
+// GotifyConfig sends the results of the runs as push notifications through
+// a Gotify server
+type GotifyConfig struct {
+	URL    string `json:"url" yaml:"url"`
+	Token  string `json:"token" yaml:"token"`                       // Token of the application
+	On     string `json:"on,omitempty" yaml:"on,omitempty"`         // Results pushed: failure (default) or always
+	Format string `json:"format,omitempty" yaml:"format,omitempty"` // Result message format: compact, normal or verbose
+}
+
+// TemplatesConfig holds the Go templates of the messages of the runs,
+// replacing their default format
+type TemplatesConfig struct {
+	Start   string `json:"start,omitempty" yaml:"start,omitempty"`     // Message sent when a command starts
+	Success string `json:"success,omitempty" yaml:"success,omitempty"` // Result of a successful run
+	Failure string `json:"failure,omitempty" yaml:"failure,omitempty"` // Result of a failed run
+	Summary string `json:"summary,omitempty" yaml:"summary,omitempty"` // Summary of a pipeline of several commands
+}
+
+// EmailConfig sends the results of the runs by email through an SMTP server
+type EmailConfig struct {
+	Host      string   `json:"host" yaml:"host"`
+	Port      int      `json:"port,omitempty" yaml:"port,omitempty"` // 587 (STARTTLS) by default, 465 for implicit TLS
+	Username  string   `json:"username,omitempty" yaml:"username,omitempty"`
+	Password  string   `json:"password,omitempty" yaml:"password,omitempty"`
+	From      string   `json:"from" yaml:"from"`
+	To        []string `json:"to" yaml:"to"`
+	On        string   `json:"on,omitempty" yaml:"on,omitempty"`               // Results emailed: failure (default) or always
+	Format    string   `json:"format,omitempty" yaml:"format,omitempty"`       // Output in the emails: compact (none), normal or verbose (tail)
+	Subject   string   `json:"subject,omitempty" yaml:"subject,omitempty"`     // Template of the subject
+	Body      string   `json:"body,omitempty" yaml:"body,omitempty"`           // Template of the body
+	AttachLog string   `json:"attachLog,omitempty" yaml:"attachLog,omitempty"` // When to attach the run log: never (default), failure or always
 }
 
 // DockerConfig holds Docker-specific settings
@@ -29,27 +343,626 @@ type DockerConfig struct {
 	Host string `json:"host,omitempty" yaml:"host,omitempty"`
 }
 
+// SSHConfig holds the authentication of the commands run on remote hosts
+type SSHConfig struct {
+	User         string `json:"user,omitempty" yaml:"user,omitempty"`                 // User of the hosts given without one, defaults to the current user
+	IdentityFile string `json:"identityFile,omitempty" yaml:"identityFile,omitempty"` // Unencrypted private key, defaults to the keys of ~/.ssh
+	KnownHosts   string `json:"knownHosts,omitempty" yaml:"knownHosts,omitempty"`     // known_hosts file verifying the hosts, defaults to ~/.ssh/known_hosts
+	DisableAgent bool   `json:"disableAgent,omitempty" yaml:"disableAgent,omitempty"` // Whether to ignore the SSH agent of SSH_AUTH_SOCK
+}
+
 // LogConfig holds logging configuration
 type LogConfig struct {
-	Directory string `json:"directory,omitempty" yaml:"directory,omitempty"`  // Directory to store log files
-	MaxSize   int    `json:"maxSize,omitempty" yaml:"maxSize,omitempty"`    // Maximum size in MB before rotation
-	MaxAge    int    `json:"maxAge,omitempty" yaml:"maxAge,omitempty"`     // Maximum age in days before deletion
-	MaxBackups int   `json:"maxBackups,omitempty" yaml:"maxBackups,omitempty"` // Maximum number of backups to keep
-	Compress  bool   `json:"compress,omitempty" yaml:"compress,omitempty"`   // Whether to compress rotated files
+	Directory  string           `json:"directory,omitempty" yaml:"directory,omitempty"`   // Directory to store log files
+	MaxSize    int              `json:"maxSize,omitempty" yaml:"maxSize,omitempty"`       // Maximum size in MB before rotation
+	MaxAge     int              `json:"maxAge,omitempty" yaml:"maxAge,omitempty"`         // Maximum age in days before deletion
+	MaxBackups int              `json:"maxBackups,omitempty" yaml:"maxBackups,omitempty"` // Maximum number of backups to keep
+	Compress   bool             `json:"compress,omitempty" yaml:"compress,omitempty"`     // Whether to compress rotated files
+	Daemon     *DaemonLogConfig `json:"daemon,omitempty" yaml:"daemon,omitempty"`         // Operational log of delivr itself
+	Format     string           `json:"format,omitempty" yaml:"format,omitempty"`         // Format of the command logs: text (default) or json
+	PerRun     bool             `json:"perRun,omitempty" yaml:"perRun,omitempty"`         // Write each run to its own timestamped file instead of a daily file
+}
+
+// DaemonLogConfig holds the settings of the operational log, which records
+// what delivr does (triggers, notifications, errors) separately from the
+// output of the commands
+type DaemonLogConfig struct {
+	File       string `json:"file,omitempty" yaml:"file,omitempty"`             // Log file, defaults to delivr.log in the log directory
+	MaxSize    int    `json:"maxSize,omitempty" yaml:"maxSize,omitempty"`       // Maximum size in MB before rotation
+	MaxAge     int    `json:"maxAge,omitempty" yaml:"maxAge,omitempty"`         // Maximum age in days before deletion
+	MaxBackups int    `json:"maxBackups,omitempty" yaml:"maxBackups,omitempty"` // Maximum number of backups to keep
+	Compress   bool   `json:"compress,omitempty" yaml:"compress,omitempty"`     // Whether to compress rotated files
+}
+
+// SecretConfig tells where the value of a secret is read from
+type SecretConfig struct {
+	Provider string   `json:"provider" yaml:"provider"`                   // env, file or exec
+	Var      string   `json:"var,omitempty" yaml:"var,omitempty"`         // Environment variable holding the value (env)
+	Path     string   `json:"path,omitempty" yaml:"path,omitempty"`       // File holding the value (file)
+	Command  string   `json:"command,omitempty" yaml:"command,omitempty"` // Program printing the value (exec)
+	Args     []string `json:"args,omitempty" yaml:"args,omitempty"`       // Arguments of the program (exec)
+}
+
+// HostConfig identifies the server in notifications and logs
+type HostConfig struct {
+	Name   string            `json:"name,omitempty" yaml:"name,omitempty"`     // Defaults to the hostname
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"` // e.g. env: prod, dc: fra1
+}
+
+// RedactionConfig lists the values masked in command output before it's
+// logged or notified
+type RedactionConfig struct {
+	Patterns []string `json:"patterns,omitempty" yaml:"patterns,omitempty"` // Regular expressions; only the groups are masked when there are some
+	Secrets  []string `json:"secrets,omitempty" yaml:"secrets,omitempty"`   // Names of the secrets whose values are masked
+}
+
+// HistoryConfig holds the settings of the run history
+type HistoryConfig struct {
+	// Backend stores the runs: sqlite, file (JSON lines), postgres or mysql.
+	// It defaults to file when File is set, for the configurations written
+	// before the other backends, and to sqlite otherwise.
+	Backend string `json:"backend,omitempty" yaml:"backend,omitempty"`
+	File    string `json:"file,omitempty" yaml:"file,omitempty"` // Database of sqlite or file of the file backend, defaults to history.db or history.jsonl in the log directory
+	DSN     string `json:"dsn,omitempty" yaml:"dsn,omitempty"`   // Connection string of postgres and mysql
+}
+
+// ServerConfig holds settings for the HTTP server started in daemon mode
+type ServerConfig struct {
+	Address string `json:"address,omitempty" yaml:"address,omitempty"` // Address to listen on, e.g. 127.0.0.1:8080
+	Token   string `json:"token,omitempty" yaml:"token,omitempty"`     // Token required to call the endpoints
+	// GRPCAddress is the address the gRPC API listens on, which is disabled
+	// when empty. Its calls carry the token in the "authorization" metadata.
+	GRPCAddress string `json:"grpcAddress,omitempty" yaml:"grpcAddress,omitempty"`
+	// TokenHeader is the request header carrying the token, instead of
+	// "Authorization: Bearer <token>"
+	TokenHeader string `json:"tokenHeader,omitempty" yaml:"tokenHeader,omitempty"`
+	// BasePath is prepended to the path of every endpoint, e.g. "/delivr"
+	BasePath string `json:"basePath,omitempty" yaml:"basePath,omitempty"`
+	// Paths overrides the paths of the endpoints, by endpoint name: run,
+	// status, metrics, pause, resume, adhoc, imageUpdate, gitPush,
+	// discordInteractions, workflows, approve, reject, replay, runs, openapi
+	// and dashboard
+	Paths map[string]string `json:"paths,omitempty" yaml:"paths,omitempty"`
+	// WebhookSecret authenticates the GitHub and GitLab webhooks, instead of
+	// the token
+	WebhookSecret string `json:"webhookSecret,omitempty" yaml:"webhookSecret,omitempty"`
+	// AllowAdhoc enables running commands that aren't in the configuration,
+	// with the AdminToken
+	AllowAdhoc bool   `json:"allowAdhoc,omitempty" yaml:"allowAdhoc,omitempty"`
+	AdminToken string `json:"adminToken,omitempty" yaml:"adminToken,omitempty"`
+	// Dashboard serves a web page showing the commands, their last run and
+	// the live output, from which the commands can be run
+	Dashboard bool `json:"dashboard,omitempty" yaml:"dashboard,omitempty"`
+}
+
+// PreflightConfig holds the assertions checked before running commands
+type PreflightConfig struct {
+	MinFreeDiskMB int      `json:"minFreeDiskMB,omitempty" yaml:"minFreeDiskMB,omitempty"` // Minimum free disk space in MB
+	DiskPath      string   `json:"diskPath,omitempty" yaml:"diskPath,omitempty"`           // Path whose filesystem is checked, defaults to the working directory
+	Docker        bool     `json:"docker,omitempty" yaml:"docker,omitempty"`               // Whether the Docker daemon must be reachable
+	RequiredEnv   []string `json:"requiredEnv,omitempty" yaml:"requiredEnv,omitempty"`     // Environment variables that must be set
+	LockFile      string   `json:"lockFile,omitempty" yaml:"lockFile,omitempty"`           // Lock file preventing concurrent deploys
+}
+
+// ImageUpdate maps image update notifications (Watchtower, diun) to the
+// commands that redeploy the image
+type ImageUpdate struct {
+	Image    string   `json:"image" yaml:"image"`       // Image name, optionally with a tag and glob patterns
+	Commands []string `json:"commands" yaml:"commands"` // Names of the commands to run, in order
+}
+
+// WatchConfig runs commands when files or directories change
+type WatchConfig struct {
+	Paths    []string `json:"paths" yaml:"paths"`                           // Files and directories watched, directories with their subdirectories
+	Commands []string `json:"commands" yaml:"commands"`                     // Names of the commands or pipelines to run, in order
+	Debounce Duration `json:"debounce,omitempty" yaml:"debounce,omitempty"` // Quiet period after the last change before the commands run, 2s by default
+}
+
+// ImagePoll runs commands in daemon mode when the digest of an image tag
+// changes in its registry, checked at an interval
+type ImagePoll struct {
+	Image    string   `json:"image" yaml:"image"`                           // Image with its tag, e.g. ghcr.io/acme/web:latest
+	Commands []string `json:"commands" yaml:"commands"`                     // Names of the commands or pipelines to run, in order
+	Interval Duration `json:"interval,omitempty" yaml:"interval,omitempty"` // Delay between two checks, 5m by default
+	// Username and Password authenticate with the registry, which is queried
+	// anonymously without them
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+// GitPush maps the pushes notified by GitHub and GitLab webhooks to the
+// commands deploying them
+type GitPush struct {
+	Repository string   `json:"repository,omitempty" yaml:"repository,omitempty"` // Repository, e.g. acme/web, with glob patterns; any when empty
+	Branch     string   `json:"branch,omitempty" yaml:"branch,omitempty"`         // Branch, e.g. main or release/*; any when empty
+	Commands   []string `json:"commands" yaml:"commands"`                         // Names of the commands to run, in order
 }
 
 // Command represents a command to be executed
 type Command struct {
-	Name        string   `json:"name" yaml:"name"`
-	Description string   `json:"description" yaml:"description"`
-	Command     string   `json:"command" yaml:"command"`
-	Args        []string `json:"args,omitempty" yaml:"args,omitempty"`
-	Dir         string   `json:"dir,omitempty" yaml:"dir,omitempty"`
-	EnvVars     []string `json:"envVars,omitempty" yaml:"envVars,omitempty"`
+	Name         string   `json:"name" yaml:"name"`
+	Description  string   `json:"description" yaml:"description"`
+	Command      string   `json:"command" yaml:"command"`
+	Args         []string `json:"args,omitempty" yaml:"args,omitempty"`
+	Dir          string   `json:"dir,omitempty" yaml:"dir,omitempty"`
+	EnvVars      []string `json:"envVars,omitempty" yaml:"envVars,omitempty"`
+	Timeout      Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`           // Maximum execution time before the command is killed
+	Retries      int      `json:"retries,omitempty" yaml:"retries,omitempty"`           // Number of times to retry a failed command
+	RetryDelay   Duration `json:"retryDelay,omitempty" yaml:"retryDelay,omitempty"`     // Delay before the first retry
+	RetryBackoff float64  `json:"retryBackoff,omitempty" yaml:"retryBackoff,omitempty"` // Multiplier applied to the delay after each retry
+	Budget       Duration `json:"budget,omitempty" yaml:"budget,omitempty"`             // Expected duration, longer runs are flagged in the breakdown
+	Stream       bool     `json:"stream,omitempty" yaml:"stream,omitempty"`             // Whether to show the output in Discord while the command runs
+	// Outputs are values exported to the next steps of a pipeline, as
+	// {{ .outputs.NAME }}: each regular expression is matched against the
+	// output of the command, and its first group is the value. Commands can
+	// also write NAME=value lines to the file named by $DELIVR_OUTPUT.
+	Outputs map[string]string `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	// Params are the names of the parameters supplied when the command is
+	// triggered, with --param, the body of the HTTP request or the options of
+	// the slash command, and substituted as {{ .params.NAME }}
+	Params []string `json:"params,omitempty" yaml:"params,omitempty"`
+	// StreamThrottle limits the updates of the live output, so that verbose
+	// commands don't exhaust the rate limits of the channel
+	StreamThrottle *StreamThrottle `json:"streamThrottle,omitempty" yaml:"streamThrottle,omitempty"`
+	// Type selects how the command is executed: "exec" (default) runs the
+	// program given in Command, "docker" performs the Docker action through
+	// the Docker Engine API and "k8s" the Kubernetes action through the
+	// Kubernetes API
+	Type    string         `json:"type,omitempty" yaml:"type,omitempty"`
+	Docker  *DockerAction  `json:"docker,omitempty" yaml:"docker,omitempty"`
+	Compose *ComposeAction `json:"compose,omitempty" yaml:"compose,omitempty"`
+	K8s     *K8sAction     `json:"k8s,omitempty" yaml:"k8s,omitempty"`
+	// AllowedWindows restrict when triggered runs of the command may start.
+	// Outside of them, jobs wait for the next window, or are rejected when
+	// OutsideWindow is "reject".
+	AllowedWindows []TimeWindow `json:"allowedWindows,omitempty" yaml:"allowedWindows,omitempty"`
+	OutsideWindow  string       `json:"outsideWindow,omitempty" yaml:"outsideWindow,omitempty"`
+	// Protected commands only run during a freeze period when forced
+	Protected bool `json:"protected,omitempty" yaml:"protected,omitempty"`
+	// RequireApproval holds the triggered runs of the command until one of
+	// the approvers of the Discord bot approves them
+	RequireApproval bool `json:"requireApproval,omitempty" yaml:"requireApproval,omitempty"`
+	// Tags select the command with --tags, e.g. deploy or db
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// Channel is the Discord channel, among discord.channels, receiving the
+	// runs of the command instead of the default channel or of its route
+	Channel string `json:"channel,omitempty" yaml:"channel,omitempty"`
+	// FailureChannel overrides discord.failureChannel for the command
+	FailureChannel string `json:"failureChannel,omitempty" yaml:"failureChannel,omitempty"`
+	// Notifiers are the kinds of notifiers receiving the runs of the command,
+	// e.g. telegram or mattermost, all of them by default
+	Notifiers []string `json:"notifiers,omitempty" yaml:"notifiers,omitempty"`
+	// Quota aborts the command when its output grows too large, overriding
+	// the global quota
+	Quota *QuotaConfig `json:"quota,omitempty" yaml:"quota,omitempty"`
+	// Simulate is the fake outcome of the command when running with
+	// --simulate, overriding the global one
+	Simulate *SimulateConfig `json:"simulate,omitempty" yaml:"simulate,omitempty"`
+	// Shell is a script run with Interpreter -c instead of Command and Args,
+	// for steps needing pipes, redirections or chaining
+	Shell       string `json:"shell,omitempty" yaml:"shell,omitempty"`
+	Interpreter string `json:"interpreter,omitempty" yaml:"interpreter,omitempty"`
+	// Stdin is the standard input of the command, for the tools reading a
+	// password or a dump from it
+	Stdin *Stdin `json:"stdin,omitempty" yaml:"stdin,omitempty"`
+	// PreHooks run before the command, which doesn't run when one of them
+	// fails. PostHooks run after it, depending on its outcome.
+	PreHooks  []Hook `json:"preHooks,omitempty" yaml:"preHooks,omitempty"`
+	PostHooks []Hook `json:"postHooks,omitempty" yaml:"postHooks,omitempty"`
+	// OnlyIf and SkipIf are shell conditions evaluated before the command:
+	// it's skipped when OnlyIf fails or SkipIf succeeds
+	OnlyIf string `json:"onlyIf,omitempty" yaml:"onlyIf,omitempty"`
+	SkipIf string `json:"skipIf,omitempty" yaml:"skipIf,omitempty"`
+	// Hosts restrict the command to the hosts with one of these names or
+	// glob patterns, e.g. web-*, so that a shared configuration runs a
+	// different subset of the commands on each server
+	Hosts []string `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	// FailurePolicy overrides the failure policy of the configuration
+	FailurePolicy string `json:"failurePolicy,omitempty" yaml:"failurePolicy,omitempty"`
+	// ANSI overrides the handling of the ANSI escape sequences of the
+	// configuration
+	ANSI string `json:"ansi,omitempty" yaml:"ansi,omitempty"`
+	// SuccessPattern and FailurePattern are regular expressions classifying
+	// the command from its output rather than its exit code: a run matching
+	// FailurePattern fails, and one matching SuccessPattern succeeds unless
+	// it matched FailurePattern too
+	SuccessPattern string `json:"successPattern,omitempty" yaml:"successPattern,omitempty"`
+	FailurePattern string `json:"failurePattern,omitempty" yaml:"failurePattern,omitempty"`
+	// Output processors shape the output excerpt of the notifications, in
+	// order. The log keeps the whole output.
+	Output []OutputProcessor `json:"output,omitempty" yaml:"output,omitempty"`
+	// OutputMode is how much output the result notifications include: none,
+	// summary, tail or full (default)
+	OutputMode string `json:"outputMode,omitempty" yaml:"outputMode,omitempty"`
+	// Supersede is what a new run does to the status message of the previous
+	// run in the bot channel, for monitor-style commands: "delete" or
+	// "collapse". The messages where the status changed are kept.
+	Supersede string `json:"supersede,omitempty" yaml:"supersede,omitempty"`
+	// Host runs the command on a remote machine over SSH, written
+	// [user@]host[:port], or on the machines of a host group. Unlike Hosts,
+	// it doesn't select where delivr runs the command but where the command
+	// itself runs.
+	Host string `json:"host,omitempty" yaml:"host,omitempty"`
+	// Targets run the command on several remote hosts or host groups
+	Targets []string `json:"targets,omitempty" yaml:"targets,omitempty"`
+	// FanOut configures the runs on several remote hosts
+	FanOut *FanOut `json:"fanOut,omitempty" yaml:"fanOut,omitempty"`
+}
+
+// FanOut configures how a command runs on several remote hosts. By default,
+// the hosts run one after the other and a failure stops the rollout.
+type FanOut struct {
+	Parallel        int  `json:"parallel,omitempty" yaml:"parallel,omitempty"`               // Number of hosts running the command at once
+	ContinueOnError bool `json:"continueOnError,omitempty" yaml:"continueOnError,omitempty"` // Whether the remaining hosts run after a failure
+}
+
+// Stdin is the standard input of a command: an inline text or the content of
+// a local file, read at each attempt
+type Stdin struct {
+	Text string `json:"text,omitempty" yaml:"text,omitempty"` // Inline text, which may hold secret references
+	File string `json:"file,omitempty" yaml:"file,omitempty"` // Local file, relative to workingDir
+}
+
+// OutputProcessor transforms the output shown in the notifications
+type OutputProcessor struct {
+	Type    string `json:"type" yaml:"type"`                           // strip-ansi, redact, grep, jq or tail
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"` // Regular expression of grep and redact
+	Invert  bool   `json:"invert,omitempty" yaml:"invert,omitempty"`   // grep keeps the lines not matching the pattern
+	Filter  string `json:"filter,omitempty" yaml:"filter,omitempty"`   // Filter of jq
+	Lines   int    `json:"lines,omitempty" yaml:"lines,omitempty"`     // Number of lines kept by tail
+}
+
+// Output processor types
+const (
+	OutputStripANSI = "strip-ansi"
+	OutputRedact    = "redact"
+	OutputGrep      = "grep"
+	OutputJQ        = "jq"
+	OutputTail      = "tail"
+)
+
+// What happens to the ANSI escape sequences and the control characters of the
+// output
+const (
+	// ANSIStrip removes them, keeping the last version of the lines redrawn
+	// with carriage returns
+	ANSIStrip = "strip"
+	// ANSIKeep keeps the raw output
+	ANSIKeep = "keep"
+)
+
+// Output modes, how much output the result notifications include
+const (
+	// OutputModeNone only reports the status
+	OutputModeNone = "none"
+	// OutputModeSummary includes the beginning of the output in a single
+	// message
+	OutputModeSummary = "summary"
+	// OutputModeTail includes the end of the output in a single message
+	OutputModeTail = "tail"
+	// OutputModeFull includes the beginning of the output, split into
+	// several messages by the notifiers allowing it
+	OutputModeFull = "full"
+)
+
+// Failure policies
+const (
+	// FailureStop skips the next commands after a failure
+	FailureStop = "stop"
+	// FailureContinue runs the next commands, the failure being tolerated:
+	// it doesn't fail the run
+	FailureContinue = "continue"
+	// FailureContinueButMark runs the next commands and fails the run
+	FailureContinueButMark = "continue-but-mark"
+)
+
+// What a new run does to the status message of the previous run
+const (
+	// SupersedeDelete deletes the previous status message
+	SupersedeDelete = "delete"
+	// SupersedeCollapse replaces the previous status message with a small
+	// one-line summary
+	SupersedeCollapse = "collapse"
+)
+
+// StreamThrottle limits the updates of the live output of a command
+type StreamThrottle struct {
+	MinInterval Duration `json:"minInterval,omitempty" yaml:"minInterval,omitempty"` // Minimum delay between two updates, 5s by default
+	MaxEdits    int      `json:"maxEdits,omitempty" yaml:"maxEdits,omitempty"`       // Maximum number of updates per run, including the final one, unlimited when 0
+}
+
+// ValidateStreamThrottles checks the throttling of the live output of the
+// commands
+func (c *Config) ValidateStreamThrottles() error {
+	for _, cmd := range c.Commands {
+		throttle := cmd.StreamThrottle
+		if throttle == nil {
+			continue
+		}
+		if !cmd.Stream {
+			return fmt.Errorf("command '%s': streamThrottle requires stream", cmd.Name)
+		}
+		if throttle.MinInterval != 0 && throttle.MinInterval.Std() < time.Second {
+			return fmt.Errorf("command '%s': streamThrottle.minInterval must be at least 1s", cmd.Name)
+		}
+		if throttle.MaxEdits < 0 {
+			return fmt.Errorf("command '%s': streamThrottle.maxEdits must be positive", cmd.Name)
+		}
+	}
+	return nil
+}
+
+// ValidateRetries checks the retry policies of the commands
+func (c *Config) ValidateRetries() error {
+	for _, cmd := range c.Commands {
+		switch {
+		case cmd.Retries < 0:
+			return fmt.Errorf("command '%s': retries must not be negative, got %d", cmd.Name, cmd.Retries)
+		case cmd.RetryDelay < 0:
+			return fmt.Errorf("command '%s': retryDelay must not be negative, got %s", cmd.Name, cmd.RetryDelay.Std())
+		case cmd.RetryBackoff != 0 && cmd.RetryBackoff < 1:
+			return fmt.Errorf("command '%s': retryBackoff must be at least 1, got %g", cmd.Name, cmd.RetryBackoff)
+		}
+	}
+	return nil
+}
+
+// ValidateStdin checks the standard input of the commands, which is only
+// given to the programs and scripts run locally or over SSH
+func (c *Config) ValidateStdin() error {
+	for _, cmd := range c.Commands {
+		stdin := cmd.Stdin
+		if stdin == nil {
+			continue
+		}
+		switch {
+		case stdin.Text != "" && stdin.File != "":
+			return fmt.Errorf("command '%s': stdin.text and stdin.file are exclusive", cmd.Name)
+		case stdin.Text == "" && stdin.File == "":
+			return fmt.Errorf("command '%s': stdin requires a text or a file", cmd.Name)
+		case cmd.Type != "" && cmd.Type != CommandTypeExec:
+			return fmt.Errorf("command '%s': stdin can't be used with commands of type %s", cmd.Name, cmd.Type)
+		}
+	}
+	return nil
+}
+
+// ValidateShutdownGracePeriod checks the grace period of the running commands
+// at shutdown
+func (c *Config) ValidateShutdownGracePeriod() error {
+	if c.ShutdownGracePeriod < 0 {
+		return fmt.Errorf("shutdownGracePeriod must be positive, got %s", c.ShutdownGracePeriod)
+	}
+	return nil
+}
+
+// ValidateOutputs checks the names and regular expressions of the outputs of
+// the commands
+func (c *Config) ValidateOutputs() error {
+	for _, cmd := range c.Commands {
+		for name, pattern := range cmd.Outputs {
+			if !ValidOutputName(name) {
+				return fmt.Errorf("command '%s': invalid output name '%s', must be letters, digits and underscores", cmd.Name, name)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("command '%s': output '%s': %w", cmd.Name, name, err)
+			}
+			if re.NumSubexp() == 0 {
+				return fmt.Errorf("command '%s': output '%s': the regular expression must capture the value in a group", cmd.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateOutputPatterns checks the success and failure patterns of the
+// commands
+func (c *Config) ValidateOutputPatterns() error {
+	for _, cmd := range c.Commands {
+		for _, pattern := range []struct{ field, value string }{
+			{"successPattern", cmd.SuccessPattern},
+			{"failurePattern", cmd.FailurePattern},
+		} {
+			if pattern.value == "" {
+				continue
+			}
+			if _, err := regexp.Compile(pattern.value); err != nil {
+				return fmt.Errorf("command '%s': %s: %w", cmd.Name, pattern.field, err)
+			}
+		}
+	}
+	return nil
+}
+
+// outputNamePattern matches the valid names of outputs
+var outputNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidOutputName reports whether name is a valid output name: letters,
+// digits and underscores, not starting with a digit
+func ValidOutputName(name string) bool {
+	return outputNamePattern.MatchString(name)
+}
+
+// ValidateSupersede checks what the commands do to their superseded status
+// messages
+func (c *Config) ValidateSupersede() error {
+	for _, cmd := range c.Commands {
+		switch cmd.Supersede {
+		case "", SupersedeDelete, SupersedeCollapse:
+		default:
+			return fmt.Errorf("command '%s': unknown supersede mode '%s', must be delete or collapse", cmd.Name, cmd.Supersede)
+		}
+	}
+	return nil
+}
+
+// ValidateApprovals checks that the approvals required by the commands can
+// be given, with the buttons of the Discord bot received on the interactions
+// endpoint of the HTTP server
+func (c *Config) ValidateApprovals() error {
+	for _, cmd := range c.Commands {
+		if !cmd.RequireApproval {
+			continue
+		}
+		bot := c.Discord.Bot
+		switch {
+		case bot == nil || bot.ApplicationID == "" || bot.PublicKey == "":
+			return fmt.Errorf("command '%s' requires an approval, which needs the Discord bot with its applicationId and publicKey", cmd.Name)
+		case bot.ChannelID == "":
+			return fmt.Errorf("command '%s' requires an approval, which is requested in discord.bot.channelId, but it is empty", cmd.Name)
+		case len(bot.Approvers) == 0:
+			return fmt.Errorf("command '%s' requires an approval, but discord.bot.approvers is empty", cmd.Name)
+		case c.Server == nil:
+			return fmt.Errorf("command '%s' requires an approval, which needs the HTTP server to receive the Discord interactions", cmd.Name)
+		}
+	}
+	if bot := c.Discord.Bot; bot != nil && bot.ApprovalTimeout < 0 {
+		return errors.New("discord.bot.approvalTimeout must be positive")
+	}
+	return nil
+}
+
+// ValidateDiscordACL checks that the rules of the access list of the Discord
+// bot allow someone to run known commands
+func (c *Config) ValidateDiscordACL() error {
+	if c.Discord.Bot == nil {
+		return nil
+	}
+	for i, rule := range c.Discord.Bot.ACL {
+		if len(rule.Users) == 0 && len(rule.Roles) == 0 {
+			return fmt.Errorf("discord.bot.acl[%d]: no users or roles", i)
+		}
+		if len(rule.Commands) == 0 && len(rule.Tags) == 0 {
+			return fmt.Errorf("discord.bot.acl[%d]: no commands or tags", i)
+		}
+		for _, name := range rule.Commands {
+			if _, ok := c.FindCommand(name); ok || name == "*" || c.OnOtherHost(name) {
+				continue
+			}
+			if _, ok := c.Pipelines[name]; !ok {
+				return fmt.Errorf("discord.bot.acl[%d]: unknown command '%s'", i, name)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateFailurePolicies checks the failure policies of the configuration
+// and of the commands
+func (c *Config) ValidateFailurePolicies() error {
+	if err := validateFailurePolicy(c.FailurePolicy); err != nil {
+		return err
+	}
+	for _, cmd := range c.Commands {
+		if err := validateFailurePolicy(cmd.FailurePolicy); err != nil {
+			return fmt.Errorf("command '%s': %w", cmd.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateFailurePolicy checks a failure policy, which may be empty
+func validateFailurePolicy(policy string) error {
+	switch policy {
+	case "", FailureStop, FailureContinue, FailureContinueButMark:
+		return nil
+	}
+	return fmt.Errorf("unknown failure policy '%s', must be stop, continue or continue-but-mark", policy)
 }
 
-// Variables pour stocker le chemin du fichier de configuration chargé
-var loadedConfigPath string
+// Hook is a program or shell script run around a command, in its working
+// directory and with its environment
+type Hook struct {
+	Command string   `json:"command,omitempty" yaml:"command,omitempty"`
+	Args    []string `json:"args,omitempty" yaml:"args,omitempty"`
+	Shell   string   `json:"shell,omitempty" yaml:"shell,omitempty"`
+	Timeout Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// On selects the outcomes of the command after which a post hook runs:
+	// success, failure or always (default)
+	On string `json:"on,omitempty" yaml:"on,omitempty"`
+}
+
+// Hook conditions
+const (
+	HookOnSuccess = "success"
+	HookOnFailure = "failure"
+	HookOnAlways  = "always"
+)
+
+// QuotaConfig limits the output of a command. A zero limit isn't enforced.
+type QuotaConfig struct {
+	MaxOutput    Size `json:"maxOutput,omitempty" yaml:"maxOutput,omitempty"`       // Output of an attempt, stdout and stderr included
+	MaxLogGrowth Size `json:"maxLogGrowth,omitempty" yaml:"maxLogGrowth,omitempty"` // Output written to the log by the run, all attempts included
+}
+
+// HasTag reports whether the command has one of the given tags
+func (c Command) HasTag(tags []string) bool {
+	for _, tag := range tags {
+		if slices.Contains(c.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// TimeWindow is a recurring period of the week, in local time
+type TimeWindow struct {
+	Days []string `json:"days,omitempty" yaml:"days,omitempty"` // mon to sun, weekdays or weekends, every day when empty
+	From string   `json:"from" yaml:"from"`                     // Opening time as HH:MM
+	To   string   `json:"to" yaml:"to"`                         // Closing time as HH:MM, before From for windows spanning midnight
+}
+
+// Command types
+const (
+	CommandTypeExec    = "exec"
+	CommandTypeDocker  = "docker"
+	CommandTypeCompose = "compose"
+	CommandTypeK8s     = "k8s"
+)
+
+// K8sAction describes a Kubernetes operation of a command of type k8s
+type K8sAction struct {
+	Action     string   `json:"action" yaml:"action"`                             // apply or restart
+	Kubeconfig string   `json:"kubeconfig,omitempty" yaml:"kubeconfig,omitempty"` // Kubeconfig file, defaults to $KUBECONFIG, ~/.kube/config, then the in-cluster configuration
+	Context    string   `json:"context,omitempty" yaml:"context,omitempty"`       // Kubeconfig context, defaults to the current context
+	Namespace  string   `json:"namespace,omitempty" yaml:"namespace,omitempty"`   // Namespace, defaults to the namespace of the context
+	Manifests  []string `json:"manifests,omitempty" yaml:"manifests,omitempty"`   // Manifest files, directories or glob patterns to apply
+	Workloads  []string `json:"workloads,omitempty" yaml:"workloads,omitempty"`   // Workloads to restart, e.g. "deployment/web" or "statefulset/db"
+	NoWait     bool     `json:"noWait,omitempty" yaml:"noWait,omitempty"`         // Whether to return without waiting for the rollouts to complete
+	Timeout    Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`       // Bound on the wait for the rollouts, 10m by default
+}
+
+// ComposeAction describes a Docker Compose operation of a command of type compose
+type ComposeAction struct {
+	Action   string   `json:"action" yaml:"action"`                         // up, down, pull or restart
+	File     string   `json:"file,omitempty" yaml:"file,omitempty"`         // Compose file, defaults to the compose file of the working directory
+	Project  string   `json:"project,omitempty" yaml:"project,omitempty"`   // Project name, defaults to the name of the directory
+	Services []string `json:"services,omitempty" yaml:"services,omitempty"` // Services to act on, all services when empty
+}
+
+// DockerAction describes a container operation of a command of type docker
+type DockerAction struct {
+	Action    string   `json:"action" yaml:"action"`                           // run, pull, start, stop, restart or remove
+	Image     string   `json:"image,omitempty" yaml:"image,omitempty"`         // Image to pull or run
+	Container string   `json:"container,omitempty" yaml:"container,omitempty"` // Name of the container to create or act on
+	Cmd       []string `json:"cmd,omitempty" yaml:"cmd,omitempty"`             // Command run in the container, defaults to the image command
+	Env       []string `json:"env,omitempty" yaml:"env,omitempty"`             // Environment variables of the container
+	Volumes   []string `json:"volumes,omitempty" yaml:"volumes,omitempty"`     // Bind mounts, e.g. "/data:/var/lib/data:ro"
+	Ports     []string `json:"ports,omitempty" yaml:"ports,omitempty"`         // Published ports, e.g. "8080:80"
+	Network   string   `json:"network,omitempty" yaml:"network,omitempty"`     // Network to connect the container to
+	Restart   string   `json:"restart,omitempty" yaml:"restart,omitempty"`     // Restart policy, e.g. "unless-stopped"
+	Pull      bool     `json:"pull,omitempty" yaml:"pull,omitempty"`           // Whether to pull the image before running it
+	Detach    bool     `json:"detach,omitempty" yaml:"detach,omitempty"`       // Whether to return once the container started instead of waiting for it to exit
+	Remove    bool     `json:"remove,omitempty" yaml:"remove,omitempty"`       // Whether to remove the container once it exited, or to force the removal
+}
+
+// loaded is the configuration running, whose file GetLoadedConfigPath,
+// GetLoadedConfigHash and GetConfigSource describe
+var (
+	loadedMu sync.Mutex
+	loaded   *Config
+)
 
 // DefaultConfigPath returns the default config file paths in order of preference
 func DefaultConfigPath() string {
@@ -57,7 +970,7 @@ func DefaultConfigPath() string {
 	if _, err := os.Stat(".delivr.yml"); err == nil {
 		return ".delivr.yml"
 	}
-	
+
 	// Try hidden .delivr.json in current directory
 	if _, err := os.Stat(".delivr.json"); err == nil {
 		return ".delivr.json"
@@ -67,12 +980,12 @@ func DefaultConfigPath() string {
 	if _, err := os.Stat("config.yml"); err == nil {
 		return "config.yml"
 	}
-	
+
 	// Try standard JSON in current directory
 	if _, err := os.Stat("config.json"); err == nil {
 		return "config.json"
 	}
-	
+
 	// Then try in home directory
 	home, err := os.UserHomeDir()
 	if err == nil {
@@ -81,21 +994,156 @@ func DefaultConfigPath() string {
 		if _, err := os.Stat(homeYamlCfg); err == nil {
 			return homeYamlCfg
 		}
-		
+
 		// Try JSON in home directory
 		homeJsonCfg := filepath.Join(home, ".delivr", "config.json")
 		if _, err := os.Stat(homeJsonCfg); err == nil {
 			return homeJsonCfg
 		}
 	}
-	
+
 	// Default to current directory .delivr.yml
 	return ".delivr.yml"
 }
 
-// GetLoadedConfigPath returns the path of the loaded configuration file
+// FindCommand returns the command with the given name
+func (c *Config) FindCommand(name string) (Command, bool) {
+	for _, cmd := range c.Commands {
+		if cmd.Name == name {
+			return cmd, true
+		}
+	}
+	return Command{}, false
+}
+
+// ResolveCommands returns the commands matching the given names, in order.
+// Pipeline names are replaced with the commands of the pipeline.
+func (c *Config) ResolveCommands(names []string) ([]Command, error) {
+	commands := make([]Command, 0, len(names))
+	for _, name := range names {
+		if pipeline, ok := c.Pipelines[name]; ok {
+			for _, step := range pipeline {
+				cmd, ok := c.FindCommand(step)
+				if !ok && c.OnOtherHost(step) {
+					continue
+				}
+				if !ok {
+					return nil, fmt.Errorf("pipeline '%s': unknown command '%s'", name, step)
+				}
+				commands = append(commands, cmd)
+			}
+			continue
+		}
+		cmd, ok := c.FindCommand(name)
+		if !ok && c.OnOtherHost(name) {
+			return nil, fmt.Errorf("command '%s' only runs on other hosts", name)
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown command '%s'", name)
+		}
+		commands = append(commands, cmd)
+	}
+	return commands, nil
+}
+
+// ValidatePipelines checks that the pipelines only list known commands and
+// don't share their names with commands
+func (c *Config) ValidatePipelines() error {
+	names := make([]string, 0, len(c.Pipelines))
+	for name := range c.Pipelines {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if _, ok := c.FindCommand(name); ok || c.OnOtherHost(name) {
+			return fmt.Errorf("pipeline '%s': a command has the same name", name)
+		}
+		if len(c.Pipelines[name]) == 0 {
+			return fmt.Errorf("pipeline '%s': no command", name)
+		}
+		for _, step := range c.Pipelines[name] {
+			if _, ok := c.FindCommand(step); !ok && !c.OnOtherHost(step) {
+				return fmt.Errorf("pipeline '%s': unknown command '%s'", name, step)
+			}
+		}
+	}
+	return nil
+}
+
+// SelectCommands returns the commands of the list named in names and having
+// one of tags, in order. An empty names or tags list doesn't filter.
+func SelectCommands(list []Command, names, tags []string) ([]Command, error) {
+	for _, name := range names {
+		if !slices.ContainsFunc(list, func(cmd Command) bool { return cmd.Name == name }) {
+			return nil, fmt.Errorf("unknown command '%s'", name)
+		}
+	}
+
+	var commands []Command
+	for _, cmd := range list {
+		if len(names) > 0 && !slices.Contains(names, cmd.Name) {
+			continue
+		}
+		if len(tags) > 0 && !cmd.HasTag(tags) {
+			continue
+		}
+		commands = append(commands, cmd)
+	}
+	if len(commands) == 0 {
+		return nil, errors.New("no command matches the selection")
+	}
+	return commands, nil
+}
+
+// SetLoaded makes cfg the running configuration, once it replaced the
+// previous one: Load leaves the running configuration as it is, so that a
+// configuration that is rejected isn't reported as running
+func SetLoaded(cfg *Config) {
+	loadedMu.Lock()
+	defer loadedMu.Unlock()
+	loaded = cfg
+}
+
+// running returns the running configuration, an empty one before SetLoaded
+func running() *Config {
+	loadedMu.Lock()
+	defer loadedMu.Unlock()
+	if loaded == nil {
+		return &Config{}
+	}
+	return loaded
+}
+
+// GetLoadedConfigPath returns the path of the running configuration file
 func GetLoadedConfigPath() string {
-	return loadedConfigPath
+	return running().path
+}
+
+// GetLoadedConfigHash returns the SHA-256 hash of the running configuration
+// file
+func GetLoadedConfigHash() string {
+	return running().hash
+}
+
+// Path returns the file the configuration was loaded from
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Source returns the URL the configuration was fetched from, or the path of
+// its local file
+func (c *Config) Source() string {
+	if c.source != "" {
+		return c.source
+	}
+	return c.path
+}
+
+// Hash returns the SHA-256 hash of the configuration file and its included
+// files
+func (c *Config) Hash() string {
+	return c.hash
 }
 
 // isYAMLFile checks if a path has a YAML extension
@@ -104,10 +1152,11 @@ func isYAMLFile(path string) bool {
 	return ext == ".yml" || ext == ".yaml"
 }
 
-// Load loads the configuration from file
+// Load loads the configuration from file. It is only reported as running
+// once passed to SetLoaded.
 func Load(customPath string) (*Config, error) {
 	configPath := DefaultConfigPath()
-	
+
 	// Check if config path is provided as a parameter
 	if customPath != "" {
 		configPath = customPath
@@ -115,7 +1164,7 @@ func Load(customPath string) (*Config, error) {
 		// Check if config path is overridden by environment
 		configPath = envPath
 	}
-	
+
 	// If using the default path and the file doesn't exist, check for deprecated config names
 	if customPath == "" && os.Getenv("DELIVR_CONFIG") == "" {
 		if _, err := os.Stat(configPath); os.IsNotExist(err) {
@@ -129,42 +1178,124 @@ func Load(customPath string) (*Config, error) {
 			}
 		}
 	}
-	
+
+	// Fetch the remote configurations, then load their local copy
+	source := ""
+	if IsRemote(configPath) {
+		local, err := loadRemote(configPath)
+		if err != nil {
+			return nil, err
+		}
+		source, configPath = configPath, local
+	}
+
 	// Vérifier que le fichier existe
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("configuration file not found: %s", configPath)
 	}
-	
+
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, err
 	}
-	
+
+	config, err := parse(configPath, data)
+	if err != nil {
+		return nil, err
+	}
+
+	config.path = configPath
+	config.source = source
+	config.hash = hashFiles(data, config.includedFiles)
+
+	return config, nil
+}
+
+// parse decodes the content of a configuration file. Errors are returned as
+// an *Error locating them in the file.
+func parse(path string, data []byte) (*Config, error) {
 	var config Config
-	
+
 	// Determine if it's a YAML file and use appropriate unmarshal
-	if isYAMLFile(configPath) {
+	if isYAMLFile(path) {
 		if err := yaml.Unmarshal(data, &config); err != nil {
-			return nil, fmt.Errorf("error parsing YAML config: %w", err)
+			return nil, decodeError(path, data, err)
 		}
 	} else {
 		// Assume JSON
 		if err := json.Unmarshal(data, &config); err != nil {
-			return nil, fmt.Errorf("error parsing JSON config: %w", err)
+			return nil, decodeError(path, data, err)
 		}
 	}
-	
-	// Store the loaded config path
-	loadedConfigPath = configPath
-	
+	if err := checkKnownFields(path, data); err != nil {
+		return nil, err
+	}
+
+	if err := config.applyIncludes(path); err != nil {
+		return nil, err
+	}
+
+	// Substitute the variables of the environment, then expand ${VAR}
+	// references so that secrets can stay out of the file
+	if err := config.applyEnvironment(); err != nil {
+		return nil, &Error{File: path, Msg: err.Error()}
+	}
+	if err := config.interpolate(); err != nil {
+		return nil, &Error{File: path, Msg: err.Error()}
+	}
+	if err := config.decryptValues(path); err != nil {
+		return nil, err
+	}
+	if err := config.normalizePaths(path); err != nil {
+		return nil, &Error{File: path, Msg: err.Error()}
+	}
 	return &config, nil
 }
 
+// LoadNotifications reads the notifier settings of a configuration file that
+// can't be loaded, so that the error can be reported. Other settings are
+// ignored, and so are their errors. It returns nil when the file can't be
+// decoded at all.
+func LoadNotifications(path string) *Config {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	// Only decode the notifier settings so that errors elsewhere don't
+	// matter, the decoders keeping the valid fields on type errors
+	var config struct {
+		Discord       DiscordConfig        `json:"discord" yaml:"discord"`
+		Notifications *NotificationsConfig `json:"notifications" yaml:"notifications"`
+		Host          *HostConfig          `json:"host" yaml:"host"`
+	}
+	if isYAMLFile(path) {
+		var typeErr *yaml.TypeError
+		if err := yaml.Unmarshal(data, &config); err != nil && !errors.As(err, &typeErr) {
+			return nil
+		}
+	} else {
+		var typeErr *json.UnmarshalTypeError
+		if err := json.Unmarshal(data, &config); err != nil && !errors.As(err, &typeErr) {
+			return nil
+		}
+	}
+
+	partial := &Config{
+		Discord:       config.Discord,
+		Notifications: config.Notifications,
+		Host:          config.Host,
+	}
+	_ = partial.interpolate()
+	_ = partial.decryptValues(path)
+	return partial
+}
+
 // Save saves the configuration to file
 func Save(config *Config, path string) error {
 	var data []byte
 	var err error
-	
+
 	// Determine format based on file extension
 	if isYAMLFile(path) {
 		data, err = yaml.Marshal(config)
@@ -178,13 +1309,13 @@ func Save(config *Config, path string) error {
 			return fmt.Errorf("error encoding JSON: %w", err)
 		}
 	}
-	
+
 	// Ensure directory exists
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
-	
+
 	return os.WriteFile(path, data, 0644)
 }
 
@@ -197,18 +1328,18 @@ func CreateDefaultConfig(path string) error {
 
 	// Create Logs config
 	logsConfig := &LogConfig{
-		Directory: "./logs",
-		MaxSize:   10,
-		MaxAge:    30,
+		Directory:  "./logs",
+		MaxSize:    10,
+		MaxAge:     30,
 		MaxBackups: 5,
-		Compress:  true,
+		Compress:   true,
 	}
 
 	// Create a default configuration
 	defaultConfig := &Config{
 		WorkingDir: "",
-		Docker: dockerConfig,
-		Logs: logsConfig,
+		Docker:     dockerConfig,
+		Logs:       logsConfig,
 		Discord: DiscordConfig{
 			ChannelID: "YOUR_DISCORD_WEBHOOK_URL_HERE",
 		},
@@ -227,7 +1358,7 @@ func CreateDefaultConfig(path string) error {
 			},
 		},
 	}
-	
+
 	// Save the configuration to the specified path
 	return Save(defaultConfig, path)
 }
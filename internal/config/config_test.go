@@ -0,0 +1,41 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadKeepsRunningConfig checks that loading a configuration, e.g. on
+// a reload that is then rejected, doesn't change the running one
+func TestLoadKeepsRunningConfig(t *testing.T) {
+	t.Cleanup(func() { SetLoaded(nil) })
+	dir := t.TempDir()
+	load := func(name, content string) *Config {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load %s: %v", name, err)
+		}
+		return cfg
+	}
+
+	first := load("first.yml", "version: \"1\"\n")
+	SetLoaded(first)
+	second := load("second.yml", "version: \"2\"\n")
+	if second.Hash() == first.Hash() || second.Path() == first.Path() {
+		t.Fatalf("both configurations loaded as %s with hash %s", second.Path(), second.Hash())
+	}
+	if GetLoadedConfigHash() != first.Hash() || GetConfigSource() != first.Path() {
+		t.Errorf("running configuration %s (%s) after Load, want %s (%s)", GetConfigSource(), GetLoadedConfigHash(), first.Path(), first.Hash())
+	}
+
+	SetLoaded(second)
+	if GetLoadedConfigHash() != second.Hash() || GetConfigSource() != second.Path() {
+		t.Errorf("running configuration %s (%s) after SetLoaded, want %s (%s)", GetConfigSource(), GetLoadedConfigHash(), second.Path(), second.Hash())
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Drift describes a configuration file, or one of its included files, that
+// changed on disk since it was loaded
+type Drift struct {
+	// Path is the path of the configuration file, or the URL it was
+	// fetched from
+	Path          string
+	LoadedVersion string
+	DiskVersion   string
+	LoadedHash    string
+	DiskHash      string
+	// Err is set when the file on disk isn't a valid configuration
+	Err error
+}
+
+// DriftChecker detects changes of the configuration file that haven't been
+// loaded, reporting each new on-disk state once
+type DriftChecker struct {
+	path     string
+	source   string
+	hash     string
+	version  string
+	reported string
+	// included are the files included by the loaded configuration
+	included []string
+}
+
+// NewDriftChecker creates a checker comparing the file on disk with the
+// loaded configuration
+func NewDriftChecker(cfg *Config) *DriftChecker {
+	return &DriftChecker{
+		path:     cfg.path,
+		source:   cfg.Source(),
+		hash:     cfg.hash,
+		version:  cfg.Version,
+		included: cfg.includedFiles,
+	}
+}
+
+// Check returns the drift when the file, or one of its included files,
+// changed since it was loaded and the change wasn't reported yet, nil
+// otherwise
+func (d *DriftChecker) Check() (*Drift, error) {
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	// The files included by the loaded configuration are hashed with it:
+	// including other files requires editing it, which changes the hash
+	hash := hashFiles(data, d.included)
+	if hash == d.hash || hash == d.reported {
+		return nil, nil
+	}
+	d.reported = hash
+
+	// Read the version even when the file is invalid, ignoring other
+	// parsing errors
+	var onDisk struct {
+		Version string `json:"version" yaml:"version"`
+	}
+	if isYAMLFile(d.path) {
+		_ = yaml.Unmarshal(data, &onDisk)
+	} else {
+		_ = json.Unmarshal(data, &onDisk)
+	}
+	_, parseErr := parse(d.path, data)
+
+	return &Drift{
+		Path:          d.source,
+		LoadedVersion: d.version,
+		DiskVersion:   onDisk.Version,
+		LoadedHash:    d.hash,
+		DiskHash:      hash,
+		Err:           parseErr,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration that is written as a human readable string
+// (e.g. "30s", "5m") in configuration files
+type Duration time.Duration
+
+// Std returns the value as a standard time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// String returns the duration formatted like time.Duration
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// parseDuration accepts either a duration string or a plain number of seconds
+func parseDuration(value string) (Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if parsed, err := time.ParseDuration(value); err == nil {
+		return Duration(parsed), nil
+	}
+	var seconds float64
+	if _, err := fmt.Sscanf(value, "%g", &seconds); err == nil {
+		return Duration(seconds * float64(time.Second)), nil
+	}
+	return 0, fmt.Errorf("invalid duration %q", value)
+}
+
+// MarshalJSON encodes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON decodes a duration from a string or a number of seconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch value := raw.(type) {
+	case string:
+		parsed, err := parseDuration(value)
+		if err != nil {
+			return err
+		}
+		*d = parsed
+	case float64:
+		*d = Duration(value * float64(time.Second))
+	case nil:
+		*d = 0
+	default:
+		return fmt.Errorf("invalid duration %v", raw)
+	}
+	return nil
+}
+
+// MarshalYAML encodes the duration as a string
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// UnmarshalYAML decodes a duration from a string or a number of seconds
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := parseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// encryptedPattern matches the values encrypted with age, written
+// ENC[age,<base64 of the encrypted value>]
+var encryptedPattern = regexp.MustCompile(`ENC\[age,([A-Za-z0-9+/=\s]+)\]`)
+
+// ageKeyFile is the file holding the age identities decrypting the values,
+// read from $DELIVR_AGE_KEY_FILE when empty
+var ageKeyFile string
+
+// SetAgeKeyFile sets the file holding the age identities that decrypt the
+// encrypted values of the configurations loaded afterwards
+func SetAgeKeyFile(path string) {
+	ageKeyFile = path
+}
+
+// ageIdentities returns the identities decrypting the values: the ones of
+// $DELIVR_AGE_KEY, or of the key file
+func ageIdentities() ([]age.Identity, error) {
+	if key := os.Getenv("DELIVR_AGE_KEY"); key != "" {
+		identities, err := age.ParseIdentities(strings.NewReader(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid DELIVR_AGE_KEY: %w", err)
+		}
+		return identities, nil
+	}
+	path := ageKeyFile
+	if path == "" {
+		path = os.Getenv("DELIVR_AGE_KEY_FILE")
+	}
+	if path == "" {
+		return nil, errors.New("the configuration has encrypted values, but no age key is set: use --age-key-file, DELIVR_AGE_KEY_FILE or DELIVR_AGE_KEY")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the age key: %w", err)
+	}
+	defer f.Close()
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age key %s: %w", path, err)
+	}
+	return identities, nil
+}
+
+// keyRecipients returns the recipients matching the identities decrypting
+// the values, so that values can be encrypted for them
+func keyRecipients() ([]age.Recipient, error) {
+	identities, err := ageIdentities()
+	if err != nil {
+		return nil, err
+	}
+	var recipients []age.Recipient
+	for _, identity := range identities {
+		if x25519, ok := identity.(*age.X25519Identity); ok {
+			recipients = append(recipients, x25519.Recipient())
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, errors.New("the age key has no X25519 identity")
+	}
+	return recipients, nil
+}
+
+// Encrypt encrypts a value for age recipients (age1...), or for the age key
+// decrypting the values when there are none, written so that it can be
+// pasted in a configuration file
+func Encrypt(value string, recipientKeys []string) (string, error) {
+	var recipients []age.Recipient
+	for _, key := range recipientKeys {
+		recipient, err := age.ParseX25519Recipient(key)
+		if err != nil {
+			return "", err
+		}
+		recipients = append(recipients, recipient)
+	}
+	if len(recipients) == 0 {
+		var err error
+		if recipients, err = keyRecipients(); err != nil {
+			return "", err
+		}
+	}
+
+	var out bytes.Buffer
+	w, err := age.Encrypt(&out, recipients...)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(w, value); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return "ENC[age," + base64.StdEncoding.EncodeToString(out.Bytes()) + "]", nil
+}
+
+// decrypter decrypts the encrypted values of a configuration, loading the
+// identities at the first one
+type decrypter struct {
+	identities []age.Identity
+	// values are the decrypted values
+	values []string
+}
+
+// decrypt replaces the encrypted values of s with their plain values
+func (d *decrypter) decrypt(s string) (string, error) {
+	if !strings.Contains(s, "ENC[age,") {
+		return s, nil
+	}
+	if d.identities == nil {
+		identities, err := ageIdentities()
+		if err != nil {
+			return "", err
+		}
+		d.identities = identities
+	}
+
+	var decryptErr error
+	decrypted := encryptedPattern.ReplaceAllStringFunc(s, func(value string) string {
+		encoded := strings.Join(strings.Fields(encryptedPattern.FindStringSubmatch(value)[1]), "")
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			decryptErr = fmt.Errorf("invalid encrypted value: %w", err)
+			return ""
+		}
+		r, err := age.Decrypt(bytes.NewReader(data), d.identities...)
+		if err != nil {
+			decryptErr = fmt.Errorf("failed to decrypt the value: %w", err)
+			return ""
+		}
+		plain, err := io.ReadAll(r)
+		if err != nil {
+			decryptErr = fmt.Errorf("failed to decrypt the value: %w", err)
+			return ""
+		}
+		d.values = append(d.values, string(plain))
+		return string(plain)
+	})
+	return decrypted, decryptErr
+}
+
+// decryptValues replaces the encrypted values of the settings with their
+// plain values, reporting the field of the first one that can't be decrypted
+func (c *Config) decryptValues(path string) error {
+	d := &decrypter{}
+	if err := d.walk(reflect.ValueOf(c).Elem(), "", path); err != nil {
+		return err
+	}
+	c.decrypted = d.values
+	return nil
+}
+
+// DecryptedValues returns the plain values of the encrypted values of the
+// configuration, to mask them in the output of the commands
+func (c *Config) DecryptedValues() []string {
+	return c.decrypted
+}
+
+// walk decrypts the strings held by v, named field in the file
+func (d *decrypter) walk(v reflect.Value, field, file string) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return d.walk(v.Elem(), field, file)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			if field != "" {
+				name = field + "." + name
+			}
+			if err := d.walk(v.Field(i), name, file); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := d.walk(v.Index(i), fmt.Sprintf("%s[%d]", field, i), file); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			name := fmt.Sprintf("%s.%v", field, key)
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := d.walk(elem, name, file); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.String:
+		decrypted, err := d.decrypt(v.String())
+		if err != nil {
+			return &Error{File: file, Field: field, Msg: err.Error()}
+		}
+		v.SetString(decrypted)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Environment is a profile of the configuration, selected with --env, whose
+// variables are substituted in the command definitions
+type Environment struct {
+	Vars map[string]string `json:"vars,omitempty" yaml:"vars,omitempty"`
+}
+
+// selectedEnvironment is the environment applied to the loaded
+// configurations
+var selectedEnvironment string
+
+// SelectEnvironment selects the environment applied to the configurations
+// loaded afterwards, none when empty
+func SelectEnvironment(name string) {
+	selectedEnvironment = name
+}
+
+// Environment returns the name of the environment applied to the
+// configuration, empty when none was selected
+func (c *Config) Environment() string {
+	return c.environment
+}
+
+// templatePattern matches the {{ .vars.NAME }} and {{ .env }} references.
+// Other {{ }} expressions, e.g. docker --format templates, are kept as is.
+var templatePattern = regexp.MustCompile(`\{\{\s*\.(?:vars\.([A-Za-z_][A-Za-z0-9_]*)|(env))\s*\}\}`)
+
+// applyEnvironment substitutes the variables of the selected environment,
+// which override the top-level ones, in the command definitions. References
+// to undefined variables are an error.
+func (c *Config) applyEnvironment() error {
+	vars := make(map[string]string, len(c.Vars))
+	for name, value := range c.Vars {
+		vars[name] = value
+	}
+	if selectedEnvironment != "" {
+		env, ok := c.Environments[selectedEnvironment]
+		if !ok {
+			names := make([]string, 0, len(c.Environments))
+			for name := range c.Environments {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if len(names) == 0 {
+				return fmt.Errorf("unknown environment '%s', the configuration defines no environments", selectedEnvironment)
+			}
+			return fmt.Errorf("unknown environment '%s', must be one of %s", selectedEnvironment, strings.Join(names, ", "))
+		}
+		for name, value := range env.Vars {
+			vars[name] = value
+		}
+		c.environment = selectedEnvironment
+	}
+
+	undefined := make(map[string]bool)
+	c.commandFields(func(s string) string {
+		if !strings.Contains(s, "{{") {
+			return s
+		}
+		return templatePattern.ReplaceAllStringFunc(s, func(ref string) string {
+			match := templatePattern.FindStringSubmatch(ref)
+			if match[2] != "" {
+				if c.environment == "" {
+					undefined[".env"] = true
+				}
+				return c.environment
+			}
+			value, ok := vars[match[1]]
+			if !ok {
+				undefined[".vars."+match[1]] = true
+			}
+			return value
+		})
+	})
+
+	if len(undefined) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(undefined))
+	for name := range undefined {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if c.environment == "" {
+		return fmt.Errorf("undefined template variables referenced in the commands, no environment selected: %s", strings.Join(names, ", "))
+	}
+	return fmt.Errorf("undefined template variables referenced in the commands with environment '%s': %s", c.environment, strings.Join(names, ", "))
+}
+
+// commandFields replaces each templated and interpolated field of the
+// commands and their hooks with the result of expand
+func (c *Config) commandFields(expand func(string) string) {
+	for i := range c.Commands {
+		c.Commands[i] = c.Commands[i].Expand(expand)
+	}
+}
+
+// Expand returns a copy of the command with expand applied to the fields
+// holding templates and variable references: the command line, conditions,
+// environment, working directory, standard input, actions and hooks. The command itself
+// isn't modified.
+func (c Command) Expand(expand func(string) string) Command {
+	expandAll := func(values []string) []string {
+		if values == nil {
+			return nil
+		}
+		expanded := make([]string, len(values))
+		for i, value := range values {
+			expanded[i] = expand(value)
+		}
+		return expanded
+	}
+	c.Description = expand(c.Description)
+	c.Command = expand(c.Command)
+	c.Shell = expand(c.Shell)
+	c.OnlyIf = expand(c.OnlyIf)
+	c.SkipIf = expand(c.SkipIf)
+	c.Dir = expand(c.Dir)
+	c.Args = expandAll(c.Args)
+	c.EnvVars = expandAll(c.EnvVars)
+	if c.Stdin != nil {
+		stdin := *c.Stdin
+		stdin.Text = expand(stdin.Text)
+		stdin.File = expand(stdin.File)
+		c.Stdin = &stdin
+	}
+	if c.Docker != nil {
+		action := *c.Docker
+		action.Image = expand(action.Image)
+		action.Container = expand(action.Container)
+		action.Env = expandAll(action.Env)
+		action.Cmd = expandAll(action.Cmd)
+		c.Docker = &action
+	}
+	if c.Compose != nil {
+		action := *c.Compose
+		action.File = expand(action.File)
+		action.Project = expand(action.Project)
+		c.Compose = &action
+	}
+	if c.K8s != nil {
+		action := *c.K8s
+		action.Context = expand(action.Context)
+		action.Namespace = expand(action.Namespace)
+		action.Manifests = expandAll(action.Manifests)
+		action.Workloads = expandAll(action.Workloads)
+		c.K8s = &action
+	}
+	expandHooks := func(hooks []Hook) []Hook {
+		if hooks == nil {
+			return nil
+		}
+		expanded := make([]Hook, len(hooks))
+		for i, hook := range hooks {
+			hook.Command = expand(hook.Command)
+			hook.Shell = expand(hook.Shell)
+			hook.Args = expandAll(hook.Args)
+			expanded[i] = hook
+		}
+		return expanded
+	}
+	c.PreHooks = expandHooks(c.PreHooks)
+	c.PostHooks = expandHooks(c.PostHooks)
+	return c
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Error is an error of the configuration file, located as precisely as
+// the decoder allows
+type Error struct {
+	File string
+	// Line and Column are 1-based, 0 when unknown
+	Line   int
+	Column int
+	// Field is the path of the field in error, e.g. commands[2].timeout
+	Field string
+	Msg   string
+}
+
+// Error formats the error as file:line:column: field: message
+func (e *Error) Error() string {
+	var msg strings.Builder
+	msg.WriteString(e.File)
+	if e.Line > 0 {
+		fmt.Fprintf(&msg, ":%d", e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&msg, ":%d", e.Column)
+		}
+	}
+	if e.Field != "" {
+		fmt.Fprintf(&msg, ": %s", e.Field)
+	}
+	fmt.Fprintf(&msg, ": %s", e.Msg)
+	return msg.String()
+}
+
+// yamlLinePattern extracts the line from the errors of the YAML decoder and
+// of the custom unmarshalers, e.g. "yaml: line 3: mapping values are not allowed"
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// jsonIndexPattern matches the array indexes of the field paths of the JSON
+// decoder, e.g. ".2" in "commands.2.timeout"
+var jsonIndexPattern = regexp.MustCompile(`\.(\d+)\b`)
+
+// decodeError converts an error of the YAML or JSON decoder into an Error
+// located in the file
+func decodeError(path string, data []byte, err error) *Error {
+	cfgErr := &Error{File: path, Msg: err.Error()}
+
+	if isYAMLFile(path) {
+		// Type errors are collected for the whole document, report the first
+		more := 0
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+			cfgErr.Msg = typeErr.Errors[0]
+			more = len(typeErr.Errors) - 1
+		}
+		if match := yamlLinePattern.FindStringSubmatch(cfgErr.Msg); match != nil {
+			cfgErr.Line, _ = strconv.Atoi(match[1])
+			cfgErr.Msg = match[2]
+			var root yaml.Node
+			if yaml.Unmarshal(data, &root) == nil {
+				cfgErr.Field = yamlFieldAt(&root, cfgErr.Line, "")
+			}
+		}
+		if more > 0 {
+			cfgErr.Msg += fmt.Sprintf(" (and %d more errors)", more)
+		}
+		return cfgErr
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		cfgErr.Line, cfgErr.Column = position(data, syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		cfgErr.Line, cfgErr.Column = position(data, typeErr.Offset)
+		cfgErr.Field = jsonIndexPattern.ReplaceAllString(typeErr.Field, "[$1]")
+		cfgErr.Msg = fmt.Sprintf("cannot use %s as %s", typeErr.Value, typeErr.Type)
+	}
+	return cfgErr
+}
+
+// position returns the line and column of a byte offset
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, column - 1
+}
+
+// yamlFieldAt returns the path of the deepest field defined at a line of a
+// YAML document, or an empty string
+func yamlFieldAt(node *yaml.Node, line int, path string) string {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if field := yamlFieldAt(child, line, path); field != "" {
+				return field
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field := key.Value
+			if path != "" {
+				field = path + "." + key.Value
+			}
+			if nested := yamlFieldAt(value, line, field); nested != "" {
+				return nested
+			}
+			if key.Line == line || value.Line == line {
+				return field
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			field := fmt.Sprintf("%s[%d]", path, i)
+			if nested := yamlFieldAt(item, line, field); nested != "" {
+				return nested
+			}
+			if item.Line == line {
+				return field
+			}
+		}
+	}
+	return ""
+}
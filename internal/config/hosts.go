@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"path"
+)
+
+// RunsOn reports whether the command runs on the named host, i.e. it isn't
+// restricted to some hosts or one of its host patterns matches the name
+func (c Command) RunsOn(host string) bool {
+	if len(c.Hosts) == 0 {
+		return true
+	}
+	for _, pattern := range c.Hosts {
+		if matched, _ := path.Match(pattern, host); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateHosts checks the host patterns of the commands
+func (c *Config) ValidateHosts() error {
+	for _, cmd := range c.Commands {
+		for _, pattern := range cmd.Hosts {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("command '%s': invalid host pattern '%s'", cmd.Name, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// ScopeToHost removes the commands that don't run on the named host, and
+// returns their names. Pipelines skip them, and triggers naming them are
+// rejected.
+func (c *Config) ScopeToHost(host string) []string {
+	var removed []string
+	commands := make([]Command, 0, len(c.Commands))
+	for _, cmd := range c.Commands {
+		if cmd.RunsOn(host) {
+			commands = append(commands, cmd)
+			continue
+		}
+		if c.otherHosts == nil {
+			c.otherHosts = make(map[string]bool)
+		}
+		c.otherHosts[cmd.Name] = true
+		removed = append(removed, cmd.Name)
+	}
+	c.Commands = commands
+	return removed
+}
+
+// OnOtherHost reports whether the named command was removed by ScopeToHost
+func (c *Config) OnOtherHost(name string) bool {
+	return c.otherHosts[name]
+}
+
+// Remote reports whether the command runs on remote hosts
+func (c Command) Remote() bool {
+	return c.Host != "" || len(c.Targets) > 0
+}
+
+// RemoteHosts returns the remote hosts the command runs on, in order and
+// without duplicates, with the host groups expanded
+func (c Command) RemoteHosts(groups map[string][]string) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	add := func(host string) {
+		if !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	for _, target := range append([]string{c.Host}, c.Targets...) {
+		if target == "" {
+			continue
+		}
+		if group, ok := groups[target]; ok {
+			for _, host := range group {
+				add(host)
+			}
+			continue
+		}
+		add(target)
+	}
+	return hosts
+}
@@ -0,0 +1,278 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// library is the content of an included file: commands and the definitions
+// they share
+type library struct {
+	Include    []string                `json:"include,omitempty" yaml:"include,omitempty"`
+	Commands   []Command               `json:"commands,omitempty" yaml:"commands,omitempty"`
+	Pipelines  map[string][]string     `json:"pipelines,omitempty" yaml:"pipelines,omitempty"`
+	HostGroups map[string][]string     `json:"hostGroups,omitempty" yaml:"hostGroups,omitempty"`
+	Secrets    map[string]SecretConfig `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+	Vars       map[string]string       `json:"vars,omitempty" yaml:"vars,omitempty"`
+}
+
+// includer merges the included files into a configuration
+type includer struct {
+	// files are the paths of the included files, in the order they were read
+	files []string
+	// loaded are the absolute paths of the files already read, the
+	// configuration file included
+	loaded map[string]bool
+	// origins are the files defining each name, by kind of definition
+	origins map[string]map[string]string
+}
+
+// applyIncludes merges the files listed in include, and those they include,
+// into the configuration. The commands of the included files come first, in
+// the order of the list, then those of the configuration file. A file is
+// read once, whatever the number of times it is included. Commands,
+// pipelines, host groups and secrets defined by several files are an error,
+// while the variables of a file override those of the files it includes.
+func (c *Config) applyIncludes(path string) error {
+	if len(c.Include) == 0 {
+		return nil
+	}
+	in := &includer{loaded: make(map[string]bool), origins: make(map[string]map[string]string)}
+	if abs, err := filepath.Abs(path); err == nil {
+		in.loaded[abs] = true
+	}
+
+	main := library{Commands: c.Commands, Pipelines: c.Pipelines, HostGroups: c.HostGroups, Secrets: c.Secrets, Vars: c.Vars}
+	merged, err := in.include(path, c.Include)
+	if err != nil {
+		return err
+	}
+	if err := in.define(path, main); err != nil {
+		return err
+	}
+	merged.merge(main)
+
+	c.Commands = merged.Commands
+	c.Pipelines = merged.Pipelines
+	c.HostGroups = merged.HostGroups
+	c.Secrets = merged.Secrets
+	c.Vars = merged.Vars
+	c.includedFiles = in.files
+	return nil
+}
+
+// include reads and merges the files matching the patterns, relative to the
+// directory of the including file from
+func (in *includer) include(from string, patterns []string) (library, error) {
+	var merged library
+	for _, pattern := range patterns {
+		files, err := includedFiles(filepath.Dir(from), pattern)
+		if err != nil {
+			return merged, &Error{File: from, Field: "include", Msg: err.Error()}
+		}
+		for _, file := range files {
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				return merged, &Error{File: from, Field: "include", Msg: err.Error()}
+			}
+			if in.loaded[abs] {
+				continue
+			}
+			in.loaded[abs] = true
+
+			lib, err := readLibrary(file)
+			if err != nil {
+				return merged, err
+			}
+			in.files = append(in.files, file)
+			// The files a library includes come before it, and its variables
+			// override theirs
+			nested, err := in.include(file, lib.Include)
+			if err != nil {
+				return merged, err
+			}
+			if err := in.define(file, lib); err != nil {
+				return merged, err
+			}
+			nested.merge(lib)
+			merged.merge(nested)
+		}
+	}
+	return merged, nil
+}
+
+// includedFiles returns the files matching an include pattern, sorted: a
+// file, a directory whose YAML and JSON files are included, or a glob pattern
+func includedFiles(dir, pattern string) ([]string, error) {
+	path := pattern
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("included file not found: %s", pattern)
+		}
+		if !info.IsDir() {
+			return []string{path}, nil
+		}
+		path = filepath.Join(path, "*")
+	}
+
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include pattern '%s': %w", pattern, err)
+	}
+	var files []string
+	for _, match := range matches {
+		if info, err := os.Stat(match); err != nil || info.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(match))
+		if ext == ".yml" || ext == ".yaml" || ext == ".json" {
+			files = append(files, match)
+		}
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// libraryFieldsMsg is the error of a field of an included file that isn't
+// one of a library
+const libraryFieldsMsg = "included files can only define commands, pipelines, hostGroups, secrets, vars and include"
+
+// readLibrary decodes an included file, which can only hold the fields of a
+// library and extension keys
+func readLibrary(path string) (library, error) {
+	var lib library
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return lib, &Error{File: path, Msg: err.Error()}
+	}
+	if isYAMLFile(path) {
+		err = yaml.Unmarshal(data, &lib)
+	} else {
+		err = json.Unmarshal(data, &lib)
+	}
+	if err != nil {
+		return lib, decodeError(path, data, err)
+	}
+	if err := checkFields(path, data, reflect.TypeOf(library{})); err != nil {
+		var fields FieldErrors
+		var cfgErr *Error
+		switch {
+		case errors.As(err, &fields):
+			// The settings of a configuration file are not library fields
+			for _, field := range fields {
+				if !strings.ContainsAny(field.Field, ".[") {
+					field.Msg = libraryFieldsMsg
+				}
+			}
+		case errors.As(err, &cfgErr) && strings.HasPrefix(cfgErr.Msg, "json: unknown field"):
+			cfgErr.Msg = libraryFieldsMsg
+		}
+		return lib, err
+	}
+	return lib, nil
+}
+
+// merge adds the definitions of src to the library, the variables of src
+// overriding its own
+func (l *library) merge(src library) {
+	l.Commands = append(l.Commands, src.Commands...)
+	for name, steps := range src.Pipelines {
+		if l.Pipelines == nil {
+			l.Pipelines = make(map[string][]string)
+		}
+		l.Pipelines[name] = steps
+	}
+	for name, hosts := range src.HostGroups {
+		if l.HostGroups == nil {
+			l.HostGroups = make(map[string][]string)
+		}
+		l.HostGroups[name] = hosts
+	}
+	for name, secret := range src.Secrets {
+		if l.Secrets == nil {
+			l.Secrets = make(map[string]SecretConfig)
+		}
+		l.Secrets[name] = secret
+	}
+	for name, value := range src.Vars {
+		if l.Vars == nil {
+			l.Vars = make(map[string]string)
+		}
+		l.Vars[name] = value
+	}
+}
+
+// define records the names defined by a file, failing when another file
+// already defined one of them
+func (in *includer) define(file string, lib library) error {
+	check := func(kind, name string) error {
+		if in.origins[kind] == nil {
+			in.origins[kind] = make(map[string]string)
+		}
+		if origin, ok := in.origins[kind][name]; ok && origin != file {
+			return &Error{File: file, Msg: fmt.Sprintf("%s '%s' is already defined in %s", kind, name, origin)}
+		}
+		in.origins[kind][name] = file
+		return nil
+	}
+	for _, cmd := range lib.Commands {
+		if err := check("command", cmd.Name); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(lib.Pipelines) {
+		if err := check("pipeline", name); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(lib.HostGroups) {
+		if err := check("host group", name); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(lib.Secrets) {
+		if err := check("secret", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashFiles returns the SHA-256 hash of the content of a configuration file
+// followed by the content of its included files, so that editing any of them
+// changes it. Without included files, it is the hash of the file.
+func hashFiles(data []byte, included []string) string {
+	hash := sha256.New()
+	hash.Write(data)
+	for _, file := range included {
+		if content, err := os.ReadFile(file); err == nil {
+			hash.Write(content)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// sortedKeys returns the keys of a map, sorted
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
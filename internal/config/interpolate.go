@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// variablePattern matches ${VAR} and ${VAR:-default} references, and the
+// escaped form $${VAR} which is kept as a literal ${VAR}
+var variablePattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolator expands environment variable references and remembers the
+// variables that were not set
+type interpolator struct {
+	missing map[string]bool
+}
+
+// expand replaces the variable references of s with their values
+func (in *interpolator) expand(s string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	return variablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		match := variablePattern.FindStringSubmatch(ref)
+		if value, ok := os.LookupEnv(match[1]); ok {
+			return value
+		}
+		if match[2] != "" {
+			return match[3]
+		}
+		in.missing[match[1]] = true
+		return ""
+	})
+}
+
+// interpolate expands the environment variable references of the command
+// lines, environments, working directories, URLs and secrets of the
+// configuration. Unset variables without default are reported as an error
+// when StrictEnv is set, and replaced with an empty string otherwise.
+func (c *Config) interpolate() error {
+	in := &interpolator{missing: make(map[string]bool)}
+
+	c.WorkingDir = in.expand(c.WorkingDir)
+	c.Discord.ChannelID = in.expand(c.Discord.ChannelID)
+	for i := range c.Discord.Routes {
+		c.Discord.Routes[i].ChannelID = in.expand(c.Discord.Routes[i].ChannelID)
+	}
+	for name, channel := range c.Discord.Channels {
+		c.Discord.Channels[name] = in.expand(channel)
+	}
+	if bot := c.Discord.Bot; bot != nil {
+		bot.Token = in.expand(bot.Token)
+		bot.PublicKey = in.expand(bot.PublicKey)
+	}
+	if c.Notifications != nil {
+		if slack := c.Notifications.Slack; slack != nil {
+			slack.WebhookURL = in.expand(slack.WebhookURL)
+		}
+		for i := range c.Notifications.Webhooks {
+			webhook := &c.Notifications.Webhooks[i]
+			webhook.URL = in.expand(webhook.URL)
+			for name, value := range webhook.Headers {
+				webhook.Headers[name] = in.expand(value)
+			}
+		}
+		if telegram := c.Notifications.Telegram; telegram != nil {
+			telegram.BotToken = in.expand(telegram.BotToken)
+			telegram.ChatID = in.expand(telegram.ChatID)
+		}
+		if mattermost := c.Notifications.Mattermost; mattermost != nil {
+			mattermost.WebhookURL = in.expand(mattermost.WebhookURL)
+		}
+		if ntfy := c.Notifications.Ntfy; ntfy != nil {
+			ntfy.Server = in.expand(ntfy.Server)
+			ntfy.Topic = in.expand(ntfy.Topic)
+			ntfy.Token = in.expand(ntfy.Token)
+			ntfy.Username = in.expand(ntfy.Username)
+			ntfy.Password = in.expand(ntfy.Password)
+		}
+		if gotify := c.Notifications.Gotify; gotify != nil {
+			gotify.URL = in.expand(gotify.URL)
+			gotify.Token = in.expand(gotify.Token)
+		}
+		if email := c.Notifications.Email; email != nil {
+			email.Host = in.expand(email.Host)
+			email.Username = in.expand(email.Username)
+			email.Password = in.expand(email.Password)
+			email.From = in.expand(email.From)
+			for i := range email.To {
+				email.To[i] = in.expand(email.To[i])
+			}
+		}
+	}
+	if c.Server != nil {
+		c.Server.Token = in.expand(c.Server.Token)
+		c.Server.AdminToken = in.expand(c.Server.AdminToken)
+		c.Server.WebhookSecret = in.expand(c.Server.WebhookSecret)
+	}
+	for i := range c.ImagePolls {
+		poll := &c.ImagePolls[i]
+		poll.Username = in.expand(poll.Username)
+		poll.Password = in.expand(poll.Password)
+	}
+	if c.History != nil {
+		c.History.DSN = in.expand(c.History.DSN)
+	}
+
+	if tagging := c.Tagging; tagging != nil {
+		tagging.Dir = in.expand(tagging.Dir)
+		tagging.Version = in.expand(tagging.Version)
+		if tagging.GitHub != nil {
+			tagging.GitHub.Token = in.expand(tagging.GitHub.Token)
+		}
+	}
+
+	c.commandFields(in.expand)
+
+	if len(in.missing) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(in.missing))
+	for name := range in.missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if c.StrictEnv {
+		return fmt.Errorf("environment variables referenced in the configuration are not set: %s", strings.Join(names, ", "))
+	}
+	fmt.Printf("Warning: Environment variables referenced in the configuration are not set and were replaced with an empty value: %s\n", strings.Join(names, ", "))
+	return nil
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// credentialsConfig references a variable in every credential and URL field
+// documented as expanded
+const credentialsConfig = `
+workingDir: ${SECRET}
+discord:
+  channelId: ${SECRET}
+  routes:
+    - tags: [prod]
+      channelId: ${SECRET}
+  channels:
+    ops: ${SECRET}
+  bot:
+    token: ${SECRET}
+    channelId: "1234"
+    publicKey: ${SECRET}
+notifications:
+  slack:
+    webhookUrl: ${SECRET}
+  webhooks:
+    - url: ${SECRET}
+      headers:
+        Authorization: Bearer ${SECRET}
+  telegram:
+    botToken: ${SECRET}
+    chatId: ${SECRET}
+  mattermost:
+    webhookUrl: ${SECRET}
+  ntfy:
+    server: ${SECRET}
+    topic: ${SECRET}
+    token: ${SECRET}
+    username: ${SECRET}
+    password: ${SECRET}
+  gotify:
+    url: ${SECRET}
+    token: ${SECRET}
+  email:
+    host: ${SECRET}
+    username: ${SECRET}
+    password: ${SECRET}
+    from: ${SECRET}
+    to:
+      - ${SECRET}
+server:
+  address: 127.0.0.1:8080
+  token: ${SECRET}
+  adminToken: ${SECRET}
+  webhookSecret: ${SECRET}
+history:
+  backend: postgres
+  dsn: ${SECRET}
+tagging:
+  dir: ${SECRET}
+  version: ${SECRET}
+  github:
+    repository: acme/web
+    token: ${SECRET}
+imagePolls:
+  - image: ghcr.io/acme/web:latest
+    commands: [deploy]
+    username: ${SECRET}
+    password: ${SECRET}
+commands:
+  - name: deploy
+    description: ${SECRET}
+    command: ${SECRET}
+    args:
+      - ${SECRET}
+    envVars:
+      - TOKEN=${SECRET}
+`
+
+// unexpanded returns the fields of v, named field, still holding a variable
+// reference
+func unexpanded(v reflect.Value, field string) []string {
+	var fields []string
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return unexpanded(v.Elem(), field)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			if field != "" {
+				name = field + "." + name
+			}
+			fields = append(fields, unexpanded(v.Field(i), name)...)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			fields = append(fields, unexpanded(v.Index(i), fmt.Sprintf("%s[%d]", field, i))...)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			fields = append(fields, unexpanded(v.MapIndex(key), fmt.Sprintf("%s.%v", field, key))...)
+		}
+	case reflect.String:
+		if strings.Contains(v.String(), "${") {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// TestInterpolateCredentials checks that the variables referenced by the
+// credential and URL fields are expanded
+func TestInterpolateCredentials(t *testing.T) {
+	t.Setenv("SECRET", "s3cr3t")
+	path := filepath.Join(t.TempDir(), ".delivr.yml")
+	config, err := parse(path, []byte(credentialsConfig))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if fields := unexpanded(reflect.ValueOf(config), ""); len(fields) > 0 {
+		t.Errorf("variables not expanded in %s", strings.Join(fields, ", "))
+	}
+	if got := config.History.DSN; got != "s3cr3t" {
+		t.Errorf("history.dsn is %q, want the value of the variable", got)
+	}
+	if got := config.Notifications.Webhooks[0].Headers["Authorization"]; got != "Bearer s3cr3t" {
+		t.Errorf("webhook header is %q, want the value of the variable", got)
+	}
+}
+
+// TestInterpolate checks the expansion of the variable references
+func TestInterpolate(t *testing.T) {
+	t.Setenv("SET", "value")
+	tests := []struct {
+		value   string
+		want    string
+		missing string
+	}{
+		{"plain", "plain", ""},
+		{"${SET}", "value", ""},
+		{"a-${SET}-${SET}-b", "a-value-value-b", ""},
+		{"${UNSET_VARIABLE:-default}", "default", ""},
+		{"$${SET}", "${SET}", ""},
+		{"$SET", "$SET", ""},
+		{"${UNSET_VARIABLE}", "", "UNSET_VARIABLE"},
+	}
+	for _, tt := range tests {
+		in := &interpolator{missing: make(map[string]bool)}
+		if got := in.expand(tt.value); got != tt.want {
+			t.Errorf("expand(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+		if tt.missing != "" && !in.missing[tt.missing] {
+			t.Errorf("expand(%q) didn't report %s as missing", tt.value, tt.missing)
+		}
+		if tt.missing == "" && len(in.missing) > 0 {
+			t.Errorf("expand(%q) reported %v as missing", tt.value, in.missing)
+		}
+	}
+}
+
+// TestInterpolateStrictEnv checks that the unset variables fail loading
+// with strictEnv
+func TestInterpolateStrictEnv(t *testing.T) {
+	c := &Config{StrictEnv: true, Server: &ServerConfig{WebhookSecret: "${UNSET_SECRET}"}}
+	err := c.interpolate()
+	if err == nil || !strings.Contains(err.Error(), "UNSET_SECRET") {
+		t.Errorf("interpolate returned %v, want the unset variable reported", err)
+	}
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// paramRefPattern matches the {{ .params.NAME }} references to the parameters
+// of a command
+var paramRefPattern = regexp.MustCompile(`\{\{\s*\.params\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// ValidateParams checks the names of the parameters of the commands, that the
+// commands only reference the parameters they declare, and that the commands
+// declaring some aren't run by triggers that can't supply them
+func (c *Config) ValidateParams() error {
+	for _, cmd := range c.Commands {
+		declared := make(map[string]bool, len(cmd.Params))
+		for _, name := range cmd.Params {
+			if !ValidOutputName(name) {
+				return fmt.Errorf("command '%s': invalid parameter name '%s', must be letters, digits and underscores", cmd.Name, name)
+			}
+			if declared[name] {
+				return fmt.Errorf("command '%s': duplicate parameter '%s'", cmd.Name, name)
+			}
+			declared[name] = true
+		}
+
+		var undeclared []string
+		cmd.Expand(func(s string) string {
+			for _, match := range paramRefPattern.FindAllStringSubmatch(s, -1) {
+				if !declared[match[1]] {
+					undeclared = append(undeclared, match[1])
+				}
+			}
+			return s
+		})
+		if len(undeclared) > 0 {
+			return fmt.Errorf("command '%s': references undeclared parameters: %s", cmd.Name, strings.Join(sortedUnique(undeclared), ", "))
+		}
+	}
+
+	// The git pushes, image updates, polls, file changes and workflows run
+	// their commands without parameters
+	type trigger struct {
+		name     string
+		commands []string
+	}
+	var triggers []trigger
+	add := func(name string, commands []string) {
+		triggers = append(triggers, trigger{name, commands})
+	}
+	for i, push := range c.GitPushes {
+		add(fmt.Sprintf("gitPushes[%d]", i), push.Commands)
+	}
+	for i, update := range c.ImageUpdates {
+		add(fmt.Sprintf("imageUpdates[%d]", i), update.Commands)
+	}
+	for i, poll := range c.ImagePolls {
+		add(fmt.Sprintf("imagePolls[%d]", i), poll.Commands)
+	}
+	for i, watch := range c.Watch {
+		add(fmt.Sprintf("watch[%d]", i), watch.Commands)
+	}
+	for _, workflow := range c.Workflows {
+		add(fmt.Sprintf("workflow '%s'", workflow.Name), workflow.Commands)
+	}
+	for _, trigger := range triggers {
+		for _, name := range trigger.commands {
+			steps := []string{name}
+			if pipeline, ok := c.Pipelines[name]; ok {
+				steps = pipeline
+			}
+			for _, step := range steps {
+				if cmd, ok := c.FindCommand(step); ok && len(cmd.Params) > 0 {
+					return fmt.Errorf("%s: command '%s' requires parameters, which the trigger can't supply", trigger.name, cmd.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ParseParams parses parameters written name=value
+func ParseParams(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	params := make(map[string]string, len(values))
+	for _, param := range values {
+		name, value, ok := strings.Cut(param, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !ValidOutputName(name) {
+			return nil, fmt.Errorf("invalid parameter '%s', must be written name=value", param)
+		}
+		params[name] = value
+	}
+	return params, nil
+}
+
+// CheckParams checks that params supplies the parameters of the commands, and
+// only those
+func CheckParams(commands []Command, params map[string]string) error {
+	declared := make(map[string]bool)
+	var missing []string
+	for _, cmd := range commands {
+		for _, name := range cmd.Params {
+			declared[name] = true
+			if _, ok := params[name]; !ok {
+				missing = append(missing, name)
+			}
+		}
+	}
+	var unknown []string
+	for name := range params {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing parameters "+strings.Join(sortedUnique(missing), ", "))
+	}
+	if len(unknown) > 0 {
+		problems = append(problems, "unknown parameters "+strings.Join(sortedUnique(unknown), ", "))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// WithParams returns a copy of the command with its parameter references
+// replaced by their values. Parameters not supplied are replaced by empty
+// strings, CheckParams reporting them beforehand.
+func (c Command) WithParams(params map[string]string) Command {
+	if len(c.Params) == 0 {
+		return c
+	}
+	return c.Expand(func(s string) string {
+		if !strings.Contains(s, "{{") {
+			return s
+		}
+		return paramRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+			return params[paramRefPattern.FindStringSubmatch(ref)[1]]
+		})
+	})
+}
+
+// sortedUnique returns the sorted values without duplicates
+func sortedUnique(values []string) []string {
+	sort.Strings(values)
+	unique := values[:0]
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
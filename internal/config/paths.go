@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// normalizePaths expands a leading ~ in the local paths of the configuration
+// and makes the relative ones absolute: workingDir and logs.directory are
+// relative to the directory of the configuration file, and the dir and the
+// stdin file of the commands to workingDir, or to the directory of the
+// configuration file without it. The paths holding {{ }} references, resolved
+// when the commands run, and the dir of remote commands are kept as is. The
+// stdin file being read by delivr, it is local for remote commands as well.
+func (c *Config) normalizePaths(path string) error {
+	base, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("failed to resolve the directory of the configuration file: %w", err)
+	}
+
+	if c.WorkingDir, err = normalizePath(c.WorkingDir, base); err != nil {
+		return fmt.Errorf("workingDir: %w", err)
+	}
+	if c.Logs != nil {
+		if c.Logs.Directory, err = normalizePath(c.Logs.Directory, base); err != nil {
+			return fmt.Errorf("logs.directory: %w", err)
+		}
+	}
+
+	if c.WorkingDir != "" && !strings.Contains(c.WorkingDir, "{{") {
+		base = c.WorkingDir
+	}
+	for i := range c.Commands {
+		cmd := &c.Commands[i]
+		if cmd.Stdin != nil {
+			stdin := *cmd.Stdin
+			if stdin.File, err = normalizePath(stdin.File, base); err != nil {
+				return fmt.Errorf("command '%s': stdin.file: %w", cmd.Name, err)
+			}
+			cmd.Stdin = &stdin
+		}
+		if cmd.Remote() {
+			continue
+		}
+		if cmd.Dir, err = normalizePath(cmd.Dir, base); err != nil {
+			return fmt.Errorf("command '%s': dir: %w", cmd.Name, err)
+		}
+	}
+	return nil
+}
+
+// normalizePath expands a leading ~ in a path and makes it absolute, relative
+// to base. Empty paths and paths holding {{ }} references are returned as is.
+func normalizePath(path, base string) (string, error) {
+	if path == "" || strings.Contains(path, "{{") {
+		return path, nil
+	}
+	path = filepath.FromSlash(path)
+	if path == "~" || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot expand %s: %w", path, err)
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	return filepath.Clean(path), nil
+}
+
+// ValidatePaths checks that workingDir and the dir of the local commands are
+// existing directories, that the stdin files of the commands exist, and that
+// logs.directory is a directory when it exists. The paths resolved when the
+// commands run aren't checked.
+func (c *Config) ValidatePaths() error {
+	if err := checkPath(c.WorkingDir); err != nil {
+		return fmt.Errorf("workingDir: %w", err)
+	}
+	for _, cmd := range c.Commands {
+		if cmd.Stdin != nil {
+			if err := checkFile(cmd.Stdin.File); err != nil {
+				return fmt.Errorf("command '%s': stdin.file: %w", cmd.Name, err)
+			}
+		}
+		if cmd.Remote() {
+			continue
+		}
+		if err := checkPath(cmd.Dir); err != nil {
+			return fmt.Errorf("command '%s': dir: %w", cmd.Name, err)
+		}
+	}
+	// The log directory is created when missing
+	if c.Logs != nil && c.Logs.Directory != "" {
+		if _, err := os.Stat(c.Logs.Directory); err == nil {
+			if err := CheckDirectory(c.Logs.Directory); err != nil {
+				return fmt.Errorf("logs.directory: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkPath checks a directory of the configuration, unless it is empty or
+// resolved when the commands run
+func checkPath(dir string) error {
+	if dir == "" || strings.Contains(dir, "{{") {
+		return nil
+	}
+	return CheckDirectory(dir)
+}
+
+// checkFile checks that a file of the configuration exists and isn't a
+// directory, unless its path is empty or resolved when the commands run
+func checkFile(path string) error {
+	if path == "" || strings.Contains(path, "{{") {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("file %s doesn't exist", path)
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return nil
+}
+
+// CheckDirectory checks that a path exists and is a directory
+func CheckDirectory(dir string) error {
+	info, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("directory %s doesn't exist", dir)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// maxRemoteSize is the maximum size of a configuration downloaded over HTTP
+// or from S3
+const maxRemoteSize = 10 << 20
+
+// remoteTimeout is the maximum duration of a download of the configuration
+const remoteTimeout = 2 * time.Minute
+
+// remoteChecksum is the expected SHA-256 checksum of the remote
+// configurations, or the URL of a file holding it
+var remoteChecksum string
+
+// SetRemoteChecksum sets the checksum the remote configurations loaded
+// afterwards are validated against: the hex SHA-256 of the file, or the URL
+// of a checksum file written like sha256sum does. None when empty.
+func SetRemoteChecksum(checksum string) {
+	remoteChecksum = checksum
+}
+
+// GetConfigSource returns the URL the running configuration was fetched
+// from, or the path of the local configuration file
+func GetConfigSource() string {
+	return running().Source()
+}
+
+// IsRemote reports whether a configuration source is a URL to fetch: http://,
+// https://, s3://bucket/key, or a git repository written
+// git+ssh://host/repo.git//path/to/.delivr.yml?ref=main (git+https:// and
+// git+file:// too)
+func IsRemote(source string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://", "git+ssh://", "git+https://", "git+http://", "git+file://"} {
+		if strings.HasPrefix(source, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchRemote downloads a remote configuration into the cache directory, once
+// its checksum is valid, and returns the path of the local copy. The files of
+// a git repository are checked out next to the configuration, so that it can
+// include them.
+func FetchRemote(source string) (string, error) {
+	dir, err := remoteCacheDir(source)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+
+	if strings.HasPrefix(source, "git+") {
+		return fetchGit(ctx, source, dir)
+	}
+
+	data, err := download(ctx, source)
+	if err != nil {
+		return "", err
+	}
+	if err := verifyChecksum(ctx, data); err != nil {
+		return "", err
+	}
+	local := filepath.Join(dir, "config"+remoteExt(source))
+	if current, err := os.ReadFile(local); err == nil && bytes.Equal(current, data) {
+		return local, nil
+	}
+	// Replace the copy at once, the drift checker may be reading it
+	tmp := local + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to cache the configuration: %w", err)
+	}
+	if err := os.Rename(tmp, local); err != nil {
+		return "", fmt.Errorf("failed to cache the configuration: %w", err)
+	}
+	return local, nil
+}
+
+// cachedRemote returns the path of the local copy of a remote configuration
+// fetched earlier, empty when there is none
+func cachedRemote(source string) string {
+	dir, err := remoteCacheDir(source)
+	if err != nil {
+		return ""
+	}
+	local := filepath.Join(dir, "config"+remoteExt(source))
+	if strings.HasPrefix(source, "git+") {
+		_, _, file, err := parseGitSource(source)
+		if err != nil {
+			return ""
+		}
+		local = filepath.Join(dir, "repo", filepath.FromSlash(file))
+	}
+	if _, err := os.Stat(local); err != nil {
+		return ""
+	}
+	return local
+}
+
+// loadRemote fetches a remote configuration and returns the path of its local
+// copy. When the source can't be reached, the copy fetched last is used.
+func loadRemote(source string) (string, error) {
+	local, err := FetchRemote(source)
+	if err == nil {
+		return local, nil
+	}
+	if cached := cachedRemote(source); cached != "" && !errors.Is(err, errChecksum) {
+		log.Printf("Warning: Could not fetch the configuration from %s, using the copy fetched last: %v", source, err)
+		return cached, nil
+	}
+	return "", fmt.Errorf("failed to fetch the configuration from %s: %w", source, err)
+}
+
+// remoteCacheDir returns the directory caching a remote configuration,
+// creating it when missing
+func remoteCacheDir(source string) (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		base = os.TempDir()
+	}
+	sum := sha256.Sum256([]byte(source))
+	dir := filepath.Join(base, "delivr", "config", hex.EncodeToString(sum[:8]))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create the configuration cache: %w", err)
+	}
+	return dir, nil
+}
+
+// remoteExt returns the extension of the file a URL points to, deciding
+// whether the configuration is decoded as YAML or JSON. YAML by default.
+func remoteExt(source string) string {
+	if u, err := url.Parse(source); err == nil {
+		switch ext := strings.ToLower(path.Ext(u.Path)); ext {
+		case ".yml", ".yaml", ".json":
+			return ext
+		}
+	}
+	return ".yml"
+}
+
+// download returns the content of an HTTP or S3 URL
+func download(ctx context.Context, source string) ([]byte, error) {
+	var body io.ReadCloser
+	if strings.HasPrefix(source, "s3://") {
+		u, err := url.Parse(source)
+		if err != nil || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			return nil, fmt.Errorf("invalid S3 URL %s, expected s3://bucket/key", source)
+		}
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the AWS configuration: %w", err)
+		}
+		bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+		out, err := s3.NewFromConfig(awsCfg).GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key})
+		if err != nil {
+			return nil, err
+		}
+		body = out.Body
+	} else {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		body = resp.Body
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(body, maxRemoteSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxRemoteSize {
+		return nil, fmt.Errorf("the configuration is larger than %d bytes", maxRemoteSize)
+	}
+	return data, nil
+}
+
+// errChecksum is returned when a remote configuration doesn't match the
+// expected checksum
+var errChecksum = errors.New("checksum mismatch")
+
+// verifyChecksum checks the SHA-256 checksum of a remote configuration
+// against the one set with SetRemoteChecksum, fetching the checksum file when
+// it is a URL
+func verifyChecksum(ctx context.Context, data []byte) error {
+	expected := remoteChecksum
+	if expected == "" {
+		return nil
+	}
+	if strings.HasPrefix(expected, "http://") || strings.HasPrefix(expected, "https://") || strings.HasPrefix(expected, "s3://") {
+		content, err := download(ctx, expected)
+		if err != nil {
+			return fmt.Errorf("failed to fetch the checksum from %s: %w", expected, err)
+		}
+		fields := strings.Fields(string(content))
+		if len(fields) == 0 {
+			return fmt.Errorf("the checksum file %s is empty", expected)
+		}
+		expected = fields[0]
+	}
+	expected = strings.ToLower(strings.TrimPrefix(expected, "sha256:"))
+	if _, err := hex.DecodeString(expected); err != nil || len(expected) != sha256.Size*2 {
+		return fmt.Errorf("invalid SHA-256 checksum '%s'", expected)
+	}
+
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return fmt.Errorf("%w: expected %s, got %s", errChecksum, expected, actual)
+	}
+	return nil
+}
+
+// parseGitSource splits a git source into the URL of the repository, the
+// branch or tag to check out, and the path of the configuration file in the
+// repository
+func parseGitSource(source string) (repo, ref, file string, err error) {
+	u, err := url.Parse(strings.TrimPrefix(source, "git+"))
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid git URL: %w", err)
+	}
+	ref = u.Query().Get("ref")
+	u.RawQuery = ""
+	repoPath, file, ok := strings.Cut(u.Path, "//")
+	if !ok || strings.Trim(file, "/") == "" {
+		return "", "", "", errors.New("invalid git URL, expected the path of the configuration file after //, e.g. git+ssh://git@example.com/ops.git//.delivr.yml")
+	}
+	u.Path = repoPath
+	return u.String(), ref, strings.Trim(file, "/"), nil
+}
+
+// fetchGit clones the repository of a git source, or updates the clone made
+// earlier, and returns the path of the configuration file in it. A
+// configuration not matching the checksum is left out: the clone is reset to
+// the commit checked out before.
+func fetchGit(ctx context.Context, source, dir string) (string, error) {
+	repo, ref, file, err := parseGitSource(source)
+	if err != nil {
+		return "", err
+	}
+	checkout := filepath.Join(dir, "repo")
+	local := filepath.Join(checkout, filepath.FromSlash(file))
+
+	previous := ""
+	if _, err := os.Stat(filepath.Join(checkout, ".git")); err == nil {
+		if out, err := git(ctx, checkout, "rev-parse", "HEAD"); err == nil {
+			previous = strings.TrimSpace(out)
+		}
+		target := ref
+		if target == "" {
+			target = "HEAD"
+		}
+		if _, err := git(ctx, checkout, "fetch", "--depth", "1", "origin", target); err != nil {
+			return "", err
+		}
+		if _, err := git(ctx, checkout, "reset", "--hard", "FETCH_HEAD"); err != nil {
+			return "", err
+		}
+	} else {
+		if err := os.RemoveAll(checkout); err != nil {
+			return "", err
+		}
+		args := []string{"clone", "--depth", "1"}
+		if ref != "" {
+			args = append(args, "--branch", ref)
+		}
+		if _, err := git(ctx, dir, append(args, repo, checkout)...); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := os.ReadFile(local)
+	if err == nil {
+		err = verifyChecksum(ctx, data)
+	} else {
+		err = fmt.Errorf("%s not found in %s", file, repo)
+	}
+	if err != nil {
+		if previous != "" {
+			if _, rerr := git(ctx, checkout, "reset", "--hard", previous); rerr != nil {
+				log.Printf("Warning: Could not restore the configuration repository: %v", rerr)
+			}
+		} else {
+			os.RemoveAll(checkout)
+		}
+		return "", err
+	}
+	return local, nil
+}
+
+// git runs a git command in a directory, without prompting for credentials
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
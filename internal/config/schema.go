@@ -0,0 +1,97 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// schemaURI is the JSON Schema dialect of the generated schema
+const schemaURI = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema returns the JSON Schema of the configuration files, generated from
+// the settings, so that editors can complete and check them. The unknown
+// fields are rejected, as they are when loading the configuration.
+func Schema() ([]byte, error) {
+	g := schemaGenerator{defs: make(map[string]map[string]interface{})}
+	root := g.object(reflect.TypeOf(Config{}))
+	root["$schema"] = schemaURI
+	root["title"] = "Delivr configuration"
+	root["$defs"] = g.defs
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// schemaGenerator describes the types of the settings, the structs being
+// defined once under $defs
+type schemaGenerator struct {
+	defs map[string]map[string]interface{}
+}
+
+// describe returns the schema of the values of a type
+func (g *schemaGenerator) describe(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case reflect.TypeOf(Duration(0)):
+		return map[string]interface{}{
+			"type":        []string{"string", "number"},
+			"description": "Duration such as 30s or 5m, or a number of seconds",
+		}
+	case reflect.TypeOf(Size(0)):
+		return map[string]interface{}{
+			"type":        []string{"string", "integer"},
+			"description": "Size such as 512KB or 10MB, or a number of bytes",
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if _, ok := g.defs[t.Name()]; !ok {
+			// Reserve the name first, the struct may refer to itself
+			g.defs[t.Name()] = nil
+			g.defs[t.Name()] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.describe(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.describe(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+// object returns the schema of a struct, its properties named after the YAML
+// keys. The keys starting with x- are allowed, to hold YAML anchors.
+func (g *schemaGenerator) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		properties[name] = g.describe(f.Type)
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"patternProperties":    map[string]interface{}{"^" + extensionPrefix: map[string]interface{}{}},
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Outcomes of the simulated runs of the commands
+const (
+	SimulateSuccess = "success"
+	SimulateFail    = "fail"
+	SimulateSlow    = "slow"
+)
+
+// SimulateConfig is the fake outcome of a command when running with
+// --simulate, which replaces the commands with fake runs
+type SimulateConfig struct {
+	// Outcome is success (default), fail or slow, a slow run succeeding
+	// after Duration
+	Outcome string `json:"outcome,omitempty" yaml:"outcome,omitempty"`
+	// Duration is how long the fake run lasts, 1m for slow runs and none
+	// otherwise. A run longer than the timeout of the command times out.
+	Duration Duration `json:"duration,omitempty" yaml:"duration,omitempty"`
+	// ExitCode is the exit code of the failed runs, 1 by default
+	ExitCode int `json:"exitCode,omitempty" yaml:"exitCode,omitempty"`
+	// Output is printed by the fake run, on stderr when it fails, e.g. to
+	// match the output patterns of the command
+	Output string `json:"output,omitempty" yaml:"output,omitempty"`
+	// Outputs are the step outputs exported by a successful fake run
+	Outputs map[string]string `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+}
+
+// ValidateSimulate checks the fake outcomes of the commands
+func (c *Config) ValidateSimulate() error {
+	if err := c.Simulate.validate(); err != nil {
+		return fmt.Errorf("simulate: %w", err)
+	}
+	for _, cmd := range c.Commands {
+		if err := cmd.Simulate.validate(); err != nil {
+			return fmt.Errorf("command '%s': simulate: %w", cmd.Name, err)
+		}
+	}
+	return nil
+}
+
+// validate checks a fake outcome, if any
+func (s *SimulateConfig) validate() error {
+	if s == nil {
+		return nil
+	}
+	switch s.Outcome {
+	case "", SimulateSuccess, SimulateFail, SimulateSlow:
+	default:
+		return fmt.Errorf("invalid outcome '%s', must be success, fail or slow", s.Outcome)
+	}
+	if s.Duration < 0 {
+		return errors.New("duration must be positive")
+	}
+	if s.ExitCode < 0 || s.ExitCode > 255 {
+		return errors.New("exitCode must be between 0 and 255")
+	}
+	for name := range s.Outputs {
+		if !ValidOutputName(name) {
+			return fmt.Errorf("invalid output name '%s', must be letters, digits and underscores", name)
+		}
+	}
+	return nil
+}
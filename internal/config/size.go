@@ -0,0 +1,99 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Size is a number of bytes that is written as a human readable string
+// (e.g. "512KB", "10MB") in configuration files
+type Size int64
+
+// sizeUnits are the accepted units, in powers of 1024
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// String returns the size with the largest unit dividing it
+func (s Size) String() string {
+	for _, unit := range sizeUnits {
+		if s != 0 && int64(s)%unit.multiplier == 0 {
+			return fmt.Sprintf("%d%s", int64(s)/unit.multiplier, unit.suffix)
+		}
+	}
+	return "0B"
+}
+
+// parseSize accepts a number followed by B, KB, MB or GB, or a plain number
+// of bytes
+func parseSize(value string) (Size, error) {
+	number := strings.ToUpper(strings.TrimSpace(value))
+	if number == "" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix)), unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, must be a number of bytes or end with KB, MB or GB", value)
+	}
+	return Size(n * float64(multiplier)), nil
+}
+
+// MarshalJSON encodes the size as a string
+func (s Size) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON decodes a size from a string or a number of bytes
+func (s *Size) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch value := raw.(type) {
+	case string:
+		parsed, err := parseSize(value)
+		if err != nil {
+			return err
+		}
+		*s = parsed
+	case float64:
+		*s = Size(value)
+	case nil:
+		*s = 0
+	default:
+		return fmt.Errorf("invalid size %v", raw)
+	}
+	return nil
+}
+
+// MarshalYAML encodes the size as a string
+func (s Size) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// UnmarshalYAML decodes a size from a string or a number of bytes
+func (s *Size) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := parseSize(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*s = parsed
+	return nil
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// extensionPrefix starts the keys that are ignored instead of rejected as
+// unknown fields, so that YAML anchors can be defined next to the settings
+const extensionPrefix = "x-"
+
+// FieldErrors lists the errors of several fields of a configuration file
+type FieldErrors []*Error
+
+// Error formats the errors one per line
+func (e FieldErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the errors of the fields
+func (e FieldErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// checkKnownFields rejects the fields of a configuration file that don't
+// match any setting, which the decoders would silently ignore
+func checkKnownFields(path string, data []byte) error {
+	return checkFields(path, data, reflect.TypeOf(Config{}))
+}
+
+// checkFields rejects the fields of a file decoded to t that don't match any
+// of its fields, the extension keys excepted. JSON files are parsed as YAML,
+// of which JSON is a subset, to locate the fields, and decoded strictly
+// without their extension keys when that fails.
+func checkFields(path string, data []byte, t reflect.Type) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		if isYAMLFile(path) {
+			return decodeError(path, data, err)
+		}
+		var doc interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return decodeError(path, data, err)
+		}
+		stripped, err := json.Marshal(withoutExtensions(doc))
+		if err != nil {
+			return decodeError(path, data, err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(stripped))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(reflect.New(t).Interface()); err != nil {
+			return decodeError(path, data, err)
+		}
+		return nil
+	}
+
+	w := fieldWalker{file: path, foldCase: !isYAMLFile(path)}
+	for _, doc := range root.Content {
+		w.walk(doc, t, "")
+	}
+	if len(w.unknown) > 0 {
+		return w.unknown
+	}
+	return nil
+}
+
+// withoutExtensions removes the extension keys from the objects of a JSON
+// document
+func withoutExtensions(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if strings.HasPrefix(key, extensionPrefix) {
+				delete(v, key)
+				continue
+			}
+			v[key] = withoutExtensions(value)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = withoutExtensions(item)
+		}
+	}
+	return v
+}
+
+// fieldWalker compares the nodes of a document with the types they decode to
+type fieldWalker struct {
+	file string
+	// foldCase matches the keys case-insensitively, as the JSON decoder does
+	foldCase bool
+	unknown  FieldErrors
+}
+
+// walk checks the keys of the mappings of a node decoded to t
+func (w *fieldWalker) walk(node *yaml.Node, t reflect.Type, path string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()) {
+		return
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Tag == "!!merge" || strings.HasPrefix(key.Value, extensionPrefix) {
+				continue
+			}
+			field := key.Value
+			if path != "" {
+				field = path + "." + key.Value
+			}
+			ft, ok := w.fieldType(t, key.Value)
+			if !ok {
+				msg := "unknown field"
+				if name := w.closestField(t, key.Value); name != "" {
+					msg += fmt.Sprintf(", did you mean %s?", name)
+				}
+				w.unknown = append(w.unknown, &Error{File: w.file, Line: key.Line, Column: key.Column, Field: field, Msg: msg})
+				continue
+			}
+			w.walk(value, ft, field)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			w.walk(node.Content[i+1], t.Elem(), fmt.Sprintf("%s.%s", path, node.Content[i].Value))
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			w.walk(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+// fieldNames returns the names of the fields of a struct in the file, empty
+// for the fields that aren't decoded
+func (w *fieldWalker) fieldNames(t reflect.Type) []string {
+	tag := "json"
+	if !w.foldCase {
+		tag = "yaml"
+	}
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if name == "-" {
+			names = append(names, "")
+			continue
+		}
+		if name == "" {
+			name = f.Name
+			if !w.foldCase {
+				name = strings.ToLower(name)
+			}
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// fieldType returns the type of the field of a struct named key in the file
+func (w *fieldWalker) fieldType(t reflect.Type, key string) (reflect.Type, bool) {
+	for i, name := range w.fieldNames(t) {
+		if name == key || (w.foldCase && strings.EqualFold(name, key)) {
+			return t.Field(i).Type, true
+		}
+	}
+	return nil, false
+}
+
+// closestField returns the field of a struct whose name is the closest to an
+// unknown key, to suggest it, empty when none is close enough
+func (w *fieldWalker) closestField(t reflect.Type, key string) string {
+	closest, best := "", 3
+	for _, name := range w.fieldNames(t) {
+		if name == "" {
+			continue
+		}
+		if strings.EqualFold(name, key) {
+			return name
+		}
+		if d := editDistance(strings.ToLower(name), strings.ToLower(key)); d < best {
+			closest, best = name, d
+		}
+	}
+	return closest
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,47 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+)
+
+// File is a file attached to a message
+type File struct {
+	Name    string
+	Content []byte
+}
+
+// attachmentRef describes an attached file in the JSON payload of a message
+type attachmentRef struct {
+	ID       int    `json:"id"`
+	Filename string `json:"filename"`
+}
+
+// multipartMessage encodes a message payload and a file as the multipart
+// body expected by the API, returning the body and its content type
+func multipartMessage(payload map[string]interface{}, file File) (*bytes.Buffer, string, error) {
+	payload["attachments"] = []attachmentRef{{ID: 0, Filename: file.Name}}
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("error marshaling JSON: %w", err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writer.WriteField("payload_json", string(jsonData)); err != nil {
+		return nil, "", err
+	}
+	part, err := writer.CreateFormFile("files[0]", file.Name)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := part.Write(file.Content); err != nil {
+		return nil, "", err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return &body, writer.FormDataContentType(), nil
+}
@@ -0,0 +1,188 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// apiBaseURL is the base URL of the Discord REST API
+const apiBaseURL = "https://discord.com/api/v10"
+
+// Bot handles Discord API interactions authenticated with a bot token
+type Bot struct {
+	token   string
+	client  *http.Client
+	limiter rateLimiter
+}
+
+// NewBot creates a new Discord bot client
+func NewBot(token string) (*Bot, error) {
+	if token == "" {
+		return nil, errors.New("discord bot token is required")
+	}
+	return &Bot{
+		token:  token,
+		client: &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+// CreateMessage posts a message in a channel or thread and returns its ID
+func (b *Bot) CreateMessage(channelID, content string) (string, error) {
+	var created struct {
+		ID string `json:"id"`
+	}
+	payload := map[string]interface{}{"content": content}
+	if err := b.do(http.MethodPost, "/channels/"+channelID+"/messages", payload, &created); err != nil {
+		return "", fmt.Errorf("error sending message to Discord: %w", err)
+	}
+	return created.ID, nil
+}
+
+// CreateMessageWithFile posts a message with a file attached in a channel or
+// thread and returns its ID
+func (b *Bot) CreateMessageWithFile(channelID, content string, file File) (string, error) {
+	body, contentType, err := multipartMessage(map[string]interface{}{"content": content}, file)
+	if err != nil {
+		return "", fmt.Errorf("error sending message to Discord: %w", err)
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := b.send(http.MethodPost, "/channels/"+channelID+"/messages", body, contentType, &created); err != nil {
+		return "", fmt.Errorf("error sending message to Discord: %w", err)
+	}
+	return created.ID, nil
+}
+
+// CreateEmbed posts a rich embed message in a channel or thread and returns
+// its ID. The file is attached to the message unless nil.
+func (b *Bot) CreateEmbed(channelID string, embed *Embed, file *File) (string, error) {
+	var created struct {
+		ID string `json:"id"`
+	}
+	payload := map[string]interface{}{"embeds": []*Embed{embed}}
+	var err error
+	if file == nil {
+		err = b.do(http.MethodPost, "/channels/"+channelID+"/messages", payload, &created)
+	} else {
+		body, contentType, merr := multipartMessage(payload, *file)
+		if merr != nil {
+			return "", fmt.Errorf("error sending embed to Discord: %w", merr)
+		}
+		err = b.send(http.MethodPost, "/channels/"+channelID+"/messages", body, contentType, &created)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error sending embed to Discord: %w", err)
+	}
+	return created.ID, nil
+}
+
+// CreateMessageWithComponents posts a message with components, e.g.
+// buttons, in a channel or thread and returns its ID
+func (b *Bot) CreateMessageWithComponents(channelID, content string, components []Component) (string, error) {
+	var created struct {
+		ID string `json:"id"`
+	}
+	payload := map[string]interface{}{"content": content, "components": components}
+	if err := b.do(http.MethodPost, "/channels/"+channelID+"/messages", payload, &created); err != nil {
+		return "", fmt.Errorf("error sending message to Discord: %w", err)
+	}
+	return created.ID, nil
+}
+
+// EditMessageWithComponents replaces the content and the components of a
+// message
+func (b *Bot) EditMessageWithComponents(channelID, messageID, content string, components []Component) error {
+	payload := map[string]interface{}{"content": content, "components": components}
+	if err := b.do(http.MethodPatch, "/channels/"+channelID+"/messages/"+messageID, payload, nil); err != nil {
+		return fmt.Errorf("error editing Discord message: %w", err)
+	}
+	return nil
+}
+
+// EditMessage replaces the content of a message
+func (b *Bot) EditMessage(channelID, messageID, content string) error {
+	payload := map[string]interface{}{"content": content}
+	if err := b.do(http.MethodPatch, "/channels/"+channelID+"/messages/"+messageID, payload, nil); err != nil {
+		return fmt.Errorf("error editing Discord message: %w", err)
+	}
+	return nil
+}
+
+// DeleteMessage deletes a message
+func (b *Bot) DeleteMessage(channelID, messageID string) error {
+	if err := b.do(http.MethodDelete, "/channels/"+channelID+"/messages/"+messageID, nil, nil); err != nil {
+		return fmt.Errorf("error deleting Discord message: %w", err)
+	}
+	return nil
+}
+
+// CheckChannel fetches a channel without posting, to verify that the token is
+// valid and that the bot can see the channel
+func (b *Bot) CheckChannel(channelID string) error {
+	if err := b.do(http.MethodGet, "/channels/"+channelID, nil, nil); err != nil {
+		return fmt.Errorf("error checking Discord channel: %w", err)
+	}
+	return nil
+}
+
+// StartThread creates a thread attached to a message and returns its ID,
+// which can be used as a channel ID to post in the thread
+func (b *Bot) StartThread(channelID, messageID, name string) (string, error) {
+	// Thread names are limited to 100 characters
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	var thread struct {
+		ID string `json:"id"`
+	}
+	payload := map[string]interface{}{
+		"name":                  name,
+		"auto_archive_duration": 1440,
+	}
+	if err := b.do(http.MethodPost, "/channels/"+channelID+"/messages/"+messageID+"/threads", payload, &thread); err != nil {
+		return "", fmt.Errorf("error creating Discord thread: %w", err)
+	}
+	return thread.ID, nil
+}
+
+// do sends a request to the REST API and decodes the response into out
+func (b *Bot) do(method, path string, payload interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return fmt.Errorf("error marshaling JSON: %w", err)
+		}
+	}
+	return b.send(method, path, &body, "application/json", out)
+}
+
+// send sends a request body to the REST API and decodes the response into out
+func (b *Bot) send(method, path string, body io.Reader, contentType string, out interface{}) error {
+	header := http.Header{}
+	header.Set("Authorization", "Bot "+b.token)
+	header.Set("Content-Type", contentType)
+
+	resp, attempts, err := b.limiter.do(b.client, method, apiBaseURL+path, body, header)
+	if err != nil {
+		return fmt.Errorf("error calling Discord API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := statusError(resp, attempts); err != nil {
+		return err
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("error decoding response: %w", err)
+		}
+	}
+	return nil
+}
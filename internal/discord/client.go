@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 )
@@ -13,6 +14,7 @@ import (
 type Client struct {
 	// Discord webhook URL
 	webhookURL string
+	limiter    rateLimiter
 }
 
 // Message represents a Discord message
@@ -25,9 +27,9 @@ type Message struct {
 
 // Embed represents a Discord embed
 type Embed struct {
-	Title       string      `json:"title,omitempty"`
-	Description string      `json:"description,omitempty"`
-	Color       int         `json:"color,omitempty"`
+	Title       string       `json:"title,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Color       int          `json:"color,omitempty"`
 	Fields      []EmbedField `json:"fields,omitempty"`
 }
 
@@ -61,34 +63,122 @@ func (c *Client) SendMessage(content string) error {
 	return c.sendWebhookMessage(content)
 }
 
-// sendWebhookMessage sends a message via webhook
-func (c *Client) sendWebhookMessage(content string) error {
+// PostMessage sends a message and returns its ID so that it can be edited
+func (c *Client) PostMessage(content string) (string, error) {
 	message := Message{
 		Content:  content,
 		Username: "Delivr",
 	}
 
-	jsonData, err := json.Marshal(message)
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(http.MethodPost, c.webhookURL+"?wait=true", message, &created); err != nil {
+		return "", fmt.Errorf("error sending message to Discord: %w", err)
+	}
+	return created.ID, nil
+}
+
+// PostMessageWithFile sends a message with a file attached and returns its ID
+func (c *Client) PostMessageWithFile(content string, file File) (string, error) {
+	payload := map[string]interface{}{
+		"content":  content,
+		"username": "Delivr",
+	}
+	body, contentType, err := multipartMessage(payload, file)
+	if err != nil {
+		return "", fmt.Errorf("error sending message to Discord: %w", err)
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := c.send(http.MethodPost, c.webhookURL+"?wait=true", body, contentType, &created); err != nil {
+		return "", fmt.Errorf("error sending message to Discord: %w", err)
+	}
+	return created.ID, nil
+}
+
+// PostEmbed sends a rich embed message and returns its ID. The file is
+// attached to the message unless nil.
+func (c *Client) PostEmbed(embed *Embed, file *File) (string, error) {
+	var created struct {
+		ID string `json:"id"`
+	}
+	payload := map[string]interface{}{
+		"username": "Delivr",
+		"embeds":   []*Embed{embed},
+	}
+	var err error
+	if file == nil {
+		err = c.do(http.MethodPost, c.webhookURL+"?wait=true", payload, &created)
+	} else {
+		body, contentType, merr := multipartMessage(payload, *file)
+		if merr != nil {
+			return "", fmt.Errorf("error sending embed to Discord: %w", merr)
+		}
+		err = c.send(http.MethodPost, c.webhookURL+"?wait=true", body, contentType, &created)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error sending embed to Discord: %w", err)
+	}
+	return created.ID, nil
+}
+
+// EditMessage replaces the content of a message previously sent by the webhook
+func (c *Client) EditMessage(messageID, content string) error {
+	message := Message{
+		Content: content,
+	}
+
+	if err := c.do(http.MethodPatch, c.webhookURL+"/messages/"+messageID, message, nil); err != nil {
+		return fmt.Errorf("error editing Discord message: %w", err)
+	}
+	return nil
+}
+
+// do sends a JSON payload to the webhook API and decodes the response into out
+func (c *Client) do(method, url string, payload interface{}, out interface{}) error {
+	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("error marshaling JSON: %w", err)
 	}
+	return c.send(method, url, bytes.NewBuffer(jsonData), "application/json", out)
+}
+
+// send sends a request body to the webhook API and decodes the response into out
+func (c *Client) send(method, url string, body io.Reader, contentType string, out interface{}) error {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
 
-	resp, err := http.Post(c.webhookURL, "application/json", bytes.NewBuffer(jsonData))
+	resp, attempts, err := c.limiter.do(http.DefaultClient, method, url, body, header)
 	if err != nil {
 		return fmt.Errorf("error sending webhook: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var response map[string]interface{}
-		if err := json.NewDecoder(resp.Body).Decode(&response); err == nil {
-			return fmt.Errorf("error sending message to Discord: HTTP %d %s, %v", 
-				resp.StatusCode, resp.Status, response)
+	if err := statusError(resp, attempts); err != nil {
+		return err
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("error decoding response: %w", err)
 		}
-		return fmt.Errorf("error sending message to Discord: HTTP %d %s", 
-			resp.StatusCode, resp.Status)
 	}
+	return nil
+}
 
+// sendWebhookMessage sends a message via webhook
+func (c *Client) sendWebhookMessage(content string) error {
+	message := Message{
+		Content:  content,
+		Username: "Delivr",
+	}
+
+	if err := c.do(http.MethodPost, c.webhookURL, message, nil); err != nil {
+		return fmt.Errorf("error sending message to Discord: %w", err)
+	}
 	return nil
 }
 
@@ -106,27 +196,18 @@ func (c *Client) SendEmbed(title, description string, fields []EmbedField, color
 		Embeds:   []*Embed{embed},
 	}
 
-	jsonData, err := json.Marshal(message)
-	if err != nil {
-		return fmt.Errorf("error marshaling JSON: %w", err)
+	if err := c.do(http.MethodPost, c.webhookURL, message, nil); err != nil {
+		return fmt.Errorf("error sending embed to Discord: %w", err)
 	}
+	return nil
+}
 
-	resp, err := http.Post(c.webhookURL, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("error sending webhook: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var response map[string]interface{}
-		if err := json.NewDecoder(resp.Body).Decode(&response); err == nil {
-			return fmt.Errorf("error sending embed to Discord: HTTP %d %s, %v", 
-				resp.StatusCode, resp.Status, response)
-		}
-		return fmt.Errorf("error sending embed to Discord: HTTP %d %s", 
-			resp.StatusCode, resp.Status)
+// Check fetches the webhook without posting, to verify that it exists and
+// that its token is valid
+func (c *Client) Check() error {
+	if err := c.send(http.MethodGet, c.webhookURL, nil, "application/json", nil); err != nil {
+		return fmt.Errorf("error checking Discord webhook: %w", err)
 	}
-
 	return nil
 }
 
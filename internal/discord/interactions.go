@@ -0,0 +1,199 @@
+package discord
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Interaction types
+const (
+	InteractionPing               = 1
+	InteractionApplicationCommand = 2
+	InteractionMessageComponent   = 3
+)
+
+// Interaction response types
+const (
+	ResponsePong           = 1
+	ResponseChannelMessage = 4
+	ResponseUpdateMessage  = 7
+)
+
+// Message component types
+const (
+	ComponentActionRow = 1
+	ComponentButton    = 2
+)
+
+// Button styles
+const (
+	ButtonSuccess = 3
+	ButtonDanger  = 4
+)
+
+// FlagEphemeral makes a response visible only to the user who invoked the command
+const FlagEphemeral = 64
+
+// Application command option types
+const (
+	OptionSubCommand = 1
+	OptionString     = 3
+)
+
+// Interaction is an interaction received from Discord, e.g. a slash command
+type Interaction struct {
+	ID        string           `json:"id"`
+	Type      int              `json:"type"`
+	Token     string           `json:"token"`
+	ChannelID string           `json:"channel_id"`
+	Data      *InteractionData `json:"data,omitempty"`
+	Member    *Member          `json:"member,omitempty"`
+	User      *User            `json:"user,omitempty"`
+	// Message is the message holding the clicked button
+	Message *Message `json:"message,omitempty"`
+}
+
+// InteractionData holds the invoked command and its options, or the ID of
+// the clicked button
+type InteractionData struct {
+	Name     string              `json:"name"`
+	Options  []InteractionOption `json:"options,omitempty"`
+	CustomID string              `json:"custom_id,omitempty"`
+}
+
+// InteractionOption is an option or subcommand of an invoked command
+type InteractionOption struct {
+	Name    string              `json:"name"`
+	Type    int                 `json:"type"`
+	Value   interface{}         `json:"value,omitempty"`
+	Options []InteractionOption `json:"options,omitempty"`
+}
+
+// Member is the guild member who invoked an interaction
+type Member struct {
+	User  *User    `json:"user"`
+	Roles []string `json:"roles"`
+}
+
+// User is a Discord user
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// Invoker returns the user who invoked the interaction
+func (i *Interaction) Invoker() *User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// StringOption returns the value of a string option
+func (o InteractionOption) StringOption(name string) string {
+	value, _ := o.Option(name)
+	return value
+}
+
+// Option returns the value of a string option, and whether it was given
+func (o InteractionOption) Option(name string) (string, bool) {
+	for _, option := range o.Options {
+		if option.Name == name {
+			if value, ok := option.Value.(string); ok {
+				return value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// InteractionResponse is the reply to an interaction
+type InteractionResponse struct {
+	Type int                      `json:"type"`
+	Data *InteractionResponseData `json:"data,omitempty"`
+}
+
+// InteractionResponseData is the message sent in reply to an interaction
+type InteractionResponseData struct {
+	Content    string      `json:"content,omitempty"`
+	Flags      int         `json:"flags,omitempty"`
+	Components []Component `json:"components,omitempty"`
+}
+
+// Component is a component of a message: an action row holding buttons, or
+// a button
+type Component struct {
+	Type       int         `json:"type"`
+	Style      int         `json:"style,omitempty"`
+	Label      string      `json:"label,omitempty"`
+	CustomID   string      `json:"custom_id,omitempty"`
+	Disabled   bool        `json:"disabled,omitempty"`
+	Components []Component `json:"components,omitempty"`
+}
+
+// InvokedBy reports whether the interaction was invoked by one of the users,
+// or by a member with one of the roles, given by ID
+func (i *Interaction) InvokedBy(ids []string) bool {
+	user := i.Invoker()
+	for _, id := range ids {
+		if user != nil && user.ID == id {
+			return true
+		}
+		if i.Member == nil {
+			continue
+		}
+		for _, role := range i.Member.Roles {
+			if role == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ApplicationCommand is the definition of a slash command
+type ApplicationCommand struct {
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Options     []ApplicationCommandOption `json:"options,omitempty"`
+}
+
+// ApplicationCommandOption is an option or subcommand of a slash command
+type ApplicationCommandOption struct {
+	Type        int                        `json:"type"`
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Required    bool                       `json:"required,omitempty"`
+	Options     []ApplicationCommandOption `json:"options,omitempty"`
+}
+
+// VerifyInteraction checks the Ed25519 signature Discord adds to the
+// interactions it sends, as required for interaction endpoints
+func VerifyInteraction(r *http.Request, body []byte, publicKey string) error {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("invalid discord public key")
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return errors.New("missing or malformed signature")
+	}
+
+	message := append([]byte(r.Header.Get("X-Signature-Timestamp")), body...)
+	if !ed25519.Verify(ed25519.PublicKey(key), message, signature) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// RegisterCommand creates or updates a global slash command of the application
+func (b *Bot) RegisterCommand(applicationID string, command ApplicationCommand) error {
+	if err := b.do(http.MethodPost, "/applications/"+applicationID+"/commands", command, nil); err != nil {
+		return fmt.Errorf("error registering Discord command: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRateLimitRetries is the number of times a rate limited request is
+	// sent again before failing
+	maxRateLimitRetries = 5
+	// maxRetryAfter is the longest delay waited for before sending a rate
+	// limited request again. Longer limits fail the request at once.
+	maxRetryAfter = 2 * time.Minute
+	// defaultRetryAfter is the delay used when Discord doesn't give one
+	defaultRetryAfter = time.Second
+	// maxServerRetries is the number of times a request failing with a
+	// server error (5xx) is sent again before failing
+	maxServerRetries = 3
+	// serverRetryDelay is the delay before the first new attempt of a
+	// request failing with a server error, doubled after each attempt
+	serverRetryDelay = time.Second
+)
+
+// rateLimiter holds the requests to the Discord API while its rate limit is
+// exhausted, retries the requests answered with 429 Too Many Requests, and
+// the requests failing with a transient server error
+type rateLimiter struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// do sends a request, waiting for the rate limit to reset first. Requests
+// that are rate limited are sent again after the delay asked for by Discord,
+// and requests failing with a server error after an exponential backoff. The
+// last response is returned with the number of attempts when they still
+// fail.
+func (l *rateLimiter) do(client *http.Client, method, url string, body io.Reader, header http.Header) (*http.Response, int, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = io.ReadAll(body); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	limitedAttempts, serverErrors := 0, 0
+	backoff := serverRetryDelay
+	for attempt := 1; ; attempt++ {
+		l.wait()
+		req, err := http.NewRequest(method, url, bytes.NewReader(data))
+		if err != nil {
+			return nil, attempt, err
+		}
+		req.Header = header.Clone()
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, attempt, err
+		}
+		delay, limited := l.update(resp)
+		switch {
+		case limited && limitedAttempts < maxRateLimitRetries && delay <= maxRetryAfter:
+			limitedAttempts++
+			log.Printf("Rate limited by Discord, retrying in %s", delay)
+		case resp.StatusCode >= 500 && serverErrors < maxServerRetries:
+			serverErrors++
+			log.Printf("Discord answered %s, retrying in %s", resp.Status, backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+		default:
+			return resp, attempt, nil
+		}
+		resp.Body.Close()
+	}
+}
+
+// statusError returns the error of a response that isn't a success, with
+// the error reported by Discord when there is one, or nil
+func statusError(resp *http.Response, attempts int) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	suffix := ""
+	if attempts > 1 {
+		suffix = fmt.Sprintf(" after %d attempts", attempts)
+	}
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err == nil {
+		return fmt.Errorf("HTTP %d %s%s, %v", resp.StatusCode, resp.Status, suffix, response)
+	}
+	return fmt.Errorf("HTTP %d %s%s", resp.StatusCode, resp.Status, suffix)
+}
+
+// wait sleeps until the rate limit resets
+func (l *rateLimiter) wait() {
+	l.mu.Lock()
+	delay := time.Until(l.until)
+	l.mu.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// update records the rate limit reported by a response. It returns the delay
+// before the request can be sent again when it was rate limited.
+func (l *rateLimiter) update(resp *http.Response) (time.Duration, bool) {
+	var delay time.Duration
+	limited := resp.StatusCode == http.StatusTooManyRequests
+	switch {
+	case limited:
+		delay = retryAfter(resp)
+	case resp.Header.Get("X-RateLimit-Remaining") == "0":
+		delay = headerSeconds(resp.Header, "X-RateLimit-Reset-After", 0)
+	}
+	if delay > 0 && delay <= maxRetryAfter {
+		l.mu.Lock()
+		if until := time.Now().Add(delay); until.After(l.until) {
+			l.until = until
+		}
+		l.mu.Unlock()
+	}
+	return delay, limited
+}
+
+// retryAfter returns the delay before a rate limited request can be sent
+// again, from the Retry-After header or from the retry_after field of the
+// body. The body is kept readable.
+func retryAfter(resp *http.Response) time.Duration {
+	if delay := headerSeconds(resp.Header, "Retry-After", 0); delay > 0 {
+		return delay
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	var limit struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if err != nil || json.Unmarshal(data, &limit) != nil || limit.RetryAfter <= 0 {
+		return defaultRetryAfter
+	}
+	return time.Duration(limit.RetryAfter * float64(time.Second))
+}
+
+// headerSeconds parses a header holding a number of seconds, possibly
+// fractional, and returns fallback when it is missing or invalid
+func headerSeconds(header http.Header, name string, fallback time.Duration) time.Duration {
+	seconds, err := strconv.ParseFloat(header.Get(name), 64)
+	if err != nil || seconds < 0 {
+		return fallback
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
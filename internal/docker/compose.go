@@ -0,0 +1,100 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// Compose actions
+const (
+	ComposeUp      = "up"
+	ComposeDown    = "down"
+	ComposePull    = "pull"
+	ComposeRestart = "restart"
+)
+
+// Service is the state of a compose service as reported by "docker compose ps"
+type Service struct {
+	Name    string `json:"Name"`
+	Service string `json:"Service"`
+	State   string `json:"State"`
+	Health  string `json:"Health"`
+}
+
+// ValidateCompose checks that a compose action is supported
+func ValidateCompose(action *config.ComposeAction) error {
+	if action == nil {
+		return errors.New("missing compose action")
+	}
+	switch action.Action {
+	case ComposeUp, ComposeDown, ComposePull, ComposeRestart:
+		return nil
+	default:
+		return fmt.Errorf("unknown compose action '%s'", action.Action)
+	}
+}
+
+// composeBase returns the docker CLI arguments selecting the compose project
+func composeBase(action *config.ComposeAction) []string {
+	args := []string{"compose"}
+	if action.File != "" {
+		args = append(args, "--file", action.File)
+	}
+	if action.Project != "" {
+		args = append(args, "--project-name", action.Project)
+	}
+	return args
+}
+
+// ComposeArgs returns the docker CLI arguments performing a compose action
+func ComposeArgs(action *config.ComposeAction) []string {
+	if action == nil {
+		return nil
+	}
+	args := append(composeBase(action), action.Action)
+	switch action.Action {
+	case ComposeUp:
+		args = append(args, "--detach", "--remove-orphans")
+	case ComposeDown:
+		// down always applies to the whole project
+		return append(args, "--remove-orphans")
+	}
+	return append(args, action.Services...)
+}
+
+// ComposeStatusArgs returns the docker CLI arguments listing the state of
+// the services of the project
+func ComposeStatusArgs(action *config.ComposeAction) []string {
+	return append(composeBase(action), "ps", "--all", "--format", "json")
+}
+
+// ParseComposeStatus parses the output of "docker compose ps --format json",
+// which is a JSON array in older releases and one object per line in newer ones
+func ParseComposeStatus(output []byte) ([]Service, error) {
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 {
+		return nil, nil
+	}
+
+	var services []Service
+	if output[0] == '[' {
+		if err := json.Unmarshal(output, &services); err != nil {
+			return nil, fmt.Errorf("failed to parse compose status: %w", err)
+		}
+		return services, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for decoder.More() {
+		var service Service
+		if err := decoder.Decode(&service); err != nil {
+			return nil, fmt.Errorf("failed to parse compose status: %w", err)
+		}
+		services = append(services, service)
+	}
+	return services, nil
+}
@@ -0,0 +1,306 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// Docker actions
+const (
+	ActionRun     = "run"
+	ActionPull    = "pull"
+	ActionStart   = "start"
+	ActionStop    = "stop"
+	ActionRestart = "restart"
+	ActionRemove  = "remove"
+)
+
+// ExitError is returned when a container exits with a non-zero code
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("container exited with code %d", e.Code)
+}
+
+// ExitCode returns the exit code of the container
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// Client performs container operations through the Docker Engine API
+type Client struct {
+	api *client.Client
+}
+
+// NewClient creates a client for the given Docker host, or for the host
+// configured in the environment (DOCKER_HOST) when empty
+func NewClient(host string) (*Client, error) {
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if host != "" {
+		opts = append(opts, client.WithHost(host))
+	}
+	api, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+	}
+	return &Client{api: api}, nil
+}
+
+// Close releases the resources of the client
+func (c *Client) Close() error {
+	return c.api.Close()
+}
+
+// Validate checks that an action has the fields it requires
+func Validate(action *config.DockerAction) error {
+	if action == nil {
+		return errors.New("missing docker action")
+	}
+	switch action.Action {
+	case ActionRun, ActionPull:
+		if action.Image == "" {
+			return fmt.Errorf("docker action %s requires an image", action.Action)
+		}
+	case ActionStart, ActionStop, ActionRestart, ActionRemove:
+		if action.Container == "" {
+			return fmt.Errorf("docker action %s requires a container", action.Action)
+		}
+	default:
+		return fmt.Errorf("unknown docker action '%s'", action.Action)
+	}
+	return nil
+}
+
+// Run performs an action, writing progress and container output to stdout
+// and stderr. env is added to the environment of created containers.
+func (c *Client) Run(ctx context.Context, action *config.DockerAction, env []string, stdout, stderr io.Writer) error {
+	if err := Validate(action); err != nil {
+		return err
+	}
+
+	switch action.Action {
+	case ActionPull:
+		return c.pull(ctx, action.Image, stdout)
+	case ActionRun:
+		return c.run(ctx, action, env, stdout, stderr)
+	case ActionStart:
+		if err := c.api.ContainerStart(ctx, action.Container, container.StartOptions{}); err != nil {
+			return err
+		}
+	case ActionStop:
+		if err := c.api.ContainerStop(ctx, action.Container, container.StopOptions{}); err != nil {
+			return err
+		}
+	case ActionRestart:
+		if err := c.api.ContainerRestart(ctx, action.Container, container.StopOptions{}); err != nil {
+			return err
+		}
+	case ActionRemove:
+		if err := c.api.ContainerRemove(ctx, action.Container, container.RemoveOptions{Force: action.Remove}); err != nil {
+			return err
+		}
+	}
+	return c.report(ctx, action, stdout)
+}
+
+// report writes the state of the container after an action
+func (c *Client) report(ctx context.Context, action *config.DockerAction, stdout io.Writer) error {
+	if action.Action == ActionRemove {
+		fmt.Fprintf(stdout, "Container %s removed\n", action.Container)
+		return nil
+	}
+	info, err := c.api.ContainerInspect(ctx, action.Container)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Container %s (%.12s): %s\n", action.Container, info.ID, info.State.Status)
+	return nil
+}
+
+// pullMessage is a progress message of an image pull
+type pullMessage struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Progress string `json:"progress"`
+	Error    string `json:"error"`
+}
+
+// pull pulls an image, writing the progress without the progress bars
+func (c *Client) pull(ctx context.Context, ref string, out io.Writer) error {
+	reader, err := c.api.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	decoder := json.NewDecoder(reader)
+	for {
+		var msg pullMessage
+		if err := decoder.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read pull progress: %w", err)
+		}
+		if msg.Error != "" {
+			return errors.New(msg.Error)
+		}
+		if msg.Progress != "" {
+			continue
+		}
+		if msg.ID != "" {
+			fmt.Fprintf(out, "%s: %s\n", msg.ID, msg.Status)
+		} else {
+			fmt.Fprintln(out, msg.Status)
+		}
+	}
+}
+
+// run creates and starts a container, then waits for it to exit unless
+// the action is detached
+func (c *Client) run(ctx context.Context, action *config.DockerAction, env []string, stdout, stderr io.Writer) error {
+	if action.Pull {
+		if err := c.pull(ctx, action.Image, stdout); err != nil {
+			return fmt.Errorf("failed to pull %s: %w", action.Image, err)
+		}
+	}
+
+	exposed, bindings, err := nat.ParsePortSpecs(action.Ports)
+	if err != nil {
+		return fmt.Errorf("invalid ports: %w", err)
+	}
+
+	created, err := c.api.ContainerCreate(ctx,
+		&container.Config{
+			Image:        action.Image,
+			Cmd:          action.Cmd,
+			Env:          append(append([]string{}, action.Env...), env...),
+			ExposedPorts: exposed,
+		},
+		&container.HostConfig{
+			Binds:         action.Volumes,
+			PortBindings:  bindings,
+			NetworkMode:   container.NetworkMode(action.Network),
+			RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyMode(action.Restart)},
+		},
+		&network.NetworkingConfig{}, nil, action.Container)
+	if err != nil {
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+	fmt.Fprintf(stdout, "Created container %.12s from %s\n", created.ID, action.Image)
+
+	if action.Detach {
+		if err := c.api.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+			return fmt.Errorf("failed to start container: %w", err)
+		}
+		fmt.Fprintf(stdout, "Started container %.12s\n", created.ID)
+		return nil
+	}
+	if action.Remove {
+		defer func() {
+			if err := c.api.ContainerRemove(context.Background(), created.ID, container.RemoveOptions{Force: true}); err != nil {
+				fmt.Fprintf(stderr, "Failed to remove container %.12s: %v\n", created.ID, err)
+			}
+		}()
+	}
+
+	// Wait from before the start so that a quick exit isn't missed
+	waitCh, errCh := c.api.ContainerWait(ctx, created.ID, container.WaitConditionNextExit)
+	if err := c.api.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+
+	logs, err := c.api.ContainerLogs(ctx, created.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
+	if err != nil {
+		return fmt.Errorf("failed to read container logs: %w", err)
+	}
+	defer logs.Close()
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		stdcopy.StdCopy(stdout, stderr, logs)
+	}()
+
+	select {
+	case resp := <-waitCh:
+		<-copied
+		if resp.Error != nil {
+			return errors.New(resp.Error.Message)
+		}
+		if resp.StatusCode != 0 {
+			return &ExitError{Code: int(resp.StatusCode)}
+		}
+		return nil
+	case err := <-errCh:
+		if ctx.Err() != nil {
+			// Don't leave the container running after a timeout
+			if err := c.api.ContainerStop(context.Background(), created.ID, container.StopOptions{}); err != nil {
+				return errors.Join(ctx.Err(), fmt.Errorf("failed to stop container %.12s: %w", created.ID, err))
+			}
+			return ctx.Err()
+		}
+		return err
+	}
+}
+
+// CommandLine returns the docker CLI arguments equivalent to an action, to
+// describe it in logs and history
+func CommandLine(action *config.DockerAction) []string {
+	if action == nil {
+		return nil
+	}
+	switch action.Action {
+	case ActionRun:
+		args := []string{"run"}
+		if action.Detach {
+			args = append(args, "--detach")
+		}
+		if action.Remove {
+			args = append(args, "--rm")
+		}
+		if action.Pull {
+			args = append(args, "--pull=always")
+		}
+		if action.Container != "" {
+			args = append(args, "--name", action.Container)
+		}
+		if action.Network != "" {
+			args = append(args, "--network", action.Network)
+		}
+		if action.Restart != "" {
+			args = append(args, "--restart", action.Restart)
+		}
+		for _, port := range action.Ports {
+			args = append(args, "-p", port)
+		}
+		for _, volume := range action.Volumes {
+			args = append(args, "-v", volume)
+		}
+		for _, env := range action.Env {
+			args = append(args, "-e", env)
+		}
+		return append(append(args, action.Image), action.Cmd...)
+	case ActionPull:
+		return []string{"pull", action.Image}
+	case ActionRemove:
+		if action.Remove {
+			return []string{"rm", "--force", action.Container}
+		}
+		return []string{"rm", action.Container}
+	default:
+		return []string{action.Action, action.Container}
+	}
+}
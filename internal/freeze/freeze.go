@@ -0,0 +1,176 @@
+// Package freeze implements the freeze periods, during which protected
+// commands only run when forced. Periods are configured as date ranges or
+// read from an iCalendar feed.
+package freeze
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// defaultRefresh is the default delay between two downloads of the feed
+const defaultRefresh = time.Hour
+
+// Period is a freeze period, from From included to To excluded
+type Period struct {
+	From   time.Time
+	To     time.Time
+	Reason string
+}
+
+// String describes the period for rejection messages
+func (p Period) String() string {
+	msg := "frozen until " + p.To.Format("Mon 2006-01-02 15:04")
+	if p.Reason != "" {
+		msg += ": " + p.Reason
+	}
+	return msg
+}
+
+// Calendar holds the configured freeze periods and those of the feed
+type Calendar struct {
+	periods []Period
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu   sync.RWMutex
+	feed []Period
+}
+
+// New creates a calendar from the configuration, which may be nil
+func New(cfg *config.FreezeConfig) (*Calendar, error) {
+	c := &Calendar{client: &http.Client{Timeout: 30 * time.Second}}
+	if cfg == nil {
+		return c, nil
+	}
+
+	for i, p := range cfg.Periods {
+		from, err := parseDate(p.From, false)
+		if err != nil {
+			return nil, fmt.Errorf("freeze period %d: invalid from: %w", i+1, err)
+		}
+		to, err := parseDate(p.To, true)
+		if err != nil {
+			return nil, fmt.Errorf("freeze period %d: invalid to: %w", i+1, err)
+		}
+		if !to.After(from) {
+			return nil, fmt.Errorf("freeze period %d: to must be after from", i+1)
+		}
+		c.periods = append(c.periods, Period{From: from, To: to, Reason: p.Reason})
+	}
+
+	c.url = cfg.ICal
+	c.refresh = cfg.Refresh.Std()
+	if c.refresh <= 0 {
+		c.refresh = defaultRefresh
+	}
+	return c, nil
+}
+
+// parseDate parses a day as YYYY-MM-DD in local time or an RFC 3339 time. The
+// end of a range is the midnight after the day, since the day is included.
+func parseDate(value string, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("'%s' must be YYYY-MM-DD or an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+// Refresh downloads the iCalendar feed, if any. The previous periods of the
+// feed are kept when it fails.
+func (c *Calendar) Refresh() error {
+	if c.url == "" {
+		return nil
+	}
+
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return fmt.Errorf("failed to download freeze calendar: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download freeze calendar: HTTP %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return fmt.Errorf("failed to download freeze calendar: %w", err)
+	}
+
+	periods, err := parseICal(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid freeze calendar: %w", err)
+	}
+
+	c.mu.Lock()
+	c.feed = periods
+	c.mu.Unlock()
+	log.Printf("Loaded %d freeze periods from %s", len(periods), c.url)
+	return nil
+}
+
+// Watch refreshes the feed periodically until stop is closed
+func (c *Calendar) Watch(stop <-chan struct{}) {
+	if c.url == "" {
+		return
+	}
+	ticker := time.NewTicker(c.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Refresh(); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Active returns the freeze period in progress at t, if any. When several
+// periods overlap, the one ending last is returned.
+func (c *Calendar) Active(t time.Time) (Period, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var active Period
+	found := false
+	for _, periods := range [][]Period{c.periods, c.feed} {
+		for _, p := range periods {
+			if !t.Before(p.From) && t.Before(p.To) && (!found || p.To.After(active.To)) {
+				active, found = p, true
+			}
+		}
+	}
+	return active, found
+}
+
+// Blocks returns the first protected command of the list and the freeze
+// period in progress at t, if any
+func (c *Calendar) Blocks(commands []config.Command, t time.Time) (string, Period, bool) {
+	for _, cmd := range commands {
+		if !cmd.Protected {
+			continue
+		}
+		if period, ok := c.Active(t); ok {
+			return cmd.Name, period, true
+		}
+		return "", Period{}, false
+	}
+	return "", Period{}, false
+}
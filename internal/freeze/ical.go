@@ -0,0 +1,110 @@
+package freeze
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// parseICal extracts the events of an iCalendar document as freeze periods.
+// Recurring events are only considered on their first occurrence.
+func parseICal(data string) ([]Period, error) {
+	// Long lines are folded by starting the next line with a space or a tab
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+
+	if !strings.Contains(data, "BEGIN:VCALENDAR") {
+		return nil, errors.New("not an iCalendar document")
+	}
+
+	var periods []Period
+	var event *Period
+	var allDay bool
+	for _, line := range strings.Split(data, "\n") {
+		name, params, value, ok := parseProperty(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event, allDay = &Period{}, false
+		case event == nil:
+		case name == "END" && value == "VEVENT":
+			if event.From.IsZero() {
+				return nil, errors.New("event without DTSTART")
+			}
+			if event.To.IsZero() {
+				// Events without end last a day, or are instants
+				event.To = event.From
+				if allDay {
+					event.To = event.From.AddDate(0, 0, 1)
+				}
+			}
+			if event.To.After(event.From) {
+				periods = append(periods, *event)
+			}
+			event = nil
+		case name == "DTSTART":
+			t, date, err := parseICalTime(value, params)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DTSTART: %w", err)
+			}
+			event.From, allDay = t, date
+		case name == "DTEND":
+			t, _, err := parseICalTime(value, params)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DTEND: %w", err)
+			}
+			event.To = t
+		case name == "SUMMARY":
+			event.Reason = unescapeText(value)
+		}
+	}
+	return periods, nil
+}
+
+// parseProperty splits a content line into its name, parameters and value
+func parseProperty(line string) (string, map[string]string, string, bool) {
+	head, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+	if !ok {
+		return "", nil, "", false
+	}
+	parts := strings.Split(head, ";")
+	params := make(map[string]string)
+	for _, param := range parts[1:] {
+		if key, val, ok := strings.Cut(param, "="); ok {
+			params[strings.ToUpper(key)] = strings.Trim(val, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, value, true
+}
+
+// parseICalTime parses a DATE or DATE-TIME value, and reports whether it's a
+// date. Floating times and dates are in local time.
+func parseICalTime(value string, params map[string]string) (time.Time, bool, error) {
+	loc := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// unescapeText decodes the escaped characters of a TEXT value
+func unescapeText(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
@@ -0,0 +1,87 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileBackend appends runs to a JSON lines file
+type fileBackend struct {
+	path string
+	mu   sync.Mutex
+}
+
+// OpenFile creates a store writing to the given JSON lines file
+func OpenFile(path string) (*Store, error) {
+	backend, err := newFileBackend(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(backend), nil
+}
+
+// newFileBackend creates a backend writing to the given file
+func newFileBackend(path string) (*fileBackend, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return &fileBackend{path: path}, nil
+}
+
+// Append adds a run at the end of the file
+func (f *fileBackend) Append(run Run) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("error encoding history record: %w", err)
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// List reads all the runs of the file
+func (f *fileBackend) List() ([]Run, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.Open(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	var runs []Run
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			// Skip corrupted lines, e.g. from a crash while writing
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, scanner.Err()
+}
+
+// Close does nothing, the file being opened on each call
+func (f *fileBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,327 @@
+package history
+
+import (
+	"fmt"
+	"time"
+)
+
+// Step is the outcome of one command of a run
+type Step struct {
+	Name        string        `json:"name"`
+	Status      string        `json:"status"`
+	Duration    time.Duration `json:"duration"`
+	Budget      time.Duration `json:"budget,omitempty"`
+	Environment Environment   `json:"environment"`
+	// Tolerated is set on the failed steps whose failure policy is continue,
+	// which don't fail the run
+	Tolerated bool `json:"tolerated,omitempty"`
+	// NotificationFailed is set when a notification of the step couldn't be
+	// sent, which doesn't change its status
+	NotificationFailed bool `json:"notificationFailed,omitempty"`
+	// Messages are the notification messages of the step whose ID is known,
+	// so that they can be edited, replied to or deleted later
+	Messages []Message `json:"messages,omitempty"`
+	// Outputs are the values the step exported to the next steps
+	Outputs map[string]string `json:"outputs,omitempty"`
+	// ExitCode is the exit code of the command, -1 when it couldn't start
+	// or was killed by a signal
+	ExitCode int `json:"exitCode,omitempty"`
+	// LogPath is the log file the output of the step was written to
+	LogPath string `json:"logPath,omitempty"`
+	// Attempts is the number of times the command ran, with its retries
+	Attempts int `json:"attempts,omitempty"`
+	// StdoutSize and StderrSize are the sizes in bytes of the output of the
+	// last attempt
+	StdoutSize int64 `json:"stdoutSize,omitempty"`
+	StderrSize int64 `json:"stderrSize,omitempty"`
+}
+
+// Message identifies a notification message sent for a step
+type Message struct {
+	// Notifier is the kind of notifier that sent it: discord or discordBot
+	Notifier string `json:"notifier"`
+	// Kind is what the message shows: message, result or stream
+	Kind string `json:"kind"`
+	// ChannelID is the channel or thread of the message, empty for webhooks
+	ChannelID string `json:"channelId,omitempty"`
+	MessageID string `json:"messageId"`
+}
+
+// Failed reports whether the step failed the run. Skipped steps and
+// tolerated failures don't.
+func (s Step) Failed() bool {
+	return s.Status != "success" && s.Status != "skipped" && !s.Tolerated
+}
+
+// Environment describes what exactly ran for a step. Secrets are masked in
+// the command line and only the names of the environment variables are kept.
+type Environment struct {
+	CommandLine string   `json:"commandLine"`
+	EnvVars     []string `json:"envVars,omitempty"`
+	WorkingDir  string   `json:"workingDir,omitempty"`
+}
+
+// Run is a history record of a sequence of commands
+type Run struct {
+	ID        string        `json:"id"`
+	Source    string        `json:"source"`
+	StartedAt time.Time     `json:"startedAt"`
+	Duration  time.Duration `json:"duration"`
+	Status    string        `json:"status"`
+	Steps     []Step        `json:"steps"`
+	// ConfigFile and ConfigHash identify the configuration used for the run
+	ConfigFile string `json:"configFile,omitempty"`
+	ConfigHash string `json:"configHash,omitempty"`
+	// Host is the name of the server the run happened on
+	Host string `json:"host,omitempty"`
+	// Release and Environment identify the stage of a workflow the run
+	// belongs to, the runs of the stages sharing the release ID
+	Release     string `json:"release,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	// Trigger, Commands, EnvVars and Params are the input of the run, from
+	// which it can be replayed: the kind of trigger, the names of the commands
+	// to run, the variables the trigger added to their environment and the
+	// parameters it supplied
+	Trigger  string            `json:"trigger,omitempty"`
+	Commands []string          `json:"commands,omitempty"`
+	EnvVars  []string          `json:"envVars,omitempty"`
+	Params   map[string]string `json:"params,omitempty"`
+	// ReplayOf is the ID of the run this run replays
+	ReplayOf string `json:"replayOf,omitempty"`
+}
+
+// EndedAt returns the time the run ended
+func (r Run) EndedAt() time.Time {
+	return r.StartedAt.Add(r.Duration)
+}
+
+// Backend persists the runs of the history
+type Backend interface {
+	// Append records a run
+	Append(run Run) error
+	// List returns all recorded runs, oldest first
+	List() ([]Run, error)
+	Close() error
+}
+
+// filter selects the runs read from a backend. The zero value selects them
+// all.
+type filter struct {
+	// id selects the run with this ID
+	id string
+	// host selects the runs of this server and those without host
+	host string
+	// status selects the runs with this status
+	status string
+	// since selects the runs started at or after this time
+	since time.Time
+	// limit is the number of runs likely needed, read at once by the
+	// backends reading the runs by pages, 0 when unknown
+	limit int
+}
+
+// matches reports whether a run is selected by the filter
+func (f filter) matches(run Run) bool {
+	switch {
+	case f.id != "" && run.ID != f.id:
+		return false
+	case f.host != "" && run.Host != "" && run.Host != f.host:
+		return false
+	case f.status != "" && run.Status != f.status:
+		return false
+	case !f.since.IsZero() && run.StartedAt.Before(f.since):
+		return false
+	}
+	return true
+}
+
+// selector is implemented by the backends selecting the runs themselves,
+// rather than the store filtering all of them
+type selector interface {
+	// Select calls each with the runs selected by a filter, most recent
+	// first, until it returns false
+	Select(f filter, each func(Run) bool) error
+}
+
+// Store records the runs in a backend and answers the questions the other
+// packages ask about them
+type Store struct {
+	backend Backend
+	// host scopes the per-command lookups to the runs of this server when
+	// several servers share the backend
+	host string
+}
+
+// NewStore creates a store on top of a backend
+func NewStore(backend Backend) *Store {
+	return &Store{backend: backend}
+}
+
+// SetHost scopes the lookups of the previous runs of a command, e.g. for the
+// duration trends, to the runs of the named server
+func (s *Store) SetHost(name string) {
+	s.host = name
+}
+
+// NewID returns an identifier for a new run
+func NewID(startedAt time.Time) string {
+	return startedAt.UTC().Format("20060102T150405.000000000")
+}
+
+// Append adds a run to the history
+func (s *Store) Append(run Run) error {
+	return s.backend.Append(run)
+}
+
+// List returns all recorded runs, oldest first, including those of the
+// other servers sharing the backend
+func (s *Store) List() ([]Run, error) {
+	return s.backend.List()
+}
+
+// Close closes the backend
+func (s *Store) Close() error {
+	return s.backend.Close()
+}
+
+// each calls fn with the runs selected by a filter, most recent first, until
+// it returns false. The backends that can't select the runs are read whole.
+func (s *Store) each(f filter, fn func(Run) bool) error {
+	if sel, ok := s.backend.(selector); ok {
+		return sel.Select(f, fn)
+	}
+	runs, err := s.List()
+	if err != nil {
+		return err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if f.matches(runs[i]) && !fn(runs[i]) {
+			break
+		}
+	}
+	return nil
+}
+
+// Find returns the run with the given ID
+func (s *Store) Find(id string) (Run, bool, error) {
+	var found Run
+	ok := false
+	err := s.each(filter{id: id, limit: 1}, func(run Run) bool {
+		found, ok = run, true
+		return false
+	})
+	if err != nil {
+		return Run{}, false, err
+	}
+	return found, ok, nil
+}
+
+// CommandSteps returns the last n recorded steps of a command, most recent
+// first. The runs without host are local, having been recorded by a single
+// server.
+func (s *Store) CommandSteps(name string, n int) ([]Step, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	var steps []Step
+	err := s.each(filter{host: s.host}, func(run Run) bool {
+		for j := len(run.Steps) - 1; j >= 0 && len(steps) < n; j-- {
+			if run.Steps[j].Name == name {
+				steps = append(steps, run.Steps[j])
+			}
+		}
+		return len(steps) < n
+	})
+	if err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// StepDurations returns the durations of the last n successful executions
+// of a step, most recent first
+func (s *Store) StepDurations(name string, n int) ([]time.Duration, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	var durations []time.Duration
+	err := s.each(filter{host: s.host}, func(run Run) bool {
+		for _, step := range run.Steps {
+			if step.Name == name && step.Status == "success" {
+				durations = append(durations, step.Duration)
+			}
+		}
+		return len(durations) < n
+	})
+	if err != nil {
+		return nil, err
+	}
+	return durations, nil
+}
+
+// Query selects runs of the history. The zero value selects them all.
+type Query struct {
+	// Command selects the runs with a step of this command
+	Command string
+	// Status selects the runs with this status, e.g. success or failure
+	Status string
+	// Trigger selects the runs of this kind of trigger, e.g. http
+	Trigger string
+	// Since selects the runs started at or after this time
+	Since time.Time
+	// Limit is the maximum number of runs returned, no limit when 0
+	Limit int
+}
+
+// matches reports whether a run is selected by the query
+func (q Query) matches(run Run) bool {
+	if q.Status != "" && run.Status != q.Status {
+		return false
+	}
+	if q.Trigger != "" && run.Trigger != q.Trigger {
+		return false
+	}
+	if !q.Since.IsZero() && run.StartedAt.Before(q.Since) {
+		return false
+	}
+	if q.Command == "" {
+		return true
+	}
+	for _, step := range run.Steps {
+		if step.Name == q.Command {
+			return true
+		}
+	}
+	return false
+}
+
+// Query returns the runs selected by a query, most recent first, including
+// those of the other servers sharing the backend
+func (s *Store) Query(q Query) ([]Run, error) {
+	selected := []Run{}
+	err := s.each(filter{status: q.Status, since: q.Since, limit: max(q.Limit, 0)}, func(run Run) bool {
+		if q.matches(run) {
+			selected = append(selected, run)
+		}
+		return q.Limit <= 0 || len(selected) < q.Limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return selected, nil
+}
+
+// ParseSince parses the start of a period of the history: a duration before
+// now, e.g. 24h, a date, e.g. 2024-05-01, or a time in RFC 3339
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s', must be a duration such as 24h, a date such as 2024-05-01 or an RFC 3339 time", value)
+}
@@ -0,0 +1,134 @@
+package history
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// testRuns records more runs than a page of the SQL backend, alternating
+// the hosts and the statuses, and returns the time of the first one
+func testRuns(t *testing.T, store *Store) time.Time {
+	t.Helper()
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	hosts := []string{"", "web-1", "web-2"}
+	for i := 0; i < 2*selectPage+10; i++ {
+		status := "success"
+		if i%4 == 0 {
+			status = "failure"
+		}
+		// Runs sharing a start time are told apart by their ID
+		startedAt := start.Add(time.Duration(i/2) * time.Minute)
+		run := Run{
+			ID:        fmt.Sprintf("run-%03d", i),
+			StartedAt: startedAt,
+			Status:    status,
+			Host:      hosts[i%len(hosts)],
+			Steps:     []Step{{Name: "build", Status: status, Duration: time.Duration(i) * time.Second}},
+		}
+		if i%5 == 0 {
+			run.Steps = append(run.Steps, Step{Name: "deploy", Status: status})
+		}
+		if err := store.Append(run); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	return start
+}
+
+// runIDs returns the IDs of runs, in order
+func runIDs(runs []Run) []string {
+	ids := make([]string, len(runs))
+	for i, run := range runs {
+		ids[i] = run.ID
+	}
+	return ids
+}
+
+// TestStoreLookups checks that the SQL backend, selecting the runs in the
+// database, answers the lookups like the file backend filtering all of them
+func TestStoreLookups(t *testing.T) {
+	dir := t.TempDir()
+	sqlite, err := Open(nil, dir)
+	if err != nil {
+		t.Fatalf("Open sqlite: %v", err)
+	}
+	defer sqlite.Close()
+	file, err := Open(&config.HistoryConfig{Backend: BackendFile, File: filepath.Join(dir, "runs.jsonl")}, dir)
+	if err != nil {
+		t.Fatalf("Open file: %v", err)
+	}
+	defer file.Close()
+
+	start := testRuns(t, sqlite)
+	testRuns(t, file)
+
+	queries := map[string]Query{
+		"all":          {},
+		"limit":        {Limit: 7},
+		"status":       {Status: "failure", Limit: 30},
+		"since":        {Since: start.Add(90 * time.Minute)},
+		"command":      {Command: "deploy", Limit: 25},
+		"no match":     {Status: "cancelled"},
+		"beyond pages": {Status: "success", Limit: 2 * selectPage},
+	}
+	for name, q := range queries {
+		want, err := file.Query(q)
+		if err != nil {
+			t.Fatalf("%s: file Query: %v", name, err)
+		}
+		got, err := sqlite.Query(q)
+		if err != nil {
+			t.Fatalf("%s: sqlite Query: %v", name, err)
+		}
+		if !reflect.DeepEqual(runIDs(got), runIDs(want)) {
+			t.Errorf("%s: sqlite Query returned %v, want %v", name, runIDs(got), runIDs(want))
+		}
+	}
+	all, _ := file.Query(Query{})
+	if len(all) != 2*selectPage+10 || all[0].ID != fmt.Sprintf("run-%03d", 2*selectPage+9) {
+		t.Errorf("Query returned %d runs starting with %s, want all of them most recent first", len(all), all[0].ID)
+	}
+
+	for _, id := range []string{"run-000", "run-150", "missing"} {
+		want, wantOK, _ := file.Find(id)
+		got, ok, err := sqlite.Find(id)
+		if err != nil {
+			t.Fatalf("Find %s: %v", id, err)
+		}
+		if ok != wantOK || got.ID != want.ID {
+			t.Errorf("Find %s returned %s, %v, want %s, %v", id, got.ID, ok, want.ID, wantOK)
+		}
+	}
+
+	for _, store := range []*Store{file, sqlite} {
+		store.SetHost("web-1")
+	}
+	for _, n := range []int{0, 3, 2 * selectPage} {
+		want, _ := file.StepDurations("build", n)
+		got, err := sqlite.StepDurations("build", n)
+		if err != nil {
+			t.Fatalf("StepDurations: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("StepDurations(%d) returned %v, want %v", n, got, want)
+		}
+		wantSteps, _ := file.CommandSteps("deploy", n)
+		gotSteps, err := sqlite.CommandSteps("deploy", n)
+		if err != nil {
+			t.Fatalf("CommandSteps: %v", err)
+		}
+		if !reflect.DeepEqual(gotSteps, wantSteps) {
+			t.Errorf("CommandSteps(%d) returned %v, want %v", n, gotSteps, wantSteps)
+		}
+	}
+	// The runs of web-2 and the failed ones, e.g. run-208, are left out
+	durations, _ := sqlite.StepDurations("build", 3)
+	if want := []time.Duration{207 * time.Second, 205 * time.Second, 202 * time.Second}; !reflect.DeepEqual(durations, want) {
+		t.Errorf("StepDurations returned %v, want %v", durations, want)
+	}
+}
@@ -0,0 +1,125 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// Backends of the history
+const (
+	BackendSQLite   = "sqlite"
+	BackendFile     = "file"
+	BackendPostgres = "postgres"
+	BackendMySQL    = "mysql"
+)
+
+// backendName returns the backend of a configuration, which may be nil
+func backendName(cfg *config.HistoryConfig) string {
+	switch {
+	case cfg == nil:
+		return BackendSQLite
+	case cfg.Backend != "":
+		return cfg.Backend
+	case cfg.File != "":
+		return BackendFile
+	default:
+		return BackendSQLite
+	}
+}
+
+// Validate checks the history configuration without connecting
+func Validate(cfg *config.HistoryConfig) error {
+	switch backendName(cfg) {
+	case BackendSQLite, BackendFile:
+		return nil
+	case BackendPostgres, BackendMySQL:
+		if cfg.DSN == "" {
+			return fmt.Errorf("the %s backend requires a dsn", cfg.Backend)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown history backend '%s', must be sqlite, file, postgres or mysql", cfg.Backend)
+	}
+}
+
+// Open opens the history of the configuration, which may be nil. The files
+// of the sqlite and file backends default to the given directory.
+//
+// The sqlite backend being the default, a new database imports the runs of
+// the history.jsonl file written before it in the same directory.
+func Open(cfg *config.HistoryConfig, dir string) (*Store, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	file, dsn := "", ""
+	if cfg != nil {
+		file, dsn = cfg.File, cfg.DSN
+	}
+
+	switch backend := backendName(cfg); backend {
+	case BackendFile:
+		if file == "" {
+			file = filepath.Join(dir, "history.jsonl")
+		}
+		return OpenFile(file)
+	case BackendSQLite:
+		if file == "" {
+			file = filepath.Join(dir, "history.db")
+		}
+		db, err := openSQLite(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := importFile(db, filepath.Join(filepath.Dir(file), "history.jsonl")); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return NewStore(db), nil
+	default:
+		db, err := openSQL(backend, dsn)
+		if err != nil {
+			return nil, err
+		}
+		return NewStore(db), nil
+	}
+}
+
+// importFile copies the runs of a JSON lines history into an empty database,
+// in a single transaction so that an interrupted import is done again
+func importFile(db *sqlBackend, path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	empty, err := db.empty()
+	if err != nil || !empty {
+		return err
+	}
+
+	runs, err := (&fileBackend{path: path}).List()
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", path, err)
+	}
+	if len(runs) == 0 {
+		return nil
+	}
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", path, err)
+	}
+	for _, run := range runs {
+		if err := db.insert(tx, run); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to import %s: %w", path, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to import %s: %w", path, err)
+	}
+	log.Printf("Imported %d runs from %s into the history database", len(runs), path)
+	return nil
+}
@@ -0,0 +1,243 @@
+package history
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	// Drivers of the SQL backends
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	// Pure Go, so that delivr builds without cgo
+	_ "modernc.org/sqlite"
+)
+
+// dialect describes the differences between the SQL databases
+type dialect struct {
+	driver string
+	// schema creates the table of the runs when it doesn't exist
+	schema []string
+	// placeholder returns the placeholder of the nth parameter, from 1
+	placeholder func(n int) string
+}
+
+func questionMark(int) string { return "?" }
+
+var dialects = map[string]dialect{
+	BackendSQLite: {
+		driver: "sqlite",
+		schema: []string{
+			`CREATE TABLE IF NOT EXISTS delivr_runs (host TEXT NOT NULL, id TEXT NOT NULL, started_at INTEGER NOT NULL, status TEXT NOT NULL, data TEXT NOT NULL, PRIMARY KEY (host, id))`,
+			`CREATE INDEX IF NOT EXISTS delivr_runs_started_at ON delivr_runs (started_at)`,
+			`CREATE INDEX IF NOT EXISTS delivr_runs_id ON delivr_runs (id)`,
+		},
+		placeholder: questionMark,
+	},
+	BackendPostgres: {
+		driver: "postgres",
+		schema: []string{
+			`CREATE TABLE IF NOT EXISTS delivr_runs (host TEXT NOT NULL, id TEXT NOT NULL, started_at BIGINT NOT NULL, status TEXT NOT NULL, data TEXT NOT NULL, PRIMARY KEY (host, id))`,
+			`CREATE INDEX IF NOT EXISTS delivr_runs_started_at ON delivr_runs (started_at)`,
+			`CREATE INDEX IF NOT EXISTS delivr_runs_id ON delivr_runs (id)`,
+		},
+		placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+	},
+	BackendMySQL: {
+		driver: "mysql",
+		schema: []string{
+			"CREATE TABLE IF NOT EXISTS delivr_runs (host VARCHAR(255) NOT NULL, id VARCHAR(64) NOT NULL, started_at BIGINT NOT NULL, status VARCHAR(32) NOT NULL, data MEDIUMTEXT NOT NULL, PRIMARY KEY (host, id), INDEX delivr_runs_started_at (started_at), INDEX delivr_runs_id (id))",
+		},
+		placeholder: questionMark,
+	},
+}
+
+// sqlBackend stores the runs in a table of a SQL database, as JSON documents
+// along with the columns the runs are ordered and looked up by. Several
+// servers can share the table, their runs being told apart by their host.
+type sqlBackend struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// openSQL connects to a database and creates the table of the runs
+func openSQL(backend, dsn string) (*sqlBackend, error) {
+	d := dialects[backend]
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the %s history: %w", backend, err)
+	}
+	if backend == BackendSQLite {
+		// A single connection avoids the lock errors of concurrent writes
+		db.SetMaxOpenConns(1)
+	}
+	for _, statement := range d.schema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create the %s history table: %w", backend, err)
+		}
+	}
+	return &sqlBackend{db: db, dialect: d}, nil
+}
+
+// openSQLite opens a SQLite database, creating its directory
+func openSQLite(path string) (*sqlBackend, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return openSQL(BackendSQLite, "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+}
+
+// Append inserts a run
+func (b *sqlBackend) Append(run Run) error {
+	return b.insert(b.db, run)
+}
+
+// insert inserts a run with a connection or a transaction
+func (b *sqlBackend) insert(db interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, run Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("error encoding history record: %w", err)
+	}
+	placeholders := make([]string, 5)
+	for i := range placeholders {
+		placeholders[i] = b.dialect.placeholder(i + 1)
+	}
+	_, err = db.Exec("INSERT INTO delivr_runs (host, id, started_at, status, data) VALUES ("+strings.Join(placeholders, ", ")+")",
+		run.Host, run.ID, run.StartedAt.UnixNano(), run.Status, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to record the run in the history: %w", err)
+	}
+	return nil
+}
+
+// List reads all the runs, oldest first
+func (b *sqlBackend) List() ([]Run, error) {
+	rows, err := b.db.Query("SELECT data FROM delivr_runs ORDER BY started_at, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the history: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read the history: %w", err)
+		}
+		var run Run
+		if err := json.Unmarshal([]byte(data), &run); err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// selectPage is the number of runs read at once by Select, when the filter
+// doesn't tell how many are needed
+const selectPage = 100
+
+// Select calls each with the runs selected by a filter, most recent first,
+// until it returns false. The filter is applied by the database, which reads
+// the runs by pages in the order of the started_at index.
+func (b *sqlBackend) Select(f filter, each func(Run) bool) error {
+	var conditions []string
+	var args []any
+	// where adds a condition whose parameters are written as ?
+	where := func(condition string, values ...any) {
+		for _, value := range values {
+			args = append(args, value)
+			condition = strings.Replace(condition, "?", b.dialect.placeholder(len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+	if f.id != "" {
+		where("id = ?", f.id)
+	}
+	if f.host != "" {
+		where("(host = ? OR host = '')", f.host)
+	}
+	if f.status != "" {
+		where("status = ?", f.status)
+	}
+	if !f.since.IsZero() {
+		where("started_at >= ?", f.since.UnixNano())
+	}
+	page := f.limit
+	if page <= 0 {
+		page = selectPage
+	}
+
+	// The pages after the first one start after the last run read
+	var lastStarted int64
+	var lastID string
+	for first := true; ; first = false {
+		pageConditions, pageArgs := slices.Clip(conditions), slices.Clip(args)
+		if !first {
+			n := len(pageArgs)
+			pageConditions = append(pageConditions, fmt.Sprintf("(started_at < %s OR (started_at = %s AND id < %s))",
+				b.dialect.placeholder(n+1), b.dialect.placeholder(n+2), b.dialect.placeholder(n+3)))
+			pageArgs = append(pageArgs, lastStarted, lastStarted, lastID)
+		}
+		query := "SELECT started_at, id, data FROM delivr_runs"
+		if len(pageConditions) > 0 {
+			query += " WHERE " + strings.Join(pageConditions, " AND ")
+		}
+		query += fmt.Sprintf(" ORDER BY started_at DESC, id DESC LIMIT %d", page)
+		read, more, err := b.readPage(query, pageArgs, each, &lastStarted, &lastID)
+		if err != nil || !more || read < page {
+			return err
+		}
+	}
+}
+
+// readPage calls each with the runs of a page, and returns the number of
+// rows read and whether each asked for more runs. lastStarted and lastID are
+// set to the position of the last row.
+func (b *sqlBackend) readPage(query string, args []any, each func(Run) bool, lastStarted *int64, lastID *string) (int, bool, error) {
+	rows, err := b.db.Query(query, args...)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read the history: %w", err)
+	}
+	defer rows.Close()
+
+	read := 0
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(lastStarted, lastID, &data); err != nil {
+			return read, false, fmt.Errorf("failed to read the history: %w", err)
+		}
+		read++
+		var run Run
+		if err := json.Unmarshal([]byte(data), &run); err != nil {
+			continue
+		}
+		if !each(run) {
+			return read, false, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return read, false, fmt.Errorf("failed to read the history: %w", err)
+	}
+	return read, true, nil
+}
+
+// empty reports whether no run was recorded yet
+func (b *sqlBackend) empty() (bool, error) {
+	var count int
+	if err := b.db.QueryRow("SELECT COUNT(*) FROM delivr_runs").Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to read the history: %w", err)
+	}
+	return count == 0, nil
+}
+
+// Close closes the connections to the database
+func (b *sqlBackend) Close() error {
+	return b.db.Close()
+}
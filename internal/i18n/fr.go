@@ -0,0 +1,202 @@
+package i18n
+
+// french is the French catalog, by English format
+var french = map[string]string{
+	// Results
+	"Hosts":                 "Hôtes",
+	"Rollouts":              "Déploiements",
+	" (%s ready)":           " (%s prêts)",
+	"%.2f seconds":          "%.2f secondes",
+	"%s, %d of %d attempts": "%s, tentative %d sur %d",
+	"⏱️ Command **%s** timed out after %s and was killed (took %s)\n":     "⏱️ La commande **%s** a dépassé son délai de %s et a été arrêtée (durée %s)\n",
+	"🛑 Command **%s** exceeded its quota (%s) and was killed (took %s)\n": "🛑 La commande **%s** a dépassé son quota (%s) et a été arrêtée (durée %s)\n",
+	"⏭️ Command **%s** skipped: %s\n":                                     "⏭️ Commande **%s** ignorée : %s\n",
+	"⏹️ Command **%s** was cancelled, Delivr is stopping (took %s)\n":     "⏹️ La commande **%s** a été annulée, Delivr s'arrête (durée %s)\n",
+	"💥 Command **%s** could not be started (took %s)\nError: %s":          "💥 La commande **%s** n'a pas pu être lancée (durée %s)\nErreur : %s",
+	"❌ Command **%s** failed (took %s)\n":                                 "❌ La commande **%s** a échoué (durée %s)\n",
+	"Error: %s":                                                           "Erreur : %s",
+	"✅ Command **%s** completed successfully (took %s)\n":                 "✅ La commande **%s** s'est terminée avec succès (durée %s)\n",
+	"\n🖥️ Host: %s":                                                       "\n🖥️ Hôte : %s",
+	"\n📄 Log file: `%s`":                                                  "\n📄 Fichier de log : `%s`",
+	"success":                                                             "succès",
+	"failure":                                                             "échec",
+	"timeout":                                                             "délai dépassé",
+	"quotaExceeded":                                                       "quota dépassé",
+	"skipped":                                                             "ignorée",
+	"cancelled":                                                           "annulée",
+	"spawnError":                                                          "lancement impossible",
+	"%s %s: %s in %.1fs":                                                  "%s %s : %s en %.1fs",
+	" (exit code %d)":                                                     " (code de sortie %d)",
+	" on %s":                                                              " sur %s",
+	"%s Command **%s**: %s\n":                                             "%s Commande **%s** : %s\n",
+	"Host: %s\n":                                                          "Hôte : %s\n",
+	"Duration: %.2f seconds\n":                                            "Durée : %.2f secondes\n",
+	"Exit code: %d\n":                                                     "Code de sortie : %d\n",
+	"Attempts: %d of %d\n":                                                "Tentatives : %d sur %d\n",
+	"Timeout: %s\n":                                                       "Délai : %s\n",
+	"Error: %s\n":                                                         "Erreur : %s\n",
+	"Output (last %d characters):\n```\n%s\n```\n":                        "Sortie (%d derniers caractères) :\n```\n%s\n```\n",
+	"📄 Log file: `%s`":                                                    "📄 Fichier de log : `%s`",
+	"completed successfully":                                              "terminée avec succès",
+	"failed":                                                              "a échoué",
+	"timed out":                                                           "a dépassé son délai",
+	"exceeded its quota":                                                  "a dépassé son quota",
+	"was cancelled":                                                       "a été annulée",
+	"could not be started":                                                "n'a pas pu être lancée",
+	"Exit code":                                                           "Code de sortie",
+	"Duration":                                                            "Durée",
+	"Attempts":                                                            "Tentatives",
+	"%d of %d":                                                            "%d sur %d",
+	"Timeout":                                                             "Délai",
+	"Host":                                                                "Hôte",
+	"Working directory":                                                   "Répertoire de travail",
+	"Error":                                                               "Erreur",
+	"Log file":                                                            "Fichier de log",
+
+	// Captured output
+	"\n[… %d bytes omitted, see the log …]\n": "\n[… %d octets omis, voir le log …]\n",
+
+	// Digests and attachments
+	"🗞️ Digest of %d notifications since %s": "🗞️ Résumé de %d notifications depuis %s",
+	" (continued)":                     " (suite)",
+	"📦 %d notifications":               "📦 %d notifications",
+	"📎 Last %d MB of the log attached": "📎 Derniers %d Mo du log en pièce jointe",
+	"Attachment":                       "Pièce jointe",
+
+	// Pipelines, live output and jobs
+	"❌ Error executing command '%s' (triggered by %s): %v": "❌ Erreur lors de l'exécution de la commande '%s' (déclenchée par %s) : %v",
+	"%s **%s** %s in %.2fs":                                "%s **%s** %s en %.2fs",
+	" (tolerated)":                                         " (tolérée)",
+	"🚫 **%s** not run":                                     "🚫 **%s** non exécutée",
+	"📋 Summary of %s":                                      "📋 Bilan de %s",
+	"Commands":                                             "Commandes",
+	"Succeeded":                                            "Réussies",
+	"Failed":                                               "Échouées",
+	"Skipped":                                              "Ignorées",
+	"Not run":                                              "Non exécutées",
+	"Step":                                                 "Étape",
+	"Share":                                                "Part",
+	"Trend":                                                "Tendance",
+	"📊 Duration breakdown (total %.2f seconds)\n```\n%s```":                                "📊 Répartition des durées (total %.2f secondes)\n```\n%s```",
+	"\n⚠️ Some steps exceeded their budget (marked with !)":                                "\n⚠️ Certaines étapes ont dépassé leur budget (marquées d'un !)",
+	"%+.0f%% vs avg of last %d":                                                            "%+.0f%% par rapport à la moyenne des %d dernières",
+	"-# %s %s: %s, superseded by a later run":                                              "-# %s %s : %s, remplacée par une exécution plus récente",
+	"🏃 Running command: **%s**\n> %s":                                                      "🏃 Exécution de la commande **%s**\n> %s",
+	"⚠️ Command **%s**: %v":                                                                "⚠️ Commande **%s** : %v",
+	"🛑 Pre-flight failed, no command was run\n%v":                                          "🛑 Échec des vérifications préalables, aucune commande n'a été exécutée\n%v",
+	"⏳ **%s** running for %s":                                                              "⏳ **%s** en cours depuis %s",
+	"⏹️ **%s** finished after %s":                                                          "⏹️ **%s** terminée après %s",
+	"onlyIf condition `%s` failed":                                                         "la condition onlyIf `%s` a échoué",
+	"skipIf condition `%s` succeeded":                                                      "la condition skipIf `%s` a réussi",
+	"⚠️ Job from %s forced for the protected command **%s** during the freeze period (%s)": "⚠️ Tâche de %s forcée pour la commande protégée **%s** pendant la période de gel (%s)",
+	"🧊 Job from %s rejected: '%s' is protected and %s":                                     "🧊 Tâche de %s refusée : '%s' est protégée et %s",
+	"⛔ Job from %s rejected: %v":                                                           "⛔ Tâche de %s refusée : %v",
+	"🕒 Job from %s held until %s, outside of the allowed windows":                          "🕒 Tâche de %s retenue jusqu'au %s, en dehors des créneaux autorisés",
+	"✅ Job from %s approved by %s":                                                         "✅ Tâche de %s approuvée par %s",
+	"🚫 Job from %s rejected by %s":                                                         "🚫 Tâche de %s refusée par %s",
+	"⌛ Not approved within %s":                                                             "⌛ Non approuvée en %s",
+	"⌛ Job from %s aborted: not approved within %s":                                        "⌛ Tâche de %s abandonnée : non approuvée en %s",
+	"⛔ Job from %s aborted: the allowed windows of '%s' closed before it could run":        "⛔ Tâche de %s abandonnée : les créneaux autorisés de '%s' se sont fermés avant son exécution",
+	"🧊 Job from %s aborted: '%s' is protected and %s":                                      "🧊 Tâche de %s abandonnée : '%s' est protégée et %s",
+
+	// Service
+	"🚀 Delivr service started":                   "🚀 Service Delivr démarré",
+	"configuration version %s":                   "version de configuration %s",
+	"environment %s":                             "environnement %s",
+	"✅ Delivr - All commands have been executed": "✅ Delivr - Toutes les commandes ont été exécutées",
+	"🛑 Delivr service stopping":                  "🛑 Arrêt du service Delivr",
+	", interrupted commands: %s":                 ", commandes interrompues : %s",
+	"❌ Delivr could not start, the configuration is invalid:\n```\n%v\n```":                          "❌ Delivr n'a pas pu démarrer, la configuration est invalide :\n```\n%v\n```",
+	"🛑 Startup dependencies %v, no command was run":                                                  "🛑 Dépendances de démarrage : %v, aucune commande n'a été exécutée",
+	"🧊 Commands not run: '%s' is protected and %s. Use --force to override.":                         "🧊 Commandes non exécutées : '%s' est protégée et %s. Utilisez --force pour passer outre.",
+	"⚠️ Protected command **%s** forced during the freeze period (%s)":                               "⚠️ Commande protégée **%s** forcée pendant la période de gel (%s)",
+	"❌ Delivr could not start, the configuration of `%s` is invalid:\n```\n%s: %v\n```":              "❌ Delivr n'a pas pu démarrer, la configuration de `%s` est invalide :\n```\n%s: %v\n```",
+	"⚠️ Self-check: these commands can't be started and will fail when they run\n- %s":               "⚠️ Auto-vérification : ces commandes ne peuvent pas être lancées et échoueront à leur exécution\n- %s",
+	"⚠️ Could not refresh the configuration from `%s`:\n```\n%v\n```":                                "⚠️ Impossible de rafraîchir la configuration depuis `%s` :\n```\n%v\n```",
+	"⚠️ Configuration file `%s` changed on disk but hasn't been loaded (hash %.12s → %.12s)":         "⚠️ Le fichier de configuration `%s` a changé sur le disque mais n'a pas été chargé (hash %.12s → %.12s)",
+	"\nVersion: running `%s`, on disk `%s`":                                                          "\nVersion : `%s` en cours, `%s` sur le disque",
+	"\n❌ The new configuration is invalid and delivr would fail to restart:\n```\n%v\n```":           "\n❌ La nouvelle configuration est invalide et delivr ne pourrait pas redémarrer :\n```\n%v\n```",
+	"\nReload delivr with SIGHUP, or restart it, to apply the changes.":                              "\nRechargez delivr avec SIGHUP, ou redémarrez-le, pour appliquer les changements.",
+	"⚠️ Watched paths no longer trigger commands: %v":                                                "⚠️ Les chemins surveillés ne déclenchent plus de commandes : %v",
+	"❌ Could not reload the configuration of `%s`, the running configuration is kept:\n```\n%v\n```": "❌ Impossible de recharger la configuration de `%s`, la configuration en cours est conservée :\n```\n%v\n```",
+	"🔄 Configuration reloaded":                                                                       "🔄 Configuration rechargée",
+	" (version %s)":                                                                                  " (version %s)",
+
+	// Triggers
+	"⚠️ Rejected trigger on `%s` from %s: %s": "⚠️ Déclenchement refusé sur `%s` depuis %s : %s",
+
+	// Reports
+	"%s to %s":                              "du %s au %s",
+	"\nNo runs during this period.":         "\nAucune exécution sur cette période.",
+	"Runs":                                  "Exécutions",
+	"Failure rate":                          "Taux d'échec",
+	"Mean duration":                         "Durée moyenne",
+	"… and %d more":                         "… et %d de plus",
+	"%s: %d runs, %d failed, %s on average": "%s : %d exécutions, %d en échec, %s en moyenne",
+	"%s: %d of %d failed, status changed %d times": "%s : %d sur %d en échec, statut changé %d fois",
+	"Flaky commands":   "Commandes instables",
+	"📊 Monthly report": "📊 Rapport mensuel",
+	"📊 Weekly report":  "📊 Rapport hebdomadaire",
+
+	// Approvals, replays, ad-hoc commands and tags
+	"🛑 Delivr stopped before the job was approved":                       "🛑 Delivr s'est arrêté avant l'approbation de la tâche",
+	"✋ **Approval required** for job `%s` from %s: %s\nExpires <t:%d:R>": "✋ **Approbation requise** pour la tâche `%s` de %s : %s\nExpire <t:%d:R>",
+	"Approve":             "Approuver",
+	"Reject":              "Refuser",
+	"Unknown interaction": "Interaction inconnue",
+	"⛔ You are not allowed to approve or reject jobs": "⛔ Vous n'êtes pas autorisé à approuver ou refuser des tâches",
+	"✅ Approved by %s":                              "✅ Approuvée par %s",
+	"🚫 Rejected by %s":                              "🚫 Refusée par %s",
+	"Unknown button %s":                             "Bouton inconnu %s",
+	"🔁 Replaying run **%s** (%s) requested by %s":   "🔁 Rejeu de l'exécution **%s** (%s) demandé par %s",
+	"⚠️ Ad-hoc command":                             "⚠️ Commande ad hoc",
+	"⚠️ Ad-hoc command: %s":                         "⚠️ Commande ad hoc : %s",
+	"⚠️ Could not tag the deployment of **%s**: %v": "⚠️ Impossible d'étiqueter le déploiement de **%s** : %v",
+	"🏷️ Deployment of **%s** tagged **%s**":         "🏷️ Déploiement de **%s** étiqueté **%s**",
+
+	// Workflows and image polls
+	"✅ Release **%s** approved for **%s** by %s":                             "✅ Livraison **%s** approuvée pour **%s** par %s",
+	"🚫 Release **%s** rejected for **%s** by %s":                             "🚫 Livraison **%s** refusée pour **%s** par %s",
+	"❌ Release **%s** of %s failed in **%s**, the next stages are cancelled": "❌ La livraison **%s** de %s a échoué en **%s**, les étapes suivantes sont annulées",
+	"🎉 Release **%s** of %s promoted through %s":                             "🎉 Livraison **%s** de %s promue à travers %s",
+	"❌ Release **%s** of %s failed: could not start **%s**: %v":              "❌ La livraison **%s** de %s a échoué : impossible de démarrer **%s** : %v",
+	"⏸️ Release **%s** of %s awaits approval for **%s**":                     "⏸️ La livraison **%s** de %s attend une approbation pour **%s**",
+	" (%s succeeded)": " (%s réussie)",
+	"\nApprove with `delivr approve %s` or reject with `delivr reject %s`":   "\nApprouvez avec `delivr approve %s` ou refusez avec `delivr reject %s`",
+	"⚠️ Could not check image **%s** for new digests, retrying every %s: %v": "⚠️ Impossible de vérifier les nouveaux digests de l'image **%s**, nouvel essai toutes les %s : %v",
+
+	// Slash commands
+	"Unknown command":                 "Commande inconnue",
+	"Unknown command '%s'":            "Commande inconnue '%s'",
+	"Unknown subcommand %s":           "Sous-commande inconnue %s",
+	"pause Delivr":                    "mettre Delivr en pause",
+	"resume Delivr":                   "reprendre Delivr",
+	"replay run %s":                   "rejouer l'exécution %s",
+	"run '%s'":                        "exécuter '%s'",
+	"not allowed to %s":               "non autorisé à %s",
+	"⛔ You are not allowed to %s: %s": "⛔ Vous n'êtes pas autorisé à %s : %s",
+	"`discord.bot.acl` doesn't grant it to you or to your roles":                              "`discord.bot.acl` ne l'accorde ni à vous ni à vos rôles",
+	"`discord.bot.acl` doesn't allow you or your roles to run '%s'":                           "`discord.bot.acl` ne vous permet pas, ni à vos rôles, d'exécuter '%s'",
+	"only the users allowed to run every command by `discord.bot.acl` can":                    "seuls les utilisateurs autorisés à exécuter toutes les commandes par `discord.bot.acl` le peuvent",
+	"⏸️ Delivr is already paused":                                                             "⏸️ Delivr est déjà en pause",
+	"⏸️ Delivr paused: triggers are rejected and queued jobs are held until `/delivr resume`": "⏸️ Delivr en pause : les déclenchements sont refusés et les tâches en file sont retenues jusqu'à `/delivr resume`",
+	"▶️ Delivr is not paused":                                                                 "▶️ Delivr n'est pas en pause",
+	"▶️ Delivr resumed":                                                                       "▶️ Delivr a repris",
+	"📊 **Delivr status**\n":                                                                   "📊 **État de Delivr**\n",
+	"Configuration version: %s\n":                                                             "Version de configuration : %s\n",
+	"Uptime: %s\n":                                                                            "En service depuis : %s\n",
+	"⏸️ Paused: triggers are rejected and queued jobs are held\n":                             "⏸️ En pause : les déclenchements sont refusés et les tâches en file sont retenues\n",
+	"\n🏃 Running: %s (%s, for %s)\n":                                                          "\n🏃 En cours : %s (%s, depuis %s)\n",
+	"\nNo job running\n":                                                                      "\nAucune tâche en cours\n",
+	"⏳ Queued: %s (%s)\n":                                                                     "⏳ En file : %s (%s)\n",
+	"\n**Recent results**\n":                                                                  "\n**Résultats récents**\n",
+	"History is not available":                                                                "L'historique n'est pas disponible",
+	"Failed to read the history":                                                              "Impossible de lire l'historique",
+	"%s %s in %s (%s) `%s`":                                                                   "%s %s en %s (%s) `%s`",
+	"No recorded execution of **%s**":                                                         "Aucune exécution enregistrée de **%s**",
+	"📜 **Last executions of %s**\n%s":                                                         "📜 **Dernières exécutions de %s**\n%s",
+	"❌ Could not replay run %s: %v":                                                           "❌ Impossible de rejouer l'exécution %s : %v",
+	"🔁 Replay of run %s queued as job %s":                                                     "🔁 Rejeu de l'exécution %s mis en file comme tâche %s",
+	"❌ Could not run '%s': %v":                                                                "❌ Impossible d'exécuter '%s' : %v",
+	"⏳ '%s' queued as job %s":                                                                 "⏳ '%s' mise en file comme tâche %s",
+}
@@ -0,0 +1,96 @@
+// Package i18n translates the built-in messages of the notifications. The
+// messages are written in English in the code, and looked up by their
+// English format in the catalog of the configured language.
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Languages of the built-in messages
+const (
+	English = "en"
+	French  = "fr"
+)
+
+// Languages are the supported languages, English being the default
+var Languages = []string{English, French}
+
+// catalogs are the translations of the English formats, by language
+var catalogs = map[string]map[string]string{
+	French: french,
+}
+
+// Catalog translates the messages in a language. The zero Catalog keeps
+// them in English.
+type Catalog struct {
+	messages map[string]string
+}
+
+// Load returns the catalog of a language, English when empty
+func Load(lang string) (Catalog, error) {
+	if lang == "" || lang == English {
+		return Catalog{}, nil
+	}
+	messages, ok := catalogs[lang]
+	if !ok {
+		return Catalog{}, fmt.Errorf("unknown language %q, must be one of %s", lang, strings.Join(Languages, ", "))
+	}
+	return Catalog{messages: messages}, nil
+}
+
+// Text returns the translation of a text, e.g. of a status. Texts without
+// translation stay in English.
+func (c Catalog) Text(text string) string {
+	if translated, ok := c.messages[text]; ok {
+		return translated
+	}
+	return text
+}
+
+// T formats a message like fmt.Sprintf, with the translation of its format.
+// Messages without translation stay in English.
+func (c Catalog) T(format string, args ...any) string {
+	if translated, ok := c.messages[format]; ok {
+		return fmt.Sprintf(translated, args...)
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+var (
+	mu sync.RWMutex
+	// current is the catalog of the messages sent outside the notifiers,
+	// e.g. the summaries of the pipelines
+	current Catalog
+)
+
+// SetLanguage sets the language of the messages translated with T and Text,
+// English when empty. It is called once a configuration is accepted.
+func SetLanguage(lang string) error {
+	catalog, err := Load(lang)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	current = catalog
+	return nil
+}
+
+// Text returns the translation of a text in the current language
+func Text(text string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current.Text(text)
+}
+
+// T formats a message like fmt.Sprintf, with the translation of its format
+// in the current language
+func T(format string, args ...any) string {
+	mu.RLock()
+	catalog := current
+	mu.RUnlock()
+	return catalog.T(format, args...)
+}
@@ -0,0 +1,180 @@
+// Package imagepoll triggers commands when the digest of an image tag changes
+// in its registry
+package imagepoll
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/notifier"
+	"github.com/ndious/delivr/internal/registry"
+)
+
+// DefaultInterval is the delay between two checks of an image, when none is
+// configured
+const DefaultInterval = 5 * time.Minute
+
+// minInterval avoids hitting the rate limits of the registries
+const minInterval = 30 * time.Second
+
+// Submitter queues the jobs of the polls
+type Submitter interface {
+	Submit(job command.Job) (string, error)
+}
+
+// poll is an image tag whose new digests run commands
+type poll struct {
+	ref      registry.Reference
+	commands []config.Command
+	interval time.Duration
+	client   *registry.Client
+
+	// digest is the last digest seen, and failing is set while the checks
+	// fail so that the failure is only notified once
+	digest  string
+	failing bool
+}
+
+// Poller checks the digests of the polled images
+type Poller struct {
+	polls     []*poll
+	preflight *config.PreflightConfig
+	notify    notifier.Notifier
+}
+
+// New validates the image polls of the configuration. The failures to check
+// an image are reported to notify, which may be nil to only validate.
+func New(cfg *config.Config, notify notifier.Notifier) (*Poller, error) {
+	p := &Poller{preflight: cfg.Preflight, notify: notify}
+	for i, pc := range cfg.ImagePolls {
+		ref, err := registry.ParseReference(pc.Image)
+		if err != nil {
+			return nil, fmt.Errorf("image poll %d: %w", i+1, err)
+		}
+		if len(pc.Commands) == 0 {
+			return nil, fmt.Errorf("image poll %d: no commands", i+1)
+		}
+		commands, err := cfg.ResolveCommands(pc.Commands)
+		if err != nil {
+			return nil, fmt.Errorf("image poll %d: %w", i+1, err)
+		}
+		interval := pc.Interval.Std()
+		if interval == 0 {
+			interval = DefaultInterval
+		}
+		if interval < minInterval {
+			return nil, fmt.Errorf("image poll %d: interval %s is shorter than %s", i+1, interval, minInterval)
+		}
+		p.polls = append(p.polls, &poll{
+			ref:      ref,
+			commands: commands,
+			interval: interval,
+			client:   registry.NewClient(pc.Username, pc.Password),
+		})
+	}
+	return p, nil
+}
+
+// Empty reports whether no image is polled
+func (p *Poller) Empty() bool {
+	return len(p.polls) == 0
+}
+
+// Run checks the images until stop is closed, submitting the commands of an
+// image to the queue when its digest changed since the previous check. The
+// first check only records the current digest. Run returns once the checks
+// in progress completed, so that no job is submitted afterwards.
+func (p *Poller) Run(queue Submitter, stop <-chan struct{}) {
+	if p.Empty() {
+		return
+	}
+	log.Printf("Polling %d images for new digests", len(p.polls))
+
+	var wg sync.WaitGroup
+	for _, pl := range p.polls {
+		wg.Add(1)
+		go func(pl *poll) {
+			defer wg.Done()
+			p.run(pl, queue, stop)
+		}(pl)
+	}
+	wg.Wait()
+}
+
+// run checks an image at its interval until stop is closed
+func (p *Poller) run(pl *poll, queue Submitter, stop <-chan struct{}) {
+	ticker := time.NewTicker(pl.interval)
+	defer ticker.Stop()
+
+	p.check(pl, queue)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.check(pl, queue)
+		}
+	}
+}
+
+// check fetches the digest of an image and submits its commands when it
+// changed. The digest is only recorded once the job is queued, so that a
+// rejected job is submitted again at the next check.
+func (p *Poller) check(pl *poll, queue Submitter) {
+	digest, err := pl.client.Digest(pl.ref)
+	if err != nil {
+		log.Printf("Warning: Could not check image %s: %v", pl.ref, err)
+		if !pl.failing {
+			pl.failing = true
+			p.report(i18n.T("⚠️ Could not check image **%s** for new digests, retrying every %s: %v", pl.ref, pl.interval, err))
+		}
+		return
+	}
+	if pl.failing {
+		pl.failing = false
+		log.Printf("Image %s can be checked again", pl.ref)
+	}
+
+	if pl.digest == "" {
+		log.Printf("Image %s is at %s", pl.ref, digest)
+		pl.digest = digest
+		return
+	}
+	if digest == pl.digest {
+		return
+	}
+
+	log.Printf("Image %s changed from %s to %s", pl.ref, pl.digest, digest)
+	image := pl.ref.String()
+	_, err = queue.Submit(command.Job{
+		Source:   fmt.Sprintf("new digest of %s", image),
+		Trigger:  "image-poll",
+		Commands: pl.commands,
+		EnvVars: []string{
+			"DELIVR_IMAGE=" + image,
+			"DELIVR_IMAGE_TAG=" + pl.ref.Tag,
+			"DELIVR_IMAGE_DIGEST=" + digest,
+		},
+		Preflight: p.preflight,
+	})
+	if err != nil {
+		log.Printf("Warning: Could not queue the commands of image %s, retrying at the next check: %v", image, err)
+		return
+	}
+	pl.digest = digest
+}
+
+// report notifies a failure to check an image
+func (p *Poller) report(msg string) {
+	if p.notify == nil {
+		return
+	}
+	if err := p.notify.SendMessage(msg); err != nil {
+		log.Printf("Warning: Could not send image poll message: %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+// Package k8s performs Kubernetes operations through the Kubernetes API:
+// applying manifests and restarting workloads, then waiting for their
+// rollouts
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// Kubernetes actions
+const (
+	ActionApply   = "apply"
+	ActionRestart = "restart"
+)
+
+// fieldManager identifies the changes made by delivr on the server
+const fieldManager = "delivr"
+
+// defaultTimeout bounds the wait for the rollouts when the action doesn't set
+// one, like the default progress deadline of deployments
+const defaultTimeout = 10 * time.Minute
+
+// pollInterval is the delay between two checks of a rollout
+const pollInterval = 2 * time.Second
+
+// Client performs operations through the Kubernetes API
+type Client struct {
+	typed     kubernetes.Interface
+	dynamic   dynamic.Interface
+	mapper    meta.RESTMapper
+	namespace string
+}
+
+// NewClient creates a client for the cluster of an action: the context of
+// its kubeconfig file, of $KUBECONFIG or ~/.kube/config, or the cluster
+// delivr runs in when there is no kubeconfig file
+func NewClient(action *config.K8sAction) (*Client, error) {
+	if err := Validate(action); err != nil {
+		return nil, err
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if action.Kubeconfig != "" {
+		rules.ExplicitPath = expandHome(action.Kubeconfig)
+	}
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: action.Context})
+	restConfig, err := loader.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the Kubernetes configuration: %w", err)
+	}
+
+	c := &Client{namespace: action.Namespace}
+	if c.namespace == "" {
+		if c.namespace, _, err = loader.Namespace(); err != nil {
+			return nil, fmt.Errorf("failed to read the namespace of the context: %w", err)
+		}
+	}
+	if c.typed, err = kubernetes.NewForConfig(restConfig); err != nil {
+		return nil, fmt.Errorf("failed to create the Kubernetes client: %w", err)
+	}
+	if c.dynamic, err = dynamic.NewForConfig(restConfig); err != nil {
+		return nil, fmt.Errorf("failed to create the Kubernetes client: %w", err)
+	}
+	c.mapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(c.typed.Discovery()))
+	return c, nil
+}
+
+// expandHome replaces a leading ~/ with the home directory
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// Validate checks that an action has the fields it requires
+func Validate(action *config.K8sAction) error {
+	if action == nil {
+		return errors.New("missing k8s action")
+	}
+	switch action.Action {
+	case ActionApply:
+		if len(action.Manifests) == 0 {
+			return errors.New("k8s action apply requires manifests")
+		}
+	case ActionRestart:
+		if len(action.Workloads) == 0 {
+			return errors.New("k8s action restart requires workloads")
+		}
+		for _, w := range action.Workloads {
+			if _, err := parseWorkload(w); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown k8s action '%s'", action.Action)
+	}
+	if action.Timeout < 0 {
+		return errors.New("k8s timeout must be positive")
+	}
+	return nil
+}
+
+// Run performs an action, then waits for the rollouts of the workloads it
+// changed unless the action doesn't wait. Relative manifest paths are
+// resolved against dir. Progress is written to out, and the state of the
+// rollouts is returned.
+func (c *Client) Run(ctx context.Context, action *config.K8sAction, dir string, out io.Writer) ([]Rollout, error) {
+	var workloads []workload
+	var err error
+	switch action.Action {
+	case ActionApply:
+		workloads, err = c.apply(ctx, action.Manifests, dir, out)
+	case ActionRestart:
+		workloads, err = c.restart(ctx, action.Workloads, out)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if action.NoWait {
+		rollouts := make([]Rollout, 0, len(workloads))
+		for _, w := range workloads {
+			rollout, _, err := c.status(ctx, w)
+			if err != nil {
+				return rollouts, err
+			}
+			rollouts = append(rollouts, rollout)
+		}
+		return rollouts, nil
+	}
+	timeout := action.Timeout.Std()
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	return c.wait(ctx, workloads, timeout, out)
+}
+
+// apply applies the objects of the manifests with server-side apply, taking
+// over the fields managed by others, and returns the workloads among them
+func (c *Client) apply(ctx context.Context, patterns []string, dir string, out io.Writer) ([]workload, error) {
+	objects, err := readManifests(patterns, dir)
+	if err != nil {
+		return nil, err
+	}
+	var workloads []workload
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return workloads, fmt.Errorf("%s %s: %w", gvk.Kind, obj.GetName(), err)
+		}
+		resource := c.dynamic.Resource(mapping.Resource)
+		var applier dynamic.ResourceInterface = resource
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			if obj.GetNamespace() == "" {
+				obj.SetNamespace(c.namespace)
+			}
+			applier = resource.Namespace(obj.GetNamespace())
+		}
+		name := strings.ToLower(gvk.Kind) + "/" + obj.GetName()
+		if _, err := applier.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{FieldManager: fieldManager, Force: true}); err != nil {
+			return workloads, fmt.Errorf("failed to apply %s: %w", name, err)
+		}
+		fmt.Fprintf(out, "%s applied\n", name)
+		if w, ok := workloadOf(obj); ok {
+			workloads = append(workloads, w)
+		}
+	}
+	return workloads, nil
+}
+
+// restart restarts the pods of workloads like "kubectl rollout restart", by
+// changing an annotation of their pod template
+func (c *Client) restart(ctx context.Context, names []string, out io.Writer) ([]workload, error) {
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":%q}}}}}`, time.Now().Format(time.RFC3339))
+	options := metav1.PatchOptions{FieldManager: fieldManager}
+	apps := c.typed.AppsV1()
+	var workloads []workload
+	for _, name := range names {
+		w, _ := parseWorkload(name)
+		w.namespace = c.namespace
+		var err error
+		switch w.kind {
+		case kindDeployment:
+			_, err = apps.Deployments(w.namespace).Patch(ctx, w.name, types.StrategicMergePatchType, []byte(patch), options)
+		case kindStatefulSet:
+			_, err = apps.StatefulSets(w.namespace).Patch(ctx, w.name, types.StrategicMergePatchType, []byte(patch), options)
+		case kindDaemonSet:
+			_, err = apps.DaemonSets(w.namespace).Patch(ctx, w.name, types.StrategicMergePatchType, []byte(patch), options)
+		}
+		if err != nil {
+			return workloads, fmt.Errorf("failed to restart %s: %w", w, err)
+		}
+		fmt.Fprintf(out, "%s restarted\n", w)
+		workloads = append(workloads, w)
+	}
+	return workloads, nil
+}
+
+// wait waits for the rollouts of workloads to complete, one after the other,
+// writing their progress to out when it changes
+func (c *Client) wait(ctx context.Context, workloads []workload, timeout time.Duration, out io.Writer) ([]Rollout, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	rollouts := make([]Rollout, 0, len(workloads))
+	for i, w := range workloads {
+		var progress string
+		for {
+			rollout, done, err := c.status(ctx, w)
+			if err != nil && ctx.Err() == nil {
+				rollouts = append(rollouts, Rollout{Name: w.String(), State: StateFailed})
+				return c.remaining(rollouts, workloads[i+1:]), fmt.Errorf("rollout of %s failed: %w", w, err)
+			}
+			if done {
+				fmt.Fprintf(out, "%s rolled out (%s ready)\n", w, rollout.Ready)
+				rollouts = append(rollouts, rollout)
+				break
+			}
+			if rollout.Progress != progress {
+				progress = rollout.Progress
+				fmt.Fprintf(out, "Waiting for %s: %s\n", w, progress)
+			}
+
+			select {
+			case <-ctx.Done():
+				rollouts = append(rollouts, rollout)
+				rollouts = c.remaining(rollouts, workloads[i+1:])
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					return rollouts, fmt.Errorf("rollout of %s did not complete: %s", w, progress)
+				}
+				return rollouts, ctx.Err()
+			case <-time.After(pollInterval):
+			}
+		}
+	}
+	return rollouts, nil
+}
+
+// remaining adds the workloads whose rollout wasn't waited for to rollouts
+func (c *Client) remaining(rollouts []Rollout, workloads []workload) []Rollout {
+	for _, w := range workloads {
+		rollouts = append(rollouts, Rollout{Name: w.String(), State: StateProgressing})
+	}
+	return rollouts
+}
+
+// CommandLine returns the kubectl arguments equivalent to an action, to
+// describe it in logs
+func CommandLine(action *config.K8sAction) []string {
+	if action == nil {
+		return nil
+	}
+	var args []string
+	if action.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", action.Kubeconfig)
+	}
+	if action.Context != "" {
+		args = append(args, "--context", action.Context)
+	}
+	if action.Namespace != "" {
+		args = append(args, "--namespace", action.Namespace)
+	}
+	switch action.Action {
+	case ActionApply:
+		args = append(args, "apply", "--server-side", "--force-conflicts")
+		for _, manifest := range action.Manifests {
+			args = append(args, "-f", manifest)
+		}
+	case ActionRestart:
+		args = append(args, "rollout", "restart")
+		args = append(args, action.Workloads...)
+	default:
+		args = append(args, action.Action)
+	}
+	return args
+}
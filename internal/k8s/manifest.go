@@ -0,0 +1,118 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// readManifests reads the objects of manifest files, directories and glob
+// patterns, in order. Files may hold several YAML documents or a list.
+func readManifests(patterns []string, dir string) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		paths, err := manifestFiles(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			fileObjects, err := decodeManifest(path)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, fileObjects...)
+		}
+	}
+	if len(objects) == 0 {
+		return nil, errors.New("the manifests hold no objects")
+	}
+	return objects, nil
+}
+
+// manifestFiles returns the files matching a pattern, directories being
+// expanded to their YAML and JSON files
+func manifestFiles(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest pattern '%s': %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no manifest matches '%s'", pattern)
+	}
+	var files []string
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, match)
+			continue
+		}
+		entries, err := os.ReadDir(match)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			switch filepath.Ext(entry.Name()) {
+			case ".yaml", ".yml", ".json":
+				if !entry.IsDir() {
+					files = append(files, filepath.Join(match, entry.Name()))
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+// decodeManifest reads the objects of a YAML or JSON manifest file, skipping
+// the empty documents and expanding lists
+func decodeManifest(path string) ([]*unstructured.Unstructured, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	defer file.Close()
+
+	var objects []*unstructured.Unstructured
+	decoder := yaml.NewYAMLOrJSONDecoder(file, 4096)
+	for {
+		var doc map[string]any
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objects, nil
+			}
+			return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+		}
+		if len(doc) == 0 {
+			continue
+		}
+		obj := &unstructured.Unstructured{Object: doc}
+		if obj.GetKind() == "" || obj.GetAPIVersion() == "" {
+			return nil, fmt.Errorf("manifest %s: object without apiVersion or kind", path)
+		}
+		if obj.IsList() {
+			err := obj.EachListItem(func(item runtime.Object) error {
+				objects = append(objects, item.(*unstructured.Unstructured))
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("manifest %s: %w", path, err)
+			}
+			continue
+		}
+		if obj.GetName() == "" {
+			return nil, fmt.Errorf("manifest %s: %s without a name", path, obj.GetKind())
+		}
+		objects = append(objects, obj)
+	}
+}
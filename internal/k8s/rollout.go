@@ -0,0 +1,191 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Workload kinds whose rollouts are waited for
+const (
+	kindDeployment  = "deployment"
+	kindStatefulSet = "statefulset"
+	kindDaemonSet   = "daemonset"
+)
+
+// Rollout states
+const (
+	StateRolledOut   = "rolled out"
+	StateProgressing = "progressing"
+	StateFailed      = "failed"
+)
+
+// Rollout is the state of the rollout of a workload
+type Rollout struct {
+	Name     string // kind/name, e.g. deployment/web
+	Ready    string // Ready pods out of the desired ones, e.g. 2/3
+	State    string // rolled out, progressing or failed
+	Progress string // What the rollout is waiting for, while it progresses
+}
+
+// workload is a workload whose rollout can be waited for
+type workload struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func (w workload) String() string {
+	return w.kind + "/" + w.name
+}
+
+// parseWorkload parses a workload written kind/name, the kind being one of
+// the names or short names kubectl accepts
+func parseWorkload(s string) (workload, error) {
+	kind, name, ok := strings.Cut(s, "/")
+	if !ok || name == "" {
+		return workload{}, fmt.Errorf("invalid k8s workload '%s', must be written kind/name", s)
+	}
+	switch strings.ToLower(kind) {
+	case "deployment", "deployments", "deploy":
+		kind = kindDeployment
+	case "statefulset", "statefulsets", "sts":
+		kind = kindStatefulSet
+	case "daemonset", "daemonsets", "ds":
+		kind = kindDaemonSet
+	default:
+		return workload{}, fmt.Errorf("invalid k8s workload '%s', only deployments, statefulsets and daemonsets can be restarted", s)
+	}
+	return workload{kind: kind, name: name}, nil
+}
+
+// workloadOf returns the workload of an applied object, if it is one
+func workloadOf(obj *unstructured.Unstructured) (workload, bool) {
+	gvk := obj.GroupVersionKind()
+	if gvk.Group != appsv1.GroupName {
+		return workload{}, false
+	}
+	kind := strings.ToLower(gvk.Kind)
+	switch kind {
+	case kindDeployment, kindStatefulSet, kindDaemonSet:
+		return workload{kind: kind, namespace: obj.GetNamespace(), name: obj.GetName()}, true
+	}
+	return workload{}, false
+}
+
+// status returns the state of the rollout of a workload, and whether it
+// completed. The error reports a rollout that can't complete.
+func (c *Client) status(ctx context.Context, w workload) (Rollout, bool, error) {
+	apps := c.typed.AppsV1()
+	switch w.kind {
+	case kindDeployment:
+		d, err := apps.Deployments(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+		if err != nil {
+			return Rollout{}, false, err
+		}
+		return deploymentStatus(w, d)
+	case kindStatefulSet:
+		s, err := apps.StatefulSets(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+		if err != nil {
+			return Rollout{}, false, err
+		}
+		rollout, done := statefulSetStatus(w, s)
+		return rollout, done, nil
+	default:
+		d, err := apps.DaemonSets(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+		if err != nil {
+			return Rollout{}, false, err
+		}
+		rollout, done := daemonSetStatus(w, d)
+		return rollout, done, nil
+	}
+}
+
+// progressing returns a rollout still in progress
+func progressing(rollout Rollout, format string, args ...any) Rollout {
+	rollout.State = StateProgressing
+	rollout.Progress = fmt.Sprintf(format, args...)
+	return rollout
+}
+
+// deploymentStatus checks a deployment like "kubectl rollout status"
+func deploymentStatus(w workload, d *appsv1.Deployment) (Rollout, bool, error) {
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	rollout := Rollout{Name: w.String(), Ready: fmt.Sprintf("%d/%d", d.Status.AvailableReplicas, replicas)}
+	if d.Generation > d.Status.ObservedGeneration {
+		return progressing(rollout, "waiting for the update to be observed"), false, nil
+	}
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			rollout.State = StateFailed
+			return rollout, false, errors.New("progress deadline exceeded")
+		}
+	}
+	switch {
+	case d.Status.UpdatedReplicas < replicas:
+		return progressing(rollout, "%d of %d new replicas have been updated", d.Status.UpdatedReplicas, replicas), false, nil
+	case d.Status.Replicas > d.Status.UpdatedReplicas:
+		return progressing(rollout, "%d old replicas are pending termination", d.Status.Replicas-d.Status.UpdatedReplicas), false, nil
+	case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+		return progressing(rollout, "%d of %d updated replicas are available", d.Status.AvailableReplicas, d.Status.UpdatedReplicas), false, nil
+	}
+	rollout.State = StateRolledOut
+	return rollout, true, nil
+}
+
+// statefulSetStatus checks a statefulset like "kubectl rollout status". The
+// rollouts of statefulsets not updated by rolling updates are never waited for.
+func statefulSetStatus(w workload, s *appsv1.StatefulSet) (Rollout, bool) {
+	replicas := int32(1)
+	if s.Spec.Replicas != nil {
+		replicas = *s.Spec.Replicas
+	}
+	rollout := Rollout{Name: w.String(), Ready: fmt.Sprintf("%d/%d", s.Status.ReadyReplicas, replicas), State: StateRolledOut}
+	if s.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		return rollout, true
+	}
+	if s.Generation > s.Status.ObservedGeneration {
+		return progressing(rollout, "waiting for the update to be observed"), false
+	}
+	if s.Status.ReadyReplicas < replicas {
+		return progressing(rollout, "%d of %d pods are ready", s.Status.ReadyReplicas, replicas), false
+	}
+	if ru := s.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.Partition != nil && *ru.Partition > 0 {
+		// Only the pods above the partition are updated
+		if s.Status.UpdatedReplicas < replicas-*ru.Partition {
+			return progressing(rollout, "%d of %d pods above the partition are updated", s.Status.UpdatedReplicas, replicas-*ru.Partition), false
+		}
+		return rollout, true
+	}
+	if s.Status.UpdateRevision != s.Status.CurrentRevision {
+		return progressing(rollout, "%d of %d pods are updated", s.Status.UpdatedReplicas, replicas), false
+	}
+	return rollout, true
+}
+
+// daemonSetStatus checks a daemonset like "kubectl rollout status". The
+// rollouts of daemonsets not updated by rolling updates are never waited for.
+func daemonSetStatus(w workload, d *appsv1.DaemonSet) (Rollout, bool) {
+	desired := d.Status.DesiredNumberScheduled
+	rollout := Rollout{Name: w.String(), Ready: fmt.Sprintf("%d/%d", d.Status.NumberAvailable, desired), State: StateRolledOut}
+	if d.Spec.UpdateStrategy.Type != appsv1.RollingUpdateDaemonSetStrategyType {
+		return rollout, true
+	}
+	switch {
+	case d.Generation > d.Status.ObservedGeneration:
+		return progressing(rollout, "waiting for the update to be observed"), false
+	case d.Status.UpdatedNumberScheduled < desired:
+		return progressing(rollout, "%d of %d updated pods are scheduled", d.Status.UpdatedNumberScheduled, desired), false
+	case d.Status.NumberAvailable < desired:
+		return progressing(rollout, "%d of %d updated pods are available", d.Status.NumberAvailable, desired), false
+	}
+	return rollout, true
+}
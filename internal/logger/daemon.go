@@ -0,0 +1,44 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ndious/delivr/internal/config"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// NewDaemonLogger creates the rotating operational log of the daemon. When
+// no file is configured, it is written to delivr.log in logDir.
+func NewDaemonLogger(cfg config.DaemonLogConfig, logDir string) (io.WriteCloser, error) {
+	if cfg.File == "" {
+		cfg.File = filepath.Join(logDir, "delivr.log")
+	}
+
+	if cfg.MaxSize == 0 {
+		cfg.MaxSize = 10 // 10 MB
+	}
+
+	if cfg.MaxAge == 0 {
+		cfg.MaxAge = 30 // 30 days
+	}
+
+	if cfg.MaxBackups == 0 {
+		cfg.MaxBackups = 5
+	}
+
+	// Ensure log directory exists
+	if err := os.MkdirAll(filepath.Dir(cfg.File), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	return &lumberjack.Logger{
+		Filename:   cfg.File,
+		MaxSize:    cfg.MaxSize,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAge,
+		Compress:   cfg.Compress,
+	}, nil
+}
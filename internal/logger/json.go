@@ -0,0 +1,126 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// streamDelivr is the stream of the lines written by delivr itself, such as
+// the run headers
+const streamDelivr = "delivr"
+
+// record is a line of a log in JSON format
+type record struct {
+	Timestamp time.Time `json:"timestamp"`
+	Command   string    `json:"command"`
+	Stream    string    `json:"stream"`
+	Line      string    `json:"line,omitempty"`
+	ExitCode  *int      `json:"exitCode,omitempty"`
+}
+
+// writeRecord appends a record to the log. The caller must hold w.mu.
+func (w *RunWriter) writeRecord(rec record) error {
+	rec.Timestamp = time.Now()
+	rec.Command = w.command
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(rec); err != nil {
+		return err
+	}
+	n, err := w.out.Write(data.Bytes())
+	w.size += int64(n)
+	return err
+}
+
+// writeLines appends a record for each line of text, skipping the blank and
+// separator lines of the text format. The caller must hold w.mu.
+func (w *RunWriter) writeLines(stream, text string) error {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if stream == streamDelivr && strings.Trim(line, "= ") == "" {
+			continue
+		}
+		if err := w.writeRecord(record{Stream: stream, Line: line}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stream returns a writer for an output stream of the command (stdout,
+// stderr). In JSON format, each line is written as a record of the stream.
+func (w *RunWriter) Stream(name string) io.Writer {
+	if !w.json {
+		return w
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stream := &streamWriter{run: w, name: name}
+	w.streams = append(w.streams, stream)
+	return stream
+}
+
+// Exit records the exit code of an execution of the command. In text
+// format, the exit code is part of the footer written by the runner.
+func (w *RunWriter) Exit(code int) error {
+	if !w.json {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.flushStreams()
+	return w.writeRecord(record{Stream: streamDelivr, ExitCode: &code})
+}
+
+// flushStreams writes the incomplete last lines of the streams. The caller
+// must hold w.mu.
+func (w *RunWriter) flushStreams() {
+	for _, stream := range w.streams {
+		if stream.buf.Len() > 0 {
+			w.writeRecord(record{Stream: stream.name, Line: stream.buf.String()})
+			stream.buf.Reset()
+		}
+	}
+}
+
+// streamWriter writes the output of a stream as JSON records, line by line
+type streamWriter struct {
+	run  *RunWriter
+	name string
+	buf  bytes.Buffer
+}
+
+// Write buffers p and writes a record for each complete line
+func (s *streamWriter) Write(p []byte) (int, error) {
+	s.run.mu.Lock()
+	defer s.run.mu.Unlock()
+	if s.run.closed {
+		return 0, os.ErrClosed
+	}
+
+	s.buf.Write(p)
+	for {
+		i := bytes.IndexByte(s.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := strings.TrimRight(string(s.buf.Next(i+1)), "\r\n")
+		if err := s.run.writeRecord(record{Stream: s.name, Line: line}); err != nil {
+			return len(p), err
+		}
+	}
+}
@@ -6,29 +6,105 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ndious/delivr/internal/config"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-// CommandLogger is responsible for logging command output to files
+// CommandLogger is responsible for logging command output to files. It is
+// safe for concurrent use.
 type CommandLogger struct {
 	config  config.LogConfig
 	baseDir string
-	loggers map[string]*lumberjack.Logger
+	mu      sync.Mutex
+	loggers map[string]*lumberjack.Logger // keyed by log file path
+}
+
+// RunWriter writes the log of a single command run. Runs of the same
+// command share the daily log file, each write being appended atomically,
+// unless each run has its own file.
+type RunWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	path   string
+	closed bool
+	// file is the log file owned by this run, closed with the run
+	file io.Closer
+	// size is the number of bytes written by this run
+	size int64
+	// json is set when the log is written as JSON records
+	json    bool
+	command string
+	streams []*streamWriter
+}
+
+// Write appends data to the log file. In JSON format, each line is written
+// as a record of the "delivr" stream.
+func (w *RunWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.json {
+		return len(p), w.writeLines(streamDelivr, string(p))
+	}
+	n, err := w.out.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Size returns the number of bytes written to the log file by this run,
+// which are at the end of the file while the command runs alone
+func (w *RunWriter) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+// Path returns the path of the log file
+func (w *RunWriter) Path() string {
+	return w.path
+}
+
+// Close ends the run; the shared log file stays open for other runs
+func (w *RunWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.flushStreams()
+	w.closed = true
+	if w.file != nil {
+		return w.file.Close()
+	}
+	return nil
+}
+
+// LogDirectory returns the directory of the logs of a configuration, which
+// may be nil: the configured one, or ~/.delivr/logs
+func LogDirectory(cfg *config.LogConfig) (string, error) {
+	if cfg != nil && cfg.Directory != "" {
+		return cfg.Directory, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".delivr", "logs"), nil
 }
 
 // NewCommandLogger creates a new command logger
 func NewCommandLogger(cfg config.LogConfig) (*CommandLogger, error) {
 	// Set default values if not specified
-	if cfg.Directory == "" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", err)
-		}
-		cfg.Directory = filepath.Join(homeDir, ".delivr", "logs")
+	dir, err := LogDirectory(&cfg)
+	if err != nil {
+		return nil, err
 	}
+	cfg.Directory = dir
 
 	if cfg.MaxSize == 0 {
 		cfg.MaxSize = 10 // 10 MB
@@ -42,6 +118,12 @@ func NewCommandLogger(cfg config.LogConfig) (*CommandLogger, error) {
 		cfg.MaxBackups = 5
 	}
 
+	switch cfg.Format {
+	case "", FormatText, FormatJSON:
+	default:
+		return nil, fmt.Errorf("unknown log format '%s', must be text or json", cfg.Format)
+	}
+
 	// Ensure log directory exists
 	if err := os.MkdirAll(cfg.Directory, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create log directory: %w", err)
@@ -54,30 +136,108 @@ func NewCommandLogger(cfg config.LogConfig) (*CommandLogger, error) {
 	}, nil
 }
 
-// GetLogWriter returns a writer for the specified command
-func (l *CommandLogger) GetLogWriter(commandName string) io.Writer {
-	// Sanitize command name for use in filenames
-	safeCommandName := sanitizeFilename(commandName)
+// OpenRun returns a writer for a new run of the specified command
+func (l *CommandLogger) OpenRun(commandName string) (io.WriteCloser, string) {
+	if l.config.PerRun {
+		file, err := l.openRunFile(commandName)
+		if err == nil {
+			return &RunWriter{out: file, path: file.Name(), file: file, json: l.config.Format == FormatJSON, command: commandName}, file.Name()
+		}
+		fmt.Printf("Warning: %v, logging to the daily file\n", err)
+	}
+
+	logPath := l.GetLogPath(commandName)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	// Check if logger already exists
-	if logger, ok := l.loggers[safeCommandName]; ok {
-		return logger
+	// Reuse the logger of the daily file if it already exists
+	logger, ok := l.loggers[logPath]
+	if !ok {
+		// Close the files of previous days for this command
+		prefix := filepath.Join(l.baseDir, sanitizeFilename(commandName)+"-")
+		for path, old := range l.loggers {
+			if strings.HasPrefix(path, prefix) && isDailyLog(path, prefix) {
+				_ = old.Close()
+				delete(l.loggers, path)
+			}
+		}
+
+		logger = &lumberjack.Logger{
+			Filename:   logPath,
+			MaxSize:    l.config.MaxSize,
+			MaxBackups: l.config.MaxBackups,
+			MaxAge:     l.config.MaxAge,
+			Compress:   l.config.Compress,
+		}
+		l.loggers[logPath] = logger
 	}
 
-	// Create new logger
-	today := time.Now().Format("2006-01-02")
-	logPath := filepath.Join(l.baseDir, fmt.Sprintf("%s-%s.log", safeCommandName, today))
+	return &RunWriter{out: logger, path: logPath, json: l.config.Format == FormatJSON, command: commandName}, logPath
+}
+
+// runTimestamp is the layout of the timestamp in the name of per-run log files
+const runTimestamp = "20060102T150405"
 
-	logger := &lumberjack.Logger{
-		Filename:   logPath,
-		MaxSize:    l.config.MaxSize,
-		MaxBackups: l.config.MaxBackups,
-		MaxAge:     l.config.MaxAge,
-		Compress:   l.config.Compress,
+// openRunFile creates the log file of a new run of the command, named after
+// the start time of the run, and removes the files of the previous runs that
+// are older than the maximum age
+func (l *CommandLogger) openRunFile(commandName string) (*os.File, error) {
+	prefix := filepath.Join(l.baseDir, sanitizeFilename(commandName)+"-")
+	l.removeOldRuns(prefix)
+
+	base := prefix + time.Now().Format(runTimestamp)
+	logPath := base + ".log"
+	// Runs starting within the same second get a numbered file
+	for i := 2; ; i++ {
+		file, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return file, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create log file: %w", err)
+		}
+		logPath = fmt.Sprintf("%s-%d.log", base, i)
 	}
+}
+
+// removeOldRuns deletes the per-run log files of the command whose files
+// start with prefix when they are older than the maximum age
+func (l *CommandLogger) removeOldRuns(prefix string) {
+	paths, err := filepath.Glob(prefix + "*.log")
+	if err != nil {
+		return
+	}
+	limit := time.Now().AddDate(0, 0, -l.config.MaxAge)
+	for _, path := range paths {
+		started, ok := runStart(path, prefix)
+		if ok && started.Before(limit) {
+			_ = os.Remove(path)
+		}
+	}
+}
+
+// runStart returns the start time of the run logged in path, a per-run log
+// file of the command whose files start with prefix
+func runStart(path, prefix string) (time.Time, bool) {
+	name := strings.TrimSuffix(strings.TrimPrefix(path, prefix), ".log")
+	if len(name) > len(runTimestamp) && name[len(runTimestamp)] == '-' {
+		name = name[:len(runTimestamp)]
+	}
+	started, err := time.ParseInLocation(runTimestamp, name, time.Local)
+	return started, err == nil
+}
+
+// isDailyLog reports whether path is a daily log file of the command whose
+// files start with prefix, as opposed to a command whose name shares the prefix
+func isDailyLog(path, prefix string) bool {
+	_, err := time.Parse("2006-01-02.log", strings.TrimPrefix(path, prefix))
+	return err == nil
+}
 
-	l.loggers[safeCommandName] = logger
-	return logger
+// Directory returns the directory in which log files are written
+func (l *CommandLogger) Directory() string {
+	return l.baseDir
 }
 
 // GetLogPath returns the log file path for a command
@@ -89,8 +249,11 @@ func (l *CommandLogger) GetLogPath(commandName string) string {
 
 // Close closes all open loggers
 func (l *CommandLogger) Close() {
-	for _, logger := range l.loggers {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for path, logger := range l.loggers {
 		_ = logger.Close()
+		delete(l.loggers, path)
 	}
 }
 
@@ -0,0 +1,189 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds in seconds of the duration histogram
+var durationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600}
+
+// histogram counts observations in cumulative buckets
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// registry holds the metrics of the process
+type registry struct {
+	mu            sync.Mutex
+	runs          map[[2]string]uint64 // by command and status
+	failures      map[string]uint64
+	retries       map[string]uint64
+	durations     map[string]*histogram
+	notifyErrors  map[string]uint64 // by kind of notification
+	triggers      map[string]uint64
+	lastRunUnix   map[string]float64
+	lastRunFailed map[string]float64
+}
+
+var metrics = &registry{
+	runs:          make(map[[2]string]uint64),
+	failures:      make(map[string]uint64),
+	retries:       make(map[string]uint64),
+	durations:     make(map[string]*histogram),
+	triggers:      make(map[string]uint64),
+	notifyErrors:  make(map[string]uint64),
+	lastRunUnix:   make(map[string]float64),
+	lastRunFailed: make(map[string]float64),
+}
+
+// RecordSkip records a command skipped because of its conditions, which
+// isn't a failure
+func RecordSkip(command string) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	metrics.runs[[2]string{command, "skipped"}]++
+}
+
+// RecordRun records the outcome of a command run
+func RecordRun(command, status string, duration time.Duration, attempts int) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	metrics.runs[[2]string{command, status}]++
+	if status != "success" {
+		metrics.failures[command]++
+		metrics.lastRunFailed[command] = 1
+	} else {
+		metrics.lastRunFailed[command] = 0
+	}
+	if attempts > 1 {
+		metrics.retries[command] += uint64(attempts - 1)
+	}
+	metrics.lastRunUnix[command] = float64(time.Now().Unix())
+
+	h, ok := metrics.durations[command]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		metrics.durations[command] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// RecordNotificationError counts a failed notification attempt of a kind of
+// notification: message, result or embed
+func RecordNotificationError(kind string) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	metrics.notifyErrors[kind]++
+}
+
+// RecordTrigger counts a job submitted by a trigger source
+func RecordTrigger(source string) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	metrics.triggers[source]++
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format
+func WriteText(w io.Writer) error {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	var b strings.Builder
+
+	b.WriteString("# HELP delivr_runs_total Number of command runs by final status.\n")
+	b.WriteString("# TYPE delivr_runs_total counter\n")
+	runKeys := make([][2]string, 0, len(metrics.runs))
+	for key := range metrics.runs {
+		runKeys = append(runKeys, key)
+	}
+	sort.Slice(runKeys, func(i, j int) bool {
+		if runKeys[i][0] != runKeys[j][0] {
+			return runKeys[i][0] < runKeys[j][0]
+		}
+		return runKeys[i][1] < runKeys[j][1]
+	})
+	for _, key := range runKeys {
+		fmt.Fprintf(&b, "delivr_runs_total{command=%s,status=%s} %d\n", quote(key[0]), quote(key[1]), metrics.runs[key])
+	}
+
+	writeCounter(&b, "delivr_failures_total", "Number of failed command runs.", metrics.failures)
+	writeCounter(&b, "delivr_retries_total", "Number of retried command attempts.", metrics.retries)
+	writeGauge(&b, "delivr_last_run_timestamp_seconds", "Time of the last run of each command.", metrics.lastRunUnix)
+	writeGauge(&b, "delivr_last_run_failed", "Whether the last run of each command failed.", metrics.lastRunFailed)
+
+	b.WriteString("# HELP delivr_command_duration_seconds Duration of command runs, retries included.\n")
+	b.WriteString("# TYPE delivr_command_duration_seconds histogram\n")
+	for _, command := range sortedKeys(metrics.durations) {
+		h := metrics.durations[command]
+		for i, bound := range durationBuckets {
+			fmt.Fprintf(&b, "delivr_command_duration_seconds_bucket{command=%s,le=\"%g\"} %d\n", quote(command), bound, h.counts[i])
+		}
+		fmt.Fprintf(&b, "delivr_command_duration_seconds_bucket{command=%s,le=\"+Inf\"} %d\n", quote(command), h.count)
+		fmt.Fprintf(&b, "delivr_command_duration_seconds_sum{command=%s} %g\n", quote(command), h.sum)
+		fmt.Fprintf(&b, "delivr_command_duration_seconds_count{command=%s} %d\n", quote(command), h.count)
+	}
+
+	b.WriteString("# HELP delivr_triggers_total Number of jobs submitted by trigger source.\n")
+	b.WriteString("# TYPE delivr_triggers_total counter\n")
+	for _, source := range sortedKeys(metrics.triggers) {
+		fmt.Fprintf(&b, "delivr_triggers_total{source=%s} %d\n", quote(source), metrics.triggers[source])
+	}
+
+	b.WriteString("# HELP delivr_notification_errors_total Number of failed notification attempts by kind.\n")
+	b.WriteString("# TYPE delivr_notification_errors_total counter\n")
+	for _, kind := range sortedKeys(metrics.notifyErrors) {
+		fmt.Fprintf(&b, "delivr_notification_errors_total{kind=%s} %d\n", quote(kind), metrics.notifyErrors[kind])
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeCounter writes a counter labeled by command
+func writeCounter(b *strings.Builder, name, help string, values map[string]uint64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, command := range sortedKeys(values) {
+		fmt.Fprintf(b, "%s{command=%s} %d\n", name, quote(command), values[command])
+	}
+}
+
+// writeGauge writes a gauge labeled by command
+func writeGauge(b *strings.Builder, name, help string, values map[string]float64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for _, command := range sortedKeys(values) {
+		fmt.Fprintf(b, "%s{command=%s} %g\n", name, quote(command), values[command])
+	}
+}
+
+// sortedKeys returns the keys of a map in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// quote escapes a label value
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
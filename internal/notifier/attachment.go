@@ -0,0 +1,101 @@
+package notifier
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/ndious/delivr/internal/discord"
+	"github.com/ndious/delivr/internal/i18n"
+)
+
+// maxAttachmentSize is the largest log attached to a result, only the end of
+// longer logs being attached
+const maxAttachmentSize = 8 << 20
+
+// AttachPolicy tells when the log of a run is attached to its result
+type AttachPolicy string
+
+const (
+	// AttachFailure attaches the log of failed and timed out runs
+	AttachFailure AttachPolicy = "failure"
+	// AttachAlways attaches the log of every run
+	AttachAlways AttachPolicy = "always"
+	// AttachNever never attaches the log
+	AttachNever AttachPolicy = "never"
+)
+
+// ParseAttachPolicy validates a policy name, an empty name meaning failure
+func ParseAttachPolicy(name string) (AttachPolicy, error) {
+	switch AttachPolicy(name) {
+	case "", AttachFailure:
+		return AttachFailure, nil
+	case AttachAlways, AttachNever:
+		return AttachPolicy(name), nil
+	default:
+		return "", fmt.Errorf("unknown attachLog %q, must be failure, always or never", name)
+	}
+}
+
+// attaches reports whether the log of the run of a result is attached
+func (p AttachPolicy) attaches(r Result) bool {
+	switch p {
+	case AttachAlways:
+		return r.LogPath != ""
+	case AttachFailure:
+		return r.LogPath != "" && r.Status.Failed()
+	default:
+		return false
+	}
+}
+
+// logAttachment reads the log of the run of a result, from the end of the
+// log file. It returns whether the log was cut to the attachment size.
+func logAttachment(r Result) (discord.File, bool, error) {
+	f, err := os.Open(r.LogPath)
+	if err != nil {
+		return discord.File{}, false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return discord.File{}, false, err
+	}
+	// The whole file is the log of the run when its size is unknown or when
+	// the file was rotated during the run
+	size := r.LogSize
+	if size <= 0 || size > info.Size() {
+		size = info.Size()
+	}
+	truncated := size > maxAttachmentSize
+	if truncated {
+		size = maxAttachmentSize
+	}
+
+	content := make([]byte, size)
+	if _, err := f.ReadAt(content, info.Size()-size); err != nil && err != io.EOF {
+		return discord.File{}, false, err
+	}
+	return discord.File{Name: filepath.Base(r.LogPath), Content: content}, truncated, nil
+}
+
+// logFile returns the log of the run of a result to attach to its message,
+// or nil when the log isn't attached or can't be read. The note is set when
+// only the end of the log is attached.
+func logFile(r Result, policy AttachPolicy) (file *discord.File, note string) {
+	if !policy.attaches(r) {
+		return nil, ""
+	}
+	attachment, truncated, err := logAttachment(r)
+	if err != nil {
+		log.Printf("Warning: Could not attach the log of '%s': %v", r.Command, err)
+		return nil, ""
+	}
+	if truncated {
+		note = i18n.T("📎 Last %d MB of the log attached", maxAttachmentSize>>20)
+	}
+	return &attachment, note
+}
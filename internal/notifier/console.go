@@ -0,0 +1,159 @@
+package notifier
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/discord"
+	"github.com/ndious/delivr/internal/i18n"
+)
+
+// console prints the messages meant for a notifier instead of sending them
+type console struct {
+	// name is the notifier the messages are meant for, e.g. discord or the
+	// channel of a route
+	name string
+	// kind is the kind of the notifier, selected by the commands
+	kind string
+	out  io.Writer
+	mu   *sync.Mutex
+}
+
+// SendMessage prints the message, prefixed with the name of the notifier
+func (c console) SendMessage(content string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := fmt.Fprintf(c.out, "[%s] %s\n", c.name, strings.ReplaceAll(content, "\n", "\n    "))
+	return err
+}
+
+// NewConsole creates notifiers printing their notifications on out instead of
+// sending them, standing for the notifiers enabled in the configuration, so
+// that the runs can be rehearsed with --simulate. The messages show the
+// notifier they are meant for, the Discord routes and channels included.
+func NewConsole(cfg *config.Config, out io.Writer) (Multi, error) {
+	var notifiers []Notifier
+	if _, err := i18n.Load(cfg.Language); err != nil {
+		return Multi{}, err
+	}
+	mu := &sync.Mutex{}
+	newConsole := func(kind, name, format string) (Notifier, error) {
+		profile, err := ParseProfile(format)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return text{console{name: name, kind: kind, out: out, mu: mu}, profile}, nil
+	}
+
+	if cfg.Discord.Bot != nil || cfg.Discord.ChannelID != "" {
+		discordNotifier, err := newConsole(KindDiscord, "discord", cfg.Discord.Format)
+		if err != nil {
+			return Multi{}, err
+		}
+		var failures Notifier
+		if routed(cfg) {
+			router, err := newRouter(cfg, discordNotifier, func(name, channelID string) (Notifier, error) {
+				return newConsole(KindDiscord, "discord "+name, cfg.Discord.Format)
+			})
+			if err != nil {
+				return Multi{}, fmt.Errorf("discord: %w", err)
+			}
+			discordNotifier = router
+			failures = router.failures()
+		}
+		notifiers = append(notifiers, discordNotifier)
+		if failures != nil {
+			notifiers = append(notifiers, failures)
+		}
+	}
+	if cfg.Notifications != nil {
+		if slack := cfg.Notifications.Slack; slack != nil {
+			n, err := newConsole(KindSlack, "slack", slack.Format)
+			if err != nil {
+				return Multi{}, err
+			}
+			notifiers = append(notifiers, n)
+		}
+		for i, webhook := range cfg.Notifications.Webhooks {
+			n, err := newConsole(KindWebhooks, fmt.Sprintf("webhook %d", i+1), webhook.Format)
+			if err != nil {
+				return Multi{}, err
+			}
+			notifiers = append(notifiers, n)
+		}
+		if cfg.Notifications.Email != nil {
+			email, err := NewEmail(*cfg.Notifications.Email)
+			if err != nil {
+				return Multi{}, fmt.Errorf("email: %w", err)
+			}
+			printer := console{name: "email", out: out, mu: mu}
+			email.deliver = func(subject, body string, file *discord.File) error {
+				content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s", strings.Join(email.to, ", "), subject, strings.TrimRight(body, "\n"))
+				if file != nil {
+					content += "\nAttachment: " + file.Name
+				}
+				return printer.SendMessage(content)
+			}
+			notifiers = append(notifiers, email)
+		}
+		newPushConsole := func(kind, on, format string) (Notifier, error) {
+			printer := console{name: kind, kind: kind, out: out, mu: mu}
+			n, err := newPush(kind, on, format, func(title, message string, failed bool) error {
+				return printer.SendMessage(title + "\n" + message)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", kind, err)
+			}
+			return n, nil
+		}
+		if ntfy := cfg.Notifications.Ntfy; ntfy != nil {
+			if _, err := NewNtfy(*ntfy); err != nil {
+				return Multi{}, fmt.Errorf("ntfy: %w", err)
+			}
+			n, err := newPushConsole(KindNtfy, ntfy.On, ntfy.Format)
+			if err != nil {
+				return Multi{}, err
+			}
+			notifiers = append(notifiers, n)
+		}
+		if gotify := cfg.Notifications.Gotify; gotify != nil {
+			if _, err := NewGotify(*gotify); err != nil {
+				return Multi{}, fmt.Errorf("gotify: %w", err)
+			}
+			n, err := newPushConsole(KindGotify, gotify.On, gotify.Format)
+			if err != nil {
+				return Multi{}, err
+			}
+			notifiers = append(notifiers, n)
+		}
+		if telegram := cfg.Notifications.Telegram; telegram != nil {
+			n, err := newConsole(KindTelegram, "telegram", telegram.Format)
+			if err != nil {
+				return Multi{}, err
+			}
+			notifiers = append(notifiers, n)
+		}
+		if mattermost := cfg.Notifications.Mattermost; mattermost != nil {
+			n, err := newConsole(KindMattermost, "mattermost", mattermost.Format)
+			if err != nil {
+				return Multi{}, err
+			}
+			notifiers = append(notifiers, n)
+		}
+	}
+	if len(notifiers) == 0 {
+		n, err := newConsole("", "console", "")
+		if err != nil {
+			return Multi{}, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	selected, err := selectNotifiers(cfg, notifiers)
+	if err != nil {
+		return Multi{}, err
+	}
+	return Multi{notifiers: notifiers, selected: selected, host: HostFromConfig(cfg.Host)}, nil
+}
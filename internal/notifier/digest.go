@@ -0,0 +1,273 @@
+package notifier
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/metrics"
+)
+
+// maxDigestLength is the size of a digest message, within the limit of the
+// Discord messages. Longer digests are split between their notifications.
+const maxDigestLength = 1900
+
+// digest batches the notifications of a notifier during a window and sends
+// them as a single message when the window ends. In batch mode, a
+// notification alone in its window is sent unchanged.
+type digest struct {
+	next   Notifier
+	window time.Duration
+	batch  bool
+
+	mu      sync.Mutex
+	entries []digestEntry
+	since   time.Time
+	timer   *time.Timer
+	// stopped is set once the notifiers were replaced by a reload: the
+	// notifications are sent at once
+	stopped bool
+	// channels are the digests of the channels of the routes, by the
+	// notifier of their channel, when next is a router
+	channels map[Notifier]*digest
+}
+
+// digestEntry is a notification waiting in a digest, with the result it
+// renders if any, and the notifier of its run sending it alone
+type digestEntry struct {
+	text   string
+	result *Result
+	run    Notifier
+}
+
+// newDigest wraps a notifier to batch its notifications during window
+func newDigest(next Notifier, window time.Duration) *digest {
+	return &digest{next: next, window: window}
+}
+
+// newBatch wraps a notifier to combine the notifications sent in a burst,
+// within window of the first one
+func newBatch(next Notifier, window time.Duration) *digest {
+	d := newDigest(next, window)
+	d.batch = true
+	return d
+}
+
+// ForRun returns a notifier adding the notifications of a command run to the
+// digest of the channel of the command. A notification alone in its batch is
+// sent in the run, e.g. in its thread.
+func (d *digest) ForRun(command string) Notifier {
+	target, channel := d, d.next
+	if r, ok := d.next.(*router); ok {
+		channel = r.notifierFor(command)
+		target = d.channel(channel)
+	}
+	run := digestRun{digest: target}
+	if scoper, ok := channel.(RunScoper); ok {
+		run.run = scoper.ForRun(command)
+	}
+	return run
+}
+
+// channel returns the digest of the channel of a route, the digest itself for
+// the default channel
+func (d *digest) channel(n Notifier) *digest {
+	if r, ok := d.next.(*router); ok && n == r.Notifier {
+		return d
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.channels == nil {
+		d.channels = make(map[Notifier]*digest)
+	}
+	child, ok := d.channels[n]
+	if !ok {
+		child = &digest{next: n, window: d.window, batch: d.batch, stopped: d.stopped}
+		d.channels[n] = child
+	}
+	return child
+}
+
+// digestRun adds the notifications of a command run to a digest
+type digestRun struct {
+	*digest
+	run Notifier
+}
+
+// SendMessage adds the message to the digest
+func (r digestRun) SendMessage(content string) error {
+	r.add(digestEntry{text: content, run: r.run})
+	return nil
+}
+
+// SendResult adds the result to the digest as a single line
+func (r digestRun) SendResult(result Result) error {
+	r.add(digestEntry{text: formatCompact(result), result: &result, run: r.run})
+	return nil
+}
+
+// SendMessage adds the message to the digest
+func (d *digest) SendMessage(content string) error {
+	d.add(digestEntry{text: content})
+	return nil
+}
+
+// SendResult adds the result to the digest as a single line
+func (d *digest) SendResult(result Result) error {
+	d.add(digestEntry{text: formatCompact(result), result: &result})
+	return nil
+}
+
+// add queues a notification, starting the window on the first one. Once
+// the digest is stopped, the notification is sent at once.
+func (d *digest) add(entry digestEntry) {
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		d.forward(entry)
+		return
+	}
+	defer d.mu.Unlock()
+	if len(d.entries) == 0 {
+		d.since = time.Now()
+		d.timer = time.AfterFunc(d.window, d.flush)
+	}
+	d.entries = append(d.entries, entry)
+}
+
+// flushAll sends the queued notifications of the digest and of the digests
+// of its channels
+func (d *digest) flushAll() {
+	d.flush()
+	for _, child := range d.children() {
+		child.flush()
+	}
+}
+
+// stop sends the queued notifications of the digest and of the digests of
+// its channels, and the next ones at once, so that no timer is left
+func (d *digest) stop() {
+	for _, digest := range append([]*digest{d}, d.children()...) {
+		digest.mu.Lock()
+		digest.stopped = true
+		digest.mu.Unlock()
+		digest.flush()
+	}
+}
+
+// children returns the digests of the channels of the routes
+func (d *digest) children() []*digest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	channels := make([]*digest, 0, len(d.channels))
+	for _, child := range d.channels {
+		channels = append(channels, child)
+	}
+	return channels
+}
+
+// flush sends the queued notifications
+func (d *digest) flush() {
+	d.mu.Lock()
+	entries, since := d.entries, d.since
+	d.entries = nil
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.mu.Unlock()
+
+	if len(entries) == 0 {
+		return
+	}
+	if d.batch && len(entries) == 1 {
+		d.forward(entries[0])
+		return
+	}
+	texts := make([]string, len(entries))
+	for i, entry := range entries {
+		texts[i] = entry.text
+	}
+	header := i18n.T("🗞️ Digest of %d notifications since %s", len(entries), since.Format("15:04"))
+	if d.batch {
+		header = i18n.T("📦 %d notifications", len(entries))
+	}
+	for _, msg := range digestMessages(header, texts) {
+		if err := d.next.SendMessage(msg); err != nil {
+			log.Printf("Digest notification attempt failed: %v", err)
+			metrics.RecordNotificationError("message")
+		}
+	}
+}
+
+// forward sends a notification alone in its batch as it was sent, in its run
+// when it has one. Failed results are retried in the background.
+func (d *digest) forward(entry digestEntry) {
+	next := d.next
+	if entry.run != nil {
+		next = entry.run
+	}
+	if entry.result == nil {
+		if err := next.SendMessage(entry.text); err != nil {
+			log.Printf("Notification attempt failed: %v", err)
+			metrics.RecordNotificationError("message")
+		}
+		return
+	}
+	if err := next.SendResult(*entry.result); err != nil {
+		log.Printf("Result notification attempt for '%s' failed, will retry: %v", entry.result.Command, err)
+		metrics.RecordNotificationError("result")
+		retryResult(next, *entry.result)
+	}
+}
+
+// digestMessages combines the notifications under a header in as few
+// messages as possible. A notification too long for a message of its own is
+// truncated.
+func digestMessages(header string, entries []string) []string {
+	var messages []string
+	continued := header + i18n.Text(" (continued)")
+	current := header
+	for _, entry := range entries {
+		entry = truncateEntry(entry, maxDigestLength-len(continued)-2)
+		if len(current)+len(entry)+2 > maxDigestLength && current != header {
+			messages = append(messages, current)
+			current = continued
+		}
+		current += "\n\n" + entry
+	}
+	return append(messages, current)
+}
+
+// truncateEntry shortens a notification of a digest to size bytes, closing
+// the code block it cuts
+func truncateEntry(entry string, size int) string {
+	if len(entry) <= size {
+		return entry
+	}
+	const suffix = "\n```\n... (truncated)"
+	cut := firstBytes(entry, size-len(suffix))
+	if strings.Count(cut, "```")%2 == 1 {
+		return cut + suffix
+	}
+	return cut + strings.TrimPrefix(suffix, "\n```")
+}
+
+// FlushDigests sends the notifications batched by the digests of the
+// notifiers at once
+func (m Multi) FlushDigests() {
+	for _, d := range m.digests {
+		d.flushAll()
+	}
+}
+
+// Close stops the digests of notifiers replaced by a reload: their batched
+// notifications are sent, and those of the jobs still running with them are
+// sent at once
+func (m Multi) Close() {
+	for _, d := range m.digests {
+		d.stop()
+	}
+}
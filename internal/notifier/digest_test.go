@@ -0,0 +1,28 @@
+package notifier
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestDigestMessagesTruncateLongEntries checks that a notification longer
+// than a digest message is truncated to fit in one, its code block closed
+func TestDigestMessagesTruncateLongEntries(t *testing.T) {
+	long := "✅ **deploy**\n```\n" + strings.Repeat("output line\n", 400) + "```"
+	messages := digestMessages("🗞️ Digest of 3 notifications", []string{"first", long, "last"})
+	// The truncated entry fills the first message
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(messages))
+	}
+	for i, msg := range messages {
+		if len(msg) > maxDigestLength {
+			t.Errorf("message %d is %d bytes long, more than %d", i, len(msg), maxDigestLength)
+		}
+		if strings.Count(msg, "```")%2 != 0 {
+			t.Errorf("message %d leaves a code block open", i)
+		}
+	}
+	if !strings.HasSuffix(messages[0], "```\n... (truncated)") {
+		t.Errorf("the long entry wasn't truncated in the first message")
+	}
+}
@@ -0,0 +1,142 @@
+package notifier
+
+import (
+	"log"
+
+	"github.com/ndious/delivr/internal/discord"
+	"github.com/ndious/delivr/internal/i18n"
+)
+
+// Discord sends notifications through a Discord webhook
+type Discord struct {
+	text
+	client      *discord.Client
+	attach      AttachPolicy
+	style       Style
+	maxMessages int
+}
+
+// NewDiscord creates a new Discord notifier. The output of the results is
+// split between at most maxMessages messages.
+func NewDiscord(webhookURL string, profile Profile, attach AttachPolicy, style Style, maxMessages int) (*Discord, error) {
+	client, err := discord.NewClient(webhookURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Discord{
+		text:        text{client, profile},
+		client:      client,
+		attach:      attach,
+		style:       style,
+		maxMessages: maxMessages,
+	}, nil
+}
+
+// SendResult sends the result as an embed or a message depending on the
+// style, with the log of the run attached according to the attach policy
+func (d *Discord) SendResult(result Result) error {
+	_, err := d.postResult(result)
+	return err
+}
+
+// postResult sends a result like SendResult and returns the ID of its
+// message. The rest of a long output follows in other messages.
+func (d *Discord) postResult(result Result) (string, error) {
+	result, rest := splitResult(result, d.profile, d.maxMessages)
+	id, err := d.postSplitResult(result)
+	if err != nil {
+		return id, err
+	}
+	for _, msg := range rest {
+		if _, err := d.client.PostMessage(msg); err != nil {
+			log.Printf("Warning: Could not send the rest of the output of '%s': %v", result.Command, err)
+			break
+		}
+	}
+	return id, nil
+}
+
+// postSplitResult sends a result with the first part of its output
+func (d *Discord) postSplitResult(result Result) (string, error) {
+	file, note := logFile(result, d.attach)
+
+	// A templated result is sent as is
+	if d.style == StyleEmbed && result.Message == "" {
+		embed := ResultEmbed(result, d.profile)
+		if note != "" {
+			embed.Fields = append(embed.Fields, EmbedField{Name: i18n.Text("Attachment"), Value: note})
+		}
+		return d.client.PostEmbed(discordEmbed(embed), file)
+	}
+
+	msg := FormatResultProfile(result, d.profile)
+	if note != "" {
+		msg += "\n" + note
+	}
+	if file == nil {
+		return d.client.PostMessage(msg)
+	}
+	return d.client.PostMessageWithFile(msg, *file)
+}
+
+// StartStream starts a new live output message
+func (d *Discord) StartStream() (Stream, error) {
+	return &discordStream{client: d.client}, nil
+}
+
+// ForRun returns a notifier recording the IDs of the messages of a command run
+func (d *Discord) ForRun(command string) Notifier {
+	return &discordRun{Discord: d}
+}
+
+// discordRun sends the messages of a command run through the webhook and
+// records their receipts
+type discordRun struct {
+	*Discord
+	receipts
+}
+
+// SendMessage sends a message and records its ID
+func (r *discordRun) SendMessage(content string) error {
+	id, err := r.client.PostMessage(content)
+	r.add(ReceiptDiscord, MessageText, "", id)
+	return err
+}
+
+// SendResult sends a result and records the ID of its message
+func (r *discordRun) SendResult(result Result) error {
+	id, err := r.postResult(result)
+	r.add(ReceiptDiscord, MessageResult, "", id)
+	return err
+}
+
+// StartStream starts a live output message whose ID is recorded once posted
+func (r *discordRun) StartStream() (Stream, error) {
+	return &discordStream{client: r.client, receipts: &r.receipts}, nil
+}
+
+// discordStream shows live output by editing a single webhook message
+type discordStream struct {
+	client    *discord.Client
+	messageID string
+	receipts  *receipts
+}
+
+// Update posts the message on the first call and edits it afterwards
+func (s *discordStream) Update(content string) error {
+	if s.messageID == "" {
+		id, err := s.client.PostMessage(content)
+		if err != nil {
+			return err
+		}
+		s.messageID = id
+		s.receipts.add(ReceiptDiscord, MessageStream, "", id)
+		return nil
+	}
+	return s.client.EditMessage(s.messageID, content)
+}
+
+// Close is a no-op, the last update stays visible
+func (s *discordStream) Close() error {
+	return nil
+}
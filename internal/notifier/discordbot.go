@@ -0,0 +1,234 @@
+package notifier
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/ndious/delivr/internal/discord"
+	"github.com/ndious/delivr/internal/i18n"
+)
+
+// RunScoper is implemented by notifiers that group the messages of a
+// command run, e.g. in a dedicated thread
+type RunScoper interface {
+	ForRun(command string) Notifier
+}
+
+// ForRun returns a notifier scoped to a command run, in which the notifiers
+// supporting it group the messages of the run. Only the notifiers selected by
+// the command receive them.
+func (m Multi) ForRun(command string) Notifier {
+	scoped := Multi{notifiers: make([]Notifier, 0, len(m.notifiers)), host: m.host}
+	for _, n := range m.notifiers {
+		if !m.selects(command, n) {
+			continue
+		}
+		if scoper, ok := n.(RunScoper); ok {
+			n = scoper.ForRun(command)
+		}
+		scoped.notifiers = append(scoped.notifiers, n)
+	}
+	return scoped
+}
+
+// DiscordBot sends notifications to a channel with a Discord bot, creating a
+// thread for each command run
+type DiscordBot struct {
+	bot         *discord.Bot
+	channelID   string
+	profile     Profile
+	attach      AttachPolicy
+	style       Style
+	maxMessages int
+}
+
+// NewDiscordBot creates a new Discord bot notifier. The output of the results
+// is split between at most maxMessages messages.
+func NewDiscordBot(token, channelID string, profile Profile, attach AttachPolicy, style Style, maxMessages int) (*DiscordBot, error) {
+	if channelID == "" {
+		return nil, errors.New("discord bot channel ID is required")
+	}
+	bot, err := discord.NewBot(token)
+	if err != nil {
+		return nil, err
+	}
+	return &DiscordBot{bot: bot, channelID: channelID, profile: profile, attach: attach, style: style, maxMessages: maxMessages}, nil
+}
+
+// SendMessage posts a message in the channel
+func (d *DiscordBot) SendMessage(content string) error {
+	_, err := d.bot.CreateMessage(d.channelID, content)
+	return err
+}
+
+// SendResult posts the result in the channel, with the log of the run
+// attached according to the attach policy
+func (d *DiscordBot) SendResult(result Result) error {
+	_, err := d.postResult(d.channelID, result)
+	return err
+}
+
+// postResult posts a result in a channel or thread, as an embed or a message
+// depending on the style, and returns the ID of its message. The rest of a
+// long output follows in other messages.
+func (d *DiscordBot) postResult(channelID string, result Result) (string, error) {
+	result, rest := splitResult(result, d.profile, d.maxMessages)
+	id, err := d.postSplitResult(channelID, result)
+	if err != nil {
+		return id, err
+	}
+	for _, msg := range rest {
+		if _, err := d.bot.CreateMessage(channelID, msg); err != nil {
+			log.Printf("Warning: Could not send the rest of the output of '%s': %v", result.Command, err)
+			break
+		}
+	}
+	return id, nil
+}
+
+// postSplitResult posts a result with the first part of its output
+func (d *DiscordBot) postSplitResult(channelID string, result Result) (string, error) {
+	file, note := logFile(result, d.attach)
+
+	// A templated result is sent as is
+	if d.style == StyleEmbed && result.Message == "" {
+		embed := ResultEmbed(result, d.profile)
+		if note != "" {
+			embed.Fields = append(embed.Fields, EmbedField{Name: i18n.Text("Attachment"), Value: note})
+		}
+		return d.bot.CreateEmbed(channelID, discordEmbed(embed), file)
+	}
+
+	msg := FormatResultProfile(result, d.profile)
+	if note != "" {
+		msg += "\n" + note
+	}
+	if file == nil {
+		return d.bot.CreateMessage(channelID, msg)
+	}
+	return d.bot.CreateMessageWithFile(channelID, msg, *file)
+}
+
+// StartStream starts a live output message in the channel
+func (d *DiscordBot) StartStream() (Stream, error) {
+	return &botStream{bot: d.bot, channelID: d.channelID}, nil
+}
+
+// EditSent replaces the content of a message sent by the bot
+func (d *DiscordBot) EditSent(receipt Receipt, content string) error {
+	if receipt.Notifier != ReceiptDiscordBot {
+		return nil
+	}
+	return d.bot.EditMessage(receipt.ChannelID, receipt.MessageID, content)
+}
+
+// DeleteSent deletes a message sent by the bot
+func (d *DiscordBot) DeleteSent(receipt Receipt) error {
+	if receipt.Notifier != ReceiptDiscordBot {
+		return nil
+	}
+	return d.bot.DeleteMessage(receipt.ChannelID, receipt.MessageID)
+}
+
+// ForRun returns a notifier posting the messages of a command run in a thread
+func (d *DiscordBot) ForRun(command string) Notifier {
+	return &discordThread{parent: d, command: command}
+}
+
+// discordThread posts the first message of a run in the channel, and the
+// following ones in a thread attached to it, recording their receipts
+type discordThread struct {
+	parent    *DiscordBot
+	command   string
+	starterID string
+	threadID  string
+	receipts
+}
+
+// SendMessage posts the starter message of the thread on the first call, and
+// in the thread afterwards
+func (t *discordThread) SendMessage(content string) error {
+	if t.threadID != "" {
+		id, err := t.parent.bot.CreateMessage(t.threadID, content)
+		t.add(ReceiptDiscordBot, MessageText, t.threadID, id)
+		return err
+	}
+
+	starterID, err := t.parent.bot.CreateMessage(t.parent.channelID, content)
+	if err != nil {
+		return err
+	}
+	t.starterID = starterID
+	t.add(ReceiptDiscordBot, MessageText, t.parent.channelID, starterID)
+
+	threadID, err := t.parent.bot.StartThread(t.parent.channelID, starterID, t.command)
+	if err != nil {
+		// Keep posting in the channel rather than losing messages
+		log.Printf("Warning: Could not create thread for '%s', posting in the channel: %v", t.command, err)
+		threadID = t.parent.channelID
+	}
+	t.threadID = threadID
+	return nil
+}
+
+// SendResult posts the result in the thread and updates the starter message
+// with the final status so that the channel shows it at a glance
+func (t *discordThread) SendResult(result Result) error {
+	msg := FormatResultProfile(result, t.parent.profile)
+	status, _, _ := strings.Cut(msg, "\n")
+	if t.threadID == "" {
+		// Without a start message, the status starts the thread
+		if err := t.SendMessage(status); err != nil {
+			return err
+		}
+	}
+	id, err := t.parent.postResult(t.threadID, result)
+	t.add(ReceiptDiscordBot, MessageResult, t.threadID, id)
+	if err != nil {
+		return err
+	}
+
+	if t.threadID != t.parent.channelID {
+		if err := t.parent.bot.EditMessage(t.parent.channelID, t.starterID, status); err != nil {
+			log.Printf("Warning: Could not update starter message for '%s': %v", t.command, err)
+		}
+	}
+	return nil
+}
+
+// StartStream starts a live output message in the thread
+func (t *discordThread) StartStream() (Stream, error) {
+	channelID := t.threadID
+	if channelID == "" {
+		channelID = t.parent.channelID
+	}
+	return &botStream{bot: t.parent.bot, channelID: channelID, receipts: &t.receipts}, nil
+}
+
+// botStream shows live output by editing a single message
+type botStream struct {
+	bot       *discord.Bot
+	channelID string
+	messageID string
+	receipts  *receipts
+}
+
+// Update posts the message on the first call and edits it afterwards
+func (s *botStream) Update(content string) error {
+	if s.messageID == "" {
+		id, err := s.bot.CreateMessage(s.channelID, content)
+		if err != nil {
+			return err
+		}
+		s.messageID = id
+		s.receipts.add(ReceiptDiscordBot, MessageStream, s.channelID, id)
+		return nil
+	}
+	return s.bot.EditMessage(s.channelID, s.messageID, content)
+}
+
+// Close is a no-op, the last update stays visible
+func (s *botStream) Close() error {
+	return nil
+}
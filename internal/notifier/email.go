@@ -0,0 +1,382 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/discord"
+)
+
+const (
+	// defaultSMTPPort is the submission port, secured with STARTTLS
+	defaultSMTPPort = 587
+	// implicitTLSPort is the port whose connections start with TLS
+	implicitTLSPort = 465
+	// smtpTimeout bounds the connection to the SMTP server
+	smtpTimeout = 30 * time.Second
+)
+
+// Default templates of the emails
+const (
+	defaultEmailSubject = `[delivr] {{.Command}}: {{.Status}}{{if .Host}} on {{.Host}}{{end}}`
+	defaultEmailBody    = `Command: {{.Command}}
+{{- if .Description}}
+Description: {{.Description}}{{end}}
+Status: {{.Status}}
+{{- if .Host}}
+Host: {{.Host}}{{end}}
+Duration: {{.Duration}}
+Exit code: {{.ExitCode}}
+{{- if .Error}}
+Error: {{.Error}}{{end}}
+{{- if .LogPath}}
+Log file: {{.LogPath}}{{end}}
+{{- if .Output}}
+
+Output:
+{{.Output}}{{end}}
+`
+)
+
+// Email sends the results of the runs by email. Other messages aren't sent.
+type Email struct {
+	host string
+	port int
+	auth smtp.Auth
+	// from and to are the addresses of the headers, sender and recipients
+	// the addresses of the envelope
+	from       string
+	to         []string
+	sender     string
+	recipients []string
+	always     bool
+	profile    Profile
+	attach     AttachPolicy
+	subject    *template.Template
+	body       *template.Template
+	// deliver sends an email, through the SMTP server unless simulating
+	deliver func(subject, body string, file *discord.File) error
+}
+
+// emailData is the data of the email templates
+type emailData struct {
+	Command     string
+	Description string
+	Status      Status
+	Host        string
+	Duration    time.Duration
+	ExitCode    int
+	Error       string
+	Output      string
+	LogPath     string
+	Attempts    int
+}
+
+// sampleEmailData is rendered by the templates of the emails when they are
+// parsed
+var sampleEmailData = emailData{
+	Command:     "deploy",
+	Description: "Deploy the application",
+	Status:      StatusFailure,
+	Host:        "web-1",
+	Duration:    90 * time.Second,
+	ExitCode:    1,
+	Error:       "exit status 1",
+	Output:      "output",
+	LogPath:     "/var/log/delivr/deploy.log",
+	Attempts:    2,
+}
+
+// NewEmail creates a new email notifier
+func NewEmail(cfg config.EmailConfig) (*Email, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("host is required")
+	}
+	sender, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address %q: %w", cfg.From, err)
+	}
+	if len(cfg.To) == 0 {
+		return nil, errors.New("at least one recipient is required in to")
+	}
+	e := &Email{host: cfg.Host, port: cfg.Port, from: cfg.From, to: cfg.To, sender: sender.Address}
+	for _, to := range cfg.To {
+		recipient, err := mail.ParseAddress(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to address %q: %w", to, err)
+		}
+		e.recipients = append(e.recipients, recipient.Address)
+	}
+	if e.port == 0 {
+		e.port = defaultSMTPPort
+	}
+	if cfg.Username != "" {
+		e.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	if e.always, err = parseOn(cfg.On); err != nil {
+		return nil, err
+	}
+	if e.profile, err = ParseProfile(cfg.Format); err != nil {
+		return nil, err
+	}
+	e.attach = AttachNever
+	if cfg.AttachLog != "" {
+		if e.attach, err = ParseAttachPolicy(cfg.AttachLog); err != nil {
+			return nil, err
+		}
+	}
+	if e.subject, err = parseEmailTemplate("subject", cfg.Subject, defaultEmailSubject); err != nil {
+		return nil, err
+	}
+	if e.body, err = parseEmailTemplate("body", cfg.Body, defaultEmailBody); err != nil {
+		return nil, err
+	}
+	e.deliver = e.send
+	return e, nil
+}
+
+// parseEmailTemplate parses a template of the emails, or its default
+func parseEmailTemplate(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+	return parseTemplate(name, text, sampleEmailData)
+}
+
+// SendMessage is a no-op, only the results are emailed
+func (e *Email) SendMessage(content string) error {
+	return nil
+}
+
+// SendResult emails the result of a failed run, or of every run when the
+// notifier is set to always send
+func (e *Email) SendResult(result Result) error {
+	if !e.always && !result.Status.Failed() {
+		return nil
+	}
+	subject, body, err := e.render(result)
+	if err != nil {
+		return err
+	}
+	file, note := logFile(result, e.attach)
+	if note != "" {
+		body += "\n" + strings.TrimPrefix(note, "📎 ") + "\n"
+	}
+	return e.deliver(subject, body, file)
+}
+
+// render renders the subject and body of the email of a result
+func (e *Email) render(result Result) (string, string, error) {
+	data := emailData{
+		Command:     result.Command,
+		Description: result.Description,
+		Status:      result.Status,
+		Duration:    result.Duration.Round(time.Millisecond),
+		ExitCode:    result.ExitCode,
+		Error:       result.Error,
+		Output:      result.Output,
+		LogPath:     result.LogPath,
+		Attempts:    result.Attempts,
+	}
+	if !result.Host.IsZero() {
+		data.Host = result.Host.String()
+	}
+	// The profile selects how much output is included
+	switch e.profile {
+	case ProfileCompact:
+		data.Output = ""
+	case ProfileVerbose:
+		data.Output = result.Tail
+	}
+
+	var subject, body strings.Builder
+	if err := e.subject.Execute(&subject, data); err != nil {
+		return "", "", fmt.Errorf("error rendering the email subject: %w", err)
+	}
+	if err := e.body.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("error rendering the email body: %w", err)
+	}
+	return strings.TrimSpace(subject.String()), body.String(), nil
+}
+
+// message builds an email with its headers, and the file attached if any
+func (e *Email) message(subject, text string, file *discord.File) ([]byte, error) {
+	var msg bytes.Buffer
+	header := textproto.MIMEHeader{}
+	header.Set("From", e.from)
+	header.Set("To", strings.Join(e.to, ", "))
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("MIME-Version", "1.0")
+	if file == nil {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(&msg, header)
+		if err := writeQuotedPrintable(&msg, text); err != nil {
+			return nil, err
+		}
+		return msg.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&msg)
+	header.Set("Content-Type", "multipart/mixed; boundary="+parts.Boundary())
+	writeHeader(&msg, header)
+	part, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(part, text); err != nil {
+		return nil, err
+	}
+	if err := writeAttachment(parts, *file); err != nil {
+		return nil, err
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// writeHeader writes the header of an email, followed by the blank line
+// separating it from the body
+func writeHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	for _, name := range []string{"From", "To", "Subject", "Date", "MIME-Version", "Content-Type", "Content-Transfer-Encoding"} {
+		if value := header.Get(name); value != "" {
+			fmt.Fprintf(buf, "%s: %s\r\n", name, value)
+		}
+	}
+	buf.WriteString("\r\n")
+}
+
+// writeQuotedPrintable writes a text with the quoted-printable encoding
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeAttachment adds a file to an email, encoded in base64 lines
+func writeAttachment(parts *multipart.Writer, file discord.File) error {
+	part, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": file.Name})},
+	})
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(file.Content)
+	for len(encoded) > 76 {
+		if _, err := fmt.Fprintf(part, "%s\r\n", encoded[:76]); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = fmt.Fprintf(part, "%s\r\n", encoded)
+	return err
+}
+
+// send delivers an email through the SMTP server, with STARTTLS when the
+// server supports it, or over TLS on the implicit TLS port
+func (e *Email) send(subject, body string, file *discord.File) error {
+	msg, err := e.message(subject, body, file)
+	if err != nil {
+		return err
+	}
+	client, err := e.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if e.auth != nil {
+		if err := client.Auth(e.auth); err != nil {
+			return fmt.Errorf("error authenticating to the SMTP server: %w", err)
+		}
+	}
+	if err := client.Mail(e.sender); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	for _, to := range e.recipients {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("error sending email to %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	return client.Quit()
+}
+
+// dial connects to the SMTP server and secures the connection
+func (e *Email) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(e.host, strconv.Itoa(e.port))
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	var conn net.Conn
+	var err error
+	if e.port == implicitTLSPort {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: e.host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to the SMTP server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error connecting to the SMTP server: %w", err)
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok && e.port != implicitTLSPort {
+		if err := client.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("error starting TLS with the SMTP server: %w", err)
+		}
+	}
+	return client, nil
+}
+
+// Check connects and authenticates to the SMTP server without sending
+func (e *Email) Check() error {
+	client, err := e.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if e.auth != nil {
+		if err := client.Auth(e.auth); err != nil {
+			return fmt.Errorf("error authenticating to the SMTP server: %w", err)
+		}
+	}
+	return client.Quit()
+}
@@ -0,0 +1,195 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ndious/delivr/internal/discord"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/metrics"
+)
+
+// Embed is a rich message made of a title, a description and fields
+type Embed struct {
+	Title       string
+	Description string
+	Fields      []EmbedField
+	// Color is the RGB color of the side bar
+	Color int
+}
+
+// EmbedField is a named value of an embed
+type EmbedField struct {
+	Name   string
+	Value  string
+	Inline bool
+}
+
+// Colors of the embeds
+const (
+	ColorSuccess = 0x2ecc71
+	ColorWarning = 0xf1c40f
+	ColorFailure = 0xe74c3c
+	ColorSkipped = 0x95a5a6
+)
+
+// EmbedSender is implemented by notifiers that render embeds natively
+type EmbedSender interface {
+	SendEmbed(embed Embed) error
+}
+
+// FormatEmbed renders an embed as a markdown message, for the notifiers
+// without native embeds
+func FormatEmbed(e Embed) string {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "**%s**", e.Title)
+	if e.Description != "" {
+		fmt.Fprintf(&msg, "\n%s", e.Description)
+	}
+	for _, field := range e.Fields {
+		fmt.Fprintf(&msg, "\n**%s**\n%s", field.Name, field.Value)
+	}
+	return msg.String()
+}
+
+// SendEmbed sends the embed to all notifiers, as a message to those without
+// native embeds. The title is prefixed with the host name.
+func (m Multi) SendEmbed(embed Embed) error {
+	if m.host.Name != "" {
+		embed.Title = fmt.Sprintf("[%s] %s", m.host.Name, embed.Title)
+	}
+	var errs []error
+	for _, n := range m.notifiers {
+		var err error
+		if sender, ok := n.(EmbedSender); ok {
+			err = sender.SendEmbed(embed)
+		} else {
+			err = n.SendMessage(FormatEmbed(embed))
+		}
+		if err != nil {
+			log.Printf("Notification attempt failed: %v", err)
+			metrics.RecordNotificationError("embed")
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Limits of the Discord embeds
+const (
+	maxEmbedDescription = 4096
+	maxEmbedFieldValue  = 1024
+)
+
+// resultTitles are the embed titles of the statuses, in English
+var resultTitles = map[Status]string{
+	StatusSuccess:    "completed successfully",
+	StatusFailure:    "failed",
+	StatusTimeout:    "timed out",
+	StatusQuota:      "exceeded its quota",
+	StatusSkipped:    "skipped",
+	StatusCancelled:  "was cancelled",
+	StatusSpawnError: "could not be started",
+}
+
+// ResultEmbed renders a result as an embed. The profile selects the output
+// shown: none with compact, the truncated output with normal, and the end of
+// the output with verbose.
+func ResultEmbed(r Result, profile Profile) Embed {
+	embed := Embed{
+		Title: fmt.Sprintf("%s %s %s", StatusIcon(r.Status), r.Command, i18n.Text(resultTitles[r.Status])),
+		Color: ColorSuccess,
+	}
+	switch r.Status {
+	case StatusFailure, StatusSpawnError:
+		embed.Color = ColorFailure
+	case StatusTimeout, StatusQuota, StatusCancelled:
+		embed.Color = ColorWarning
+	case StatusSkipped:
+		embed.Color = ColorSkipped
+	}
+
+	var description strings.Builder
+	if r.Description != "" && profile != ProfileCompact {
+		fmt.Fprintf(&description, "> %s\n", r.Description)
+	}
+	output := r.Output
+	if profile == ProfileVerbose {
+		output = r.Tail
+	}
+	if output != "" && profile != ProfileCompact {
+		// Keep the end of the output within the size of the description
+		if limit := maxEmbedDescription - description.Len() - 16; len(output) > limit {
+			output = "…" + output[len(output)-limit:]
+		}
+		fmt.Fprintf(&description, "```\n%s\n```", output)
+	}
+	embed.Description = description.String()
+
+	embed.Fields = append(embed.Fields,
+		EmbedField{Name: i18n.Text("Exit code"), Value: fmt.Sprintf("%d", r.ExitCode), Inline: true},
+		EmbedField{Name: i18n.Text("Duration"), Value: i18n.T("%.2f seconds", r.Duration.Seconds()), Inline: true},
+	)
+	if r.MaxAttempts > 1 {
+		embed.Fields = append(embed.Fields, EmbedField{Name: i18n.Text("Attempts"), Value: i18n.T("%d of %d", r.Attempts, r.MaxAttempts), Inline: true})
+	}
+	if r.Status == StatusTimeout {
+		embed.Fields = append(embed.Fields, EmbedField{Name: i18n.Text("Timeout"), Value: r.Timeout.String(), Inline: true})
+	}
+	if !r.Host.IsZero() {
+		embed.Fields = append(embed.Fields, EmbedField{Name: i18n.Text("Host"), Value: r.Host.String(), Inline: true})
+	}
+	if r.WorkingDir != "" {
+		embed.Fields = append(embed.Fields, EmbedField{Name: i18n.Text("Working directory"), Value: "`" + r.WorkingDir + "`", Inline: true})
+	}
+	if r.Error != "" && (r.Output == "" || profile == ProfileVerbose) {
+		embed.Fields = append(embed.Fields, EmbedField{Name: i18n.Text("Error"), Value: truncateField(r.Error)})
+	}
+	if services := formatServices(r.Services); services != "" {
+		services = strings.TrimPrefix(services, "\n**"+i18n.Text("Services")+"**\n")
+		embed.Fields = append(embed.Fields, EmbedField{Name: i18n.Text("Services"), Value: truncateField(services)})
+	}
+	if rollouts := formatRollouts(r.Rollouts); rollouts != "" {
+		rollouts = strings.TrimPrefix(rollouts, "\n**"+i18n.Text("Rollouts")+"**\n")
+		embed.Fields = append(embed.Fields, EmbedField{Name: i18n.Text("Rollouts"), Value: truncateField(rollouts)})
+	}
+	if remotes := formatRemotes(r.Remotes); remotes != "" {
+		remotes = strings.TrimPrefix(remotes, "\n**"+i18n.Text("Hosts")+"**\n")
+		embed.Fields = append(embed.Fields, EmbedField{Name: i18n.Text("Hosts"), Value: truncateField(remotes)})
+	}
+	if r.LogPath != "" {
+		embed.Fields = append(embed.Fields, EmbedField{Name: i18n.Text("Log file"), Value: truncateField("`" + r.LogPath + "`")})
+	}
+	return embed
+}
+
+// truncateField shortens a value to the size of an embed field
+func truncateField(value string) string {
+	if len(value) > maxEmbedFieldValue {
+		return firstBytes(value, maxEmbedFieldValue-1) + "…"
+	}
+	return value
+}
+
+// discordEmbed converts an embed to its Discord API representation
+func discordEmbed(e Embed) *discord.Embed {
+	fields := make([]discord.EmbedField, len(e.Fields))
+	for i, field := range e.Fields {
+		fields[i] = discord.EmbedField{Name: field.Name, Value: field.Value, Inline: field.Inline}
+	}
+	return &discord.Embed{Title: e.Title, Description: e.Description, Color: e.Color, Fields: fields}
+}
+
+// SendEmbed sends the embed through the webhook
+func (d *Discord) SendEmbed(embed Embed) error {
+	e := discordEmbed(embed)
+	return d.client.SendEmbed(e.Title, e.Description, e.Fields, e.Color)
+}
+
+// SendEmbed posts the embed in the channel
+func (d *DiscordBot) SendEmbed(embed Embed) error {
+	_, err := d.bot.CreateEmbed(d.channelID, discordEmbed(embed), nil)
+	return err
+}
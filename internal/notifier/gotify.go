@@ -0,0 +1,87 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// Priorities of the Gotify messages, high enough to be pushed for failures
+const (
+	gotifyPriorityDefault = 4
+	gotifyPriorityHigh    = 8
+)
+
+// Gotify sends messages to an application of a Gotify server
+type Gotify struct {
+	url   string
+	token string
+}
+
+// gotifyMessage is the JSON message created in Gotify, rendered as markdown
+type gotifyMessage struct {
+	Title    string                    `json:"title"`
+	Message  string                    `json:"message"`
+	Priority int                       `json:"priority"`
+	Extras   map[string]map[string]any `json:"extras"`
+}
+
+// NewGotify creates a new Gotify client
+func NewGotify(cfg config.GotifyConfig) (*Gotify, error) {
+	if cfg.Token == "" {
+		return nil, errors.New("gotify application token is required")
+	}
+	server := strings.TrimSuffix(cfg.URL, "/")
+	u, err := url.Parse(server)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid gotify URL %q, must be an http or https URL", cfg.URL)
+	}
+	return &Gotify{url: server, token: cfg.Token}, nil
+}
+
+// publish creates a message in the application, with a high priority for
+// failures
+func (g *Gotify) publish(title, message string, failed bool) error {
+	msg := gotifyMessage{
+		Title:    title,
+		Message:  message,
+		Priority: gotifyPriorityDefault,
+		Extras: map[string]map[string]any{
+			"client::display": {"contentType": "text/markdown"},
+		},
+	}
+	if failed {
+		msg.Priority = gotifyPriorityHigh
+	}
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, g.url+"/message", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error creating gotify request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.token)
+
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending message to Gotify: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("error sending message to Gotify: HTTP %d %s, %s",
+			resp.StatusCode, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
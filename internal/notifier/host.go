@@ -0,0 +1,48 @@
+package notifier
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// Host identifies the server delivr runs on in notifications
+type Host struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// HostFromConfig returns the configured host identity, defaulting to the
+// hostname of the machine
+func HostFromConfig(cfg *config.HostConfig) Host {
+	var host Host
+	if cfg != nil {
+		host.Name = cfg.Name
+		host.Labels = cfg.Labels
+	}
+	if host.Name == "" {
+		host.Name, _ = os.Hostname()
+	}
+	return host
+}
+
+// String renders the host with its labels, e.g. "web-1 (dc=fra1, env=prod)"
+func (h Host) String() string {
+	if len(h.Labels) == 0 {
+		return h.Name
+	}
+	labels := make([]string, 0, len(h.Labels))
+	for key, value := range h.Labels {
+		labels = append(labels, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(labels)
+	return fmt.Sprintf("%s (%s)", h.Name, strings.Join(labels, ", "))
+}
+
+// IsZero reports whether the host is unknown
+func (h Host) IsZero() bool {
+	return h.Name == "" && len(h.Labels) == 0
+}
@@ -0,0 +1,69 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Mattermost sends messages through a Mattermost incoming webhook. Mattermost
+// renders the markdown of the messages like Discord.
+type Mattermost struct {
+	webhookURL string
+	channel    string
+	username   string
+	client     *http.Client
+}
+
+// mattermostMessage is the payload of a Mattermost incoming webhook
+type mattermostMessage struct {
+	Text     string `json:"text"`
+	Channel  string `json:"channel,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// NewMattermost creates a new Mattermost notifier. channel and username
+// override the ones of the webhook when set.
+func NewMattermost(webhookURL, channel, username string) (*Mattermost, error) {
+	if webhookURL == "" {
+		return nil, errors.New("mattermost webhook URL is required")
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !strings.Contains(u.Path, "/hooks/") {
+		return nil, fmt.Errorf("invalid webhook URL format, must be an http or https URL like https://mattermost.example.com/hooks/xxx")
+	}
+	return &Mattermost{
+		webhookURL: webhookURL,
+		channel:    channel,
+		username:   username,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// SendMessage sends a message to Mattermost
+func (m *Mattermost) SendMessage(content string) error {
+	jsonData, err := json.Marshal(mattermostMessage{Text: content, Channel: m.channel, Username: m.username})
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %w", err)
+	}
+
+	resp, err := m.client.Post(m.webhookURL, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error sending webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("error sending message to Mattermost: HTTP %d %s, %s",
+			resp.StatusCode, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
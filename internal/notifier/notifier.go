@@ -0,0 +1,268 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/metrics"
+)
+
+// Notifier sends messages and command results to a notification backend
+type Notifier interface {
+	SendMessage(content string) error
+	SendResult(result Result) error
+}
+
+// messageSender is implemented by backends that only support text messages
+type messageSender interface {
+	SendMessage(content string) error
+}
+
+// text adapts a text-only backend to the Notifier interface by rendering
+// results as markdown messages
+type text struct {
+	messageSender
+	profile Profile
+}
+
+// SendResult sends the result formatted as a message
+func (t text) SendResult(result Result) error {
+	return t.SendMessage(FormatResultProfile(result, t.profile))
+}
+
+// Multi sends every message to several notifiers
+type Multi struct {
+	notifiers []Notifier
+	// selected are the kinds of notifiers receiving the runs of the
+	// commands selecting some, by name
+	selected map[string][]string
+	// host is added to the notifications
+	host Host
+	// digests are the notifiers batching their notifications
+	digests []*digest
+}
+
+// SendMessage sends the message to all notifiers, even when some of them
+// fail. The message is prefixed with the host name.
+func (m Multi) SendMessage(content string) error {
+	if m.host.Name != "" {
+		content = fmt.Sprintf("`[%s]` %s", m.host.Name, content)
+	}
+	var errs []error
+	for _, n := range m.notifiers {
+		if err := n.SendMessage(content); err != nil {
+			log.Printf("Notification attempt failed: %v", err)
+			metrics.RecordNotificationError("message")
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SendResult sends the result to all notifiers, even when some of them fail.
+// Failed notifications are retried in the background.
+func (m Multi) SendResult(result Result) error {
+	if result.Host.IsZero() {
+		result.Host = m.host
+	}
+	var errs []error
+	for _, n := range m.notifiers {
+		if err := n.SendResult(result); err != nil {
+			log.Printf("Result notification attempt for '%s' failed, will retry: %v", result.Command, err)
+			metrics.RecordNotificationError("result")
+			errs = append(errs, err)
+			retryResult(n, result)
+		}
+	}
+	log.Printf("Sent result notification for '%s' (%s) to %d of %d notifiers", result.Command, result.Status, len(m.notifiers)-len(errs), len(m.notifiers))
+	return errors.Join(errs...)
+}
+
+// New creates the notifiers enabled in the configuration
+func New(cfg *config.Config) (Multi, error) {
+	var notifiers []Notifier
+	host := HostFromConfig(cfg.Host)
+	// The messages are translated in the language set once the
+	// configuration is accepted
+	if _, err := i18n.Load(cfg.Language); err != nil {
+		return Multi{}, err
+	}
+
+	attach, err := ParseAttachPolicy(cfg.Discord.AttachLog)
+	if err != nil {
+		return Multi{}, fmt.Errorf("discord: %w", err)
+	}
+	style, err := ParseStyle(cfg.Discord.Style)
+	if err != nil {
+		return Multi{}, fmt.Errorf("discord: %w", err)
+	}
+	maxMessages, err := ParseMaxMessages(cfg.Discord.MaxMessages)
+	if err != nil {
+		return Multi{}, fmt.Errorf("discord: %w", err)
+	}
+	var discordNotifier, failures Notifier
+	var newRoute func(name, channelID string) (Notifier, error)
+	if cfg.Discord.Bot != nil {
+		profile, err := ParseProfile(cfg.Discord.Format)
+		if err != nil {
+			return Multi{}, fmt.Errorf("discord: %w", err)
+		}
+		client, err := NewDiscordBot(cfg.Discord.Bot.Token, cfg.Discord.Bot.ChannelID, profile, attach, style, maxMessages)
+		if err != nil {
+			return Multi{}, fmt.Errorf("discord bot: %w", err)
+		}
+		discordNotifier = client
+		newRoute = func(name, channelID string) (Notifier, error) {
+			return NewDiscordBot(cfg.Discord.Bot.Token, channelID, profile, attach, style, maxMessages)
+		}
+	} else if cfg.Discord.ChannelID != "" {
+		profile, err := ParseProfile(cfg.Discord.Format)
+		if err != nil {
+			return Multi{}, fmt.Errorf("discord: %w", err)
+		}
+		client, err := NewDiscord(cfg.Discord.ChannelID, profile, attach, style, maxMessages)
+		if err != nil {
+			return Multi{}, fmt.Errorf("discord: %w", err)
+		}
+		discordNotifier = client
+		newRoute = func(name, channelID string) (Notifier, error) {
+			return NewDiscord(channelID, profile, attach, style, maxMessages)
+		}
+	}
+	switch {
+	case routed(cfg) && discordNotifier == nil:
+		return Multi{}, errors.New("discord: routes and channels require discord.channelId or discord.bot")
+	case routed(cfg):
+		// The runs of the commands are sent to their channel or to the
+		// channel of their route
+		router, err := newRouter(cfg, discordNotifier, newRoute)
+		if err != nil {
+			return Multi{}, fmt.Errorf("discord: %w", err)
+		}
+		notifiers = append(notifiers, router)
+		failures = router.failures()
+	case discordNotifier != nil:
+		notifiers = append(notifiers, discordNotifier)
+	}
+
+	if cfg.Notifications != nil {
+		if cfg.Notifications.Slack != nil {
+			profile, err := ParseProfile(cfg.Notifications.Slack.Format)
+			if err != nil {
+				return Multi{}, fmt.Errorf("slack: %w", err)
+			}
+			client, err := NewSlack(cfg.Notifications.Slack.WebhookURL)
+			if err != nil {
+				return Multi{}, fmt.Errorf("slack: %w", err)
+			}
+			notifiers = append(notifiers, text{client, profile})
+		}
+
+		for i, webhook := range cfg.Notifications.Webhooks {
+			profile, err := ParseProfile(webhook.Format)
+			if err != nil {
+				return Multi{}, fmt.Errorf("webhook %d: %w", i+1, err)
+			}
+			client, err := NewWebhook(webhook.URL, profile, webhook.Headers, host)
+			if err != nil {
+				return Multi{}, fmt.Errorf("webhook %d: %w", i+1, err)
+			}
+			notifiers = append(notifiers, client)
+		}
+
+		if telegram := cfg.Notifications.Telegram; telegram != nil {
+			profile, err := ParseProfile(telegram.Format)
+			if err != nil {
+				return Multi{}, fmt.Errorf("telegram: %w", err)
+			}
+			client, err := NewTelegram(telegram.BotToken, telegram.ChatID)
+			if err != nil {
+				return Multi{}, fmt.Errorf("telegram: %w", err)
+			}
+			notifiers = append(notifiers, text{client, profile})
+		}
+
+		if mattermost := cfg.Notifications.Mattermost; mattermost != nil {
+			profile, err := ParseProfile(mattermost.Format)
+			if err != nil {
+				return Multi{}, fmt.Errorf("mattermost: %w", err)
+			}
+			client, err := NewMattermost(mattermost.WebhookURL, mattermost.Channel, mattermost.Username)
+			if err != nil {
+				return Multi{}, fmt.Errorf("mattermost: %w", err)
+			}
+			notifiers = append(notifiers, text{client, profile})
+		}
+	}
+
+	// The emails and push notifications are sent for each result
+	var perResult []Notifier
+	if cfg.Notifications != nil {
+		if cfg.Notifications.Email != nil {
+			client, err := NewEmail(*cfg.Notifications.Email)
+			if err != nil {
+				return Multi{}, fmt.Errorf("email: %w", err)
+			}
+			perResult = append(perResult, client)
+		}
+
+		if ntfy := cfg.Notifications.Ntfy; ntfy != nil {
+			client, err := NewNtfy(*ntfy)
+			if err != nil {
+				return Multi{}, fmt.Errorf("ntfy: %w", err)
+			}
+			n, err := newPush(KindNtfy, ntfy.On, ntfy.Format, client.publish)
+			if err != nil {
+				return Multi{}, fmt.Errorf("ntfy: %w", err)
+			}
+			perResult = append(perResult, n)
+		}
+
+		if gotify := cfg.Notifications.Gotify; gotify != nil {
+			client, err := NewGotify(*gotify)
+			if err != nil {
+				return Multi{}, fmt.Errorf("gotify: %w", err)
+			}
+			n, err := newPush(KindGotify, gotify.On, gotify.Format, client.publish)
+			if err != nil {
+				return Multi{}, fmt.Errorf("gotify: %w", err)
+			}
+			perResult = append(perResult, n)
+		}
+	}
+
+	if len(notifiers) == 0 && len(perResult) == 0 {
+		return Multi{}, errors.New("no notifier configured, set discord.channelId, discord.bot or a notifier under notifications")
+	}
+
+	// Batch the notifications of each notifier in a single message per window
+	var digests []*digest
+	switch {
+	case cfg.Notifications != nil && cfg.Notifications.Digest > 0 && cfg.Notifications.Batch > 0:
+		return Multi{}, errors.New("notifications.digest and notifications.batch are exclusive")
+	case cfg.Notifications != nil && cfg.Notifications.Digest > 0:
+		for i, n := range notifiers {
+			digests = append(digests, newDigest(n, cfg.Notifications.Digest.Std()))
+			notifiers[i] = digests[i]
+		}
+	case cfg.Notifications != nil && cfg.Notifications.Batch > 0:
+		for i, n := range notifiers {
+			digests = append(digests, newBatch(n, cfg.Notifications.Batch.Std()))
+			notifiers[i] = digests[i]
+		}
+	}
+	// The failed results are copied to the failure channels at once
+	if failures != nil {
+		notifiers = append(notifiers, failures)
+	}
+	// The emails and push notifications are never combined
+	notifiers = append(notifiers, perResult...)
+	selected, err := selectNotifiers(cfg, notifiers)
+	if err != nil {
+		return Multi{}, err
+	}
+	return Multi{notifiers: notifiers, selected: selected, host: host, digests: digests}, nil
+}
@@ -0,0 +1,97 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// defaultNtfyServer is the public ntfy server
+const defaultNtfyServer = "https://ntfy.sh"
+
+// Priorities of the ntfy notifications
+const (
+	ntfyPriorityDefault = 3
+	ntfyPriorityHigh    = 4
+)
+
+// Ntfy publishes notifications to a topic of an ntfy server
+type Ntfy struct {
+	server   string
+	topic    string
+	token    string
+	username string
+	password string
+}
+
+// ntfyMessage is the JSON message published to ntfy
+type ntfyMessage struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority"`
+	Tags     []string `json:"tags,omitempty"`
+	Markdown bool     `json:"markdown"`
+}
+
+// NewNtfy creates a new ntfy client
+func NewNtfy(cfg config.NtfyConfig) (*Ntfy, error) {
+	if cfg.Topic == "" {
+		return nil, errors.New("ntfy topic is required")
+	}
+	server := strings.TrimSuffix(cfg.Server, "/")
+	if server == "" {
+		server = defaultNtfyServer
+	}
+	u, err := url.Parse(server)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid ntfy server %q, must be an http or https URL", cfg.Server)
+	}
+	return &Ntfy{server: server, topic: cfg.Topic, token: cfg.Token, username: cfg.Username, password: cfg.Password}, nil
+}
+
+// publish sends a notification to the topic, with a high priority and a
+// warning tag for failures
+func (n *Ntfy) publish(title, message string, failed bool) error {
+	msg := ntfyMessage{Topic: n.topic, Title: title, Message: message, Priority: ntfyPriorityDefault, Markdown: true}
+	if failed {
+		msg.Priority = ntfyPriorityHigh
+		msg.Tags = []string{"warning"}
+	}
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.server, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error creating ntfy request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch {
+	case n.token != "":
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	case n.username != "":
+		req.SetBasicAuth(n.username, n.password)
+	}
+
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending notification to ntfy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("error sending notification to ntfy: HTTP %d %s, %s",
+			resp.StatusCode, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
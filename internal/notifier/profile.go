@@ -0,0 +1,141 @@
+package notifier
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ndious/delivr/internal/i18n"
+)
+
+// Profile selects how verbose the result messages of a notifier are
+type Profile string
+
+const (
+	// ProfileCompact renders results on a single line
+	ProfileCompact Profile = "compact"
+	// ProfileNormal renders results with the truncated output
+	ProfileNormal Profile = "normal"
+	// ProfileVerbose renders results with all details and the output tail
+	ProfileVerbose Profile = "verbose"
+)
+
+// ParseProfile validates a profile name, an empty name meaning normal
+func ParseProfile(name string) (Profile, error) {
+	switch Profile(name) {
+	case "", ProfileNormal:
+		return ProfileNormal, nil
+	case ProfileCompact, ProfileVerbose:
+		return Profile(name), nil
+	default:
+		return "", fmt.Errorf("unknown format %q, must be compact, normal or verbose", name)
+	}
+}
+
+// Style selects how Discord results are rendered
+type Style string
+
+const (
+	// StyleEmbed renders results as embeds with a field for each detail
+	StyleEmbed Style = "embed"
+	// StylePlain renders results as markdown messages
+	StylePlain Style = "plain"
+)
+
+// ParseStyle validates a style name, an empty name meaning embed
+func ParseStyle(name string) (Style, error) {
+	switch Style(name) {
+	case "", StyleEmbed:
+		return StyleEmbed, nil
+	case StylePlain:
+		return StylePlain, nil
+	default:
+		return "", fmt.Errorf("unknown style %q, must be embed or plain", name)
+	}
+}
+
+// FormatResultProfile renders a result as a markdown message for a profile,
+// or returns its templated message
+func FormatResultProfile(r Result, profile Profile) string {
+	if r.Message != "" {
+		return r.Message
+	}
+	switch profile {
+	case ProfileCompact:
+		return formatCompact(r)
+	case ProfileVerbose:
+		return formatVerbose(r)
+	default:
+		return FormatResult(r)
+	}
+}
+
+// StatusIcon returns the icon shown for a status
+func StatusIcon(status Status) string {
+	switch status {
+	case StatusSuccess:
+		return "✅"
+	case StatusTimeout:
+		return "⏱️"
+	case StatusQuota:
+		return "🛑"
+	case StatusSkipped:
+		return "⏭️"
+	case StatusCancelled:
+		return "⏹️"
+	case StatusSpawnError:
+		return "💥"
+	default:
+		return "❌"
+	}
+}
+
+// formatCompact renders a result on a single line
+func formatCompact(r Result) string {
+	line := i18n.T("%s %s: %s in %.1fs", StatusIcon(r.Status), r.Command, r.label(), r.Duration.Seconds())
+	if r.Status == StatusSkipped {
+		line += " (" + r.Error + ")"
+	} else if r.Status.Failed() {
+		line += i18n.T(" (exit code %d)", r.ExitCode)
+	}
+	if r.Host.Name != "" {
+		line += i18n.T(" on %s", r.Host.Name)
+	}
+	return line
+}
+
+// formatVerbose renders a result with all its details and the output tail
+func formatVerbose(r Result) string {
+	var msg strings.Builder
+	msg.WriteString(i18n.T("%s Command **%s**: %s\n", StatusIcon(r.Status), r.Command, r.label()))
+	if r.Description != "" {
+		fmt.Fprintf(&msg, "> %s\n", r.Description)
+	}
+	if !r.Host.IsZero() {
+		msg.WriteString(i18n.T("Host: %s\n", r.Host))
+	}
+	msg.WriteString(i18n.T("Duration: %.2f seconds\n", r.Duration.Seconds()))
+	msg.WriteString(i18n.T("Exit code: %d\n", r.ExitCode))
+	if r.MaxAttempts > 1 {
+		msg.WriteString(i18n.T("Attempts: %d of %d\n", r.Attempts, r.MaxAttempts))
+	}
+	if r.Timeout > 0 {
+		msg.WriteString(i18n.T("Timeout: %s\n", r.Timeout))
+	}
+	if r.Error != "" {
+		msg.WriteString(i18n.T("Error: %s\n", r.Error))
+	}
+	if r.Tail != "" {
+		msg.WriteString(i18n.T("Output (last %d characters):\n```\n%s\n```\n", len(r.Tail), r.Tail))
+	}
+	if services := formatServices(r.Services); services != "" {
+		fmt.Fprintf(&msg, "%s\n", strings.TrimPrefix(services, "\n"))
+	}
+	if rollouts := formatRollouts(r.Rollouts); rollouts != "" {
+		fmt.Fprintf(&msg, "%s\n", strings.TrimPrefix(rollouts, "\n"))
+	}
+	if remotes := formatRemotes(r.Remotes); remotes != "" {
+		fmt.Fprintf(&msg, "%s\n", strings.TrimPrefix(remotes, "\n"))
+	}
+	msg.WriteString(i18n.T("📄 Log file: `%s`", r.LogPath))
+	return msg.String()
+}
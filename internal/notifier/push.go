@@ -0,0 +1,76 @@
+package notifier
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ndious/delivr/internal/i18n"
+)
+
+// pushTimeout bounds the requests to the push notification servers
+const pushTimeout = 10 * time.Second
+
+// push sends the results of the runs as push notifications, only the failed
+// ones unless always is set. Other messages aren't sent.
+type push struct {
+	// kind is the kind of the notifier, selected by the commands
+	kind    string
+	always  bool
+	profile Profile
+	// publish sends a notification, with a higher priority for failures
+	publish func(title, message string, failed bool) error
+}
+
+// newPush creates a push notifier of a kind, sending the results selected
+// by on in the format with publish
+func newPush(kind, on, format string, publish func(title, message string, failed bool) error) (push, error) {
+	always, err := parseOn(on)
+	if err != nil {
+		return push{}, err
+	}
+	profile, err := ParseProfile(format)
+	if err != nil {
+		return push{}, err
+	}
+	return push{kind: kind, always: always, profile: profile, publish: publish}, nil
+}
+
+// SendMessage is a no-op, only the results are pushed
+func (p push) SendMessage(content string) error {
+	return nil
+}
+
+// SendResult pushes the result of a failed run, or of every run when the
+// notifier is set to always send
+func (p push) SendResult(result Result) error {
+	if !p.always && !result.Status.Failed() {
+		return nil
+	}
+	return p.publish(pushTitle(result), FormatResultProfile(result, p.profile), result.Status.Failed())
+}
+
+// pushTitle returns the title of the push notification of a result
+func pushTitle(r Result) string {
+	title := fmt.Sprintf("%s %s: %s", StatusIcon(r.Status), r.Command, r.label())
+	if r.Host.Name != "" {
+		title += i18n.T(" on %s", r.Host.Name)
+	}
+	return title
+}
+
+// parseOn validates the results a notifier sends, an empty value meaning the
+// failed ones. It reports whether every result is sent.
+func parseOn(on string) (bool, error) {
+	switch on {
+	case "", "failure":
+		return false, nil
+	case "always":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown on %q, must be failure or always", on)
+	}
+}
+
+// pushClient is the HTTP client of the push notifiers
+var pushClient = &http.Client{Timeout: pushTimeout}
@@ -0,0 +1,108 @@
+package notifier
+
+import (
+	"errors"
+	"sync"
+)
+
+// Kinds of notifiers reporting receipts
+const (
+	ReceiptDiscord    = "discord"
+	ReceiptDiscordBot = "discordBot"
+)
+
+// Kinds of messages reported in receipts
+const (
+	MessageText   = "message"
+	MessageResult = "result"
+	MessageStream = "stream"
+)
+
+// Receipt identifies a message sent by a notifier, so that it can be edited,
+// replied to or deleted later
+type Receipt struct {
+	// Notifier is the kind of notifier that sent the message
+	Notifier string
+	// Kind is what the message shows: a text message, a result or the live
+	// output
+	Kind string
+	// ChannelID is the channel or thread of the message, empty for the
+	// messages of webhooks which are addressed by their ID only
+	ChannelID string
+	MessageID string
+}
+
+// Receipter is implemented by the notifiers scoped to a command run that
+// report the messages they sent
+type Receipter interface {
+	Receipts() []Receipt
+}
+
+// Receipts returns the receipts of the notifiers reporting them
+func (m Multi) Receipts() []Receipt {
+	var receipts []Receipt
+	for _, n := range m.notifiers {
+		if receipter, ok := n.(Receipter); ok {
+			receipts = append(receipts, receipter.Receipts()...)
+		}
+	}
+	return receipts
+}
+
+// MessageEditor is implemented by the notifiers able to change the messages
+// they sent. They ignore the receipts of the other kinds of notifiers.
+type MessageEditor interface {
+	EditSent(receipt Receipt, content string) error
+	DeleteSent(receipt Receipt) error
+}
+
+// EditSent replaces the content of a message with the notifier that sent it
+func (m Multi) EditSent(receipt Receipt, content string) error {
+	var errs []error
+	for _, n := range m.notifiers {
+		if editor, ok := n.(MessageEditor); ok {
+			if err := editor.EditSent(receipt, content); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DeleteSent deletes a message with the notifier that sent it
+func (m Multi) DeleteSent(receipt Receipt) error {
+	var errs []error
+	for _, n := range m.notifiers {
+		if editor, ok := n.(MessageEditor); ok {
+			if err := editor.DeleteSent(receipt); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// receipts collects the receipts of a run. It is safe for concurrent use
+// since the live output is updated from its own goroutine.
+type receipts struct {
+	mu   sync.Mutex
+	list []Receipt
+}
+
+// add records the receipt of a message, ignoring the messages without ID. It
+// is a no-op on a nil collector.
+func (r *receipts) add(notifier, kind, channelID, messageID string) {
+	if r == nil || messageID == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.list = append(r.list, Receipt{Notifier: notifier, Kind: kind, ChannelID: channelID, MessageID: messageID})
+}
+
+// Receipts returns the receipts recorded so far
+func (r *receipts) Receipts() []Receipt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Receipt(nil), r.list...)
+}
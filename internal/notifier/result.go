@@ -0,0 +1,266 @@
+package notifier
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ndious/delivr/internal/i18n"
+)
+
+// Status is the final status of a command run
+type Status string
+
+const (
+	StatusSuccess Status = "success"
+	StatusFailure Status = "failure"
+	StatusTimeout Status = "timeout"
+	// StatusQuota is the status of a command killed for exceeding its quota
+	StatusQuota Status = "quotaExceeded"
+	// StatusSkipped is the status of a command whose conditions weren't met
+	StatusSkipped Status = "skipped"
+	// StatusCancelled is the status of a command interrupted because delivr
+	// is stopping
+	StatusCancelled Status = "cancelled"
+	// StatusSpawnError is the status of a command that could not be started,
+	// e.g. because its program doesn't exist
+	StatusSpawnError Status = "spawnError"
+)
+
+// Failed reports whether the status is a failure. Skipped commands didn't fail.
+func (s Status) Failed() bool {
+	return s != StatusSuccess && s != StatusSkipped
+}
+
+// Label returns the status in the language of the messages
+func (s Status) Label() string {
+	return i18n.Text(string(s))
+}
+
+// maxOutputLength is the maximum number of output characters kept in a result
+const maxOutputLength = 1500
+
+// maxTailLength is the maximum number of characters kept in the output tail
+const maxTailLength = 8000
+
+// Result describes the outcome of a command run
+type Result struct {
+	Command     string
+	Description string
+	Status      Status
+	Duration    time.Duration
+	Timeout     time.Duration
+	ExitCode    int
+	Error       string
+	// Output is stdout on success and stderr on failure, truncated
+	Output string
+	// Tail is the end of the same output, longer than Output
+	Tail string
+	// FullOutput is the same output, kept longer than Output to be split
+	// between several Discord messages
+	FullOutput string
+	LogPath    string
+	// WorkingDir is the directory the command ran in, if any
+	WorkingDir string
+	// LogSize is the size of the log of the run, at the end of the log file
+	LogSize     int64
+	Attempts    int
+	MaxAttempts int
+	// Services holds the state of the services after a compose command
+	Services []ServiceStatus
+	// Rollouts holds the state of the rollouts after a k8s command
+	Rollouts []RolloutStatus
+	// Remotes holds the outcome on each remote host of a command run on
+	// several of them
+	Remotes []RemoteResult
+	// Host is the server the command ran on
+	Host Host
+	// Message is the result rendered with a template of the configuration,
+	// sent instead of the default format when set
+	Message string
+}
+
+// label returns the status of the result in the language of the messages
+func (r Result) label() string {
+	return r.Status.Label()
+}
+
+// ServiceStatus is the state of a Docker Compose service
+type ServiceStatus struct {
+	Name   string `json:"name"`
+	State  string `json:"state"`
+	Health string `json:"health,omitempty"`
+}
+
+// RolloutStatus is the state of the rollout of a Kubernetes workload
+type RolloutStatus struct {
+	Name  string `json:"name"`
+	Ready string `json:"ready,omitempty"`
+	State string `json:"state"`
+}
+
+// RemoteResult is the outcome of a command on one of its remote hosts
+type RemoteResult struct {
+	Host     string
+	Status   Status
+	Duration time.Duration
+	ExitCode int
+	Error    string
+}
+
+// formatRemotes renders the outcome on each remote host of a result
+func formatRemotes(remotes []RemoteResult) string {
+	if len(remotes) == 0 {
+		return ""
+	}
+	var msg strings.Builder
+	msg.WriteString("\n**" + i18n.Text("Hosts") + "**")
+	for _, remote := range remotes {
+		fmt.Fprintf(&msg, "\n%s %s", StatusIcon(remote.Status), remote.Host)
+		if remote.Status != StatusSkipped {
+			fmt.Fprintf(&msg, " (%s)", remote.Duration.Round(time.Millisecond))
+		}
+		if remote.Error != "" {
+			fmt.Fprintf(&msg, ": %s", remote.Error)
+		}
+	}
+	return msg.String()
+}
+
+// serviceIcon returns the icon shown for the state of a service
+func serviceIcon(s ServiceStatus) string {
+	switch {
+	case s.Health == "unhealthy" || s.State == "dead" || s.State == "restarting":
+		return "🔴"
+	case s.Health == "starting" || s.State == "created" || s.State == "paused":
+		return "🟡"
+	case s.State == "running":
+		return "🟢"
+	default:
+		return "⚪"
+	}
+}
+
+// formatServices renders the state of the services of a result
+func formatServices(services []ServiceStatus) string {
+	if len(services) == 0 {
+		return ""
+	}
+	var msg strings.Builder
+	msg.WriteString("\n**" + i18n.Text("Services") + "**")
+	for _, s := range services {
+		fmt.Fprintf(&msg, "\n%s %s: %s", serviceIcon(s), s.Name, s.State)
+		if s.Health != "" {
+			fmt.Fprintf(&msg, " (%s)", s.Health)
+		}
+	}
+	return msg.String()
+}
+
+// rolloutIcon returns the icon shown for the state of a rollout
+func rolloutIcon(r RolloutStatus) string {
+	switch r.State {
+	case "rolled out":
+		return "🟢"
+	case "progressing":
+		return "🟡"
+	case "failed":
+		return "🔴"
+	default:
+		return "⚪"
+	}
+}
+
+// formatRollouts renders the state of the rollouts of a result
+func formatRollouts(rollouts []RolloutStatus) string {
+	if len(rollouts) == 0 {
+		return ""
+	}
+	var msg strings.Builder
+	msg.WriteString("\n**" + i18n.Text("Rollouts") + "**")
+	for _, r := range rollouts {
+		fmt.Fprintf(&msg, "\n%s %s: %s", rolloutIcon(r), r.Name, r.State)
+		if r.Ready != "" {
+			msg.WriteString(i18n.T(" (%s ready)", r.Ready))
+		}
+	}
+	return msg.String()
+}
+
+// TruncateOutput shortens output to the length kept in results, without
+// splitting a character
+func TruncateOutput(output string) string {
+	if len(output) > maxOutputLength {
+		return firstBytes(output, maxOutputLength) + "... (truncated)"
+	}
+	return output
+}
+
+// TailOutput keeps the end of output, to the length kept in results,
+// without splitting a character
+func TailOutput(output string) string {
+	return lastBytes(output, maxTailLength)
+}
+
+// TailExcerpt keeps the end of output, to the length of the truncated output,
+// without splitting a character
+func TailExcerpt(output string) string {
+	if len(output) > maxOutputLength {
+		return "(truncated) ..." + lastBytes(output, maxOutputLength)
+	}
+	return output
+}
+
+// FormatResult renders a result as a markdown message
+func FormatResult(r Result) string {
+	durationStr := i18n.T("%.2f seconds", r.Duration.Seconds())
+	if r.MaxAttempts > 1 {
+		durationStr = i18n.T("%s, %d of %d attempts", durationStr, r.Attempts, r.MaxAttempts)
+	}
+
+	var msg strings.Builder
+	switch r.Status {
+	case StatusTimeout:
+		msg.WriteString(i18n.T("⏱️ Command **%s** timed out after %s and was killed (took %s)\n", r.Command, r.Timeout, durationStr))
+		if r.Output != "" {
+			msg.WriteString(fmt.Sprintf("```\n%s\n```", r.Output))
+		}
+	case StatusQuota:
+		msg.WriteString(i18n.T("🛑 Command **%s** exceeded its quota (%s) and was killed (took %s)\n", r.Command, r.Error, durationStr))
+		if r.Output != "" {
+			msg.WriteString(fmt.Sprintf("```\n%s\n```", r.Output))
+		}
+	case StatusSkipped:
+		msg.WriteString(i18n.T("⏭️ Command **%s** skipped: %s\n", r.Command, r.Error))
+	case StatusCancelled:
+		msg.WriteString(i18n.T("⏹️ Command **%s** was cancelled, Delivr is stopping (took %s)\n", r.Command, durationStr))
+		if r.Output != "" {
+			msg.WriteString(fmt.Sprintf("```\n%s\n```", r.Output))
+		}
+	case StatusSpawnError:
+		msg.WriteString(i18n.T("💥 Command **%s** could not be started (took %s)\nError: %s", r.Command, durationStr, r.Error))
+	case StatusFailure:
+		msg.WriteString(i18n.T("❌ Command **%s** failed (took %s)\n", r.Command, durationStr))
+		if r.Output != "" {
+			msg.WriteString(fmt.Sprintf("```\n%s\n```", r.Output))
+		} else {
+			msg.WriteString(i18n.T("Error: %s", r.Error))
+		}
+	default:
+		msg.WriteString(i18n.T("✅ Command **%s** completed successfully (took %s)\n", r.Command, durationStr))
+		if r.Output != "" {
+			msg.WriteString(fmt.Sprintf("```\n%s\n```", r.Output))
+		}
+	}
+
+	msg.WriteString(formatServices(r.Services))
+	msg.WriteString(formatRollouts(r.Rollouts))
+	msg.WriteString(formatRemotes(r.Remotes))
+	if !r.Host.IsZero() {
+		msg.WriteString(i18n.T("\n🖥️ Host: %s", r.Host))
+	}
+
+	// Add log file info to result
+	msg.WriteString(i18n.T("\n📄 Log file: `%s`", r.LogPath))
+	return msg.String()
+}
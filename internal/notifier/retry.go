@@ -0,0 +1,55 @@
+package notifier
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ndious/delivr/internal/metrics"
+)
+
+// resultRetryDelays are the delays before each new attempt to send a result
+// notification that failed
+var resultRetryDelays = []time.Duration{5 * time.Second, 15 * time.Second, 45 * time.Second}
+
+// pendingRetries tracks the result notifications being retried
+var pendingRetries sync.WaitGroup
+
+// retryResult resends a result to a notifier in the background until it
+// succeeds or all attempts failed
+func retryResult(n Notifier, result Result) {
+	pendingRetries.Add(1)
+	go func() {
+		defer pendingRetries.Done()
+		for i, delay := range resultRetryDelays {
+			time.Sleep(delay)
+			err := n.SendResult(result)
+			if err == nil {
+				log.Printf("Result notification for '%s' sent on retry %d", result.Command, i+1)
+				return
+			}
+			metrics.RecordNotificationError("result")
+			log.Printf("Result notification retry %d of %d for '%s' failed: %v", i+1, len(resultRetryDelays), result.Command, err)
+		}
+		log.Printf("Giving up on the result notification for '%s'", result.Command)
+	}()
+}
+
+// Flush sends the digests, then waits for the result notifications being
+// retried, at most timeout. It reports whether all retries completed.
+func (m Multi) Flush(timeout time.Duration) bool {
+	m.FlushDigests()
+
+	done := make(chan struct{})
+	go func() {
+		pendingRetries.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
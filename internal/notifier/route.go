@@ -0,0 +1,197 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// route is a Discord notifier receiving the runs of the commands with one of
+// its tags
+type route struct {
+	tags     []string
+	notifier Notifier
+}
+
+// router sends the notifications of the runs of the commands to the Discord
+// notifier of their channel or of their route, and the other notifications to
+// the default Discord notifier
+type router struct {
+	Notifier
+	routes []route
+	// tags are the tags of the configured commands, by name
+	tags map[string][]string
+	// channels are the notifiers of the named channels, and commandChannels
+	// the channels of the commands setting one
+	channels        map[string]Notifier
+	commandChannels map[string]string
+	// failureChannels are the channels also receiving the failed results of
+	// the commands, by name
+	failureChannels map[string]string
+}
+
+// routed tells whether the configuration sends some notifications to other
+// Discord channels than the default one
+func routed(cfg *config.Config) bool {
+	return len(cfg.Discord.Routes) > 0 || len(cfg.Discord.Channels) > 0
+}
+
+// newRouter wraps the default Discord notifier with the routes and the named
+// channels of the configuration, created with newNotifier from their channel
+// and a name describing them
+func newRouter(cfg *config.Config, def Notifier, newNotifier func(name, channelID string) (Notifier, error)) (*router, error) {
+	r := &router{
+		Notifier:        def,
+		tags:            make(map[string][]string, len(cfg.Commands)),
+		channels:        make(map[string]Notifier, len(cfg.Discord.Channels)),
+		commandChannels: make(map[string]string),
+		failureChannels: make(map[string]string),
+	}
+	for i, rt := range cfg.Discord.Routes {
+		if len(rt.Tags) == 0 {
+			return nil, fmt.Errorf("route %d: tags are required", i+1)
+		}
+		if rt.ChannelID == "" {
+			return nil, fmt.Errorf("route %d: channelId is required", i+1)
+		}
+		n, err := newNotifier(fmt.Sprintf("route %d: %s", i+1, strings.Join(rt.Tags, ", ")), rt.ChannelID)
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %w", i+1, err)
+		}
+		r.routes = append(r.routes, route{tags: rt.Tags, notifier: n})
+	}
+
+	// Create the named channels in a stable order
+	names := make([]string, 0, len(cfg.Discord.Channels))
+	for name := range cfg.Discord.Channels {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		n, err := newNotifier("channel "+name, cfg.Discord.Channels[name])
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", name, err)
+		}
+		r.channels[name] = n
+	}
+	if name := cfg.Discord.FailureChannel; name != "" && r.channels[name] == nil {
+		return nil, fmt.Errorf("failureChannel: unknown channel '%s'", name)
+	}
+
+	for _, cmd := range cfg.Commands {
+		r.tags[cmd.Name] = cmd.Tags
+		if cmd.Channel != "" {
+			if r.channels[cmd.Channel] == nil {
+				return nil, fmt.Errorf("command '%s': unknown channel '%s'", cmd.Name, cmd.Channel)
+			}
+			r.commandChannels[cmd.Name] = cmd.Channel
+		}
+		failureChannel := cfg.Discord.FailureChannel
+		if cmd.FailureChannel != "" {
+			if r.channels[cmd.FailureChannel] == nil {
+				return nil, fmt.Errorf("command '%s': unknown failure channel '%s'", cmd.Name, cmd.FailureChannel)
+			}
+			failureChannel = cmd.FailureChannel
+		}
+		if failureChannel != "" {
+			r.failureChannels[cmd.Name] = failureChannel
+		}
+	}
+	return r, nil
+}
+
+// notifierFor returns the notifier of the channel of the command, or of the
+// first route matching one of its tags, the default one when there are none
+func (r *router) notifierFor(command string) Notifier {
+	if name, ok := r.commandChannels[command]; ok {
+		return r.channels[name]
+	}
+	for _, rt := range r.routes {
+		for _, tag := range r.tags[command] {
+			if slices.Contains(rt.tags, tag) {
+				return rt.notifier
+			}
+		}
+	}
+	return r.Notifier
+}
+
+// ForRun returns the notifier of the route of the command, scoped to the run
+// when it supports it
+func (r *router) ForRun(command string) Notifier {
+	n := r.notifierFor(command)
+	if scoper, ok := n.(RunScoper); ok {
+		return scoper.ForRun(command)
+	}
+	return n
+}
+
+// SendEmbed sends the embed with the default notifier
+func (r *router) SendEmbed(embed Embed) error {
+	if sender, ok := r.Notifier.(EmbedSender); ok {
+		return sender.SendEmbed(embed)
+	}
+	return r.SendMessage(FormatEmbed(embed))
+}
+
+// StartStream starts a stream with the default notifier
+func (r *router) StartStream() (Stream, error) {
+	if streamer, ok := r.Notifier.(Streamer); ok {
+		return streamer.StartStream()
+	}
+	return nil, errors.New("live output is not supported")
+}
+
+// EditSent edits a message with the default notifier. The bots of the routes
+// share its token, so it can edit the messages they sent in their channels.
+func (r *router) EditSent(receipt Receipt, content string) error {
+	if editor, ok := r.Notifier.(MessageEditor); ok {
+		return editor.EditSent(receipt, content)
+	}
+	return nil
+}
+
+// DeleteSent deletes a message with the default notifier
+func (r *router) DeleteSent(receipt Receipt) error {
+	if editor, ok := r.Notifier.(MessageEditor); ok {
+		return editor.DeleteSent(receipt)
+	}
+	return nil
+}
+
+// failures returns the notifier copying the failed results to the failure
+// channels, nil when none is configured
+func (r *router) failures() Notifier {
+	if len(r.failureChannels) == 0 {
+		return nil
+	}
+	return failureCopy{r}
+}
+
+// failureCopy sends the failed results of the commands to their failure
+// channel, in addition to the channel of their run. It ignores the other
+// notifications.
+type failureCopy struct {
+	router *router
+}
+
+// SendMessage ignores the message, sent to the channel of the run
+func (f failureCopy) SendMessage(content string) error {
+	return nil
+}
+
+// SendResult sends a failed result to the failure channel of its command
+func (f failureCopy) SendResult(result Result) error {
+	name, ok := f.router.failureChannels[result.Command]
+	if !ok || !result.Status.Failed() {
+		return nil
+	}
+	// The channel of the run already received it
+	if f.router.commandChannels[result.Command] == name {
+		return nil
+	}
+	return f.router.channels[name].SendResult(result)
+}
@@ -0,0 +1,82 @@
+package notifier
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// Kinds of notifiers, that the commands select with their notifiers
+const (
+	KindDiscord    = "discord"
+	KindSlack      = "slack"
+	KindWebhooks   = "webhooks"
+	KindEmail      = "email"
+	KindTelegram   = "telegram"
+	KindMattermost = "mattermost"
+	KindNtfy       = "ntfy"
+	KindGotify     = "gotify"
+)
+
+// kinds are the kinds of notifiers, in the order of the configuration
+var kinds = []string{KindDiscord, KindSlack, KindWebhooks, KindEmail, KindTelegram, KindMattermost, KindNtfy, KindGotify}
+
+// kindOf returns the kind of a notifier, empty when unknown
+func kindOf(n any) string {
+	switch n := n.(type) {
+	case *Discord, *DiscordBot, *router, failureCopy:
+		return KindDiscord
+	case *Slack:
+		return KindSlack
+	case *Webhook:
+		return KindWebhooks
+	case *Email:
+		return KindEmail
+	case *Telegram:
+		return KindTelegram
+	case *Mattermost:
+		return KindMattermost
+	case text:
+		return kindOf(n.messageSender)
+	case *digest:
+		return kindOf(n.next)
+	case push:
+		return n.kind
+	case console:
+		return n.kind
+	default:
+		return ""
+	}
+}
+
+// selectNotifiers returns the kinds of notifiers selected by the commands
+// selecting some, by name, which must be among the configured ones
+func selectNotifiers(cfg *config.Config, notifiers []Notifier) (map[string][]string, error) {
+	var configured []string
+	for _, n := range notifiers {
+		configured = append(configured, kindOf(n))
+	}
+	selected := make(map[string][]string)
+	for _, cmd := range cfg.Commands {
+		for _, kind := range cmd.Notifiers {
+			if !slices.Contains(kinds, kind) {
+				return nil, fmt.Errorf("command '%s': unknown notifier '%s', must be one of %s", cmd.Name, kind, strings.Join(kinds, ", "))
+			}
+			if !slices.Contains(configured, kind) {
+				return nil, fmt.Errorf("command '%s': notifier '%s' isn't configured", cmd.Name, kind)
+			}
+		}
+		if len(cmd.Notifiers) > 0 {
+			selected[cmd.Name] = cmd.Notifiers
+		}
+	}
+	return selected, nil
+}
+
+// selects reports whether the runs of a command are sent to a notifier
+func (m Multi) selects(command string, n Notifier) bool {
+	selected, ok := m.selected[command]
+	return !ok || slices.Contains(selected, kindOf(n))
+}
@@ -0,0 +1,61 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Slack sends messages through a Slack incoming webhook
+type Slack struct {
+	webhookURL string
+}
+
+// slackMessage is the payload of a Slack incoming webhook
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// NewSlack creates a new Slack notifier
+func NewSlack(webhookURL string) (*Slack, error) {
+	if webhookURL == "" {
+		return nil, errors.New("slack webhook URL is required")
+	}
+	if !strings.HasPrefix(webhookURL, "https://hooks.slack.com/") {
+		return nil, errors.New("invalid webhook URL format, must start with https://hooks.slack.com/")
+	}
+	return &Slack{webhookURL: webhookURL}, nil
+}
+
+// SendMessage sends a message to Slack, converting Discord flavored markdown
+// to Slack mrkdwn
+func (s *Slack) SendMessage(content string) error {
+	jsonData, err := json.Marshal(slackMessage{Text: toSlackMarkdown(content)})
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %w", err)
+	}
+
+	resp, err := http.Post(s.webhookURL, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error sending webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("error sending message to Slack: HTTP %d %s, %s",
+			resp.StatusCode, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// toSlackMarkdown converts bold markers, the only syntax used by delivr
+// messages that differs between Discord and Slack
+func toSlackMarkdown(content string) string {
+	return strings.ReplaceAll(content, "**", "*")
+}
@@ -0,0 +1,113 @@
+package notifier
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultMaxMessages is the number of Discord messages the output of a
+	// result is split between by default
+	DefaultMaxMessages = 3
+	// MaxMessagesLimit is the highest number of messages a result can be
+	// split between
+	MaxMessagesLimit = 10
+	// maxChunkLength is the size of the output in the messages following
+	// the result, within the limit of the Discord messages
+	maxChunkLength = 1900
+	// maxFullOutputLength is the maximum number of output characters kept to
+	// be split between messages
+	maxFullOutputLength = maxOutputLength + (MaxMessagesLimit-1)*maxChunkLength
+)
+
+// ParseMaxMessages validates the number of messages the output of a result
+// is split between, 0 meaning the default
+func ParseMaxMessages(n int) (int, error) {
+	switch {
+	case n == 0:
+		return DefaultMaxMessages, nil
+	case n < 1 || n > MaxMessagesLimit:
+		return 0, fmt.Errorf("maxMessages must be between 1 and %d, got %d", MaxMessagesLimit, n)
+	default:
+		return n, nil
+	}
+}
+
+// FullOutput shortens output to the length that can be split between
+// messages, without splitting a character
+func FullOutput(output string) string {
+	if len(output) > maxFullOutputLength {
+		return firstBytes(output, maxFullOutputLength) + "... (truncated)"
+	}
+	return output
+}
+
+// splitResult splits the output of a result with the normal profile between
+// at most maxMessages messages: the result shows the first part of the
+// output, and the returned messages the following ones, each in its own code
+// block. Templated results and those whose output fits in their message are
+// kept as they are. The tail shown by the verbose profile is shortened to fit
+// in the message.
+func splitResult(result Result, profile Profile, maxMessages int) (Result, []string) {
+	if profile == ProfileVerbose && len(result.Tail) > maxOutputLength {
+		result.Tail = lastBytes(result.Tail, maxOutputLength)
+	}
+	if profile != ProfileNormal || maxMessages <= 1 || result.Message != "" || len(result.FullOutput) <= maxOutputLength {
+		return result, nil
+	}
+	first, rest := cutOutput(result.FullOutput, maxOutputLength)
+	var messages []string
+	for rest != "" && len(messages) < maxMessages-1 {
+		var chunk string
+		chunk, rest = cutOutput(rest, maxChunkLength)
+		messages = append(messages, chunk)
+	}
+	if last := len(messages) - 1; rest != "" && !strings.HasSuffix(messages[last], "... (truncated)") {
+		messages[last] += "... (truncated)"
+	}
+	for i, chunk := range messages {
+		messages[i] = fmt.Sprintf("```\n%s\n```", chunk)
+	}
+	result.Output = first
+	return result, messages
+}
+
+// firstBytes returns the beginning of s at most size bytes long, ending at
+// the end of a character
+func firstBytes(s string, size int) string {
+	if len(s) <= size {
+		return s
+	}
+	i := size
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return s[:i]
+}
+
+// lastBytes returns the end of s at most size bytes long, starting at the
+// beginning of a character
+func lastBytes(s string, size int) string {
+	if len(s) <= size {
+		return s
+	}
+	i := len(s) - size
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return s[i:]
+}
+
+// cutOutput cuts the first part of output at most size characters long, at
+// the end of a line when there is one, or else between two characters
+func cutOutput(output string, size int) (string, string) {
+	if len(output) <= size {
+		return output, ""
+	}
+	if i := strings.LastIndexByte(output[:size], '\n'); i > 0 {
+		return output[:i], output[i+1:]
+	}
+	first := firstBytes(output, size)
+	return first, output[len(first):]
+}
@@ -0,0 +1,33 @@
+package notifier
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// TestExcerptsKeepCharacters checks that the excerpts of an output made of
+// multi-byte characters crossing their limits are valid UTF-8
+func TestExcerptsKeepCharacters(t *testing.T) {
+	// "é" is 2 bytes and "€" 3, so that one of them crosses every limit
+	output := "a" + strings.Repeat("é€", maxFullOutputLength)
+	excerpts := map[string]string{
+		"TruncateOutput": TruncateOutput(output),
+		"TailOutput":     TailOutput(output),
+		"TailExcerpt":    TailExcerpt(output),
+		"FullOutput":     FullOutput(output),
+	}
+	for name, excerpt := range excerpts {
+		if !utf8.ValidString(excerpt) {
+			t.Errorf("%s cut a character: %q", name, excerpt[len(excerpt)-20:])
+		}
+		if excerpt == output {
+			t.Errorf("%s didn't shorten the output", name)
+		}
+	}
+
+	first, rest := cutOutput(output, maxOutputLength)
+	if !utf8.ValidString(first) || !utf8.ValidString(rest) || first+rest != output {
+		t.Errorf("cutOutput cut a character")
+	}
+}
@@ -0,0 +1,64 @@
+package notifier
+
+import (
+	"errors"
+)
+
+// Stream shows the output of a running command, each update replacing the
+// previous one
+type Stream interface {
+	Update(content string) error
+	Close() error
+}
+
+// Streamer is implemented by notifiers able to show live command output
+type Streamer interface {
+	StartStream() (Stream, error)
+}
+
+// multiStream updates several streams at once
+type multiStream []Stream
+
+// Update updates all streams, even when some of them fail
+func (m multiStream) Update(content string) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Update(content); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes all streams
+func (m multiStream) Close() error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// StartStream starts a stream on every notifier supporting live output
+func (m Multi) StartStream() (Stream, error) {
+	var streams multiStream
+	var errs []error
+	for _, n := range m.notifiers {
+		streamer, ok := n.(Streamer)
+		if !ok {
+			continue
+		}
+		s, err := streamer.StartStream()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		streams = append(streams, s)
+	}
+	if len(streams) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	return streams, errors.Join(errs...)
+}
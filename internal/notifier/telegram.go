@@ -0,0 +1,130 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// telegramAPIURL is the base URL of the Telegram Bot API
+const telegramAPIURL = "https://api.telegram.org"
+
+// maxTelegramLength is the size of a Telegram message, longer messages being
+// truncated
+const maxTelegramLength = 4096
+
+// Telegram sends messages to a chat through the Telegram Bot API
+type Telegram struct {
+	token  string
+	chatID string
+	client *http.Client
+}
+
+// telegramMessage is the payload of the sendMessage method
+type telegramMessage struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+// telegramResponse is the response of the Bot API methods
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+// NewTelegram creates a new Telegram notifier
+func NewTelegram(token, chatID string) (*Telegram, error) {
+	if token == "" {
+		return nil, errors.New("telegram bot token is required")
+	}
+	if chatID == "" {
+		return nil, errors.New("telegram chat ID is required")
+	}
+	return &Telegram{token: token, chatID: chatID, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// SendMessage sends a message to the chat, converting Discord flavored
+// markdown to Telegram HTML
+func (t *Telegram) SendMessage(content string) error {
+	return t.call("sendMessage", telegramMessage{
+		ChatID:                t.chatID,
+		Text:                  toTelegramHTML(content),
+		ParseMode:             "HTML",
+		DisableWebPagePreview: true,
+	})
+}
+
+// Check fetches the chat without posting, to verify that the token is valid
+// and that the bot is a member of the chat
+func (t *Telegram) Check() error {
+	return t.call("getChat", map[string]string{"chat_id": t.chatID})
+}
+
+// call calls a method of the Bot API
+func (t *Telegram) call(method string, payload interface{}) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %w", err)
+	}
+	endpoint := telegramAPIURL + "/bot" + url.PathEscape(t.token) + "/" + method
+	resp, err := t.client.Post(endpoint, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		// The error holds the URL, and so the token
+		return fmt.Errorf("error calling the Telegram API: %s", strings.ReplaceAll(err.Error(), t.token, "***"))
+	}
+	defer resp.Body.Close()
+
+	var response telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || !response.OK {
+		if response.Description != "" {
+			return fmt.Errorf("error sending message to Telegram: HTTP %d %s, %s", resp.StatusCode, resp.Status, response.Description)
+		}
+		return fmt.Errorf("error sending message to Telegram: HTTP %d %s", resp.StatusCode, resp.Status)
+	}
+	return nil
+}
+
+// Markdown syntaxes used by delivr messages, converted for Telegram
+var (
+	telegramCodeBlock = regexp.MustCompile("(?s)```[a-z]*\n?(.*?)\n?```")
+	telegramCode      = regexp.MustCompile("`([^`\n]+)`")
+	telegramBold      = regexp.MustCompile(`\*\*(.+?)\*\*`)
+)
+
+// toTelegramHTML converts the code blocks, inline code and bold markers of
+// Discord flavored markdown to Telegram HTML, escaping the rest of the text,
+// and truncates the message to the size of a Telegram message
+func toTelegramHTML(content string) string {
+	if len(content) > maxTelegramLength-100 {
+		content = firstBytes(content, maxTelegramLength-100) + "... (truncated)"
+	}
+	var out strings.Builder
+	for content != "" {
+		loc := telegramCodeBlock.FindStringSubmatchIndex(content)
+		if loc == nil {
+			out.WriteString(telegramInline(content))
+			break
+		}
+		out.WriteString(telegramInline(content[:loc[0]]))
+		out.WriteString("<pre>" + html.EscapeString(content[loc[2]:loc[3]]) + "</pre>")
+		content = content[loc[1]:]
+	}
+	return out.String()
+}
+
+// telegramInline converts the inline code and bold markers of a text outside
+// of code blocks
+func telegramInline(text string) string {
+	text = html.EscapeString(text)
+	text = telegramCode.ReplaceAllString(text, "<code>$1</code>")
+	return telegramBold.ReplaceAllString(text, "<b>$1</b>")
+}
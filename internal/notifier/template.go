@@ -0,0 +1,207 @@
+package notifier
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// Templates renders the notifications customized in the configuration. The
+// notifications without template keep their default format.
+type Templates struct {
+	start   *template.Template
+	success *template.Template
+	failure *template.Template
+	summary *template.Template
+}
+
+// TemplateData is the data of the start, success and failure templates
+type TemplateData struct {
+	Command     string
+	Description string
+	Tags        []string
+	Host        string
+	// Status, Duration, ExitCode, Error, Output, LogPath and the attempts
+	// are only set once the command ran
+	Status      Status
+	Duration    time.Duration
+	ExitCode    int
+	Error       string
+	Output      string
+	LogPath     string
+	Attempts    int
+	MaxAttempts int
+}
+
+// SummaryData is the data of the summary template of the pipelines
+type SummaryData struct {
+	Source    string
+	Host      string
+	Commands  int
+	Succeeded int
+	Failed    int
+	Tolerated int
+	Skipped   int
+	NotRun    int
+	Duration  time.Duration
+	Steps     []SummaryStep
+}
+
+// SummaryStep is a command of a pipeline in the summary template, not run
+// when its status is empty
+type SummaryStep struct {
+	Name      string
+	Status    Status
+	Duration  time.Duration
+	Tolerated bool
+	ExitCode  int
+	Attempts  int
+}
+
+// ParseTemplates parses the templates of the notifications, nil when none
+// is configured
+func ParseTemplates(cfg *config.TemplatesConfig) (*Templates, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	var t Templates
+	for _, tmpl := range []struct {
+		name string
+		text string
+		data any
+		dst  **template.Template
+	}{
+		{"start", cfg.Start, sampleTemplateData, &t.start},
+		{"success", cfg.Success, sampleTemplateData, &t.success},
+		{"failure", cfg.Failure, sampleTemplateData, &t.failure},
+		{"summary", cfg.Summary, sampleSummaryData, &t.summary},
+	} {
+		if tmpl.text == "" {
+			continue
+		}
+		parsed, err := parseTemplate(tmpl.name, tmpl.text, tmpl.data)
+		if err != nil {
+			return nil, err
+		}
+		*tmpl.dst = parsed
+	}
+	return &t, nil
+}
+
+// sampleTemplateData and sampleSummaryData are rendered by the templates when
+// they are parsed, every field being set so that the templates indexing the
+// lists or ranging over them are valid
+var (
+	sampleTemplateData = TemplateData{
+		Command:     "deploy",
+		Description: "Deploy the application",
+		Tags:        []string{"prod", "web", "api"},
+		Host:        "web-1",
+		Status:      StatusFailure,
+		Duration:    90 * time.Second,
+		ExitCode:    1,
+		Error:       "exit status 1",
+		Output:      "output",
+		LogPath:     "/var/log/delivr/deploy.log",
+		Attempts:    2,
+		MaxAttempts: 3,
+	}
+	sampleSummaryData = SummaryData{
+		Source:    "startup",
+		Host:      "web-1",
+		Commands:  3,
+		Succeeded: 1,
+		Failed:    1,
+		Skipped:   1,
+		Duration:  90 * time.Second,
+		Steps: []SummaryStep{
+			{Name: "build", Status: StatusSuccess, Duration: 60 * time.Second, Attempts: 1},
+			{Name: "deploy", Status: StatusFailure, Duration: 30 * time.Second, ExitCode: 1, Attempts: 2},
+			{Name: "notify", Status: StatusSkipped},
+		},
+	}
+)
+
+// parseTemplate parses a template, rendered once with sample data so that
+// the unknown fields are reported before any notification
+func parseTemplate(name, text string, data any) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	if err := tmpl.Execute(io.Discard, data); err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// Start renders the message sent when a command starts, empty without
+// template
+func (t *Templates) Start(data TemplateData) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	return render(t.start, data)
+}
+
+// Result renders the message of the result of a run with the success or
+// failure template, empty without template. Skipped runs keep their default
+// format.
+func (t *Templates) Result(data TemplateData) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	switch {
+	case data.Status == StatusSuccess:
+		return render(t.success, data)
+	case data.Status.Failed():
+		return render(t.failure, data)
+	default:
+		return "", nil
+	}
+}
+
+// Summary renders the summary of a pipeline, empty without template
+func (t *Templates) Summary(data SummaryData) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	return render(t.summary, data)
+}
+
+// ResultData returns the data of the result templates of a result
+func ResultData(result Result, tags []string) TemplateData {
+	data := TemplateData{
+		Command:     result.Command,
+		Description: result.Description,
+		Tags:        tags,
+		Status:      result.Status,
+		Duration:    result.Duration.Round(time.Millisecond),
+		ExitCode:    result.ExitCode,
+		Error:       result.Error,
+		Output:      result.Output,
+		LogPath:     result.LogPath,
+		Attempts:    result.Attempts,
+		MaxAttempts: result.MaxAttempts,
+	}
+	if !result.Host.IsZero() {
+		data.Host = result.Host.Name
+	}
+	return data
+}
+
+// render executes a template, empty when nil
+func render(tmpl *template.Template, data any) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("error rendering the %s template: %w", tmpl.Name(), err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
@@ -0,0 +1,161 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Webhook posts JSON payloads to a generic HTTP endpoint
+type Webhook struct {
+	url     string
+	profile Profile
+	headers map[string]string
+	// host identifies the server in the message events
+	host   Host
+	client *http.Client
+}
+
+// webhookPayload is the JSON document posted to generic webhooks
+type webhookPayload struct {
+	Type        string          `json:"type"`
+	Timestamp   time.Time       `json:"timestamp"`
+	Message     string          `json:"message,omitempty"`
+	Command     string          `json:"command,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Status      Status          `json:"status,omitempty"`
+	Duration    float64         `json:"duration,omitempty"`
+	ExitCode    *int            `json:"exitCode,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Output      string          `json:"output,omitempty"`
+	LogPath     string          `json:"logPath,omitempty"`
+	Attempts    int             `json:"attempts,omitempty"`
+	Services    []ServiceStatus `json:"services,omitempty"`
+	Rollouts    []RolloutStatus `json:"rollouts,omitempty"`
+	Remotes     []webhookRemote `json:"remotes,omitempty"`
+	Host        *Host           `json:"host,omitempty"`
+}
+
+// webhookRemote is the outcome on a remote host in webhook payloads, with
+// the duration in seconds like the result
+type webhookRemote struct {
+	Host     string  `json:"host"`
+	Status   Status  `json:"status"`
+	Duration float64 `json:"duration"`
+	ExitCode int     `json:"exitCode"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// NewWebhook creates a new generic webhook notifier. headers are added to
+// every request, and host to the message events.
+func NewWebhook(endpoint string, profile Profile, headers map[string]string, host Host) (*Webhook, error) {
+	if endpoint == "" {
+		return nil, errors.New("webhook URL is required")
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %q, must be an http or https URL", endpoint)
+	}
+	return &Webhook{
+		url:     endpoint,
+		profile: profile,
+		headers: headers,
+		host:    host,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// SendMessage posts a plain message event
+func (w *Webhook) SendMessage(content string) error {
+	return w.post(webhookPayload{
+		Type:      "message",
+		Timestamp: time.Now(),
+		Message:   content,
+		Host:      webhookHost(w.host),
+	})
+}
+
+// SendResult posts a command result event
+func (w *Webhook) SendResult(result Result) error {
+	exitCode := result.ExitCode
+	payload := webhookPayload{
+		Type:        "result",
+		Timestamp:   time.Now(),
+		Command:     result.Command,
+		Description: result.Description,
+		Status:      result.Status,
+		Duration:    result.Duration.Seconds(),
+		ExitCode:    &exitCode,
+		Error:       result.Error,
+		Message:     result.Message,
+		Output:      result.Output,
+		LogPath:     result.LogPath,
+		Attempts:    result.Attempts,
+		Services:    result.Services,
+		Rollouts:    result.Rollouts,
+		Host:        webhookHost(result.Host),
+	}
+	for _, remote := range result.Remotes {
+		payload.Remotes = append(payload.Remotes, webhookRemote{
+			Host:     remote.Host,
+			Status:   remote.Status,
+			Duration: remote.Duration.Seconds(),
+			ExitCode: remote.ExitCode,
+			Error:    remote.Error,
+		})
+	}
+
+	// The profile selects how much output is included
+	switch w.profile {
+	case ProfileCompact:
+		payload.Output = ""
+	case ProfileVerbose:
+		payload.Output = result.Tail
+	}
+	return w.post(payload)
+}
+
+// webhookHost returns the host of a payload, nil when unknown
+func webhookHost(host Host) *Host {
+	if host.IsZero() {
+		return nil
+	}
+	return &host
+}
+
+// post sends a payload to the endpoint
+func (w *Webhook) post(payload webhookPayload) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range w.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("error sending webhook: HTTP %d %s, %s",
+			resp.StatusCode, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
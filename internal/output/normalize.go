@@ -0,0 +1,107 @@
+package output
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// incompleteANSIPattern matches an escape sequence cut at the end of the
+// output, which the next write may complete
+var incompleteANSIPattern = regexp.MustCompile(`\x1b(?:\[[0-9;?]*[ -/]*|\][^\x07\x1b]*\x1b?)?$`)
+
+// maxEscapeLength is the length after which an incomplete escape sequence,
+// e.g. a terminal title that is never terminated, is written anyway
+const maxEscapeLength = 4096
+
+// Normalize removes the ANSI escape sequences and the control characters of
+// s, except tabs and newlines, so that the output of docker or npm reads well
+// in code blocks and logs. Each redraw of a line with a carriage return goes
+// on a new line.
+func Normalize(s string) string {
+	if !strings.ContainsFunc(s, isControl) {
+		return s
+	}
+	var normalized strings.Builder
+	n := NewNormalizer(&normalized)
+	n.Write([]byte(s))
+	n.Flush()
+	return normalized.String()
+}
+
+// isControl reports whether r is a control character removed by Normalize
+func isControl(r rune) bool {
+	return (r < 0x20 && r != '\t' && r != '\n') || r == 0x7f
+}
+
+// Normalizer normalizes what is written to it as it arrives, so that the
+// progress redrawn with carriage returns and the prompts without newline
+// reach the live output. Only an escape sequence split across writes is
+// held until it is complete.
+type Normalizer struct {
+	out io.Writer
+	buf bytes.Buffer
+	// midLine is set when the last character written isn't a newline
+	midLine bool
+	// redraw is set after a carriage return in the middle of a line: the
+	// next character starts a new line
+	redraw bool
+}
+
+// NewNormalizer creates a writer normalizing to out
+func NewNormalizer(out io.Writer) *Normalizer {
+	return &Normalizer{out: out}
+}
+
+// Write normalizes p, keeping an incomplete escape sequence at its end for
+// the next write
+func (n *Normalizer) Write(p []byte) (int, error) {
+	n.buf.Write(p)
+	data := n.buf.Bytes()
+	end := len(data)
+	if loc := incompleteANSIPattern.FindIndex(data); loc != nil && end-loc[0] <= maxEscapeLength {
+		end = loc[0]
+	}
+	text := string(data[:end])
+	n.buf.Next(end)
+	return len(p), n.write(text)
+}
+
+// Flush drops the escape sequence left incomplete at the end of the output,
+// everything else being written already
+func (n *Normalizer) Flush() error {
+	n.buf.Reset()
+	return nil
+}
+
+// write removes the escape sequences and the control characters of text and
+// writes it, a carriage return in the middle of a line starting a new one
+func (n *Normalizer) write(text string) error {
+	text = StripANSI(text)
+	var normalized strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '\n':
+			normalized.WriteByte(c)
+			n.midLine, n.redraw = false, false
+		case c == '\r':
+			if n.midLine {
+				n.midLine, n.redraw = false, true
+			}
+		case isControl(rune(c)):
+		default:
+			if n.redraw {
+				normalized.WriteByte('\n')
+				n.redraw = false
+			}
+			normalized.WriteByte(c)
+			n.midLine = true
+		}
+	}
+	if normalized.Len() == 0 {
+		return nil
+	}
+	_, err := io.WriteString(n.out, normalized.String())
+	return err
+}
@@ -0,0 +1,218 @@
+// Package output shapes the command output shown in the notifications
+package output
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/itchyny/gojq"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/redact"
+)
+
+// ansiPattern matches the ANSI escape sequences: colors, cursor movements and
+// terminal titles
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// StripANSI removes the ANSI escape sequences of s
+func StripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+// processor transforms the output
+type processor func(string) (string, error)
+
+// Chain applies processors in order
+type Chain []processor
+
+// New builds the chain of the configured processors
+func New(cfgs []config.OutputProcessor) (Chain, error) {
+	chain := make(Chain, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		p, err := newProcessor(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("output processor %d: %w", i+1, err)
+		}
+		chain = append(chain, p)
+	}
+	return chain, nil
+}
+
+// newProcessor validates a processor configuration
+func newProcessor(cfg config.OutputProcessor) (processor, error) {
+	switch cfg.Type {
+	case config.OutputStripANSI:
+		return func(s string) (string, error) { return StripANSI(s), nil }, nil
+	case config.OutputRedact:
+		if cfg.Pattern == "" {
+			return nil, errors.New("redact requires a pattern")
+		}
+		redactor, err := redact.New(&config.RedactionConfig{Patterns: []string{cfg.Pattern}})
+		if err != nil {
+			return nil, err
+		}
+		return func(s string) (string, error) { return redactor.String(s), nil }, nil
+	case config.OutputGrep:
+		if cfg.Pattern == "" {
+			return nil, errors.New("grep requires a pattern")
+		}
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grep pattern %q: %w", cfg.Pattern, err)
+		}
+		return func(s string) (string, error) { return grep(s, re, cfg.Invert), nil }, nil
+	case config.OutputJQ:
+		if cfg.Filter == "" {
+			return nil, errors.New("jq requires a filter")
+		}
+		query, err := gojq.Parse(cfg.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jq filter %q: %w", cfg.Filter, err)
+		}
+		code, err := gojq.Compile(query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jq filter %q: %w", cfg.Filter, err)
+		}
+		return func(s string) (string, error) { return jq(s, code) }, nil
+	case config.OutputTail:
+		if cfg.Lines <= 0 {
+			return nil, errors.New("tail requires a positive number of lines")
+		}
+		return func(s string) (string, error) { return tail(s, cfg.Lines), nil }, nil
+	case "":
+		return nil, errors.New("missing type, must be strip-ansi, redact, grep, jq or tail")
+	default:
+		return nil, fmt.Errorf("unknown type '%s', must be strip-ansi, redact, grep, jq or tail", cfg.Type)
+	}
+}
+
+// Apply runs the processors in order. On error, the output processed so far
+// is returned with the error.
+func (c Chain) Apply(s string) (string, error) {
+	for i, p := range c {
+		processed, err := p(s)
+		if err != nil {
+			return s, fmt.Errorf("output processor %d: %w", i+1, err)
+		}
+		s = processed
+	}
+	return s, nil
+}
+
+// Validate checks the output processors, the output modes and the handling of
+// the ANSI escape sequences of all the commands
+func Validate(cfg *config.Config) error {
+	if err := validateANSI(cfg.ANSI); err != nil {
+		return err
+	}
+	for _, cmd := range cfg.Commands {
+		if err := validateANSI(cmd.ANSI); err != nil {
+			return fmt.Errorf("command '%s': %w", cmd.Name, err)
+		}
+		if _, err := New(cmd.Output); err != nil {
+			return fmt.Errorf("command '%s': %w", cmd.Name, err)
+		}
+		switch cmd.OutputMode {
+		case "", config.OutputModeNone, config.OutputModeSummary, config.OutputModeTail, config.OutputModeFull:
+		default:
+			return fmt.Errorf("command '%s': unknown output mode '%s', must be none, summary, tail or full", cmd.Name, cmd.OutputMode)
+		}
+	}
+	return nil
+}
+
+// validateANSI checks the handling of the ANSI escape sequences, which may be
+// empty
+func validateANSI(mode string) error {
+	switch mode {
+	case "", config.ANSIStrip, config.ANSIKeep:
+		return nil
+	}
+	return fmt.Errorf("unknown ansi mode '%s', must be strip or keep", mode)
+}
+
+// grep keeps the lines matching re, or those not matching it when invert is
+// set
+func grep(s string, re *regexp.Regexp, invert bool) string {
+	var kept []string
+	for _, line := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		if re.MatchString(line) != invert {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// tail keeps the last lines of s
+func tail(s string, lines int) string {
+	all := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	return strings.Join(all, "\n")
+}
+
+// jq runs a filter on the JSON values of s, one result per line. Strings are
+// written raw and the other values as compact JSON.
+func jq(s string, code *gojq.Code) (string, error) {
+	var results []string
+	decoder := json.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	for {
+		var input interface{}
+		if err := decoder.Decode(&input); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("jq: output isn't JSON: %w", err)
+		}
+		input = normalize(input)
+
+		iter := code.Run(input)
+		for {
+			v, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if err, ok := v.(error); ok {
+				return "", fmt.Errorf("jq: %w", err)
+			}
+			if str, ok := v.(string); ok {
+				results = append(results, str)
+				continue
+			}
+			encoded, err := gojq.Marshal(v)
+			if err != nil {
+				return "", fmt.Errorf("jq: %w", err)
+			}
+			results = append(results, string(encoded))
+		}
+	}
+	return strings.Join(results, "\n"), nil
+}
+
+// normalize converts the numbers decoded as json.Number to the types gojq
+// supports
+func normalize(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return int(n)
+		}
+		f, _ := value.Float64()
+		return f
+	case []interface{}:
+		for i, item := range value {
+			value[i] = normalize(item)
+		}
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = normalize(item)
+		}
+	}
+	return v
+}
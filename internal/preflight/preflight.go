@@ -0,0 +1,162 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// defaultDockerHost is used when neither the config nor DOCKER_HOST set one
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// Error lists the pre-flight checks that failed
+type Error struct {
+	Failures []string
+}
+
+func (e *Error) Error() string {
+	return "pre-flight failed: " + strings.Join(e.Failures, "; ")
+}
+
+// Check runs the configured pre-flight assertions. When a lock file is
+// configured it is acquired, and the returned release function must be
+// called once the run is over.
+func Check(cfg *config.PreflightConfig, workingDir string, dockerHost string) (func(), error) {
+	release := func() {}
+	if cfg == nil {
+		return release, nil
+	}
+
+	var failures []string
+
+	// Required environment variables
+	for _, name := range cfg.RequiredEnv {
+		if os.Getenv(name) == "" {
+			failures = append(failures, fmt.Sprintf("environment variable %s is not set", name))
+		}
+	}
+
+	// Free disk space
+	if cfg.MinFreeDiskMB > 0 {
+		diskPath := cfg.DiskPath
+		if diskPath == "" {
+			diskPath = workingDir
+		}
+		if diskPath == "" {
+			diskPath = "."
+		}
+		free, err := freeDiskMB(diskPath)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("could not check free disk space on %s: %v", diskPath, err))
+		} else if free < uint64(cfg.MinFreeDiskMB) {
+			failures = append(failures, fmt.Sprintf("only %d MB free on %s, %d MB required", free, diskPath, cfg.MinFreeDiskMB))
+		}
+	}
+
+	// Docker daemon
+	if cfg.Docker {
+		if err := PingDocker(dockerHost); err != nil {
+			failures = append(failures, fmt.Sprintf("docker daemon is not reachable: %v", err))
+		}
+	}
+
+	// No other deploy in progress; acquired last so that a failing check
+	// above never leaves a lock behind
+	if cfg.LockFile != "" && len(failures) == 0 {
+		unlock, err := acquireLock(cfg.LockFile)
+		if err != nil {
+			failures = append(failures, err.Error())
+		} else {
+			release = unlock
+		}
+	}
+
+	if len(failures) > 0 {
+		return release, &Error{Failures: failures}
+	}
+	return release, nil
+}
+
+// PingDocker calls the /_ping endpoint of the Docker daemon of host, or of
+// $DOCKER_HOST and the default socket when empty
+func PingDocker(host string) error {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = defaultDockerHost
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return fmt.Errorf("invalid docker host %q: %w", host, err)
+	}
+
+	transport := &http.Transport{}
+	baseURL := "http://docker"
+	switch u.Scheme {
+	case "unix":
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", u.Path)
+		}
+	case "tcp", "http":
+		baseURL = "http://" + u.Host
+	case "https":
+		baseURL = "https://" + u.Host
+	default:
+		return fmt.Errorf("unsupported docker host scheme %q", u.Scheme)
+	}
+
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+	resp, err := client.Get(baseURL + "/_ping")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response %s", resp.Status)
+	}
+	return nil
+}
+
+// acquireLock creates the lock file holding the current PID. A lock left
+// behind by a process that no longer exists is taken over.
+func acquireLock(path string) (func(), error) {
+	for i := 0; i < 2; i++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(file, "%d\n", os.Getpid())
+			file.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("could not create lock file %s: %w", path, err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read lock file %s: %w", path, err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err == nil && processAlive(pid) {
+			return nil, fmt.Errorf("another deploy is in progress (pid %d, lock file %s)", pid, path)
+		}
+
+		// Stale lock
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("could not remove stale lock file %s: %w", path, err)
+		}
+	}
+	return nil, fmt.Errorf("another deploy is in progress (lock file %s)", path)
+}
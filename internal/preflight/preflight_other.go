@@ -0,0 +1,17 @@
+//go:build !unix
+
+package preflight
+
+import (
+	"errors"
+)
+
+// freeDiskMB is not supported on this platform
+func freeDiskMB(path string) (uint64, error) {
+	return 0, errors.New("not supported on this platform")
+}
+
+// processAlive assumes the process exists since it can't be checked
+func processAlive(pid int) bool {
+	return true
+}
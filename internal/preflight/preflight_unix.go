@@ -0,0 +1,22 @@
+//go:build unix
+
+package preflight
+
+import (
+	"syscall"
+)
+
+// freeDiskMB returns the space available to unprivileged users in MB
+func freeDiskMB(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize) / (1024 * 1024), nil
+}
+
+// processAlive reports whether a process with the given PID exists
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
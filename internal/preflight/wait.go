@@ -0,0 +1,127 @@
+package preflight
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultWaitTimeout is the maximum wait for the startup dependencies when
+// no timeout is configured
+const DefaultWaitTimeout = 5 * time.Minute
+
+// waitInterval is the delay between two checks of the dependencies
+const waitInterval = 2 * time.Second
+
+// ErrWaitStopped is returned when delivr stops while waiting
+var ErrWaitStopped = errors.New("not awaited, delivr is stopping")
+
+// dependency is a service the startup commands wait for
+type dependency struct {
+	name  string
+	ready func() error
+}
+
+// ValidateWaitFor checks the startup dependencies: docker, network or
+// url:<URL>
+func ValidateWaitFor(targets []string) error {
+	_, err := parseWaitFor(targets, "")
+	return err
+}
+
+// parseWaitFor returns the checks of the startup dependencies
+func parseWaitFor(targets []string, dockerHost string) ([]dependency, error) {
+	dependencies := make([]dependency, 0, len(targets))
+	for _, target := range targets {
+		switch {
+		case target == "docker":
+			dependencies = append(dependencies, dependency{name: target, ready: func() error { return PingDocker(dockerHost) }})
+		case target == "network":
+			dependencies = append(dependencies, dependency{name: target, ready: networkUp})
+		case strings.HasPrefix(target, "url:"):
+			rawURL := strings.TrimPrefix(target, "url:")
+			if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("invalid url '%s' in waitFor, must be an http or https URL", rawURL)
+			}
+			dependencies = append(dependencies, dependency{name: target, ready: func() error { return urlResponds(rawURL) }})
+		default:
+			return nil, fmt.Errorf("unknown waitFor dependency '%s', must be docker, network or url:<URL>", target)
+		}
+	}
+	return dependencies, nil
+}
+
+// WaitFor waits until the startup dependencies are ready, checking them
+// every 2 seconds, for at most timeout. stopping is polled to give up when
+// delivr stops.
+func WaitFor(targets []string, dockerHost string, timeout time.Duration, stopping func() bool) error {
+	dependencies, err := parseWaitFor(targets, dockerHost)
+	if err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		timeout = DefaultWaitTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var pending []string
+		for _, dep := range dependencies {
+			if err := dep.ready(); err != nil {
+				pending = append(pending, fmt.Sprintf("%s (%v)", dep.name, err))
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not ready after %s: %s", timeout, strings.Join(pending, "; "))
+		}
+		if stopping() {
+			return ErrWaitStopped
+		}
+		time.Sleep(waitInterval)
+	}
+}
+
+// networkUp checks that an interface other than the loopback is up with a
+// routable address
+func networkUp() error {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return err
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ip, ok := addr.(*net.IPNet); ok && ip.IP.IsGlobalUnicast() {
+				return nil
+			}
+		}
+	}
+	return errors.New("no network interface with a routable address")
+}
+
+// urlResponds checks that a URL answers without a server error
+func urlResponds(rawURL string) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("unexpected response %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package redact
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// Mask replaces redacted values
+const Mask = "****"
+
+// maxLineLength is the length after which a line without newline is
+// redacted and written anyway
+const maxLineLength = 64 * 1024
+
+// Redactor masks sensitive values in command output
+type Redactor struct {
+	patterns []*regexp.Regexp
+	values   []string
+}
+
+// New creates a redactor for the configured patterns
+func New(cfg *config.RedactionConfig) (*Redactor, error) {
+	r := &Redactor{}
+	if cfg == nil {
+		return r, nil
+	}
+	for _, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// With returns a redactor also masking the given literal values
+func (r *Redactor) With(values ...string) *Redactor {
+	extended := &Redactor{patterns: r.patterns, values: append([]string{}, r.values...)}
+	for _, value := range values {
+		if value != "" {
+			extended.values = append(extended.values, value)
+		}
+	}
+	return extended
+}
+
+// Empty reports whether the redactor masks nothing
+func (r *Redactor) Empty() bool {
+	return r == nil || (len(r.patterns) == 0 && len(r.values) == 0)
+}
+
+// String masks the sensitive values of s. For patterns with groups, only the
+// groups are masked, e.g. the value in `password=(\S+)`.
+func (r *Redactor) String(s string) string {
+	if r.Empty() {
+		return s
+	}
+	for _, value := range r.values {
+		s = strings.ReplaceAll(s, value, Mask)
+	}
+	for _, re := range r.patterns {
+		if re.NumSubexp() == 0 {
+			s = re.ReplaceAllLiteralString(s, Mask)
+			continue
+		}
+		s = maskGroups(re, s)
+	}
+	return s
+}
+
+// maskGroups masks the groups of the matches of re in s
+func maskGroups(re *regexp.Regexp, s string) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range re.FindAllStringSubmatchIndex(s, -1) {
+		for i := 2; i < len(match); i += 2 {
+			start, end := match[i], match[i+1]
+			if start < last || start < 0 {
+				continue
+			}
+			b.WriteString(s[last:start])
+			b.WriteString(Mask)
+			last = end
+		}
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// Writer masks the sensitive values of what is written to it, line by line
+// so that values split across writes are still masked
+type Writer struct {
+	out      io.Writer
+	redactor *Redactor
+	buf      bytes.Buffer
+}
+
+// NewWriter creates a writer redacting to out
+func NewWriter(out io.Writer, redactor *Redactor) *Writer {
+	return &Writer{out: out, redactor: redactor}
+}
+
+// Write buffers p and writes the redacted complete lines
+func (w *Writer) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			if w.buf.Len() > maxLineLength {
+				return len(p), w.Flush()
+			}
+			return len(p), nil
+		}
+		line := w.buf.Next(i + 1)
+		if _, err := io.WriteString(w.out, w.redactor.String(string(line))); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// Flush writes the redacted incomplete last line
+func (w *Writer) Flush() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w.out, w.redactor.String(w.buf.String()))
+	w.buf.Reset()
+	return err
+}
@@ -0,0 +1,249 @@
+// Package registry reads the digests of image tags from container registries
+// through the distribution API
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// dockerHub is the registry of the images named without registry
+const dockerHub = "registry-1.docker.io"
+
+// manifestTypes are the manifest media types accepted, so that multi-platform
+// images are identified by the digest of their index
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Reference is an image tag in a registry
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+// String returns the reference as written in a configuration
+func (r Reference) String() string {
+	if r.Registry == dockerHub {
+		return strings.TrimPrefix(r.Repository, "library/") + ":" + r.Tag
+	}
+	return r.Registry + "/" + r.Repository + ":" + r.Tag
+}
+
+// ParseReference parses an image reference with an optional registry and
+// tag, e.g. "nginx", "acme/web:1.2" or "ghcr.io/acme/web:latest". Images
+// without registry are on Docker Hub, and the tag defaults to latest.
+func ParseReference(image string) (Reference, error) {
+	if image == "" {
+		return Reference{}, errors.New("empty image")
+	}
+	if strings.Contains(image, "@") {
+		return Reference{}, fmt.Errorf("image '%s' is pinned to a digest, which never changes", image)
+	}
+
+	ref := Reference{Registry: dockerHub, Repository: image, Tag: "latest"}
+	// The first component is a registry when it looks like a host name
+	if first, rest, ok := strings.Cut(image, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.Registry, ref.Repository = first, rest
+	}
+	if slash, colon := strings.LastIndex(ref.Repository, "/"), strings.LastIndex(ref.Repository, ":"); colon > slash {
+		ref.Repository, ref.Tag = ref.Repository[:colon], ref.Repository[colon+1:]
+	}
+	if ref.Registry == "docker.io" || ref.Registry == "index.docker.io" {
+		ref.Registry = dockerHub
+	}
+	if ref.Registry == dockerHub && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	if ref.Repository == "" || ref.Tag == "" {
+		return Reference{}, fmt.Errorf("invalid image '%s'", image)
+	}
+	return ref, nil
+}
+
+// Client reads manifests from registries, anonymously or with credentials
+type Client struct {
+	username string
+	password string
+	http     *http.Client
+}
+
+// NewClient creates a client authenticating with the given credentials when
+// the registry asks for them, anonymous when they are empty
+func NewClient(username, password string) *Client {
+	return &Client{
+		username: username,
+		password: password,
+		http:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Digest returns the digest of the manifest of an image tag
+func (c *Client) Digest(ref Reference) (string, error) {
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", ref.Registry, ref.Repository, url.PathEscape(ref.Tag))
+
+	resp, err := c.request(http.MethodHead, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	// Retry with the credentials or token the registry asks for
+	authorization := ""
+	if resp.StatusCode == http.StatusUnauthorized {
+		authorization, err = c.authorize(resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", ref, err)
+		}
+		if resp, err = c.request(http.MethodHead, manifestURL, authorization); err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: registry answered %s", ref, resp.Status)
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// Some registries only give the digest of the manifest they send
+	if resp, err = c.request(http.MethodGet, manifestURL, authorization); err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: registry answered %s", ref, resp.Status)
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.LimitReader(resp.Body, 4<<20)); err != nil {
+		return "", fmt.Errorf("%s: %w", ref, err)
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// request sends a manifest request with the given Authorization header
+func (c *Client) request(method, manifestURL, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(method, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return c.http.Do(req)
+}
+
+// authorize answers an authentication challenge of a registry with the
+// Authorization header of the next request: the credentials for Basic
+// challenges, a token obtained from the realm for Bearer challenges
+func (c *Client) authorize(challenge string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.username == "" {
+			return "", errors.New("the registry requires credentials")
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(c.username, c.password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+		token, err := c.token(params)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	default:
+		return "", fmt.Errorf("unsupported authentication challenge '%s'", challenge)
+	}
+}
+
+// token obtains a pull token from the realm of a Bearer challenge
+func (c *Client) token(params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Scheme == "" {
+		return "", fmt.Errorf("invalid token realm '%s'", params["realm"])
+	}
+	query := realm.Query()
+	for _, name := range []string{"service", "scope"} {
+		if params[name] != "" {
+			query.Set(name, params[name])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get a registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get a registry token: %s", resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode the registry token: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", errors.New("the registry returned an empty token")
+}
+
+// parseChallenge splits a WWW-Authenticate header, e.g.
+// `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`,
+// into its scheme and parameters
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var name, value string
+		name, rest, _ = strings.Cut(rest, "=")
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(name), ",")))
+		rest = strings.TrimSpace(rest)
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if name != "" {
+			params[name] = value
+		}
+	}
+	return scheme, params
+}
@@ -0,0 +1,348 @@
+// Package remote runs commands on remote machines over SSH
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// defaultPort is the SSH port of the hosts given without one
+const defaultPort = "22"
+
+// dialTimeout bounds the connection and handshake with a host
+const dialTimeout = 30 * time.Second
+
+// defaultKeys are the private keys tried, in order, when no identity file is
+// configured
+var defaultKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// Target is a remote host and the user commands run as
+type Target struct {
+	User string
+	Host string
+	Port string
+}
+
+// String returns the target as user@host:port
+func (t Target) String() string {
+	return t.User + "@" + net.JoinHostPort(t.Host, t.Port)
+}
+
+// ParseTarget parses a target written [user@]host[:port], e.g.
+// deploy@web-1:2222. IPv6 addresses with a port are written in brackets.
+// The user defaults to defaultUser, then to the current user.
+func ParseTarget(target, defaultUser string) (Target, error) {
+	t := Target{User: defaultUser, Host: target, Port: defaultPort}
+	if at := strings.LastIndex(target, "@"); at >= 0 {
+		t.User, t.Host = target[:at], target[at+1:]
+	}
+	if host, port, err := net.SplitHostPort(t.Host); err == nil {
+		t.Host, t.Port = host, port
+	}
+	t.Host = strings.Trim(t.Host, "[]")
+	if t.Host == "" || t.Port == "" {
+		return Target{}, fmt.Errorf("invalid SSH host '%s'", target)
+	}
+	if t.User == "" {
+		current, err := user.Current()
+		if err != nil {
+			return Target{}, fmt.Errorf("no user for SSH host '%s': %w", target, err)
+		}
+		t.User = current.Username
+	}
+	return t, nil
+}
+
+// Client opens SSH sessions with the configured authentication, verifying
+// the hosts against a known_hosts file
+type Client struct {
+	user    string
+	auth    []ssh.AuthMethod
+	hostKey ssh.HostKeyCallback
+	agent   net.Conn
+}
+
+// New creates a client from the SSH configuration, which may be nil to use
+// the defaults: the SSH agent when SSH_AUTH_SOCK is set, the default keys of
+// ~/.ssh and ~/.ssh/known_hosts.
+func New(cfg *config.SSHConfig) (*Client, error) {
+	if cfg == nil {
+		cfg = &config.SSHConfig{}
+	}
+	c := &Client{user: cfg.User}
+
+	home, _ := os.UserHomeDir()
+	knownHosts := expandHome(cfg.KnownHosts, home)
+	if knownHosts == "" {
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKey, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts: %w", err)
+	}
+	c.hostKey = hostKey
+
+	// Keys are tried before the agent
+	var signers []ssh.Signer
+	if cfg.IdentityFile != "" {
+		signer, err := readKey(expandHome(cfg.IdentityFile, home))
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	} else if home != "" {
+		for _, name := range defaultKeys {
+			// The default keys protected by a passphrase are left to the agent
+			if signer, err := readKey(filepath.Join(home, ".ssh", name)); err == nil {
+				signers = append(signers, signer)
+			}
+		}
+	}
+	if len(signers) > 0 {
+		c.auth = append(c.auth, ssh.PublicKeys(signers...))
+	}
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" && !cfg.DisableAgent {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to the SSH agent: %w", err)
+		}
+		c.agent = conn
+		c.auth = append(c.auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	if len(c.auth) == 0 {
+		return nil, errors.New("no SSH key: set ssh.identityFile or run an SSH agent")
+	}
+	return c, nil
+}
+
+// readKey reads an unencrypted private key
+func readKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH key %s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// expandHome replaces a leading ~/ with the home directory
+func expandHome(path, home string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok && home != "" {
+		return filepath.Join(home, rest)
+	}
+	return path
+}
+
+// Close closes the connection to the SSH agent
+func (c *Client) Close() error {
+	if c.agent == nil {
+		return nil
+	}
+	return c.agent.Close()
+}
+
+// Target parses a target, the user defaulting to the configured one
+func (c *Client) Target(target string) (Target, error) {
+	return ParseTarget(target, c.user)
+}
+
+// Session is a command running on a remote host
+type Session struct {
+	conn    *ssh.Client
+	session *ssh.Session
+}
+
+// Start connects to a target and starts a command line there, run by the
+// shell of the user. The command reads stdin when it isn't nil, and its
+// output is copied to stdout and stderr.
+func (c *Client) Start(target Target, commandLine string, stdin io.Reader, stdout, stderr io.Writer) (*Session, error) {
+	conn, err := ssh.Dial("tcp", net.JoinHostPort(target.Host, target.Port), &ssh.ClientConfig{
+		User:            target.User,
+		Auth:            c.auth,
+		HostKeyCallback: c.hostKey,
+		Timeout:         dialTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", target, err)
+	}
+	session, err := conn.NewSession()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open a session on %s: %w", target, err)
+	}
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if err := session.Start(commandLine); err != nil {
+		session.Close()
+		conn.Close()
+		return nil, fmt.Errorf("failed to start the command on %s: %w", target, err)
+	}
+	return &Session{conn: conn, session: session}, nil
+}
+
+// Wait waits for the command to complete and closes the connection
+func (s *Session) Wait() error {
+	defer s.conn.Close()
+	err := s.session.Wait()
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitError{Status: exitErr.ExitStatus(), Signal: exitErr.Signal()}
+	}
+	return err
+}
+
+// Signal sends a signal to the command. Servers that don't support signals
+// ignore it, so Kill should follow when the command must end.
+func (s *Session) Signal(sig os.Signal) error {
+	name := signalName(sig)
+	if name == "" {
+		return fmt.Errorf("unsupported signal %v", sig)
+	}
+	return s.session.Signal(name)
+}
+
+// Kill ends the command by closing the connection
+func (s *Session) Kill() error {
+	s.session.Signal(ssh.SIGKILL)
+	return s.conn.Close()
+}
+
+// signalName returns the SSH name of a signal, empty when it has none
+func signalName(sig os.Signal) ssh.Signal {
+	switch sig {
+	case os.Interrupt:
+		return ssh.SIGINT
+	case os.Kill:
+		return ssh.SIGKILL
+	case syscall.SIGTERM:
+		return ssh.SIGTERM
+	case syscall.SIGHUP:
+		return ssh.SIGHUP
+	case syscall.SIGQUIT:
+		return ssh.SIGQUIT
+	}
+	return ""
+}
+
+// ExitError is returned when a remote command exits with a non-zero status
+// or is killed by a signal
+type ExitError struct {
+	Status int
+	Signal string
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != "" {
+		return fmt.Sprintf("remote command killed by signal %s", e.Signal)
+	}
+	return fmt.Sprintf("remote command exited with status %d", e.Status)
+}
+
+// ExitCode returns the exit status, -1 when the command was killed
+func (e *ExitError) ExitCode() int {
+	if e.Signal != "" {
+		return -1
+	}
+	return e.Status
+}
+
+// CommandLine builds the shell command line running a program with its
+// arguments in a directory, with environment variables, on a POSIX host
+func CommandLine(dir string, env []string, program string, args []string) string {
+	var line strings.Builder
+	if dir != "" {
+		fmt.Fprintf(&line, "cd %s && ", Quote(dir))
+	}
+	line.WriteString("exec ")
+	// env sets the variables without depending on how the shell of the user
+	// treats assignments
+	if len(env) > 0 {
+		line.WriteString("env ")
+		for _, kv := range env {
+			line.WriteString(Quote(kv) + " ")
+		}
+	}
+	line.WriteString(Quote(program))
+	for _, arg := range args {
+		line.WriteString(" " + Quote(arg))
+	}
+	return line.String()
+}
+
+// Quote quotes a word for a POSIX shell
+func Quote(word string) string {
+	if word != "" && strings.IndexFunc(word, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,@%+", r))
+	}) < 0 {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// Validate checks the host groups and the remote hosts of the commands. Only
+// the commands running a program or a shell script can run remotely.
+func Validate(cfg *config.Config) error {
+	user := ""
+	if cfg.SSH != nil {
+		user = cfg.SSH.User
+	}
+	for name, hosts := range cfg.HostGroups {
+		if len(hosts) == 0 {
+			return fmt.Errorf("host group '%s' has no hosts", name)
+		}
+		for _, host := range hosts {
+			if _, err := ParseTarget(host, user); err != nil {
+				return fmt.Errorf("host group '%s': %w", name, err)
+			}
+		}
+	}
+
+	for _, cmd := range cfg.Commands {
+		if !cmd.Remote() {
+			if cmd.FanOut != nil {
+				return fmt.Errorf("command '%s': fanOut requires a host or targets", cmd.Name)
+			}
+			continue
+		}
+		if cmd.Type != "" && cmd.Type != config.CommandTypeExec {
+			return fmt.Errorf("command '%s': commands of type %s can't run on a remote host", cmd.Name, cmd.Type)
+		}
+		for _, host := range cmd.RemoteHosts(cfg.HostGroups) {
+			if _, err := ParseTarget(host, user); err != nil {
+				return fmt.Errorf("command '%s': %w", cmd.Name, err)
+			}
+		}
+		if cmd.FanOut != nil && cmd.FanOut.Parallel < 0 {
+			return fmt.Errorf("command '%s': fanOut.parallel must be positive", cmd.Name)
+		}
+	}
+	return nil
+}
+
+// Needed reports whether a command runs on a remote host
+func Needed(cfg *config.Config) bool {
+	for _, cmd := range cfg.Commands {
+		if cmd.Remote() {
+			return true
+		}
+	}
+	return false
+}
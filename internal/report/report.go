@@ -0,0 +1,169 @@
+// Package report summarizes the history of the runs over a period: counts,
+// failure rates, durations and flaky commands. The summaries are posted to
+// the notifiers on a schedule.
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ndious/delivr/internal/history"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/notifier"
+)
+
+// CommandStats are the statistics of a command over a period
+type CommandStats struct {
+	Name         string
+	Executions   int
+	Failures     int
+	MeanDuration time.Duration
+	// Flips is the number of times the status changed between two
+	// consecutive executions, from success to failure or back
+	Flips int
+}
+
+// Summary is the summary of the runs of a period
+type Summary struct {
+	From         time.Time
+	To           time.Time
+	Runs         int
+	Failures     int
+	MeanDuration time.Duration
+	// Commands are sorted by number of executions
+	Commands []CommandStats
+	// Flaky are the commands that both succeeded and failed, the most
+	// unstable first
+	Flaky []CommandStats
+}
+
+// FailureRate returns the share of failed runs
+func (s Summary) FailureRate() float64 {
+	if s.Runs == 0 {
+		return 0
+	}
+	return float64(s.Failures) / float64(s.Runs)
+}
+
+// Summarize computes the summary of the runs started in [from, to), listing
+// at most top flaky commands
+func Summarize(runs []history.Run, from, to time.Time, top int) Summary {
+	summary := Summary{From: from, To: to}
+
+	stats := make(map[string]*CommandStats)
+	lastFailed := make(map[string]bool)
+	durations := make(map[string]time.Duration)
+	var total time.Duration
+	for _, run := range runs {
+		if run.StartedAt.Before(from) || !run.StartedAt.Before(to) {
+			continue
+		}
+		summary.Runs++
+		total += run.Duration
+		if run.Status != string(notifier.StatusSuccess) {
+			summary.Failures++
+		}
+
+		for _, step := range run.Steps {
+			if step.Status == string(notifier.StatusSkipped) {
+				continue
+			}
+			s, ok := stats[step.Name]
+			if !ok {
+				s = &CommandStats{Name: step.Name}
+				stats[step.Name] = s
+			}
+			failed := step.Status != string(notifier.StatusSuccess)
+			if s.Executions > 0 && failed != lastFailed[step.Name] {
+				s.Flips++
+			}
+			lastFailed[step.Name] = failed
+			s.Executions++
+			if failed {
+				s.Failures++
+			}
+			durations[step.Name] += step.Duration
+		}
+	}
+	if summary.Runs > 0 {
+		summary.MeanDuration = total / time.Duration(summary.Runs)
+	}
+
+	for name, s := range stats {
+		s.MeanDuration = durations[name] / time.Duration(s.Executions)
+		summary.Commands = append(summary.Commands, *s)
+		if s.Failures > 0 && s.Failures < s.Executions {
+			summary.Flaky = append(summary.Flaky, *s)
+		}
+	}
+	sort.Slice(summary.Commands, func(i, j int) bool {
+		a, b := summary.Commands[i], summary.Commands[j]
+		if a.Executions != b.Executions {
+			return a.Executions > b.Executions
+		}
+		return a.Name < b.Name
+	})
+	sort.Slice(summary.Flaky, func(i, j int) bool {
+		a, b := summary.Flaky[i], summary.Flaky[j]
+		if a.Flips != b.Flips {
+			return a.Flips > b.Flips
+		}
+		if a.Failures != b.Failures {
+			return a.Failures > b.Failures
+		}
+		return a.Name < b.Name
+	})
+	if len(summary.Flaky) > top {
+		summary.Flaky = summary.Flaky[:top]
+	}
+	return summary
+}
+
+// maxCommandLines is the number of commands listed in the embed
+const maxCommandLines = 10
+
+// Embed renders the summary as an embed with the given title
+func (s Summary) Embed(title string) notifier.Embed {
+	embed := notifier.Embed{
+		Title:       title,
+		Description: i18n.T("%s to %s", s.From.Format("2006-01-02"), s.To.Add(-time.Second).Format("2006-01-02")),
+		Color:       notifier.ColorSuccess,
+	}
+	if s.Runs == 0 {
+		embed.Description += i18n.T("\nNo runs during this period.")
+		return embed
+	}
+	switch rate := s.FailureRate(); {
+	case rate >= 0.2:
+		embed.Color = notifier.ColorFailure
+	case rate > 0:
+		embed.Color = notifier.ColorWarning
+	}
+
+	embed.Fields = append(embed.Fields,
+		notifier.EmbedField{Name: i18n.Text("Runs"), Value: fmt.Sprintf("%d", s.Runs), Inline: true},
+		notifier.EmbedField{Name: i18n.Text("Failure rate"), Value: fmt.Sprintf("%.1f%% (%d)", s.FailureRate()*100, s.Failures), Inline: true},
+		notifier.EmbedField{Name: i18n.Text("Mean duration"), Value: s.MeanDuration.Round(100 * time.Millisecond).String(), Inline: true},
+	)
+
+	var lines []string
+	for i, c := range s.Commands {
+		if i == maxCommandLines {
+			lines = append(lines, i18n.T("… and %d more", len(s.Commands)-i))
+			break
+		}
+		lines = append(lines, i18n.T("%s: %d runs, %d failed, %s on average", c.Name, c.Executions, c.Failures, c.MeanDuration.Round(100*time.Millisecond)))
+	}
+	embed.Fields = append(embed.Fields, notifier.EmbedField{Name: i18n.Text("Commands"), Value: strings.Join(lines, "\n")})
+
+	if len(s.Flaky) > 0 {
+		lines = lines[:0]
+		for _, c := range s.Flaky {
+			lines = append(lines, i18n.T("%s: %d of %d failed, status changed %d times", c.Name, c.Failures, c.Executions, c.Flips))
+		}
+		embed.Fields = append(embed.Fields, notifier.EmbedField{Name: i18n.Text("Flaky commands"), Value: strings.Join(lines, "\n")})
+	}
+	return embed
+}
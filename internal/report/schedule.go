@@ -0,0 +1,145 @@
+package report
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/history"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/notifier"
+)
+
+// Period is the period covered by a report
+type Period string
+
+const (
+	// Weekly reports are posted on Mondays and cover the previous week
+	Weekly Period = "weekly"
+	// Monthly reports are posted on the 1st and cover the previous month
+	Monthly Period = "monthly"
+)
+
+// defaultTop is the default number of flaky commands listed
+const defaultTop = 5
+
+// Schedule tells when a report is posted
+type Schedule struct {
+	Period Period
+	// Hour and Minute are the local time of day of the report
+	Hour   int
+	Minute int
+	Top    int
+}
+
+// Parse validates the report configurations
+func Parse(cfgs []config.ReportConfig) ([]Schedule, error) {
+	var schedules []Schedule
+	for i, cfg := range cfgs {
+		s := Schedule{Period: Period(cfg.Period), Hour: 9, Top: cfg.Top}
+		if s.Period != Weekly && s.Period != Monthly {
+			return nil, fmt.Errorf("report %d: unknown period '%s', must be weekly or monthly", i+1, cfg.Period)
+		}
+		if cfg.At != "" {
+			at, err := time.Parse("15:04", cfg.At)
+			if err != nil {
+				return nil, fmt.Errorf("report %d: invalid time '%s', must be HH:MM", i+1, cfg.At)
+			}
+			s.Hour, s.Minute = at.Hour(), at.Minute()
+		}
+		if s.Top <= 0 {
+			s.Top = defaultTop
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
+
+// Next returns the first time the report is due after now
+func (s Schedule) Next(now time.Time) time.Time {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for {
+		if s.isReportDay(day) {
+			at := time.Date(day.Year(), day.Month(), day.Day(), s.Hour, s.Minute, 0, 0, day.Location())
+			if at.After(now) {
+				return at
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+}
+
+// isReportDay reports whether the report is posted on the given day
+func (s Schedule) isReportDay(day time.Time) bool {
+	if s.Period == Monthly {
+		return day.Day() == 1
+	}
+	return day.Weekday() == time.Monday
+}
+
+// Window returns the period covered by the report posted at the given time,
+// which ends at midnight on the day of the report
+func (s Schedule) Window(at time.Time) (from, to time.Time) {
+	to = time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+	if s.Period == Monthly {
+		return to.AddDate(0, -1, 0), to
+	}
+	return to.AddDate(0, 0, -7), to
+}
+
+// Title returns the title of the report
+func (s Schedule) Title() string {
+	if s.Period == Monthly {
+		return i18n.Text("📊 Monthly report")
+	}
+	return i18n.Text("📊 Weekly report")
+}
+
+// Post computes the report due at the given time and sends it
+func (s Schedule) Post(store *history.Store, notify notifier.Multi, at time.Time) error {
+	from, to := s.Window(at)
+	runs, err := store.Query(history.Query{Since: from})
+	if err != nil {
+		return err
+	}
+	// Summarize reads the runs oldest first
+	slices.Reverse(runs)
+	summary := Summarize(runs, from, to, s.Top)
+	log.Printf("Posting %s report: %d runs, %d failed", s.Period, summary.Runs, summary.Failures)
+	return notify.SendEmbed(summary.Embed(s.Title()))
+}
+
+// Run posts the reports when they are due, until stop is closed
+func Run(schedules []Schedule, store *history.Store, notify notifier.Multi, stop <-chan struct{}) {
+	if len(schedules) == 0 {
+		return
+	}
+	for {
+		now := time.Now()
+		next := 0
+		for i, s := range schedules {
+			if s.Next(now).Before(schedules[next].Next(now)) {
+				next = i
+			}
+		}
+		at := schedules[next].Next(now)
+
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-timer.C:
+			// Post every report due at this time, e.g. weekly and monthly
+			for _, s := range schedules {
+				if s.Next(now).Equal(at) {
+					if err := s.Post(store, notify, at); err != nil {
+						log.Printf("Warning: Could not send the %s report: %v", s.Period, err)
+					}
+				}
+			}
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
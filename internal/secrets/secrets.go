@@ -0,0 +1,132 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// Providers
+const (
+	ProviderEnv  = "env"
+	ProviderFile = "file"
+	ProviderExec = "exec"
+)
+
+// execTimeout is the maximum time given to an exec provider
+const execTimeout = 30 * time.Second
+
+// referencePattern matches secret://<name> references
+var referencePattern = regexp.MustCompile(`secret://([A-Za-z0-9_.-]+)`)
+
+// Resolver replaces secret references with the values read from their providers
+type Resolver struct {
+	secrets map[string]config.SecretConfig
+}
+
+// New creates a resolver for the configured secrets
+func New(secrets map[string]config.SecretConfig) (*Resolver, error) {
+	for name, secret := range secrets {
+		var missing string
+		switch secret.Provider {
+		case ProviderEnv:
+			if secret.Var == "" {
+				missing = "var"
+			}
+		case ProviderFile:
+			if secret.Path == "" {
+				missing = "path"
+			}
+		case ProviderExec:
+			if secret.Command == "" {
+				missing = "command"
+			}
+		default:
+			return nil, fmt.Errorf("secret '%s': unknown provider '%s'", name, secret.Provider)
+		}
+		if missing != "" {
+			return nil, fmt.Errorf("secret '%s': the %s provider requires %s", name, secret.Provider, missing)
+		}
+	}
+	return &Resolver{secrets: secrets}, nil
+}
+
+// HasReference reports whether s references a secret
+func HasReference(s string) bool {
+	return strings.Contains(s, "secret://")
+}
+
+// Resolve replaces the secret references of s with their values
+func (r *Resolver) Resolve(s string) (string, error) {
+	if !HasReference(s) {
+		return s, nil
+	}
+
+	var resolveErr error
+	resolved := referencePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := strings.TrimPrefix(ref, "secret://")
+		value, err := r.value(name)
+		if err != nil && resolveErr == nil {
+			resolveErr = err
+		}
+		return value
+	})
+	return resolved, resolveErr
+}
+
+// ResolveAll resolves the secret references of every element of values,
+// returning a new slice
+func (r *Resolver) ResolveAll(values []string) ([]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+	resolved := make([]string, len(values))
+	for i, value := range values {
+		var err error
+		if resolved[i], err = r.Resolve(value); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// value reads a secret from its provider
+func (r *Resolver) value(name string) (string, error) {
+	secret, ok := r.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("unknown secret '%s'", name)
+	}
+
+	switch secret.Provider {
+	case ProviderEnv:
+		value, ok := os.LookupEnv(secret.Var)
+		if !ok {
+			return "", fmt.Errorf("secret '%s': environment variable %s is not set", name, secret.Var)
+		}
+		return value, nil
+	case ProviderFile:
+		data, err := os.ReadFile(secret.Path)
+		if err != nil {
+			return "", fmt.Errorf("secret '%s': %w", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+		defer cancel()
+		var stderr bytes.Buffer
+		command := exec.CommandContext(ctx, secret.Command, secret.Args...)
+		command.Stderr = &stderr
+		output, err := command.Output()
+		if err != nil {
+			return "", fmt.Errorf("secret '%s': %s failed: %v %s", name, secret.Command, err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimRight(string(output), "\r\n"), nil
+	}
+}
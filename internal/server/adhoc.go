@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/i18n"
+)
+
+// AdhocRequest is the body of POST /adhoc. The command is built from the
+// configured command named Template when set, with the other fields
+// overriding it.
+type AdhocRequest struct {
+	Template    string          `json:"template,omitempty"`
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Command     string          `json:"command,omitempty"`
+	Args        []string        `json:"args,omitempty"`
+	Shell       string          `json:"shell,omitempty"`
+	Dir         string          `json:"dir,omitempty"`
+	EnvVars     []string        `json:"envVars,omitempty"`
+	Timeout     config.Duration `json:"timeout,omitempty"`
+	// RequestedBy identifies who requested the command in the notifications
+	RequestedBy string `json:"requestedBy,omitempty"`
+	// Force runs a protected template during a freeze period
+	Force bool `json:"force,omitempty"`
+}
+
+// handleAdhoc queues a command that isn't in the configuration. It runs
+// through the regular pipeline so that it's logged, recorded and announced.
+func (s *Server) handleAdhoc(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Server.AllowAdhoc {
+		writeError(w, http.StatusForbidden, "ad-hoc commands are disabled")
+		return
+	}
+
+	var req AdhocRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+
+	cmd, err := s.adhocCommand(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	requestedBy := req.RequestedBy
+	if requestedBy == "" {
+		requestedBy = r.RemoteAddr
+	}
+	log.Printf("Received ad-hoc command '%s' from %s", cmd.Name, requestedBy)
+
+	id, err := s.queue.Submit(command.Job{
+		Source:    "ad-hoc request from " + requestedBy,
+		Trigger:   "adhoc",
+		Commands:  []config.Command{cmd},
+		Preflight: s.cfg.Preflight,
+		Force:     req.Force,
+	})
+	if errors.Is(err, command.ErrOutsideWindow) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Is(err, command.ErrFrozen) {
+		writeError(w, http.StatusLocked, err.Error())
+		return
+	}
+	if errors.Is(err, command.ErrQueueFull) || errors.Is(err, command.ErrQueuePaused) || errors.Is(err, command.ErrQueueStopping) || errors.Is(err, command.ErrApprovalUnavailable) {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"id":      id,
+		"command": cmd.Name,
+		"state":   command.JobQueued,
+	})
+}
+
+// adhocCommand builds the command of an ad-hoc request
+func (s *Server) adhocCommand(req AdhocRequest) (config.Command, error) {
+	cmd := config.Command{Name: "ad-hoc"}
+	if req.Template != "" {
+		template, ok := s.cfg.FindCommand(req.Template)
+		if !ok {
+			return cmd, fmt.Errorf("unknown template command '%s'", req.Template)
+		}
+		cmd = template
+	}
+
+	if req.Name != "" {
+		cmd.Name = req.Name
+	}
+	if req.Description != "" {
+		cmd.Description = req.Description
+	}
+	if req.Command != "" && req.Shell != "" {
+		return cmd, errors.New("command and shell are exclusive")
+	}
+	if req.Command != "" {
+		cmd.Command = req.Command
+		cmd.Shell = ""
+		cmd.Type = config.CommandTypeExec
+	}
+	if req.Shell != "" {
+		cmd.Shell = req.Shell
+		cmd.Command, cmd.Args = "", nil
+		cmd.Type = config.CommandTypeExec
+	}
+	if req.Args != nil {
+		cmd.Args = req.Args
+	}
+	if req.Dir != "" {
+		cmd.Dir = req.Dir
+	}
+	if req.EnvVars != nil {
+		cmd.EnvVars = append(append([]string{}, cmd.EnvVars...), req.EnvVars...)
+	}
+	if req.Timeout > 0 {
+		cmd.Timeout = req.Timeout
+	}
+
+	if cmd.Command == "" && cmd.Shell == "" && cmd.Type != config.CommandTypeDocker && cmd.Type != config.CommandTypeCompose && cmd.Type != config.CommandTypeK8s {
+		return cmd, errors.New("command or template is required")
+	}
+	if cmd.Description == "" {
+		cmd.Description = i18n.Text("⚠️ Ad-hoc command")
+	} else {
+		cmd.Description = i18n.T("⚠️ Ad-hoc command: %s", cmd.Description)
+	}
+	return cmd, nil
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/metrics"
+	"github.com/ndious/delivr/internal/notifier"
+	"github.com/ndious/delivr/internal/workflow"
+)
+
+// statusResponse is the body of GET /status
+type statusResponse struct {
+	Version    string              `json:"version,omitempty"`
+	ConfigFile string              `json:"configFile"`
+	StartedAt  time.Time           `json:"startedAt"`
+	Uptime     string              `json:"uptime"`
+	Commands   []string            `json:"commands"`
+	Queue      command.QueueStatus `json:"queue"`
+	// Releases are the workflow releases in progress and recently finished
+	Releases []workflow.Release `json:"releases,omitempty"`
+}
+
+// RunRequest is the optional body of the run endpoint
+type RunRequest struct {
+	// Params are the values of the parameters declared by the commands
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// handleRun queues the command or the pipeline named in the path
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("command")
+	commands, err := s.cfg.ResolveCommands([]string{name})
+	if err != nil {
+		s.reportTrigger(r, err.Error())
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	var req RunRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+			return
+		}
+	}
+
+	// force=true overrides the freeze periods
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+
+	log.Printf("Received run request for '%s' from %s", name, r.RemoteAddr)
+	id, err := s.submitRun(name, commands, command.Job{
+		Source:  "HTTP API",
+		Trigger: "http",
+		Params:  req.Params,
+		Force:   force,
+	})
+	if err != nil {
+		writeSubmitError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"id":      id,
+		"command": name,
+		"state":   s.jobState(id),
+	})
+}
+
+// jobState returns the state of a job just submitted: queued, or waiting
+// for an allowed window or an approval
+func (s *Server) jobState(id string) string {
+	if job, ok := findJob(s.queue.Status(), id); ok {
+		return job.State
+	}
+	return command.JobQueued
+}
+
+// submitRun queues the commands resolved from name, tagging the release once
+// they succeeded
+func (s *Server) submitRun(name string, commands []config.Command, job command.Job) (string, error) {
+	job.Commands = commands
+	job.Preflight = s.cfg.Preflight
+	job.Done = func(state string) {
+		if state == string(notifier.StatusSuccess) {
+			s.tagger.After(name)
+		}
+	}
+	return s.queue.Submit(job)
+}
+
+// handleMetrics exposes the metrics in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.WriteText(w); err != nil {
+		log.Printf("Failed to write metrics: %v", err)
+	}
+}
+
+// handlePause stops the intake and execution of jobs until resumed
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received pause request from %s", r.RemoteAddr)
+	changed := s.queue.Pause()
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": true, "changed": changed})
+}
+
+// handleResume accepts and runs jobs again after a pause
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received resume request from %s", r.RemoteAddr)
+	changed := s.queue.Resume()
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": false, "changed": changed})
+}
+
+// handleStatus reports the daemon status and the jobs of the queue
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(s.cfg.Commands))
+	for _, cmd := range s.cfg.Commands {
+		names = append(names, cmd.Name)
+	}
+
+	writeJSON(w, http.StatusOK, statusResponse{
+		Version:    s.cfg.Version,
+		ConfigFile: s.cfg.Source(),
+		StartedAt:  s.startedAt,
+		Uptime:     time.Since(s.startedAt).Round(time.Second).String(),
+		Commands:   names,
+		Queue:      s.queue.Status(),
+		Releases:   s.workflows.Releases(),
+	})
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/discord"
+	"github.com/ndious/delivr/internal/i18n"
+)
+
+// Prefixes of the IDs of the approval buttons, followed by the job ID
+const (
+	approveButton = "approve:"
+	rejectButton  = "reject:"
+)
+
+// RequestApproval posts the approval request of a job in the channel of the
+// Discord bot, with buttons to approve or reject it. It implements
+// command.Approver.
+func (s *Server) RequestApproval(job command.JobStatus, expires time.Time) (func(outcome string), error) {
+	if s.bot == nil {
+		return nil, errors.New("the Discord interactions are not configured")
+	}
+	channelID := s.cfg.Discord.Bot.ChannelID
+	content := i18n.T("✋ **Approval required** for job `%s` from %s: %s\nExpires <t:%d:R>",
+		job.ID, job.Source, strings.Join(job.Commands, ", "), expires.Unix())
+	messageID, err := s.bot.CreateMessageWithComponents(channelID, content, approvalButtons(job.ID, false))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Requested the approval of job %s in Discord", job.ID)
+
+	bot := s.bot
+	return func(outcome string) {
+		if err := bot.EditMessageWithComponents(channelID, messageID, content+"\n"+outcome, approvalButtons(job.ID, true)); err != nil {
+			log.Printf("Warning: Could not update the approval request of job %s: %v", job.ID, err)
+		}
+	}, nil
+}
+
+// approvalButtons returns the buttons approving and rejecting a job
+func approvalButtons(id string, disabled bool) []discord.Component {
+	return []discord.Component{{
+		Type: discord.ComponentActionRow,
+		Components: []discord.Component{
+			{Type: discord.ComponentButton, Style: discord.ButtonSuccess, Label: i18n.Text("Approve"), CustomID: approveButton + id, Disabled: disabled},
+			{Type: discord.ComponentButton, Style: discord.ButtonDanger, Label: i18n.Text("Reject"), CustomID: rejectButton + id, Disabled: disabled},
+		},
+	}}
+}
+
+// approvalDecision applies the decision of a click on an approval button,
+// updating the request with the outcome. Users other than the approvers only
+// get an ephemeral reply.
+func (s *Server) approvalDecision(interaction *discord.Interaction) discord.InteractionResponse {
+	reply := func(content string) discord.InteractionResponse {
+		return discord.InteractionResponse{
+			Type: discord.ResponseChannelMessage,
+			Data: &discord.InteractionResponseData{Content: content, Flags: discord.FlagEphemeral},
+		}
+	}
+	if interaction.Data == nil {
+		return reply(i18n.Text("Unknown interaction"))
+	}
+
+	by := "Discord"
+	if user := interaction.Invoker(); user != nil {
+		by = user.Username
+	}
+	if !interaction.InvokedBy(s.cfg.Discord.Bot.Approvers) {
+		log.Printf("Discord user %s isn't allowed to decide on approvals", by)
+		return reply(i18n.Text("⛔ You are not allowed to approve or reject jobs"))
+	}
+
+	var id, outcome string
+	var err error
+	switch button := interaction.Data.CustomID; {
+	case strings.HasPrefix(button, approveButton):
+		id = strings.TrimPrefix(button, approveButton)
+		err = s.queue.Approve(id, by)
+		outcome = i18n.T("✅ Approved by %s", by)
+	case strings.HasPrefix(button, rejectButton):
+		id = strings.TrimPrefix(button, rejectButton)
+		err = s.queue.Reject(id, by)
+		outcome = i18n.T("🚫 Rejected by %s", by)
+	default:
+		return reply(i18n.T("Unknown button %s", button))
+	}
+	if err != nil {
+		return reply("❌ " + err.Error())
+	}
+
+	content := outcome
+	if interaction.Message != nil {
+		content = interaction.Message.Content + "\n" + outcome
+	}
+	return discord.InteractionResponse{
+		Type: discord.ResponseUpdateMessage,
+		Data: &discord.InteractionResponseData{
+			Content:    content,
+			Components: approvalButtons(id, true),
+		},
+	}
+}
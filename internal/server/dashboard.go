@@ -0,0 +1,159 @@
+package server
+
+import (
+	_ "embed"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/config"
+)
+
+//go:embed dashboard.html
+var dashboardPage string
+
+// dashboardTemplate renders the page with the paths of the endpoints it calls
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardPage))
+
+// dashboardCommand is a command as shown by the dashboard
+type dashboardCommand struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Tags        []string     `json:"tags,omitempty"`
+	Params      []string     `json:"params,omitempty"`
+	LastRun     *lastCommand `json:"lastRun,omitempty"`
+}
+
+// lastCommand is the last recorded step of a command
+type lastCommand struct {
+	Run       string        `json:"run"`
+	Status    string        `json:"status"`
+	StartedAt time.Time     `json:"startedAt"`
+	Duration  time.Duration `json:"duration"`
+	ExitCode  int           `json:"exitCode"`
+}
+
+// dashboardState is the body of the response of GET /dashboard/state
+type dashboardState struct {
+	Version    string              `json:"version,omitempty"`
+	ConfigFile string              `json:"configFile"`
+	Commands   []dashboardCommand  `json:"commands"`
+	Queue      command.QueueStatus `json:"queue"`
+}
+
+// handleDashboard serves the page of the dashboard
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	header := "Authorization"
+	if s.cfg.Server.TokenHeader != "" {
+		header = s.cfg.Server.TokenHeader
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := dashboardTemplate.Execute(w, map[string]string{
+		"Run":         s.paths["run"],
+		"State":       s.paths["dashboard"] + "/state",
+		"Output":      s.paths["dashboard"] + "/output",
+		"TokenHeader": header,
+	})
+	if err != nil {
+		log.Printf("Failed to render the dashboard: %v", err)
+	}
+}
+
+// handleDashboardState returns the commands with their last run, and the
+// jobs of the queue
+func (s *Server) handleDashboardState(w http.ResponseWriter, r *http.Request) {
+	last, err := s.lastRuns(s.cfg.Commands)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	state := dashboardState{
+		Version:    s.cfg.Version,
+		ConfigFile: s.cfg.Source(),
+		Commands:   make([]dashboardCommand, 0, len(s.cfg.Commands)),
+		Queue:      s.queue.Status(),
+	}
+	for _, cmd := range s.cfg.Commands {
+		state.Commands = append(state.Commands, dashboardCommand{
+			Name:        cmd.Name,
+			Description: cmd.Description,
+			Tags:        cmd.Tags,
+			Params:      cmd.Params,
+			LastRun:     last[cmd.Name],
+		})
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+// lastRuns returns the last recorded step of the commands, by name, reading
+// the history from the most recent run until all of them are found
+func (s *Server) lastRuns(commands []config.Command) (map[string]*lastCommand, error) {
+	last := make(map[string]*lastCommand, len(commands))
+	if s.history == nil {
+		return last, nil
+	}
+	runs, err := s.history.List()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(commands))
+	for _, cmd := range commands {
+		wanted[cmd.Name] = true
+	}
+	for i := len(runs) - 1; i >= 0 && len(last) < len(wanted); i-- {
+		run := runs[i]
+		for j := len(run.Steps) - 1; j >= 0; j-- {
+			step := run.Steps[j]
+			if !wanted[step.Name] || last[step.Name] != nil {
+				continue
+			}
+			last[step.Name] = &lastCommand{
+				Run:       run.ID,
+				Status:    step.Status,
+				StartedAt: run.StartedAt,
+				Duration:  step.Duration,
+				ExitCode:  step.ExitCode,
+			}
+		}
+	}
+	return last, nil
+}
+
+// handleDashboardOutput streams the output of the commands as server-sent
+// events, until the client goes away or the server stops
+func (s *Server) handleDashboardOutput(w http.ResponseWriter, r *http.Request) {
+	if s.feed == nil {
+		writeError(w, http.StatusServiceUnavailable, "output streaming is not available")
+		return
+	}
+	chunks, unsubscribe := s.feed.Subscribe()
+	defer unsubscribe()
+	stream, ok := newEventStream(w)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case chunk := <-chunks:
+			err = stream.send("output", newOutputEvent(chunk))
+		case <-keepAlive.C:
+			err = stream.keepAlive()
+		case <-r.Context().Done():
+			return
+		case <-s.stopping:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
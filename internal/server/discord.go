@@ -0,0 +1,421 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/discord"
+	"github.com/ndious/delivr/internal/history"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/notifier"
+)
+
+// slashHistoryRuns is the number of executions listed by /delivr history
+const slashHistoryRuns = 10
+
+// maxSlashOptions is the number of options Discord accepts per subcommand
+const maxSlashOptions = 25
+
+// slashCommand is the definition of the /delivr slash command
+var slashCommand = discord.ApplicationCommand{
+	Name:        "delivr",
+	Description: "Query the Delivr daemon",
+	Options: []discord.ApplicationCommandOption{
+		{
+			Type:        discord.OptionSubCommand,
+			Name:        "status",
+			Description: "Show the daemon status, running jobs and recent results",
+		},
+		{
+			Type:        discord.OptionSubCommand,
+			Name:        "pause",
+			Description: "Stop accepting and running triggered jobs",
+		},
+		{
+			Type:        discord.OptionSubCommand,
+			Name:        "resume",
+			Description: "Accept and run triggered jobs again",
+		},
+		{
+			Type:        discord.OptionSubCommand,
+			Name:        "history",
+			Description: "Show the last executions of a command",
+			Options: []discord.ApplicationCommandOption{
+				{
+					Type:        discord.OptionString,
+					Name:        "command",
+					Description: "Name of the command",
+					Required:    true,
+				},
+			},
+		},
+		{
+			Type:        discord.OptionSubCommand,
+			Name:        "replay",
+			Description: "Run a recorded execution again with the same variables",
+			Options: []discord.ApplicationCommandOption{
+				{
+					Type:        discord.OptionString,
+					Name:        "run",
+					Description: "ID of the run, as listed by /delivr history",
+					Required:    true,
+				},
+			},
+		},
+	},
+}
+
+// RegisterSlashCommand registers the /delivr slash command for the
+// application, its run subcommand taking the parameters of the commands of
+// the configuration as options
+func RegisterSlashCommand(token, applicationID string, cfg *config.Config) error {
+	bot, err := discord.NewBot(token)
+	if err != nil {
+		return err
+	}
+	definition := slashCommand
+	definition.Options = append(append([]discord.ApplicationCommandOption{}, slashCommand.Options...), slashRunCommand(cfg))
+	if err := bot.RegisterCommand(applicationID, definition); err != nil {
+		return err
+	}
+	log.Printf("Registered the /%s Discord slash command", slashCommand.Name)
+	return nil
+}
+
+// slashRunCommand defines the /delivr run subcommand, with an option for each
+// parameter declared by the commands. Discord only accepts lowercase option
+// names, which are matched to the parameters regardless of case.
+func slashRunCommand(cfg *config.Config) discord.ApplicationCommandOption {
+	run := discord.ApplicationCommandOption{
+		Type:        discord.OptionSubCommand,
+		Name:        "run",
+		Description: "Queue a command or a pipeline",
+		Options: []discord.ApplicationCommandOption{
+			{
+				Type:        discord.OptionString,
+				Name:        "command",
+				Description: "Name of the command or pipeline",
+				Required:    true,
+			},
+		},
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, cmd := range cfg.Commands {
+		for _, name := range cmd.Params {
+			if name = strings.ToLower(name); !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	if len(names) > maxSlashOptions-1 {
+		log.Printf("Warning: Only %d of the %d parameters are options of /%s run", maxSlashOptions-1, len(names), slashCommand.Name)
+		names = names[:maxSlashOptions-1]
+	}
+	for _, name := range names {
+		run.Options = append(run.Options, discord.ApplicationCommandOption{
+			Type:        discord.OptionString,
+			Name:        name,
+			Description: "Parameter " + name + " of the command",
+		})
+	}
+	return run
+}
+
+// handleInteraction answers the slash commands sent by Discord to the
+// interactions endpoint
+func (s *Server) handleInteraction(w http.ResponseWriter, r *http.Request) {
+	bot := s.cfg.Discord.Bot
+	if bot == nil || bot.PublicKey == "" {
+		writeError(w, http.StatusNotFound, "discord interactions are not configured")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	if err := discord.VerifyInteraction(r, body, bot.PublicKey); err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var interaction discord.Interaction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid interaction")
+		return
+	}
+
+	switch interaction.Type {
+	case discord.InteractionPing:
+		writeJSON(w, http.StatusOK, discord.InteractionResponse{Type: discord.ResponsePong})
+	case discord.InteractionApplicationCommand:
+		writeJSON(w, http.StatusOK, discord.InteractionResponse{
+			Type: discord.ResponseChannelMessage,
+			Data: &discord.InteractionResponseData{
+				Content: s.slashReply(&interaction),
+				Flags:   discord.FlagEphemeral,
+			},
+		})
+	case discord.InteractionMessageComponent:
+		writeJSON(w, http.StatusOK, s.approvalDecision(&interaction))
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported interaction type")
+	}
+}
+
+// slashReply builds the answer to a /delivr command
+func (s *Server) slashReply(interaction *discord.Interaction) string {
+	if interaction.Data == nil || interaction.Data.Name != slashCommand.Name || len(interaction.Data.Options) == 0 {
+		return i18n.Text("Unknown command")
+	}
+
+	subcommand := interaction.Data.Options[0]
+	if user := interaction.Invoker(); user != nil {
+		log.Printf("Received /%s %s from Discord user %s", slashCommand.Name, subcommand.Name, user.Username)
+	}
+
+	switch subcommand.Name {
+	case "status":
+		return s.slashStatus()
+	case "history":
+		return s.slashHistory(subcommand.StringOption("command"))
+	case "replay":
+		return s.slashReplay(interaction, subcommand.StringOption("run"))
+	case "run":
+		return s.slashRun(interaction, subcommand)
+	case "pause":
+		if s.slashDenied(interaction, "", s.cfg.Commands) != "" {
+			return s.slashRefusal(interaction, "pause", i18n.Text("pause Delivr"), i18n.Text(aclAllCommands))
+		}
+		if !s.queue.Pause() {
+			return i18n.Text("⏸️ Delivr is already paused")
+		}
+		return i18n.Text("⏸️ Delivr paused: triggers are rejected and queued jobs are held until `/delivr resume`")
+	case "resume":
+		if s.slashDenied(interaction, "", s.cfg.Commands) != "" {
+			return s.slashRefusal(interaction, "resume", i18n.Text("resume Delivr"), i18n.Text(aclAllCommands))
+		}
+		if !s.queue.Resume() {
+			return i18n.Text("▶️ Delivr is not paused")
+		}
+		return i18n.Text("▶️ Delivr resumed")
+	default:
+		return i18n.T("Unknown subcommand %s", subcommand.Name)
+	}
+}
+
+// slashStatus describes the daemon and its queue
+func (s *Server) slashStatus() string {
+	var b strings.Builder
+	b.WriteString(i18n.Text("📊 **Delivr status**\n"))
+	if s.cfg.Version != "" {
+		b.WriteString(i18n.T("Configuration version: %s\n", s.cfg.Version))
+	}
+	b.WriteString(i18n.T("Uptime: %s\n", time.Since(s.startedAt).Round(time.Second)))
+
+	status := s.queue.Status()
+	if status.Paused {
+		b.WriteString(i18n.Text("⏸️ Paused: triggers are rejected and queued jobs are held\n"))
+	}
+	if status.Running != nil {
+		since := time.Duration(0)
+		if status.Running.StartedAt != nil {
+			since = time.Since(*status.Running.StartedAt).Round(time.Second)
+		}
+		b.WriteString(i18n.T("\n🏃 Running: %s (%s, for %s)\n", strings.Join(status.Running.Commands, ", "), status.Running.Source, since))
+	} else {
+		b.WriteString(i18n.Text("\nNo job running\n"))
+	}
+	for _, job := range status.Queued {
+		b.WriteString(i18n.T("⏳ Queued: %s (%s)\n", strings.Join(job.Commands, ", "), job.Source))
+	}
+
+	if len(status.Recent) > 0 {
+		b.WriteString(i18n.Text("\n**Recent results**\n"))
+		for _, job := range status.Recent {
+			finished := ""
+			if job.FinishedAt != nil {
+				finished = job.FinishedAt.Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(&b, "%s %s (%s) %s\n", jobIcon(job.State), strings.Join(job.Commands, ", "), job.Source, finished)
+		}
+	}
+	return b.String()
+}
+
+// slashHistory lists the last recorded executions of a command
+func (s *Server) slashHistory(name string) string {
+	if _, ok := s.cfg.FindCommand(name); !ok {
+		return i18n.T("Unknown command '%s'", name)
+	}
+	if s.history == nil {
+		return i18n.Text("History is not available")
+	}
+
+	// Every run selected has at least one execution of the command
+	runs, err := s.history.Query(history.Query{Command: name, Limit: slashHistoryRuns})
+	if err != nil {
+		log.Printf("Failed to read history: %v", err)
+		return i18n.Text("Failed to read the history")
+	}
+
+	var lines []string
+	for _, run := range runs {
+		for _, step := range run.Steps {
+			if step.Name == name && len(lines) < slashHistoryRuns {
+				lines = append(lines, i18n.T("%s %s in %s (%s) `%s`", jobIcon(step.Status), run.StartedAt.Format("2006-01-02 15:04"), step.Duration.Round(100*time.Millisecond), run.Source, run.ID))
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return i18n.T("No recorded execution of **%s**", name)
+	}
+	return i18n.T("📜 **Last executions of %s**\n%s", name, strings.Join(lines, "\n"))
+}
+
+// slashReplay replays a recorded run
+func (s *Server) slashReplay(interaction *discord.Interaction, id string) string {
+	by := "Discord"
+	if user := interaction.Invoker(); user != nil {
+		by = user.Username
+	}
+	if s.history != nil {
+		if run, ok, _ := s.history.Find(id); ok {
+			var commands []config.Command
+			for _, name := range run.Commands {
+				if cmd, ok := s.cfg.FindCommand(name); ok {
+					commands = append(commands, cmd)
+				}
+			}
+			if denied := s.slashDenied(interaction, "", commands); denied != "" {
+				return s.slashRefusal(interaction, "replay", i18n.T("replay run %s", id), i18n.T(aclDenied, denied))
+			}
+		}
+	}
+	resp, err := s.replay(id, by, false)
+	if err != nil {
+		return i18n.T("❌ Could not replay run %s: %v", id, err)
+	}
+	reply := i18n.T("🔁 Replay of run %s queued as job %s", id, resp.ID)
+	if resp.Warning != "" {
+		reply += "\n⚠️ " + resp.Warning
+	}
+	return reply
+}
+
+// slashRun queues a command or a pipeline with the parameters given as
+// options
+func (s *Server) slashRun(interaction *discord.Interaction, subcommand discord.InteractionOption) string {
+	name := subcommand.StringOption("command")
+	commands, err := s.cfg.ResolveCommands([]string{name})
+	if err != nil {
+		return "❌ " + err.Error()
+	}
+	if denied := s.slashDenied(interaction, name, commands); denied == name {
+		return s.slashRefusal(interaction, "run", i18n.T("run '%s'", name), i18n.Text(aclNotGranted))
+	} else if denied != "" {
+		return s.slashRefusal(interaction, "run", i18n.T("run '%s'", name), i18n.T(aclDenied, denied))
+	}
+
+	var params map[string]string
+	for _, cmd := range commands {
+		for _, param := range cmd.Params {
+			value, ok := subcommand.Option(strings.ToLower(param))
+			if !ok {
+				continue
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[param] = value
+		}
+	}
+
+	source := "Discord"
+	if user := interaction.Invoker(); user != nil {
+		source = "Discord user " + user.Username
+	}
+	id, err := s.submitRun(name, commands, command.Job{
+		Source:  source,
+		Trigger: "discord",
+		Params:  params,
+	})
+	if err != nil {
+		return i18n.T("❌ Could not run '%s': %v", name, err)
+	}
+	return i18n.T("⏳ '%s' queued as job %s", name, id)
+}
+
+// slashDenied returns the first of the commands, requested as name, that the
+// access list of the bot doesn't allow the invoker of the interaction to run,
+// or "" when it allows all of them
+func (s *Server) slashDenied(interaction *discord.Interaction, name string, commands []config.Command) string {
+	acl := s.cfg.Discord.Bot.ACL
+	if len(acl) == 0 {
+		return ""
+	}
+	for _, cmd := range commands {
+		allowed := false
+		for _, rule := range acl {
+			members := append(append([]string{}, rule.Users...), rule.Roles...)
+			if rule.Matches(name, cmd) && interaction.InvokedBy(members) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return cmd.Name
+		}
+	}
+	return ""
+}
+
+// Reasons given to the users the access list doesn't allow, translated
+// when replying
+const (
+	aclNotGranted  = "`discord.bot.acl` doesn't grant it to you or to your roles"
+	aclDenied      = "`discord.bot.acl` doesn't allow you or your roles to run '%s'"
+	aclAllCommands = "only the users allowed to run every command by `discord.bot.acl` can"
+)
+
+// slashRefusal reports a subcommand the access list doesn't allow, and
+// returns the reply explaining why
+func (s *Server) slashRefusal(interaction *discord.Interaction, subcommand, action, reason string) string {
+	from := "Discord"
+	if user := interaction.Invoker(); user != nil {
+		from = "Discord user " + user.Username
+	}
+	s.reportRejected("/"+slashCommand.Name+" "+subcommand, from, i18n.T("not allowed to %s", action))
+	return i18n.T("⛔ You are not allowed to %s: %s", action, reason)
+}
+
+// jobIcon returns the icon of a job state or step status
+func jobIcon(state string) string {
+	switch state {
+	case command.JobAborted:
+		return "🛑"
+	case command.JobQueued:
+		return "⏳"
+	case command.JobRunning:
+		return "🏃"
+	case command.JobAwaitingApproval:
+		return "✋"
+	case command.JobRejected:
+		return "🚫"
+	default:
+		return notifier.StatusIcon(notifier.Status(state))
+	}
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/config"
+)
+
+// gitPush is a push notified by GitHub or GitLab
+type gitPush struct {
+	Repository string
+	Branch     string
+	Commit     string
+	Pusher     string
+}
+
+// githubPushPayload holds the fields used of the GitHub push events
+type githubPushPayload struct {
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Deleted    bool   `json:"deleted"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Pusher struct {
+		Name string `json:"name"`
+	} `json:"pusher"`
+}
+
+// gitlabPushPayload holds the fields used of the GitLab push hooks
+type gitlabPushPayload struct {
+	Ref         string `json:"ref"`
+	After       string `json:"after"`
+	CheckoutSHA string `json:"checkout_sha"`
+	Project     struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	UserUsername string `json:"user_username"`
+}
+
+// errNotPush is returned for the events that aren't branch pushes, which are
+// acknowledged and ignored
+var errNotPush = errors.New("not a branch push")
+
+// handleGitPush receives the push webhooks of GitHub and GitLab and queues
+// the commands configured for the pushed repository and branch. The jobs of
+// the matching mappings are all resolved before any is queued. Once one is
+// queued, the push is accepted even when the next ones are rejected, so that
+// the git host doesn't send it again and run the queued ones twice: the
+// response lists the rejected commands.
+func (s *Server) handleGitPush(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 5<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	if err := s.verifyGitWebhook(r, body); err != nil {
+		s.reportTrigger(r, err.Error())
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	push, err := parseGitPush(r, body)
+	if errors.Is(err, errNotPush) {
+		writeJSON(w, http.StatusOK, map[string]string{"ignored": err.Error()})
+		return
+	}
+	if err != nil {
+		s.reportTrigger(r, "invalid git webhook: "+err.Error())
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	log.Printf("Received push of %s to %s@%s from %s", shortCommit(push.Commit), push.Repository, push.Branch, r.RemoteAddr)
+
+	// jobs are the jobs of the matching mappings, and jobCommands the
+	// commands they list
+	var jobs []command.Job
+	var jobCommands []string
+	for _, mapping := range s.cfg.GitPushes {
+		if !matchGitPush(mapping, push) {
+			continue
+		}
+		commands, err := s.cfg.ResolveCommands(mapping.Commands)
+		if err != nil {
+			s.reportTrigger(r, fmt.Sprintf("push to %s@%s: %v", push.Repository, push.Branch, err))
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		jobs = append(jobs, command.Job{
+			Source:   fmt.Sprintf("push of %s to %s@%s by %s", shortCommit(push.Commit), push.Repository, push.Branch, push.Pusher),
+			Trigger:  "git-push",
+			Commands: commands,
+			EnvVars: []string{
+				"DELIVR_GIT_REPOSITORY=" + push.Repository,
+				"DELIVR_GIT_BRANCH=" + push.Branch,
+				"DELIVR_GIT_COMMIT=" + push.Commit,
+				"DELIVR_GIT_PUSHER=" + push.Pusher,
+			},
+			Preflight: s.cfg.Preflight,
+		})
+		jobCommands = append(jobCommands, strings.Join(mapping.Commands, ", "))
+	}
+
+	var queued []string
+	var rejected []map[string]string
+	for i, job := range jobs {
+		id, err := s.queue.Submit(job)
+		if err != nil {
+			if len(queued) == 0 {
+				// Nothing was queued, the git host can send it again
+				writeSubmitError(w, err)
+				return
+			}
+			log.Printf("Warning: Could not queue %s for the push to %s@%s: %v", jobCommands[i], push.Repository, push.Branch, err)
+			s.reportTrigger(r, fmt.Sprintf("push to %s@%s: %v", push.Repository, push.Branch, err))
+			rejected = append(rejected, map[string]string{"commands": jobCommands[i], "error": err.Error()})
+			continue
+		}
+		queued = append(queued, id)
+	}
+
+	if len(jobs) == 0 {
+		log.Printf("Ignoring push to %s@%s: no matching repository and branch", push.Repository, push.Branch)
+	}
+	resp := map[string]interface{}{
+		"repository": push.Repository,
+		"branch":     push.Branch,
+		"commit":     push.Commit,
+		"queued":     queued,
+	}
+	if len(rejected) > 0 {
+		resp["rejected"] = rejected
+	}
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// verifyGitWebhook authenticates a webhook with the configured secret: the
+// signature of the body for GitHub, the token header for GitLab. Without
+// secret, the server token is required like on the other endpoints.
+func (s *Server) verifyGitWebhook(r *http.Request, body []byte) error {
+	secret := ""
+	if s.cfg.Server != nil {
+		secret = s.cfg.Server.WebhookSecret
+	}
+	if secret == "" {
+		if s.cfg.Server != nil && s.cfg.Server.Token != "" && !s.checkToken(r, s.cfg.Server.Token) {
+			return errors.New("invalid or missing token")
+		}
+		return nil
+	}
+
+	if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			return errors.New("invalid GitLab webhook token")
+		}
+		return nil
+	}
+	signature, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if !ok {
+		return errors.New("missing webhook signature or token")
+	}
+	received, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.New("invalid GitHub webhook signature")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(received, mac.Sum(nil)) {
+		return errors.New("invalid GitHub webhook signature")
+	}
+	return nil
+}
+
+// parseGitPush extracts the push of a GitHub or GitLab webhook. Pings, tag
+// pushes and branch deletions return errNotPush.
+func parseGitPush(r *http.Request, body []byte) (gitPush, error) {
+	var push gitPush
+	var ref, after string
+	switch {
+	case r.Header.Get("X-GitHub-Event") != "":
+		if event := r.Header.Get("X-GitHub-Event"); event != "push" {
+			return push, fmt.Errorf("%w: GitHub %s event", errNotPush, event)
+		}
+		var payload githubPushPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return push, fmt.Errorf("invalid GitHub push payload: %w", err)
+		}
+		if payload.Deleted {
+			return push, fmt.Errorf("%w: branch deletion", errNotPush)
+		}
+		ref, after = payload.Ref, payload.After
+		push.Repository, push.Pusher = payload.Repository.FullName, payload.Pusher.Name
+	case r.Header.Get("X-Gitlab-Event") != "":
+		if event := r.Header.Get("X-Gitlab-Event"); event != "Push Hook" {
+			return push, fmt.Errorf("%w: GitLab %s", errNotPush, event)
+		}
+		var payload gitlabPushPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return push, fmt.Errorf("invalid GitLab push payload: %w", err)
+		}
+		if payload.CheckoutSHA == "" {
+			return push, fmt.Errorf("%w: branch deletion", errNotPush)
+		}
+		ref, after = payload.Ref, payload.After
+		push.Repository, push.Pusher = payload.Project.PathWithNamespace, payload.UserUsername
+	default:
+		return push, errors.New("missing X-GitHub-Event or X-Gitlab-Event header")
+	}
+
+	branch, ok := strings.CutPrefix(ref, "refs/heads/")
+	if !ok {
+		return push, fmt.Errorf("%w: %s", errNotPush, ref)
+	}
+	if push.Repository == "" {
+		return push, errors.New("missing repository in push payload")
+	}
+	push.Branch, push.Commit = branch, after
+	return push, nil
+}
+
+// matchGitPush reports whether a push matches the repository and branch
+// patterns of a mapping. Empty patterns match everything.
+func matchGitPush(mapping config.GitPush, push gitPush) bool {
+	if mapping.Repository != "" {
+		if ok, _ := path.Match(strings.ToLower(mapping.Repository), strings.ToLower(push.Repository)); !ok {
+			return false
+		}
+	}
+	if mapping.Branch != "" {
+		if ok, _ := path.Match(mapping.Branch, push.Branch); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// shortCommit returns the abbreviated hash of a commit
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
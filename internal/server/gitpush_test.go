@@ -0,0 +1,180 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/notifier"
+)
+
+// testNotifier drops the messages of the tests
+type testNotifier struct{}
+
+func (testNotifier) SendMessage(string) error         { return nil }
+func (testNotifier) SendResult(notifier.Result) error { return nil }
+
+const testWebhookSecret = "s3cr3t"
+
+const githubPush = `{"ref": "refs/heads/main", "after": "0123456789abcdef", "repository": {"full_name": "acme/web"}, "pusher": {"name": "dev"}}`
+
+// newGitPushServer returns a server with the given push mappings, whose
+// queue holds at most size jobs. The queue isn't started, so the jobs stay
+// queued.
+func newGitPushServer(mappings []config.GitPush, size int) *Server {
+	cfg := &config.Config{
+		Commands: []config.Command{
+			{Name: "build", Command: "true"},
+			{Name: "deploy", Command: "true"},
+		},
+		Server:    &config.ServerConfig{WebhookSecret: testWebhookSecret},
+		GitPushes: mappings,
+	}
+	runner := command.NewRunner(testNotifier{}, nil, "", "")
+	return &Server{cfg: cfg, queue: command.NewQueue(runner, size), notify: testNotifier{}}
+}
+
+// githubSignature signs a body like GitHub
+func githubSignature(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postGitPush sends a push webhook with the given headers, and returns the
+// response and its decoded body
+func postGitPush(t *testing.T, s *Server, body string, headers map[string]string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/hooks/git", strings.NewReader(body))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	s.handleGitPush(rec, req)
+	var resp map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	return rec, resp
+}
+
+// TestGitPushAuthentication checks the GitHub signatures and the GitLab
+// tokens of the push webhooks
+func TestGitPushAuthentication(t *testing.T) {
+	const gitlabPush = `{"ref": "refs/heads/main", "after": "0123456789abcdef", "checkout_sha": "0123456789abcdef", "project": {"path_with_namespace": "acme/web"}, "user_username": "dev"}`
+	tests := []struct {
+		name    string
+		body    string
+		headers map[string]string
+		status  int
+	}{
+		{
+			name:    "valid signature",
+			body:    githubPush,
+			headers: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": githubSignature(testWebhookSecret, githubPush)},
+			status:  http.StatusAccepted,
+		},
+		{
+			name:    "signature of another secret",
+			body:    githubPush,
+			headers: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": githubSignature("other", githubPush)},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "signature of another body",
+			body:    githubPush,
+			headers: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": githubSignature(testWebhookSecret, "{}")},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "malformed signature",
+			body:    githubPush,
+			headers: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=not-hex"},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "missing signature",
+			body:    githubPush,
+			headers: map[string]string{"X-GitHub-Event": "push"},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "valid GitLab token",
+			body:    gitlabPush,
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": testWebhookSecret},
+			status:  http.StatusAccepted,
+		},
+		{
+			name:    "invalid GitLab token",
+			body:    gitlabPush,
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "other"},
+			status:  http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGitPushServer([]config.GitPush{{Repository: "acme/*", Branch: "main", Commands: []string{"deploy"}}}, 5)
+			rec, _ := postGitPush(t, s, tt.body, tt.headers)
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			queued := len(s.queue.Status().Queued)
+			if tt.status == http.StatusAccepted && queued != 1 {
+				t.Errorf("%d jobs queued, want 1", queued)
+			}
+			if tt.status != http.StatusAccepted && queued != 0 {
+				t.Errorf("%d jobs queued by a rejected webhook", queued)
+			}
+		})
+	}
+}
+
+// TestGitPushQueuesAllOrAccepts checks that a push is only retried by the
+// git host when none of its jobs was queued
+func TestGitPushQueuesAllOrAccepts(t *testing.T) {
+	headers := map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": githubSignature(testWebhookSecret, githubPush)}
+
+	// A mapping that can't be resolved rejects the push before any job is
+	// queued
+	s := newGitPushServer([]config.GitPush{
+		{Branch: "main", Commands: []string{"build"}},
+		{Branch: "main", Commands: []string{"missing"}},
+	}, 5)
+	if rec, _ := postGitPush(t, s, githubPush, headers); rec.Code != http.StatusInternalServerError {
+		t.Errorf("unresolved mapping: got status %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if queued := len(s.queue.Status().Queued); queued != 0 {
+		t.Errorf("unresolved mapping: %d jobs queued, want none", queued)
+	}
+
+	// Once a job is queued, the push is accepted and the rejected jobs are
+	// listed
+	s = newGitPushServer([]config.GitPush{
+		{Branch: "main", Commands: []string{"build"}},
+		{Branch: "main", Commands: []string{"deploy"}},
+	}, 1)
+	rec, resp := postGitPush(t, s, githubPush, headers)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("full queue: got status %d, want %d", rec.Code, http.StatusAccepted)
+	}
+	if queued, _ := resp["queued"].([]any); len(queued) != 1 {
+		t.Errorf("full queue: queued %v, want 1 job", resp["queued"])
+	}
+	rejected, _ := resp["rejected"].([]any)
+	if len(rejected) != 1 || rejected[0].(map[string]any)["commands"] != "deploy" {
+		t.Errorf("full queue: rejected %v, want the deploy job", resp["rejected"])
+	}
+
+	// Without any job queued, the git host may send the push again
+	s = newGitPushServer([]config.GitPush{{Branch: "main", Commands: []string{"build"}}}, 0)
+	if rec, _ := postGitPush(t, s, githubPush, headers); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("nothing queued: got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,350 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	delivrv1 "github.com/ndious/delivr/api/delivr/v1"
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/history"
+)
+
+// jobPollInterval is the delay between two checks of whether the job whose
+// output is streamed finished
+const jobPollInterval = time.Second
+
+// grpcService implements the gRPC API on top of the server
+type grpcService struct {
+	delivrv1.UnimplementedDelivrServer
+	s *Server
+}
+
+// SetOutputFeed sets the feed of the command output streamed by the gRPC API
+func (s *Server) SetOutputFeed(feed *command.OutputFeed) {
+	s.feed = feed
+}
+
+// newGRPC creates the gRPC server when an address is configured
+func (s *Server) newGRPC() *grpc.Server {
+	if s.cfg.Server == nil || s.cfg.Server.GRPCAddress == "" {
+		return nil
+	}
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := s.authorizeGRPC(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authorizeGRPC(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	delivrv1.RegisterDelivrServer(server, &grpcService{s: s})
+	return server
+}
+
+// startGRPC starts the gRPC server in the background
+func (s *Server) startGRPC() error {
+	listener, err := net.Listen("tcp", s.cfg.Server.GRPCAddress)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("gRPC server listening on %s", listener.Addr())
+	go func() {
+		if err := s.grpc.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			log.Printf("gRPC server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// shutdownGRPC waits for the pending calls until ctx is done, then closes the
+// remaining connections
+func (s *Server) shutdownGRPC(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpc.Stop()
+	}
+}
+
+// authorizeGRPC rejects the calls that don't carry the configured token,
+// either as a bearer token in the "authorization" metadata or in the
+// metadata named after the token header
+func (s *Server) authorizeGRPC(ctx context.Context) error {
+	if s.cfg.Server.Token == "" {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	token := ""
+	if header := s.cfg.Server.TokenHeader; header != "" {
+		if values := md.Get(header); len(values) > 0 {
+			token = values[0]
+		}
+	} else if values := md.Get("authorization"); len(values) > 0 && strings.HasPrefix(values[0], "Bearer ") {
+		token = strings.TrimPrefix(values[0], "Bearer ")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Server.Token)) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid or missing token")
+	}
+	return nil
+}
+
+// peerAddress returns the address of the caller of a gRPC call
+func peerAddress(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return "unknown peer"
+}
+
+// Trigger queues a command or a pipeline
+func (g *grpcService) Trigger(ctx context.Context, req *delivrv1.TriggerRequest) (*delivrv1.TriggerResponse, error) {
+	s := g.s
+	from := peerAddress(ctx)
+	commands, err := s.cfg.ResolveCommands([]string{req.Command})
+	if err != nil {
+		s.reportRejected("gRPC Trigger", from, err.Error())
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	log.Printf("Received gRPC trigger for '%s' from %s", req.Command, from)
+	id, err := s.submitRun(req.Command, commands, command.Job{
+		Source:  "gRPC API",
+		Trigger: "grpc",
+		Force:   req.Force,
+		Params:  req.Params,
+	})
+	if err != nil {
+		return nil, submitStatus(err)
+	}
+	return &delivrv1.TriggerResponse{Id: id, Command: req.Command, State: s.jobState(id)}, nil
+}
+
+// submitStatus converts the error of a job submission to a gRPC status
+func submitStatus(err error) error {
+	switch {
+	case errors.Is(err, command.ErrInvalidParams):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, command.ErrOutsideWindow), errors.Is(err, command.ErrFrozen):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, command.ErrQueueFull), errors.Is(err, command.ErrQueuePaused), errors.Is(err, command.ErrQueueStopping), errors.Is(err, command.ErrApprovalUnavailable):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// Status reports the daemon status and the jobs of the queue
+func (g *grpcService) Status(ctx context.Context, _ *delivrv1.StatusRequest) (*delivrv1.StatusResponse, error) {
+	s := g.s
+	names := make([]string, 0, len(s.cfg.Commands))
+	for _, cmd := range s.cfg.Commands {
+		names = append(names, cmd.Name)
+	}
+
+	queue := s.queue.Status()
+	resp := &delivrv1.StatusResponse{
+		Version:    s.cfg.Version,
+		ConfigFile: s.cfg.Source(),
+		StartedAt:  timestamppb.New(s.startedAt),
+		Uptime:     durationpb.New(time.Since(s.startedAt).Round(time.Second)),
+		Commands:   names,
+		Queue:      &delivrv1.Queue{Paused: queue.Paused},
+	}
+	if queue.Running != nil {
+		resp.Queue.Running = jobMessage(*queue.Running)
+	}
+	for _, job := range queue.Queued {
+		resp.Queue.Queued = append(resp.Queue.Queued, jobMessage(job))
+	}
+	for _, job := range queue.Recent {
+		resp.Queue.Recent = append(resp.Queue.Recent, jobMessage(job))
+	}
+	return resp, nil
+}
+
+// jobMessage converts the status of a job to its gRPC message
+func jobMessage(job command.JobStatus) *delivrv1.Job {
+	return &delivrv1.Job{
+		Id:          job.ID,
+		Source:      job.Source,
+		Commands:    job.Commands,
+		State:       job.State,
+		SubmittedAt: timestamppb.New(job.SubmittedAt),
+		RunAfter:    timestampMessage(job.RunAfter),
+		StartedAt:   timestampMessage(job.StartedAt),
+		FinishedAt:  timestampMessage(job.FinishedAt),
+		Steps:       stepMessages(job.Steps),
+	}
+}
+
+// timestampMessage converts an optional time to its gRPC message
+func timestampMessage(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// stepMessages converts the steps of a job or a run to their gRPC messages
+func stepMessages(steps []history.Step) []*delivrv1.Step {
+	messages := make([]*delivrv1.Step, 0, len(steps))
+	for _, step := range steps {
+		messages = append(messages, &delivrv1.Step{
+			Name:      step.Name,
+			Status:    step.Status,
+			Duration:  durationpb.New(step.Duration),
+			Tolerated: step.Tolerated,
+		})
+	}
+	return messages
+}
+
+// History lists the recorded runs, most recent first
+func (g *grpcService) History(ctx context.Context, req *delivrv1.HistoryRequest) (*delivrv1.HistoryResponse, error) {
+	if g.s.history == nil {
+		return nil, status.Error(codes.FailedPrecondition, "history is disabled")
+	}
+	runs, err := g.s.history.List()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &delivrv1.HistoryResponse{}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if req.Limit > 0 && len(resp.Runs) >= int(req.Limit) {
+			break
+		}
+		run := runs[i]
+		if req.Command != "" && !ranCommand(run, req.Command) {
+			continue
+		}
+		resp.Runs = append(resp.Runs, &delivrv1.Run{
+			Id:          run.ID,
+			Source:      run.Source,
+			Trigger:     run.Trigger,
+			StartedAt:   timestamppb.New(run.StartedAt),
+			Duration:    durationpb.New(run.Duration),
+			Status:      run.Status,
+			Steps:       stepMessages(run.Steps),
+			Host:        run.Host,
+			Release:     run.Release,
+			Environment: run.Environment,
+			ReplayOf:    run.ReplayOf,
+		})
+	}
+	return resp, nil
+}
+
+// ranCommand reports whether a run was triggered for a command or pipeline,
+// or ran a command as one of its steps
+func ranCommand(run history.Run, name string) bool {
+	if slices.Contains(run.Commands, name) {
+		return true
+	}
+	for _, step := range run.Steps {
+		if step.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// StreamOutput sends the output of the commands as they write it, until the
+// streamed job finished, the call is cancelled or the server stops
+func (g *grpcService) StreamOutput(req *delivrv1.StreamOutputRequest, stream delivrv1.Delivr_StreamOutputServer) error {
+	s := g.s
+	if s.feed == nil {
+		return status.Error(codes.Unavailable, "output streaming is not available")
+	}
+
+	chunks, unsubscribe := s.feed.Subscribe()
+	defer unsubscribe()
+
+	// Subscribe before checking the job so that none of its output is missed
+	var poll <-chan time.Time
+	if req.JobId != "" {
+		if !pendingJob(s.queue.Status(), req.JobId) {
+			return status.Errorf(codes.NotFound, "no queued or running job '%s'", req.JobId)
+		}
+		ticker := time.NewTicker(jobPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case chunk := <-chunks:
+			if req.JobId != "" && chunk.Job != req.JobId {
+				continue
+			}
+			if err := stream.Send(&delivrv1.OutputChunk{JobId: chunk.Job, Command: chunk.Command, Data: chunk.Data}); err != nil {
+				return err
+			}
+		case <-poll:
+			if !pendingJob(s.queue.Status(), req.JobId) {
+				return sendPending(stream, chunks, req.JobId)
+			}
+		case <-stream.Context().Done():
+			return nil
+		case <-s.stopping:
+			return nil
+		}
+	}
+}
+
+// sendPending sends the chunks of a finished job still buffered
+func sendPending(stream delivrv1.Delivr_StreamOutputServer, chunks <-chan command.OutputChunk, id string) error {
+	for {
+		select {
+		case chunk := <-chunks:
+			if chunk.Job != id {
+				continue
+			}
+			if err := stream.Send(&delivrv1.OutputChunk{JobId: chunk.Job, Command: chunk.Command, Data: chunk.Data}); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// pendingJob reports whether a job is queued, waiting or running
+func pendingJob(queue command.QueueStatus, id string) bool {
+	if queue.Running != nil && queue.Running.ID == id {
+		return true
+	}
+	for _, job := range queue.Queued {
+		if job.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ndious/delivr/internal/command"
+)
+
+// watchtowerImagePattern extracts image names from Watchtower notifications,
+// e.g. "Found new nginx:latest image (sha256:...)"
+var watchtowerImagePattern = regexp.MustCompile(`Found new (\S+) image`)
+
+// imageUpdatePayload covers the JSON payloads sent by diun and by Watchtower
+// (through the shoutrrr generic webhook with the json template)
+type imageUpdatePayload struct {
+	// diun
+	Image  string `json:"image"`
+	Status string `json:"status"`
+	Digest string `json:"digest"`
+	// Watchtower
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// registryPayload covers the JSON payloads of the registry webhooks sent when
+// an image is pushed
+type registryPayload struct {
+	// Docker Hub
+	PushData *struct {
+		Tag string `json:"tag"`
+	} `json:"push_data"`
+	Repository *struct {
+		RepoName string `json:"repo_name"`
+	} `json:"repository"`
+	// Distribution registries (registry:2, Zot, ...)
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			Repository string `json:"repository"`
+			Tag        string `json:"tag"`
+		} `json:"target"`
+		Request struct {
+			Host string `json:"host"`
+		} `json:"request"`
+	} `json:"events"`
+	// Harbor
+	Type      string `json:"type"`
+	EventData *struct {
+		Resources []struct {
+			ResourceURL string `json:"resource_url"`
+		} `json:"resources"`
+	} `json:"event_data"`
+}
+
+// handleImageUpdate receives image update notifications and queues the
+// redeploy commands configured for the updated images. The jobs are all
+// resolved before any is queued. Once one is queued, the notification is
+// accepted even when the next ones are rejected, so that the registry
+// doesn't send it again and run the queued ones twice: the response lists
+// the rejected images.
+func (s *Server) handleImageUpdate(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+
+	images, err := parseImageUpdate(body)
+	if err != nil {
+		s.reportTrigger(r, "invalid image update notification: "+err.Error())
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	log.Printf("Received image update notification from %s for %v", r.RemoteAddr, images)
+
+	// jobs are the jobs of the updated images, and jobImages their images
+	var jobs []command.Job
+	var jobImages []string
+	for _, image := range images {
+		for _, update := range s.cfg.ImageUpdates {
+			if !matchImage(update.Image, image) {
+				continue
+			}
+
+			commands, err := s.cfg.ResolveCommands(update.Commands)
+			if err != nil {
+				s.reportTrigger(r, fmt.Sprintf("image update of %s: %v", image, err))
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			jobs = append(jobs, command.Job{
+				Source:    fmt.Sprintf("image update of %s", image),
+				Trigger:   "image-update",
+				Commands:  commands,
+				EnvVars:   imageEnv(image),
+				Preflight: s.cfg.Preflight,
+			})
+			jobImages = append(jobImages, image)
+		}
+	}
+
+	var queued []string
+	var rejected []map[string]string
+	for i, job := range jobs {
+		image := jobImages[i]
+		if _, err := s.queue.Submit(job); err != nil {
+			if len(queued) == 0 {
+				// Nothing was queued, the registry can send it again
+				writeSubmitError(w, err)
+				return
+			}
+			log.Printf("Warning: Could not queue the commands of image %s: %v", image, err)
+			s.reportTrigger(r, fmt.Sprintf("image update of %s: %v", image, err))
+			rejected = append(rejected, map[string]string{"image": image, "error": err.Error()})
+			continue
+		}
+		queued = append(queued, image)
+	}
+
+	if len(jobs) == 0 {
+		log.Printf("Ignoring image update notification for %v: no matching image", images)
+	}
+	resp := map[string]interface{}{
+		"images": images,
+		"queued": queued,
+	}
+	if len(rejected) > 0 {
+		resp["rejected"] = rejected
+	}
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// imageEnv returns the variables describing an updated image to the commands
+func imageEnv(image string) []string {
+	_, tag := splitTag(image)
+	if tag == "" {
+		tag = "latest"
+	}
+	return []string{"DELIVR_IMAGE=" + image, "DELIVR_IMAGE_TAG=" + tag}
+}
+
+// parseImageUpdate extracts the updated image names from a notification body
+func parseImageUpdate(body []byte) ([]string, error) {
+	if images, ok := parseRegistryPush(body); ok {
+		return images, nil
+	}
+
+	text := string(body)
+
+	var payload imageUpdatePayload
+	if err := json.Unmarshal(body, &payload); err == nil {
+		if payload.Image != "" {
+			// diun also notifies about unchanged images
+			if payload.Status != "" && payload.Status != "new" && payload.Status != "update" {
+				return nil, nil
+			}
+			return []string{payload.Image}, nil
+		}
+		text = payload.Title + "\n" + payload.Message
+	}
+
+	var images []string
+	for _, match := range watchtowerImagePattern.FindAllStringSubmatch(text, -1) {
+		images = append(images, match[1])
+	}
+	if len(images) == 0 && strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("empty notification")
+	}
+	return images, nil
+}
+
+// parseRegistryPush extracts the pushed images from a registry webhook, and
+// reports whether the body is one. Pushes without tag, e.g. by digest, are
+// ignored.
+func parseRegistryPush(body []byte) ([]string, bool) {
+	var payload registryPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, false
+	}
+
+	switch {
+	case payload.PushData != nil && payload.Repository != nil:
+		if payload.PushData.Tag == "" || payload.Repository.RepoName == "" {
+			return nil, true
+		}
+		return []string{payload.Repository.RepoName + ":" + payload.PushData.Tag}, true
+	case len(payload.Events) > 0:
+		var images []string
+		for _, event := range payload.Events {
+			if event.Action != "push" || event.Target.Tag == "" || event.Target.Repository == "" {
+				continue
+			}
+			image := event.Target.Repository + ":" + event.Target.Tag
+			if event.Request.Host != "" {
+				image = event.Request.Host + "/" + image
+			}
+			if !slices.Contains(images, image) {
+				images = append(images, image)
+			}
+		}
+		return images, true
+	case payload.EventData != nil:
+		if payload.Type != "PUSH_ARTIFACT" {
+			return nil, true
+		}
+		var images []string
+		for _, resource := range payload.EventData.Resources {
+			if _, tag := splitTag(resource.ResourceURL); tag != "" {
+				images = append(images, resource.ResourceURL)
+			}
+		}
+		return images, true
+	}
+	return nil, false
+}
+
+// normalizeImage removes the implicit Docker Hub registry prefixes so that
+// "nginx" and "docker.io/library/nginx" are considered equal
+func normalizeImage(image string) string {
+	for _, prefix := range []string{"index.docker.io/", "registry-1.docker.io/", "docker.io/"} {
+		image = strings.TrimPrefix(image, prefix)
+	}
+	return strings.TrimPrefix(image, "library/")
+}
+
+// splitTag splits an image reference into its name and tag
+func splitTag(image string) (string, string) {
+	image, _, _ = strings.Cut(image, "@")
+	slash := strings.LastIndex(image, "/")
+	if colon := strings.LastIndex(image, ":"); colon > slash {
+		return image[:colon], image[colon+1:]
+	}
+	return image, ""
+}
+
+// matchImage reports whether an image reference matches a configured pattern.
+// A pattern without a tag matches every tag of the image.
+func matchImage(pattern, image string) bool {
+	patternName, patternTag := splitTag(normalizeImage(pattern))
+	imageName, imageTag := splitTag(normalizeImage(image))
+	if imageTag == "" {
+		imageTag = "latest"
+	}
+
+	if ok, _ := path.Match(patternName, imageName); !ok {
+		return false
+	}
+	if patternTag == "" {
+		return true
+	}
+	ok, _ := path.Match(patternTag, imageTag)
+	return ok
+}
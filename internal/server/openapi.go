@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ndious/delivr/api"
+)
+
+// handleOpenAPI serves the OpenAPI document of the HTTP API with the
+// configured paths of the endpoints
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc, err := s.openAPI()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// openAPI returns the OpenAPI document with the default paths of the
+// endpoints replaced by the configured ones
+func (s *Server) openAPI() (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(api.OpenAPI, &doc); err != nil {
+		return nil, err
+	}
+
+	paths, _ := doc["paths"].(map[string]interface{})
+	configured := make(map[string]interface{}, len(paths))
+	for path, item := range paths {
+		configured[s.endpointPath(path)] = item
+	}
+	doc["paths"] = configured
+	return doc, nil
+}
+
+// endpointPath converts a path with the default path of an endpoint as
+// prefix, e.g. "/run/{command}", to its configured path
+func (s *Server) endpointPath(path string) string {
+	for name, defaultPath := range defaultPaths {
+		if rest, ok := strings.CutPrefix(path, defaultPath); ok && (rest == "" || strings.HasPrefix(rest, "/")) {
+			return s.paths[name] + rest
+		}
+	}
+	return path
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/i18n"
+)
+
+// errUnknownRun is returned when replaying a run that isn't in the history
+var errUnknownRun = errors.New("unknown run")
+
+// errNotReplayable is returned when the input of a run can't be replayed
+var errNotReplayable = errors.New("run can't be replayed")
+
+// replayResponse is the body of the response of POST /replay/{run}
+type replayResponse struct {
+	ID       string   `json:"id"`
+	ReplayOf string   `json:"replayOf"`
+	Commands []string `json:"commands"`
+	State    string   `json:"state"`
+	// Warning is set when the configuration changed since the replayed run
+	Warning string `json:"warning,omitempty"`
+}
+
+// handleReplay queues the commands of a recorded run again, with the
+// variables its trigger provided
+func (s *Server) handleReplay(w http.ResponseWriter, r *http.Request) {
+	// force=true overrides the freeze periods
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+
+	resp, err := s.replay(r.PathValue("run"), r.RemoteAddr, force)
+	switch {
+	case errors.Is(err, errUnknownRun):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errNotReplayable):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeSubmitError(w, err)
+	default:
+		writeJSON(w, http.StatusAccepted, resp)
+	}
+}
+
+// replay submits a job replaying the run with the given ID. The commands are
+// those of the current configuration, so the response warns when it changed
+// since the run.
+func (s *Server) replay(id, by string, force bool) (replayResponse, error) {
+	if s.history == nil {
+		return replayResponse{}, fmt.Errorf("%w: history is disabled", errNotReplayable)
+	}
+	run, ok, err := s.history.Find(id)
+	if err != nil {
+		return replayResponse{}, err
+	}
+	if !ok {
+		return replayResponse{}, fmt.Errorf("%w '%s'", errUnknownRun, id)
+	}
+	if len(run.Commands) == 0 {
+		return replayResponse{}, fmt.Errorf("%w: run %s doesn't record its commands", errNotReplayable, id)
+	}
+	if run.Release != "" {
+		return replayResponse{}, fmt.Errorf("%w: run %s is a stage of release %s, start a new release instead", errNotReplayable, id, run.Release)
+	}
+
+	commands := make([]config.Command, 0, len(run.Commands))
+	for _, name := range run.Commands {
+		cmd, ok := s.cfg.FindCommand(name)
+		if !ok {
+			return replayResponse{}, fmt.Errorf("%w: command '%s' is no longer configured", errNotReplayable, name)
+		}
+		commands = append(commands, cmd)
+	}
+
+	resp := replayResponse{ReplayOf: id, Commands: run.Commands, State: command.JobQueued}
+	if run.ConfigHash != "" && run.ConfigHash != s.cfg.Hash() {
+		resp.Warning = "the configuration changed since the run, the commands are replayed as currently configured"
+	}
+
+	log.Printf("Received replay request for run %s from %s", id, by)
+	resp.ID, err = s.queue.Submit(command.Job{
+		Source:    fmt.Sprintf("replay of run %s", id),
+		Trigger:   "replay",
+		Commands:  commands,
+		EnvVars:   run.EnvVars,
+		Params:    run.Params,
+		Preflight: s.cfg.Preflight,
+		Force:     force,
+		ReplayOf:  id,
+	})
+	if err != nil {
+		return replayResponse{}, err
+	}
+
+	msg := i18n.T("🔁 Replaying run **%s** (%s) requested by %s", id, strings.Join(run.Commands, ", "), by)
+	if resp.Warning != "" {
+		msg += "\n⚠️ " + strings.ToUpper(resp.Warning[:1]) + resp.Warning[1:]
+	}
+	if err := s.notify.SendMessage(msg); err != nil {
+		log.Printf("Warning: Could not send replay message: %v", err)
+	}
+	return resp, nil
+}
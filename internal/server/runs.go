@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ndious/delivr/internal/history"
+)
+
+// defaultRunsLimit is the number of runs listed when the request sets none
+const defaultRunsLimit = 50
+
+// runResponse is a run of the history as returned by the runs endpoints
+type runResponse struct {
+	history.Run
+	EndedAt time.Time `json:"endedAt"`
+}
+
+// runsResponse is the body of the response of GET /runs
+type runsResponse struct {
+	Runs []runResponse `json:"runs"`
+}
+
+// handleRuns lists the runs of the history, most recent first, selected by
+// the command, status, trigger, since and limit query parameters
+func (s *Server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	if s.history == nil {
+		writeError(w, http.StatusNotFound, "history is disabled")
+		return
+	}
+	query, err := runsQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	runs, err := s.history.Query(query)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := runsResponse{Runs: make([]runResponse, 0, len(runs))}
+	for _, run := range runs {
+		resp.Runs = append(resp.Runs, runResponse{Run: run, EndedAt: run.EndedAt()})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRunDetail returns a run of the history by ID
+func (s *Server) handleRunDetail(w http.ResponseWriter, r *http.Request) {
+	if s.history == nil {
+		writeError(w, http.StatusNotFound, "history is disabled")
+		return
+	}
+	id := r.PathValue("run")
+	run, ok, err := s.history.Find(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%v '%s'", errUnknownRun, id))
+		return
+	}
+	writeJSON(w, http.StatusOK, runResponse{Run: run, EndedAt: run.EndedAt()})
+}
+
+// runsQuery returns the history query of the parameters of a request
+func runsQuery(r *http.Request) (history.Query, error) {
+	params := r.URL.Query()
+	query := history.Query{
+		Command: params.Get("command"),
+		Status:  params.Get("status"),
+		Trigger: params.Get("trigger"),
+		Limit:   defaultRunsLimit,
+	}
+	if value := params.Get("since"); value != "" {
+		since, err := history.ParseSince(value, time.Now())
+		if err != nil {
+			return query, err
+		}
+		query.Since = since
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return query, fmt.Errorf("invalid limit '%s', must be a positive number", value)
+		}
+		query.Limit = limit
+	}
+	return query, nil
+}
@@ -0,0 +1,307 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/discord"
+	"github.com/ndious/delivr/internal/history"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/notifier"
+	"github.com/ndious/delivr/internal/tagging"
+	"github.com/ndious/delivr/internal/workflow"
+)
+
+// DefaultAddress is used when no listen address is configured
+const DefaultAddress = "127.0.0.1:8080"
+
+// defaultPaths are the paths of the endpoints, by endpoint name
+var defaultPaths = map[string]string{
+	"run":                 "/run",
+	"status":              "/status",
+	"metrics":             "/metrics",
+	"pause":               "/pause",
+	"resume":              "/resume",
+	"adhoc":               "/adhoc",
+	"imageUpdate":         "/hooks/image-update",
+	"gitPush":             "/hooks/git",
+	"discordInteractions": "/discord/interactions",
+	"workflows":           "/workflows",
+	"approve":             "/approve",
+	"reject":              "/reject",
+	"replay":              "/replay",
+	"runs":                "/runs",
+	"jobs":                "/jobs",
+	"openapi":             "/openapi.json",
+	"dashboard":           "/dashboard",
+}
+
+// Server is the HTTP server started in daemon mode to receive triggers
+type Server struct {
+	cfg       *config.Config
+	queue     *command.Queue
+	history   *history.Store
+	notify    notifier.Notifier
+	workflows *workflow.Manager
+	tagger    *tagging.Tagger
+	// bot posts the approval requests when the Discord interactions are
+	// enabled
+	bot       *discord.Bot
+	http      *http.Server
+	startedAt time.Time
+	// paths are the configured paths of the endpoints, by endpoint name
+	paths map[string]string
+	// grpc serves the gRPC API when configured. It and the HTTP streams send
+	// the output of feed until stopping is closed
+	grpc     *grpc.Server
+	feed     *command.OutputFeed
+	stopping chan struct{}
+}
+
+// New creates a new server for the given configuration. Triggers that can't
+// be mapped to commands are reported to notify.
+func New(cfg *config.Config, queue *command.Queue, store *history.Store, notify notifier.Notifier) (*Server, error) {
+	s := &Server{
+		cfg:       cfg,
+		queue:     queue,
+		history:   store,
+		notify:    notify,
+		startedAt: time.Now(),
+		stopping:  make(chan struct{}),
+	}
+
+	address := DefaultAddress
+	if cfg.Server != nil && cfg.Server.Address != "" {
+		address = cfg.Server.Address
+	}
+
+	paths, err := endpointPaths(cfg.Server)
+	if err != nil {
+		return nil, err
+	}
+	s.paths = paths
+
+	if bot := cfg.Discord.Bot; bot != nil && bot.PublicKey != "" {
+		if s.bot, err = discord.NewBot(bot.Token); err != nil {
+			return nil, err
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+paths["run"]+"/{command}", s.authorize(s.handleRun))
+	mux.HandleFunc("GET "+paths["status"], s.authorize(s.handleStatus))
+	mux.HandleFunc("GET "+paths["metrics"], s.authorize(s.handleMetrics))
+	mux.HandleFunc("POST "+paths["pause"], s.authorize(s.handlePause))
+	mux.HandleFunc("POST "+paths["resume"], s.authorize(s.handleResume))
+	mux.HandleFunc("POST "+paths["adhoc"], s.authorizeAdmin(s.handleAdhoc))
+	mux.HandleFunc("POST "+paths["imageUpdate"], s.authorize(s.handleImageUpdate))
+	mux.HandleFunc("POST "+paths["workflows"]+"/{workflow}", s.authorize(s.handleWorkflow))
+	mux.HandleFunc("POST "+paths["approve"]+"/{release}", s.authorize(s.handleApprove))
+	mux.HandleFunc("POST "+paths["reject"]+"/{release}", s.authorize(s.handleReject))
+	mux.HandleFunc("POST "+paths["replay"]+"/{run}", s.authorize(s.handleReplay))
+	mux.HandleFunc("GET "+paths["runs"], s.authorize(s.handleRuns))
+	mux.HandleFunc("GET "+paths["runs"]+"/{run}", s.authorize(s.handleRunDetail))
+	mux.HandleFunc("GET "+paths["jobs"]+"/{job}/stream", s.authorize(s.handleJobStream))
+	// The stream was first served with the runs, for the same jobs
+	mux.HandleFunc("GET "+paths["runs"]+"/{run}/stream", s.authorize(s.handleJobStream))
+	mux.HandleFunc("GET "+paths["openapi"], s.authorize(s.handleOpenAPI))
+	if cfg.Server != nil && cfg.Server.Dashboard {
+		// The page itself holds no data, it asks for the token
+		mux.HandleFunc("GET "+paths["dashboard"], s.handleDashboard)
+		mux.HandleFunc("GET "+paths["dashboard"]+"/state", s.authorize(s.handleDashboardState))
+		mux.HandleFunc("GET "+paths["dashboard"]+"/output", s.authorize(s.handleDashboardOutput))
+	}
+	// Git webhooks are authenticated by their secret when one is configured
+	mux.HandleFunc("POST "+paths["gitPush"], s.handleGitPush)
+	// Interactions are authenticated by their Discord signature instead of the token
+	mux.HandleFunc("POST "+paths["discordInteractions"], s.handleInteraction)
+
+	s.http = &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.grpc = s.newGRPC()
+	return s, nil
+}
+
+// SetWorkflows sets the manager of the releases started and approved through
+// the server
+func (s *Server) SetWorkflows(workflows *workflow.Manager) {
+	s.workflows = workflows
+}
+
+// SetTagger sets the tagger called once a pipeline run through the server
+// succeeded
+func (s *Server) SetTagger(tagger *tagging.Tagger) {
+	s.tagger = tagger
+}
+
+// endpointPaths returns the paths of the endpoints with the configured
+// overrides and base path applied
+func endpointPaths(cfg *config.ServerConfig) (map[string]string, error) {
+	paths := make(map[string]string, len(defaultPaths))
+	for name, path := range defaultPaths {
+		paths[name] = path
+	}
+
+	basePath := ""
+	if cfg != nil {
+		for name, path := range cfg.Paths {
+			if _, ok := defaultPaths[name]; !ok {
+				return nil, fmt.Errorf("unknown endpoint '%s' in server paths", name)
+			}
+			paths[name] = cleanPath(path)
+		}
+		basePath = cleanPath(cfg.BasePath)
+	}
+
+	for name, path := range paths {
+		if path == "" {
+			return nil, fmt.Errorf("empty path for endpoint '%s'", name)
+		}
+		paths[name] = basePath + path
+	}
+	return paths, nil
+}
+
+// EndpointPath returns the path of an endpoint of the server configured in cfg
+func EndpointPath(cfg *config.ServerConfig, name string) (string, error) {
+	paths, err := endpointPaths(cfg)
+	if err != nil {
+		return "", err
+	}
+	path, ok := paths[name]
+	if !ok {
+		return "", fmt.Errorf("unknown endpoint '%s'", name)
+	}
+	return path, nil
+}
+
+// cleanPath adds the leading slash of a path and removes its trailing slash
+func cleanPath(path string) string {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
+// Start starts listening in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("HTTP server listening on %s", listener.Addr())
+	go func() {
+		if err := s.http.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP server error: %v", err)
+		}
+	}()
+
+	if s.grpc != nil {
+		if err := s.startGRPC(); err != nil {
+			s.http.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown gracefully stops the server, ending the output streams first
+func (s *Server) Shutdown(ctx context.Context) error {
+	close(s.stopping)
+	if s.grpc != nil {
+		s.shutdownGRPC(ctx)
+	}
+	return s.http.Shutdown(ctx)
+}
+
+// authorize rejects requests that don't carry the configured token, either
+// as a bearer token or as a "token" query parameter
+func (s *Server) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.Server == nil || s.cfg.Server.Token == "" {
+			next(w, r)
+			return
+		}
+
+		if !s.checkToken(r, s.cfg.Server.Token) {
+			writeError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// authorizeAdmin rejects requests that don't carry the admin token, passed
+// like the regular token. Admin endpoints are disabled without admin token.
+func (s *Server) authorizeAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.Server == nil || s.cfg.Server.AdminToken == "" {
+			writeError(w, http.StatusForbidden, "no admin token configured")
+			return
+		}
+		if !s.checkToken(r, s.cfg.Server.AdminToken) {
+			writeError(w, http.StatusUnauthorized, "invalid or missing admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// checkToken reports whether a request carries the expected token
+func (s *Server) checkToken(r *http.Request, expected string) bool {
+	token := r.URL.Query().Get("token")
+	if header := s.cfg.Server.TokenHeader; header != "" {
+		if value := r.Header.Get(header); value != "" {
+			token = value
+		}
+	} else if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write HTTP response: %v", err)
+	}
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// reportTrigger notifies that a trigger was rejected, since its sender
+// usually doesn't show the response to anybody
+func (s *Server) reportTrigger(r *http.Request, msg string) {
+	s.reportRejected(r.URL.Path, r.RemoteAddr, msg)
+}
+
+// reportRejected notifies that a trigger received on endpoint from the given
+// address was rejected
+func (s *Server) reportRejected(endpoint, from, msg string) {
+	log.Printf("Rejected trigger from %s: %s", from, msg)
+	if err := s.notify.SendMessage(i18n.T("⚠️ Rejected trigger on `%s` from %s: %s", endpoint, from, msg)); err != nil {
+		log.Printf("Warning: Could not send rejected trigger message: %v", err)
+	}
+}
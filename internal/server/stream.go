@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ndious/delivr/internal/command"
+)
+
+// streamKeepAlive is the interval of the comments keeping the event streams
+// open through proxies
+const streamKeepAlive = 15 * time.Second
+
+// eventStream writes server-sent events to a response
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// newEventStream starts a stream of server-sent events, reporting false when
+// the response can't be streamed
+func newEventStream(w http.ResponseWriter) (*eventStream, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stop nginx from buffering the events
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &eventStream{w: w, flusher: flusher}, true
+}
+
+// send writes an event whose data is v encoded in JSON
+func (e *eventStream) send(event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	e.flusher.Flush()
+	return nil
+}
+
+// keepAlive writes a comment, ignored by the clients
+func (e *eventStream) keepAlive() error {
+	if _, err := fmt.Fprint(e.w, ": keep-alive\n\n"); err != nil {
+		return err
+	}
+	e.flusher.Flush()
+	return nil
+}
+
+// outputEvent is the data of the output events
+type outputEvent struct {
+	Job     string `json:"job,omitempty"`
+	Command string `json:"command"`
+	Data    string `json:"data"`
+}
+
+// newOutputEvent returns the output event of a chunk of output
+func newOutputEvent(chunk command.OutputChunk) outputEvent {
+	return outputEvent{Job: chunk.Job, Command: chunk.Command, Data: string(chunk.Data)}
+}
+
+// handleJobStream streams the output of a queued or running job as
+// server-sent events: output events while its commands run, then an end
+// event with the final state of the job. A finished job only gets its end
+// event. The job is the one returned by the triggers, not a run of the
+// history, under /jobs or /runs.
+func (s *Server) handleJobStream(w http.ResponseWriter, r *http.Request) {
+	if s.feed == nil {
+		writeError(w, http.StatusServiceUnavailable, "output streaming is not available")
+		return
+	}
+	id := r.PathValue("job")
+	if id == "" {
+		id = r.PathValue("run")
+	}
+
+	// Subscribe before checking the job so that none of its output is missed
+	chunks, unsubscribe := s.feed.Subscribe()
+	defer unsubscribe()
+	job, ok := findJob(s.queue.Status(), id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no queued, running or recently finished job '%s'", id))
+		return
+	}
+	stream, ok := newEventStream(w)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	poll := time.NewTicker(jobPollInterval)
+	defer poll.Stop()
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for done := !pendingJob(s.queue.Status(), id); !done; {
+		var err error
+		select {
+		case chunk := <-chunks:
+			if chunk.Job == id {
+				err = stream.send("output", newOutputEvent(chunk))
+			}
+		case <-poll.C:
+			done = !pendingJob(s.queue.Status(), id)
+		case <-keepAlive.C:
+			err = stream.keepAlive()
+		case <-r.Context().Done():
+			return
+		case <-s.stopping:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	// Send the output written since the last poll, then the outcome
+	for pending := true; pending; {
+		select {
+		case chunk := <-chunks:
+			if chunk.Job == id && stream.send("output", newOutputEvent(chunk)) != nil {
+				return
+			}
+		default:
+			pending = false
+		}
+	}
+	if finished, ok := findJob(s.queue.Status(), id); ok {
+		job = finished
+	}
+	stream.send("end", job)
+}
+
+// findJob returns the job with the given ID among the queued, running and
+// recently finished ones
+func findJob(queue command.QueueStatus, id string) (command.JobStatus, bool) {
+	if queue.Running != nil && queue.Running.ID == id {
+		return *queue.Running, true
+	}
+	for _, jobs := range [][]command.JobStatus{queue.Queued, queue.Recent} {
+		for _, job := range jobs {
+			if job.ID == id {
+				return job, true
+			}
+		}
+	}
+	return command.JobStatus{}, false
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/workflow"
+)
+
+// DecisionRequest is the optional body of the approve and reject endpoints
+type DecisionRequest struct {
+	// By identifies who decided in the notifications
+	By string `json:"by,omitempty"`
+}
+
+// handleWorkflow starts a release of the workflow named in the path
+func (s *Server) handleWorkflow(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("workflow")
+
+	// force=true overrides the freeze periods for every stage
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+
+	log.Printf("Received release request for workflow '%s' from %s", name, r.RemoteAddr)
+	release, err := s.workflows.Start(name, "HTTP API", force)
+	if errors.Is(err, workflow.ErrUnknownWorkflow) {
+		s.reportTrigger(r, "unknown workflow '"+name+"'")
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeSubmitError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, release)
+}
+
+// handleApprove runs the stage a release is waiting for
+func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
+	s.handleDecision(w, r, s.workflows.Approve)
+}
+
+// handleReject ends a release waiting for an approval
+func (s *Server) handleReject(w http.ResponseWriter, r *http.Request) {
+	s.handleDecision(w, r, s.workflows.Reject)
+}
+
+// handleDecision applies an approval decision to the release named in the path
+func (s *Server) handleDecision(w http.ResponseWriter, r *http.Request, decide func(id, by string) (workflow.Release, error)) {
+	var req DecisionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+			return
+		}
+	}
+	by := req.By
+	if by == "" {
+		by = r.RemoteAddr
+	}
+
+	release, err := decide(r.PathValue("release"), by)
+	switch {
+	case errors.Is(err, workflow.ErrUnknownRelease):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, workflow.ErrNotAwaitingApproval):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeSubmitError(w, err)
+	default:
+		writeJSON(w, http.StatusOK, release)
+	}
+}
+
+// writeSubmitError writes the response of a job the queue didn't accept
+func writeSubmitError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, command.ErrOutsideWindow):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, command.ErrFrozen):
+		writeError(w, http.StatusLocked, err.Error())
+	case errors.Is(err, command.ErrInvalidParams):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, command.ErrQueueFull), errors.Is(err, command.ErrQueuePaused), errors.Is(err, command.ErrQueueStopping), errors.Is(err, command.ErrApprovalUnavailable):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
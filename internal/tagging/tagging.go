@@ -0,0 +1,233 @@
+// Package tagging records successful deployments in git: it creates an
+// annotated tag with the changelog since the previous tag, pushes it, and
+// optionally publishes a GitHub release.
+package tagging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/notifier"
+)
+
+// maxChangelog is the maximum number of commits listed in a changelog
+const maxChangelog = 100
+
+// notifiedChangelog is the maximum number of commits listed in notifications
+const notifiedChangelog = 20
+
+// githubAPI is the base URL of the GitHub REST API
+const githubAPI = "https://api.github.com"
+
+// Tagger tags the repository after the pipelines and workflows configured
+type Tagger struct {
+	cfg    config.TaggingConfig
+	notify notifier.Notifier
+	client *http.Client
+}
+
+// Tag describes a created tag
+type Tag struct {
+	Name      string
+	Version   string
+	Changelog string
+	// URL is the URL of the GitHub release, if any
+	URL string
+}
+
+// New creates a tagger for the tagging settings of the configuration. It
+// returns nil when tagging isn't configured.
+func New(c *config.Config, notify notifier.Notifier) (*Tagger, error) {
+	cfg := c.Tagging
+	if cfg == nil {
+		return nil, nil
+	}
+	if len(cfg.After) == 0 {
+		return nil, errors.New("after must list at least one pipeline or workflow")
+	}
+	for _, name := range cfg.After {
+		_, pipeline := c.Pipelines[name]
+		_, command := c.FindCommand(name)
+		command = command || c.OnOtherHost(name)
+		workflow := slices.ContainsFunc(c.Workflows, func(w config.Workflow) bool { return w.Name == name })
+		if !pipeline && !command && !workflow {
+			return nil, fmt.Errorf("unknown pipeline or workflow '%s' in after", name)
+		}
+	}
+	if cfg.GitHub != nil {
+		if !cfg.Push {
+			return nil, errors.New("github releases require push, since the tag must exist on GitHub")
+		}
+		if owner, name, ok := strings.Cut(cfg.GitHub.Repository, "/"); !ok || owner == "" || name == "" {
+			return nil, fmt.Errorf("invalid github repository '%s', must be owner/name", cfg.GitHub.Repository)
+		}
+		if cfg.GitHub.Token == "" {
+			return nil, errors.New("github token is required")
+		}
+	}
+
+	t := &Tagger{cfg: *cfg, notify: notify, client: &http.Client{Timeout: 30 * time.Second}}
+	if t.cfg.Dir == "" {
+		t.cfg.Dir = c.WorkingDir
+	}
+	if t.cfg.Name == "" {
+		t.cfg.Name = "deploy-{date}-{time}"
+	}
+	if t.cfg.Remote == "" {
+		t.cfg.Remote = "origin"
+	}
+	return t, nil
+}
+
+// After tags the repository if name is one of the pipelines or workflows to
+// tag, and notifies the tag or the failure. It's a no-op on a nil tagger.
+func (t *Tagger) After(name string) {
+	if t == nil || !slices.Contains(t.cfg.After, name) {
+		return
+	}
+
+	tag, err := t.Create(time.Now())
+	if err != nil {
+		log.Printf("Failed to tag the deployment of %s: %v", name, err)
+		t.send(i18n.T("⚠️ Could not tag the deployment of **%s**: %v", name, err))
+		return
+	}
+
+	log.Printf("Tagged the deployment of %s as %s", name, tag.Name)
+	msg := i18n.T("🏷️ Deployment of **%s** tagged **%s**", name, tag.Name)
+	if tag.URL != "" {
+		msg += "\n" + tag.URL
+	}
+	if changes := strings.Split(tag.Changelog, "\n"); tag.Changelog != "" {
+		if len(changes) > notifiedChangelog {
+			changes = append(changes[:notifiedChangelog], i18n.T("… and %d more", len(changes)-notifiedChangelog))
+		}
+		msg += "\n" + strings.Join(changes, "\n")
+	}
+	t.send(msg)
+}
+
+// Create tags HEAD with the changelog since the previous tag, pushes the tag
+// and creates the GitHub release when configured
+func (t *Tagger) Create(now time.Time) (Tag, error) {
+	version := t.cfg.Version
+	if version == "" {
+		head, err := t.git("rev-parse", "--short", "HEAD")
+		if err != nil {
+			return Tag{}, err
+		}
+		version = head
+	}
+	tag := Tag{
+		Name: strings.NewReplacer(
+			"{version}", version,
+			"{date}", now.Format("20060102"),
+			"{time}", now.Format("150405"),
+		).Replace(t.cfg.Name),
+		Version: version,
+	}
+
+	if _, err := t.git("rev-parse", "--verify", "--quiet", "refs/tags/"+tag.Name); err == nil {
+		return Tag{}, fmt.Errorf("tag %s already exists", tag.Name)
+	}
+
+	// List the commits since the previous tag, or the last ones without tag
+	logArgs := []string{"log", "--no-merges", fmt.Sprintf("--max-count=%d", maxChangelog), "--pretty=format:- %s (%h)"}
+	if previous, err := t.git("describe", "--tags", "--abbrev=0", "HEAD"); err == nil {
+		logArgs = append(logArgs, previous+"..HEAD")
+	}
+	changelog, err := t.git(logArgs...)
+	if err != nil {
+		return Tag{}, err
+	}
+	tag.Changelog = changelog
+
+	message := fmt.Sprintf("Deployed %s\n\n%s", version, changelog)
+	if _, err := t.git("tag", "--annotate", tag.Name, "--message", message); err != nil {
+		return Tag{}, err
+	}
+	if !t.cfg.Push {
+		return tag, nil
+	}
+	if _, err := t.git("push", t.cfg.Remote, "refs/tags/"+tag.Name); err != nil {
+		return tag, err
+	}
+
+	if t.cfg.GitHub != nil {
+		url, err := t.githubRelease(tag)
+		if err != nil {
+			return tag, err
+		}
+		tag.URL = url
+	}
+	return tag, nil
+}
+
+// git runs a git command in the repository and returns its trimmed output
+func (t *Tagger) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = t.cfg.Dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// githubRelease publishes a release of the tag and returns its URL
+func (t *Tagger) githubRelease(tag Tag) (string, error) {
+	payload, err := json.Marshal(map[string]string{
+		"tag_name": tag.Name,
+		"name":     tag.Name,
+		"body":     tag.Changelog,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, githubAPI+"/repos/"+t.cfg.GitHub.Repository+"/releases", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+t.cfg.GitHub.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to create the GitHub release: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var release struct {
+		HTMLURL string `json:"html_url"`
+		Message string `json:"message"`
+	}
+	json.NewDecoder(resp.Body).Decode(&release)
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("failed to create the GitHub release: HTTP %d %s", resp.StatusCode, release.Message)
+	}
+	return release.HTMLURL, nil
+}
+
+// send notifies a message about a tag
+func (t *Tagger) send(msg string) {
+	if err := t.notify.SendMessage(msg); err != nil {
+		log.Printf("Warning: Could not send tagging message: %v", err)
+	}
+}
@@ -0,0 +1,284 @@
+// Package watch triggers commands when files or directories change
+package watch
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/config"
+)
+
+// DefaultDebounce is the quiet period after the last change before the
+// commands run, when none is configured
+const DefaultDebounce = 2 * time.Second
+
+// Submitter queues the jobs of the watches
+type Submitter interface {
+	Submit(job command.Job) (string, error)
+}
+
+// watch is a set of paths whose changes run commands
+type watch struct {
+	paths    []string
+	commands []config.Command
+	debounce time.Duration
+
+	// changed are the files changed since the last run, and timer runs the
+	// commands once the changes stopped for the debounce period
+	mu      sync.Mutex
+	changed map[string]bool
+	timer   *time.Timer
+	// pending counts the runs scheduled by timer and not yet completed
+	pending sync.WaitGroup
+}
+
+// Watcher runs the commands of the watches when their paths change
+type Watcher struct {
+	watches    []*watch
+	workingDir string
+	preflight  *config.PreflightConfig
+}
+
+// New validates the watches of the configuration. Relative paths are
+// relative to the working directory.
+func New(cfg *config.Config) (*Watcher, error) {
+	w := &Watcher{workingDir: cfg.WorkingDir, preflight: cfg.Preflight}
+	for i, wc := range cfg.Watch {
+		if len(wc.Paths) == 0 {
+			return nil, fmt.Errorf("watch %d: no paths", i+1)
+		}
+		if len(wc.Commands) == 0 {
+			return nil, fmt.Errorf("watch %d: no commands", i+1)
+		}
+		commands, err := cfg.ResolveCommands(wc.Commands)
+		if err != nil {
+			return nil, fmt.Errorf("watch %d: %w", i+1, err)
+		}
+		if wc.Debounce < 0 {
+			return nil, fmt.Errorf("watch %d: negative debounce %s", i+1, wc.Debounce)
+		}
+
+		ww := &watch{commands: commands, debounce: wc.Debounce.Std(), changed: make(map[string]bool)}
+		if ww.debounce == 0 {
+			ww.debounce = DefaultDebounce
+		}
+		for _, p := range wc.Paths {
+			if p == "" {
+				return nil, fmt.Errorf("watch %d: empty path", i+1)
+			}
+			if !filepath.IsAbs(p) && cfg.WorkingDir != "" {
+				p = filepath.Join(cfg.WorkingDir, p)
+			}
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return nil, fmt.Errorf("watch %d: %w", i+1, err)
+			}
+			ww.paths = append(ww.paths, abs)
+		}
+		w.watches = append(w.watches, ww)
+	}
+	return w, nil
+}
+
+// Empty reports whether no watch is configured
+func (w *Watcher) Empty() bool {
+	return len(w.watches) == 0
+}
+
+// Run watches the paths until stop is closed, submitting the commands of a
+// watch to the queue once its paths stopped changing for its debounce period.
+// Once stopped, Run returns after the runs already started completed, so
+// that no job is submitted afterwards.
+func (w *Watcher) Run(queue Submitter, stop <-chan struct{}) error {
+	if w.Empty() {
+		return nil
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsw.Close()
+
+	for _, ww := range w.watches {
+		for _, p := range ww.paths {
+			if err := add(fsw, p); err != nil {
+				return err
+			}
+		}
+	}
+	log.Printf("Watching %d paths for changes", len(fsw.WatchList()))
+
+	for {
+		select {
+		case <-stop:
+			for _, ww := range w.watches {
+				ww.stop()
+			}
+			for _, ww := range w.watches {
+				ww.pending.Wait()
+			}
+			return nil
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			// Only the attributes changed
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			// Watch the directories created in a watched directory as well
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() && w.watched(event.Name) {
+					if err := add(fsw, event.Name); err != nil {
+						log.Printf("Warning: Could not watch %s: %v", event.Name, err)
+					}
+				}
+			}
+			for _, ww := range w.watches {
+				if ww.matches(event.Name) {
+					ww.change(event.Name, func(changed []string) { w.submit(queue, ww, changed) })
+				}
+			}
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("Warning: File watcher error: %v", err)
+		}
+	}
+}
+
+// add watches a directory with its subdirectories, or the directory of a
+// file so that the file is still watched when it's replaced or created
+func add(fsw *fsnotify.Watcher, p string) error {
+	info, err := os.Stat(p)
+	if err != nil || !info.IsDir() {
+		dir := filepath.Dir(p)
+		if err := fsw.Add(dir); err != nil {
+			return fmt.Errorf("cannot watch %s: %w", p, err)
+		}
+		return nil
+	}
+	return filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if err := fsw.Add(path); err != nil {
+			return fmt.Errorf("cannot watch %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// watched reports whether a path is inside the paths of a watch
+func (w *Watcher) watched(name string) bool {
+	for _, ww := range w.watches {
+		if ww.matches(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether a changed path is one of the paths of the watch
+// or inside one of them
+func (ww *watch) matches(name string) bool {
+	for _, p := range ww.paths {
+		if name == p || strings.HasPrefix(name, p+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// change records a changed path and restarts the debounce period, after
+// which run is called with the changed paths
+func (ww *watch) change(name string, run func(changed []string)) {
+	ww.mu.Lock()
+	defer ww.mu.Unlock()
+	ww.changed[name] = true
+	if ww.timer != nil && ww.timer.Stop() {
+		ww.pending.Done()
+	}
+	ww.pending.Add(1)
+	var timer *time.Timer
+	timer = time.AfterFunc(ww.debounce, func() {
+		defer ww.pending.Done()
+		ww.mu.Lock()
+		changed := make([]string, 0, len(ww.changed))
+		for name := range ww.changed {
+			changed = append(changed, name)
+		}
+		ww.changed = make(map[string]bool)
+		// A later change may have scheduled another run already
+		if ww.timer == timer {
+			ww.timer = nil
+		}
+		ww.mu.Unlock()
+
+		// The changes were taken by a run that fired before this one
+		if len(changed) == 0 {
+			return
+		}
+		sort.Strings(changed)
+		run(changed)
+	})
+	ww.timer = timer
+}
+
+// stop cancels the pending run of the watch, unless it already started
+func (ww *watch) stop() {
+	ww.mu.Lock()
+	defer ww.mu.Unlock()
+	if ww.timer != nil {
+		if ww.timer.Stop() {
+			ww.pending.Done()
+		}
+		ww.timer = nil
+	}
+}
+
+// submit queues the commands of a watch for its changed paths
+func (w *Watcher) submit(queue Submitter, ww *watch, changed []string) {
+	names := make([]string, len(changed))
+	for i, name := range changed {
+		names[i] = name
+		if w.workingDir != "" {
+			if rel, err := filepath.Rel(w.workingDir, name); err == nil && !strings.HasPrefix(rel, "..") {
+				names[i] = rel
+			}
+		}
+	}
+
+	source := "change of " + names[0]
+	if len(names) > 1 {
+		source = fmt.Sprintf("change of %s and %d other files", names[0], len(names)-1)
+	}
+	log.Printf("Detected %s", source)
+	_, err := queue.Submit(command.Job{
+		Source:    source,
+		Trigger:   "watch",
+		Commands:  ww.commands,
+		EnvVars:   []string{"DELIVR_CHANGED_FILES=" + strings.Join(changed, ",")},
+		Preflight: w.preflight,
+	})
+	if err != nil {
+		log.Printf("Warning: Could not queue the commands of the %s: %v", source, err)
+	}
+}
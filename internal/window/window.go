@@ -0,0 +1,149 @@
+// Package window implements the recurring time windows in which commands
+// are allowed to run, e.g. weekdays from 22:00 to 06:00.
+package window
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ndious/delivr/internal/config"
+)
+
+// Policies applied to the jobs triggered outside of the allowed windows
+const (
+	// PolicyQueue holds the job until the next window opens
+	PolicyQueue = "queue"
+	// PolicyReject rejects the job
+	PolicyReject = "reject"
+)
+
+// dayNames are the accepted day names, by weekday
+var dayNames = map[string][]time.Weekday{
+	"sun":      {time.Sunday},
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// Window is a recurring period opening on some days of the week. A window
+// closing before it opens, e.g. from 22:00 to 06:00, ends on the next day.
+type Window struct {
+	// days are the days the window opens, by weekday
+	days [7]bool
+	// from and to are durations since midnight
+	from, to time.Duration
+}
+
+// Set is a list of windows, open when any of them is
+type Set []Window
+
+// Parse validates the windows of the configuration
+func Parse(cfgs []config.TimeWindow) (Set, error) {
+	set := make(Set, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		var w Window
+		if len(cfg.Days) == 0 {
+			w.days = [7]bool{true, true, true, true, true, true, true}
+		}
+		for _, name := range cfg.Days {
+			weekdays, ok := dayNames[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("window %d: unknown day '%s', must be mon to sun, weekdays or weekends", i+1, name)
+			}
+			for _, day := range weekdays {
+				w.days[day] = true
+			}
+		}
+
+		var err error
+		if w.from, err = parseTime(cfg.From); err != nil {
+			return nil, fmt.Errorf("window %d: invalid from: %w", i+1, err)
+		}
+		if w.to, err = parseTime(cfg.To); err != nil {
+			return nil, fmt.Errorf("window %d: invalid to: %w", i+1, err)
+		}
+		set = append(set, w)
+	}
+	return set, nil
+}
+
+// ValidatePolicy checks the policy applied outside of the windows
+func ValidatePolicy(policy string) error {
+	switch policy {
+	case "", PolicyQueue, PolicyReject:
+		return nil
+	default:
+		return fmt.Errorf("unknown outsideWindow '%s', must be queue or reject", policy)
+	}
+}
+
+// parseTime parses a time of day as a duration since midnight
+func parseTime(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' must be HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// at returns the time of the day of t at the given duration since midnight
+func at(t time.Time, offset time.Duration) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Add(offset)
+}
+
+// Contains reports whether the window is open at t
+func (w Window) Contains(t time.Time) bool {
+	offset := t.Sub(at(t, 0))
+	today, yesterday := t.Weekday(), (t.Weekday()+6)%7
+	if w.from < w.to {
+		return w.days[today] && offset >= w.from && offset < w.to
+	}
+	// The window spans midnight, or the whole day when from equals to
+	return (w.days[today] && offset >= w.from) || (w.days[yesterday] && offset < w.to)
+}
+
+// next returns the first opening of the window after t
+func (w Window) next(t time.Time) time.Time {
+	for d := 0; d <= 7; d++ {
+		day := t.AddDate(0, 0, d)
+		if opening := at(day, w.from); w.days[day.Weekday()] && opening.After(t) {
+			return opening
+		}
+	}
+	return time.Time{}
+}
+
+// Contains reports whether the set is empty or one of its windows is open
+// at t
+func (s Set) Contains(t time.Time) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for _, w := range s {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns t when the set is open at t, the first opening of one of its
+// windows after t otherwise
+func (s Set) Next(t time.Time) time.Time {
+	if s.Contains(t) {
+		return t
+	}
+	var next time.Time
+	for _, w := range s {
+		if opening := w.next(t); next.IsZero() || opening.Before(next) {
+			next = opening
+		}
+	}
+	return next
+}
@@ -0,0 +1,422 @@
+// Package workflow implements the promotion workflows, which run the same
+// pipeline through environments, e.g. staging then production, with approval
+// gates between them. Each run of a workflow is a release, whose stages are
+// recorded in the history under the same release ID.
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/i18n"
+	"github.com/ndious/delivr/internal/notifier"
+	"github.com/ndious/delivr/internal/tagging"
+)
+
+// ErrUnknownWorkflow is returned when starting a workflow that isn't configured
+var ErrUnknownWorkflow = errors.New("unknown workflow")
+
+// ErrUnknownRelease is returned when approving a release that doesn't exist
+var ErrUnknownRelease = errors.New("unknown release")
+
+// ErrNotAwaitingApproval is returned when approving or rejecting a release
+// that isn't waiting for an approval
+var ErrNotAwaitingApproval = errors.New("release isn't awaiting approval")
+
+// Release states
+const (
+	StateRunning          = "running"
+	StateAwaitingApproval = "awaitingApproval"
+	StateSucceeded        = "succeeded"
+	StateFailed           = "failed"
+	StateRejected         = "rejected"
+)
+
+// recentReleases is the number of finished releases kept for the status
+const recentReleases = 10
+
+// Release is a run of a workflow through its stages
+type Release struct {
+	ID        string        `json:"id"`
+	Workflow  string        `json:"workflow"`
+	Source    string        `json:"source"`
+	State     string        `json:"state"`
+	StartedAt time.Time     `json:"startedAt"`
+	Stages    []StageStatus `json:"stages"`
+
+	// stage is the index of the current stage
+	stage int
+	force bool
+	// workflow is the definition the release started with, which it keeps
+	// when the configuration is reloaded
+	workflow workflow
+}
+
+// StageStatus describes a stage of a release
+type StageStatus struct {
+	Environment string `json:"environment"`
+	// State is pending, awaitingApproval, rejected, or the state of the job
+	State      string `json:"state"`
+	JobID      string `json:"jobId,omitempty"`
+	ApprovedBy string `json:"approvedBy,omitempty"`
+}
+
+// Manager starts the releases and moves them through their stages
+type Manager struct {
+	cfg       *config.Config
+	queue     *command.Queue
+	notify    notifier.Notifier
+	tagger    *tagging.Tagger
+	workflows map[string]workflow
+
+	mu       sync.Mutex
+	nextID   int
+	releases []*Release
+}
+
+// workflow is a configured workflow with its commands resolved
+type workflow struct {
+	name     string
+	commands []config.Command
+	stages   []config.Stage
+}
+
+// Validate checks the workflows of the configuration
+func Validate(cfg *config.Config) error {
+	_, err := parse(cfg)
+	return err
+}
+
+// parse resolves the commands of the workflows
+func parse(cfg *config.Config) (map[string]workflow, error) {
+	workflows := make(map[string]workflow, len(cfg.Workflows))
+	for i, w := range cfg.Workflows {
+		if w.Name == "" {
+			return nil, fmt.Errorf("workflow %d: name is required", i+1)
+		}
+		if _, ok := workflows[w.Name]; ok {
+			return nil, fmt.Errorf("workflow '%s': duplicate name", w.Name)
+		}
+		if len(w.Commands) == 0 {
+			return nil, fmt.Errorf("workflow '%s': no command", w.Name)
+		}
+		commands, err := cfg.ResolveCommands(w.Commands)
+		if err != nil {
+			return nil, fmt.Errorf("workflow '%s': %w", w.Name, err)
+		}
+		if len(w.Stages) == 0 {
+			return nil, fmt.Errorf("workflow '%s': no stage", w.Name)
+		}
+		environments := make(map[string]bool, len(w.Stages))
+		for j, stage := range w.Stages {
+			if stage.Environment == "" {
+				return nil, fmt.Errorf("workflow '%s': stage %d: environment is required", w.Name, j+1)
+			}
+			if environments[stage.Environment] {
+				return nil, fmt.Errorf("workflow '%s': duplicate environment '%s'", w.Name, stage.Environment)
+			}
+			environments[stage.Environment] = true
+		}
+		workflows[w.Name] = workflow{name: w.Name, commands: commands, stages: w.Stages}
+	}
+	return workflows, nil
+}
+
+// New creates a manager for the workflows of the configuration, submitting
+// the stages to the queue
+func New(cfg *config.Config, queue *command.Queue, notify notifier.Notifier) (*Manager, error) {
+	workflows, err := parse(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{cfg: cfg, queue: queue, notify: notify, workflows: workflows}, nil
+}
+
+// SetTagger sets the tagger called once a release succeeded
+func (m *Manager) SetTagger(tagger *tagging.Tagger) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tagger = tagger
+}
+
+// Reconfigure replaces the workflows with those of a reloaded configuration.
+// The releases in progress go on with the definition they started with.
+func (m *Manager) Reconfigure(cfg *config.Config, notify notifier.Notifier) error {
+	workflows, err := parse(cfg)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfg = cfg
+	m.notify = notify
+	m.workflows = workflows
+	return nil
+}
+
+// Start creates a release of a workflow and submits its first stage, unless
+// it requires an approval. force runs the protected commands during a freeze
+// period.
+func (m *Manager) Start(name, source string, force bool) (Release, error) {
+	m.mu.Lock()
+	w, ok := m.workflows[name]
+	if !ok {
+		m.mu.Unlock()
+		return Release{}, fmt.Errorf("%w '%s'", ErrUnknownWorkflow, name)
+	}
+	m.nextID++
+	release := &Release{
+		ID:        fmt.Sprintf("%s-%s-%d", name, time.Now().UTC().Format("20060102T150405"), m.nextID),
+		Workflow:  name,
+		Source:    source,
+		State:     StateRunning,
+		StartedAt: time.Now(),
+		force:     force,
+		workflow:  w,
+	}
+	for _, stage := range w.stages {
+		release.Stages = append(release.Stages, StageStatus{Environment: stage.Environment, State: "pending"})
+	}
+	m.releases = append(m.releases, release)
+	m.prune()
+	m.mu.Unlock()
+
+	log.Printf("Started release %s of workflow '%s' from %s", release.ID, name, source)
+	if w.stages[0].Approval {
+		m.await(release)
+		return m.snapshot(release), nil
+	}
+	if err := m.submit(release); err != nil {
+		return Release{}, err
+	}
+	return m.snapshot(release), nil
+}
+
+// Approve submits the stage a release is waiting for
+func (m *Manager) Approve(id, by string) (Release, error) {
+	release, environment, err := m.decide(id, func(release *Release) {
+		release.State = StateRunning
+		release.Stages[release.stage].ApprovedBy = by
+	})
+	if err != nil {
+		return Release{}, err
+	}
+
+	log.Printf("Release %s approved for %s by %s", id, environment, by)
+	m.send(i18n.T("✅ Release **%s** approved for **%s** by %s", id, environment, by))
+	if err := m.submit(release); err != nil {
+		return Release{}, err
+	}
+	return m.snapshot(release), nil
+}
+
+// Reject ends a release waiting for an approval
+func (m *Manager) Reject(id, by string) (Release, error) {
+	release, environment, err := m.decide(id, func(release *Release) {
+		release.State = StateRejected
+		release.Stages[release.stage].State = StateRejected
+	})
+	if err != nil {
+		return Release{}, err
+	}
+
+	log.Printf("Release %s rejected for %s by %s", id, environment, by)
+	m.send(i18n.T("🚫 Release **%s** rejected for **%s** by %s", id, environment, by))
+	return m.snapshot(release), nil
+}
+
+// Releases returns the releases in progress and the recently finished ones,
+// most recent first
+func (m *Manager) Releases() []Release {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	releases := make([]Release, 0, len(m.releases))
+	for i := len(m.releases) - 1; i >= 0; i-- {
+		releases = append(releases, m.copy(m.releases[i]))
+	}
+	return releases
+}
+
+// decide applies an approval decision to the release with the given ID if it
+// awaits one, and returns the release and the environment of the stage
+func (m *Manager) decide(id string, apply func(*Release)) (*Release, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, release := range m.releases {
+		if release.ID != id {
+			continue
+		}
+		if release.State != StateAwaitingApproval {
+			return nil, "", fmt.Errorf("%w: release %s is %s", ErrNotAwaitingApproval, id, release.State)
+		}
+		apply(release)
+		return release, release.Stages[release.stage].Environment, nil
+	}
+	return nil, "", fmt.Errorf("%w '%s'", ErrUnknownRelease, id)
+}
+
+// submit queues the current stage of a release
+func (m *Manager) submit(release *Release) error {
+	m.mu.Lock()
+	w := release.workflow
+	stage := w.stages[release.stage]
+	preflight := m.cfg.Preflight
+	m.mu.Unlock()
+
+	jobID, err := m.queue.Submit(command.Job{
+		Source:    fmt.Sprintf("release %s (%s)", release.ID, stage.Environment),
+		Trigger:   "workflow",
+		Commands:  w.commands,
+		EnvVars:   stage.EnvVars,
+		Preflight: preflight,
+		Force:     release.force,
+		Stage:     command.Stage{Release: release.ID, Environment: stage.Environment},
+		Done:      func(state string) { m.finished(release, state) },
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		release.State = StateFailed
+		release.Stages[release.stage].State = command.JobAborted
+		log.Printf("Release %s failed: could not submit %s: %v", release.ID, stage.Environment, err)
+		return err
+	}
+	release.Stages[release.stage].State = command.JobQueued
+	release.Stages[release.stage].JobID = jobID
+	return nil
+}
+
+// finished moves a release to its next stage once the job of the current
+// one finished
+func (m *Manager) finished(release *Release, state string) {
+	w := release.workflow
+
+	m.mu.Lock()
+	tagger := m.tagger
+	current := release.Stages[release.stage]
+	release.Stages[release.stage].State = state
+	if state != string(notifier.StatusSuccess) {
+		release.State = StateFailed
+		m.mu.Unlock()
+		log.Printf("Release %s failed in %s (%s)", release.ID, current.Environment, state)
+		m.send(i18n.T("❌ Release **%s** of %s failed in **%s**, the next stages are cancelled", release.ID, release.Workflow, current.Environment))
+		return
+	}
+	if release.stage == len(release.Stages)-1 {
+		release.State = StateSucceeded
+		m.mu.Unlock()
+		log.Printf("Release %s succeeded", release.ID)
+		m.send(i18n.T("🎉 Release **%s** of %s promoted through %s", release.ID, release.Workflow, environments(w.stages)))
+		tagger.After(release.Workflow)
+		return
+	}
+	release.stage++
+	next := w.stages[release.stage]
+	m.mu.Unlock()
+
+	if next.Approval {
+		m.await(release)
+		return
+	}
+	// The stage is submitted by the worker of the queue, which keeps running
+	// the queued jobs while delivr stops
+	if m.queue.Stopping() {
+		m.stopped(release)
+		return
+	}
+	// submit logs the failure, which isn't notified once stopping
+	if err := m.submit(release); err != nil && !errors.Is(err, command.ErrQueueStopping) {
+		m.send(i18n.T("❌ Release **%s** of %s failed: could not start **%s**: %v", release.ID, release.Workflow, next.Environment, err))
+	}
+}
+
+// stopped fails a release whose next stage can't be submitted because
+// delivr is stopping
+func (m *Manager) stopped(release *Release) {
+	m.mu.Lock()
+	release.State = StateFailed
+	release.Stages[release.stage].State = command.JobAborted
+	environment := release.Stages[release.stage].Environment
+	m.mu.Unlock()
+	log.Printf("Error: Release %s failed: %s was not submitted, delivr is stopping", release.ID, environment)
+}
+
+// await holds a release until its current stage is approved or rejected
+func (m *Manager) await(release *Release) {
+	m.mu.Lock()
+	release.State = StateAwaitingApproval
+	release.Stages[release.stage].State = StateAwaitingApproval
+	environment := release.Stages[release.stage].Environment
+	previous := ""
+	if release.stage > 0 {
+		previous = release.Stages[release.stage-1].Environment
+	}
+	m.mu.Unlock()
+
+	log.Printf("Release %s awaits approval for %s", release.ID, environment)
+	msg := i18n.T("⏸️ Release **%s** of %s awaits approval for **%s**", release.ID, release.Workflow, environment)
+	if previous != "" {
+		msg += i18n.T(" (%s succeeded)", previous)
+	}
+	msg += i18n.T("\nApprove with `delivr approve %s` or reject with `delivr reject %s`", release.ID, release.ID)
+	m.send(msg)
+}
+
+// environments lists the environments of the stages, in order
+func environments(stages []config.Stage) string {
+	names := make([]string, len(stages))
+	for i, stage := range stages {
+		names[i] = stage.Environment
+	}
+	return strings.Join(names, " → ")
+}
+
+// prune forgets the oldest finished releases. The caller must hold m.mu.
+func (m *Manager) prune() {
+	finished := 0
+	for i := len(m.releases) - 1; i >= 0; i-- {
+		switch m.releases[i].State {
+		case StateSucceeded, StateFailed, StateRejected:
+			finished++
+			if finished > recentReleases {
+				m.releases = append(m.releases[:i], m.releases[i+1:]...)
+			}
+		}
+	}
+}
+
+// snapshot returns a copy of a release
+func (m *Manager) snapshot(release *Release) Release {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.copy(release)
+}
+
+// copy returns a copy of a release. The caller must hold m.mu.
+func (m *Manager) copy(release *Release) Release {
+	c := *release
+	c.Stages = append([]StageStatus{}, release.Stages...)
+	return c
+}
+
+// send notifies a message about a release
+func (m *Manager) send(msg string) {
+	m.mu.Lock()
+	notify := m.notify
+	m.mu.Unlock()
+	if err := notify.SendMessage(msg); err != nil {
+		log.Printf("Warning: Could not send release message: %v", err)
+	}
+}
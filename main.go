@@ -1,25 +1,63 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/ndious/delivr/internal/command"
 	"github.com/ndious/delivr/internal/config"
-	"github.com/ndious/delivr/internal/discord"
+	"github.com/ndious/delivr/internal/freeze"
+	"github.com/ndious/delivr/internal/history"
+	"github.com/ndious/delivr/internal/i18n"
 	"github.com/ndious/delivr/internal/logger"
+	"github.com/ndious/delivr/internal/notifier"
+	"github.com/ndious/delivr/internal/preflight"
 )
 
 func main() {
 	// Parse command line flags
 	daemonMode := flag.Bool("daemon", false, "Run in daemon mode (don't exit after running commands)")
-	configPath := flag.String("config", "", "Path to the configuration file (default: .delivr.yml in the current directory)")
+	configPath := flag.String("config", "", "Path or URL of the configuration file: https://, s3://bucket/key or git+ssh://host/repo.git//path?ref=branch (default: .delivr.yml in the current directory)")
+	reloadOnChange := flag.Bool("reload-on-change", false, "Reload the configuration when it changes on disk in daemon mode, instead of only reporting it")
+	configRefresh := flag.Duration("config-refresh", 0, "Interval between two fetches of the remote configuration in daemon mode, e.g. 5m (default: never)")
 	initConfig := flag.Bool("init", false, "Generate a default configuration file")
 	outPath := flag.String("out", ".delivr.yml", "Path for the generated configuration file when using --init")
+	force := flag.Bool("force", false, "Run the protected commands during a freeze period")
+	only := flag.String("only", "", "Comma-separated names of the commands to run, instead of all of them")
+	tags := flag.String("tags", "", "Comma-separated tags, only the commands with one of them are run")
+	failFast := flag.Bool("fail-fast", false, "Stop at the first failed command, whatever the failure policies")
+	simulate := flag.Bool("simulate", false, "Replace the commands with fake runs and print the notifications instead of sending them, to rehearse the configuration")
+	var paramValues []string
+	flag.Func("param", "Parameter of the commands, written name=value, e.g. tag=v1.2.3 (repeatable)", func(value string) error {
+		paramValues = append(paramValues, value)
+		return nil
+	})
+	config.SelectEnvironment(os.Getenv("DELIVR_ENV"))
+	flag.Func("env", "Environment of the configuration whose variables are applied to the commands, e.g. staging (default: $DELIVR_ENV)", func(name string) error {
+		config.SelectEnvironment(name)
+		return nil
+	})
+	flag.Func("config-checksum", "SHA-256 checksum of the remote configuration, or URL of a checksum file", func(checksum string) error {
+		config.SetRemoteChecksum(checksum)
+		return nil
+	})
+	flag.Func("age-key-file", "File holding the age key decrypting the encrypted values of the configuration (default: $DELIVR_AGE_KEY_FILE)", func(path string) error {
+		config.SetAgeKeyFile(path)
+		return nil
+	})
+	var recipients []string
+	flag.Func("recipient", "age recipient (age1...) the value is encrypted for with the encrypt command (repeatable, default: the age key)", func(recipient string) error {
+		recipients = append(recipients, recipient)
+		return nil
+	})
 	flag.Parse()
 
 	// Check if we should generate a default configuration file
@@ -32,6 +70,103 @@ func main() {
 		return
 	}
 
+	// Control a running daemon
+	var runTarget string
+	switch action := flag.Arg(0); action {
+	case "pause", "resume":
+		// Accept the flags after the command as well
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if err := sendControl(action, *configPath); err != nil {
+			log.Fatalf("Failed to %s the daemon: %v", action, err)
+		}
+		if action == "pause" {
+			log.Println("Daemon paused: triggers are rejected and queued jobs are held until resumed")
+		} else {
+			log.Println("Daemon resumed")
+		}
+		return
+	case "adhoc":
+		id, err := sendAdhoc(flag.Args()[1:], *configPath)
+		if err != nil {
+			log.Fatalf("Failed to submit the ad-hoc command: %v", err)
+		}
+		log.Printf("Ad-hoc command queued as job %s", id)
+		return
+	case "promote":
+		id, err := sendPromote(flag.Args()[1:], *configPath)
+		if err != nil {
+			log.Fatalf("Failed to start the release: %v", err)
+		}
+		log.Printf("Release %s started", id)
+		return
+	case "replay":
+		id, warning, err := sendReplay(flag.Args()[1:], *configPath)
+		if err != nil {
+			log.Fatalf("Failed to replay the run: %v", err)
+		}
+		if warning != "" {
+			log.Printf("Warning: %s", warning)
+		}
+		log.Printf("Replay queued as job %s", id)
+		return
+	case "approve", "reject":
+		if err := sendDecision(action, flag.Args()[1:], *configPath); err != nil {
+			log.Fatalf("Failed to %s the release: %v", action, err)
+		}
+		if action == "approve" {
+			log.Println("Release approved, its next stage is queued")
+		} else {
+			log.Println("Release rejected")
+		}
+		return
+	case "run":
+		// Run a pipeline or a command instead of all the commands, accepting
+		// the flags after its name as well
+		runTarget = flag.Arg(1)
+		if runTarget == "" {
+			log.Fatalf("Usage: delivr run <pipeline or command> [flags]")
+		}
+		flag.CommandLine.Parse(flag.Args()[2:])
+	case "validate":
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if !validateConfig(*configPath) {
+			os.Exit(1)
+		}
+		return
+	case "history":
+		if err := showHistory(flag.Args()[1:], *configPath); err != nil {
+			log.Fatalf("Failed to read the history: %v", err)
+		}
+		return
+	case "encrypt":
+		// Encrypt the value given after the flags, or read from stdin
+		flag.CommandLine.Parse(flag.Args()[1:])
+		value := flag.Arg(0)
+		if value == "" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				log.Fatalf("Failed to read the value: %v", err)
+			}
+			value = strings.TrimSuffix(string(data), "\n")
+		}
+		encrypted, err := config.Encrypt(value, recipients)
+		if err != nil {
+			log.Fatalf("Failed to encrypt the value: %v", err)
+		}
+		fmt.Println(encrypted)
+		return
+	case "schema":
+		schema, err := config.Schema()
+		if err != nil {
+			log.Fatalf("Failed to generate the schema: %v", err)
+		}
+		fmt.Println(string(schema))
+		return
+	case "":
+	default:
+		log.Fatalf("Unknown command '%s'", action)
+	}
+
 	// Initialize logger
 	log.SetOutput(os.Stdout)
 	log.Println("Starting Delivr - Docker Command Runner with Discord Integration")
@@ -39,20 +174,14 @@ func main() {
 	// Load configuration
 	cfg, err := config.Load(*configPath)
 	if err != nil {
+		reportLoadError(err)
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	config.SetLoaded(cfg)
 
-	log.Printf("Configuration loaded from: %s", config.GetLoadedConfigPath())
-
-	// Initialize Discord client with webhook URL
-	discord, err := discord.NewClient(cfg.Discord.ChannelID)
-	if err != nil {
-		log.Fatalf("Failed to initialize Discord client: %v", err)
-	}
-
-	// Send startup message
-	if err := discord.SendMessage("🚀 Delivr service started"); err != nil {
-		log.Printf("Warning: Could not send startup message: %v", err)
+	log.Printf("Configuration loaded from: %s", config.GetConfigSource())
+	if cfg.Environment() != "" {
+		log.Printf("Environment: %s", cfg.Environment())
 	}
 
 	// Initialize logger with default values if not provided
@@ -62,12 +191,22 @@ func main() {
 	} else {
 		// Use default log configuration
 		logConfig = config.LogConfig{
-			Directory: "./logs",
-			MaxSize:   10,
-			MaxAge:    30,
+			Directory:  "./logs",
+			MaxSize:    10,
+			MaxAge:     30,
 			MaxBackups: 5,
-			Compress:  true,
+			Compress:   true,
+		}
+	}
+	if *simulate {
+		// Keep the logs and the history of the fake runs apart
+		dir, err := os.MkdirTemp("", "delivr-simulate-")
+		if err != nil {
+			log.Fatalf("Failed to create the simulation directory: %v", err)
 		}
+		logConfig.Directory = dir
+		cfg.History = nil
+		log.Printf("Simulation mode: the commands aren't run and the notifications are printed, logs and history in %s", dir)
 	}
 	cmdLogger, err := logger.NewCommandLogger(logConfig)
 	if err != nil {
@@ -75,46 +214,448 @@ func main() {
 	}
 	defer cmdLogger.Close()
 
-	// Initialize Docker runner with the global working directory and docker host
-	dockerHost := ""
-	if cfg.Docker != nil && cfg.Docker.Host != "" {
-		dockerHost = cfg.Docker.Host
+	// Write the operational log to its own file in addition to stdout
+	if logConfig.Daemon != nil {
+		daemonLog, err := logger.NewDaemonLogger(*logConfig.Daemon, cmdLogger.Directory())
+		if err != nil {
+			log.Fatalf("Failed to initialize daemon log: %v", err)
+		}
+		defer daemonLog.Close()
+		log.SetOutput(io.MultiWriter(os.Stdout, daemonLog))
+		log.Printf("Operational log started with configuration %s", config.GetConfigSource())
+	}
+
+	// Initialize the notifiers (Discord, Slack, webhooks, email)
+	notify, err := newNotifiers(cfg, *simulate)
+	if err != nil {
+		log.Fatalf("Failed to initialize notifiers: %v", err)
+	}
+	// The messages built outside the notifiers, e.g. this one, are in the
+	// language of the configuration too
+	if err := i18n.SetLanguage(cfg.Language); err != nil {
+		log.Fatalf("Failed to initialize notifiers: %v", err)
+	}
+
+	// Send startup message
+	startMsg := i18n.T("🚀 Delivr service started")
+	var startDetails []string
+	if cfg.Version != "" {
+		startDetails = append(startDetails, i18n.T("configuration version %s", cfg.Version))
+	}
+	if cfg.Environment() != "" {
+		startDetails = append(startDetails, i18n.T("environment %s", cfg.Environment()))
+	}
+	if len(startDetails) > 0 {
+		startMsg += fmt.Sprintf(" (%s)", strings.Join(startDetails, ", "))
+	}
+	if err := notify.SendMessage(startMsg); err != nil {
+		log.Printf("Warning: Could not send startup message: %v", err)
 	}
-	cmdRunner := command.NewRunner(discord, cmdLogger, cfg.WorkingDir, dockerHost)
 
-	// Execute commands defined in config
-	for _, cmd := range cfg.Commands {
-		if err := cmdRunner.Execute(cmd); err != nil {
-			log.Printf("Error executing command '%s': %v", cmd.Name, err)
-			if err := discord.SendMessage(fmt.Sprintf("❌ Error executing command '%s': %v", cmd.Name, err)); err != nil {
-				log.Printf("Failed to send error message to Discord: %v", err)
+	// Record runs in the history, next to the logs unless configured otherwise
+	historyStore, err := history.Open(cfg.History, cmdLogger.Directory())
+	if err != nil {
+		log.Fatalf("Failed to initialize history: %v", err)
+	}
+	defer historyStore.Close()
+	historyStore.SetHost(notifier.HostFromConfig(cfg.Host).Name)
+
+	// Check the configuration and create the components running its commands
+	opts := setupOptions{
+		logger:         cmdLogger,
+		history:        historyStore,
+		failFast:       *failFast,
+		simulate:       *simulate,
+		configRefresh:  *configRefresh,
+		reloadOnChange: *reloadOnChange,
+	}
+	inst, err := setup(cfg, notify, opts)
+	if err != nil {
+		reportSetupError(notify, err)
+	}
+	instances := []*instance{inst}
+	defer func() {
+		for _, inst := range instances {
+			inst.close()
+		}
+	}()
+	cmdRunner := inst.runner
+
+	// Forward termination signals to the running commands, which run in their
+	// own process groups, then stop
+	runners := &runnerSet{}
+	runners.add(cmdRunner)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	stopCh := make(chan os.Signal, 1)
+	go func() {
+		for sig := range sigCh {
+			log.Printf("Received signal %v, forwarding it to the running commands", sig)
+			runners.signal(sig)
+			select {
+			case stopCh <- sig:
+			default:
 			}
 		}
+	}()
+
+	// Reload the configuration on SIGHUP in daemon mode, once the startup
+	// commands ran
+	hupCh := make(chan os.Signal, 1)
+	if *daemonMode {
+		signal.Notify(hupCh, syscall.SIGHUP)
 	}
 
-	// If not in daemon mode, exit after running commands
+	// Report the commands that can't be started now rather than when they run
+	if !*simulate {
+		selfCheck(cmdRunner, cfg.Commands, notify)
+	}
+
+	// Run a pipeline, or a part of the commands, at startup when asked to
+	startupCommands := cfg.Commands
+	stopOnError := false
+	if runTarget != "" {
+		startupCommands, err = cfg.ResolveCommands([]string{runTarget})
+		if err != nil {
+			log.Fatalf("Cannot run '%s': %v", runTarget, err)
+		}
+		stopOnError = true
+	}
+	if *only != "" || *tags != "" {
+		startupCommands, err = config.SelectCommands(startupCommands, splitList(*only), splitList(*tags))
+		if err != nil {
+			log.Fatalf("Invalid command selection: %v", err)
+		}
+		log.Printf("Running %d of %d commands", len(startupCommands), len(cfg.Commands))
+	}
+	params, err := config.ParseParams(paramValues)
+	if err != nil {
+		log.Fatalf("Invalid parameters: %v", err)
+	}
+	if runTarget == "" && *only == "" && *tags == "" && len(params) == 0 {
+		// The commands with parameters only run when they are supplied
+		startupCommands = withoutParams(startupCommands)
+	}
+	if err := config.CheckParams(startupCommands, params); err != nil {
+		log.Fatalf("Cannot run the commands: %v", err)
+	}
+
+	// Wait for the services the commands depend on, e.g. when started at boot,
+	// then run pre-flight checks and execute commands defined in config
+	release := func() {}
+	if !*simulate {
+		err = waitForDependencies(cfg, dockerHost(cfg), cmdRunner, notify)
+		if err == nil {
+			release, err = cmdRunner.Preflight(cfg.Preflight)
+		}
+	}
+	startupSucceeded := false
+	if err != nil {
+		log.Printf("Commands aborted: %v", err)
+	} else if !checkFreeze(inst.freezes, startupCommands, *force, notify) {
+		log.Printf("Commands aborted: protected commands during a freeze period")
+	} else {
+		steps := cmdRunner.RunPipeline("startup", startupCommands, params, stopOnError)
+		startupSucceeded = succeeded(steps, len(startupCommands))
+		// Only tag complete runs of a pipeline
+		if runTarget != "" && *only == "" && *tags == "" && startupSucceeded {
+			inst.tagger.After(runTarget)
+		}
+	}
+	release()
+
+	// If not in daemon mode, exit after running commands, with a non-zero
+	// status when they didn't all succeed
 	if !*daemonMode {
+		if cmdRunner.Stopping() {
+			log.Println("Interrupted, shutting down...")
+			if err := notify.SendMessage(stoppingMessage(cmdRunner.Interrupted())); err != nil {
+				log.Printf("Warning: Could not send shutdown message: %v", err)
+			}
+			flushNotifications(notify)
+			os.Exit(exitInterrupted)
+		}
+
 		// Send shutdown message
-		if err := discord.SendMessage("✅ Delivr - Toutes les commandes ont été exécutées"); err != nil {
+		if err := notify.SendMessage(i18n.T("✅ Delivr - All commands have been executed")); err != nil {
 			log.Printf("Warning: Could not send completion message: %v", err)
 		}
 		log.Println("All commands executed, shutting down...")
+		flushNotifications(notify)
+		if !startupSucceeded {
+			log.Println("Exiting with an error, some commands failed or didn't run")
+			os.Exit(exitFailure)
+		}
 		return
 	}
 
-	// In daemon mode, setup signal handling for graceful shutdown
-	log.Println("Running in daemon mode, press Ctrl+C to exit")
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	// In daemon mode, start the triggers: the HTTP server if one is
+	// configured, the file watches, the image polls and the reports
+	d := newDaemon(inst, opts)
+	if err := d.start(inst); err != nil {
+		reportSetupError(notify, err)
+	}
 
 	// Wait for termination signal
-	sig := <-sigCh
-	log.Printf("Received signal %v, shutting down...", sig)
+	log.Println("Running in daemon mode, press Ctrl+C to exit")
+	for running := true; running; {
+		select {
+		case <-hupCh:
+			log.Printf("Received signal %v", syscall.SIGHUP)
+		case <-d.reload:
+			log.Printf("Configuration changed on disk")
+		case sig := <-stopCh:
+			log.Printf("Received signal %v, shutting down...", sig)
+			running = false
+			continue
+		}
+		if next := d.reloadConfig(*configPath, inst, runners); next != inst {
+			instances = append(instances, next)
+			inst = next
+		}
+	}
+
+	// Stop receiving triggers and let queued jobs complete
+	d.stopTriggers()
+	d.queue.Stop()
 
 	// Send shutdown message
-	if err := discord.SendMessage("🛑 Delivr service stopping"); err != nil {
+	if err := inst.notify.SendMessage(stoppingMessage(runners.interrupted())); err != nil {
 		log.Printf("Warning: Could not send shutdown message: %v", err)
 	}
+	flushNotifications(inst.notify)
 
 	log.Println("Shutdown complete")
 }
+
+// stoppingMessage is the shutdown message, listing the commands interrupted
+// by the termination signal
+func stoppingMessage(interrupted []string) string {
+	msg := i18n.T("🛑 Delivr service stopping")
+	if len(interrupted) > 0 {
+		msg += i18n.T(", interrupted commands: %s", strings.Join(interrupted, ", "))
+	}
+	return msg
+}
+
+// Exit statuses when the commands run without daemon mode didn't all succeed
+const (
+	exitFailure     = 1
+	exitInterrupted = 130
+)
+
+// notificationFlushTimeout is the maximum time waited at exit for the result
+// notifications being retried
+const notificationFlushTimeout = 90 * time.Second
+
+// flushNotifications sends the digests of notify and waits for the result
+// notifications being retried
+func flushNotifications(notify notifier.Multi) {
+	if !notify.Flush(notificationFlushTimeout) {
+		log.Printf("Warning: Some result notifications could not be sent before exiting")
+	}
+}
+
+// reportLoadError sends an error of the configuration file to the notifiers
+// that can still be read from it, since nobody may be watching the output
+// of the daemon
+func reportLoadError(err error) {
+	var cfgErr *config.Error
+	if !errors.As(err, &cfgErr) {
+		return
+	}
+	partial := config.LoadNotifications(cfgErr.File)
+	if partial == nil {
+		return
+	}
+	notify, nerr := notifier.New(partial)
+	if nerr != nil {
+		return
+	}
+	if nerr := notify.SendMessage(i18n.T("❌ Delivr could not start, the configuration is invalid:\n```\n%v\n```", err)); nerr != nil {
+		log.Printf("Warning: Could not send configuration error message: %v", nerr)
+	}
+	notify.FlushDigests()
+}
+
+// waitForDependencies waits for the startup dependencies of the
+// configuration, and notifies when they aren't ready in time
+func waitForDependencies(cfg *config.Config, dockerHost string, runner *command.Runner, notify notifier.Notifier) error {
+	if len(cfg.WaitFor) == 0 {
+		return nil
+	}
+
+	log.Printf("Waiting for %s", strings.Join(cfg.WaitFor, ", "))
+	startedAt := time.Now()
+	err := preflight.WaitFor(cfg.WaitFor, dockerHost, cfg.WaitForTimeout.Std(), runner.Stopping)
+	if err != nil {
+		if !errors.Is(err, preflight.ErrWaitStopped) {
+			if nerr := notify.SendMessage(i18n.T("🛑 Startup dependencies %v, no command was run", err)); nerr != nil {
+				log.Printf("Warning: Could not send startup dependencies message: %v", nerr)
+			}
+		}
+		return fmt.Errorf("startup dependencies %w", err)
+	}
+	log.Printf("Startup dependencies ready after %s", time.Since(startedAt).Round(time.Second))
+	return nil
+}
+
+// succeeded reports whether the pipeline ran all its commands successfully
+func succeeded(steps []history.Step, commands int) bool {
+	if len(steps) != commands {
+		return false
+	}
+	for _, step := range steps {
+		if step.Failed() {
+			return false
+		}
+	}
+	return true
+}
+
+// splitList splits a comma-separated list, ignoring the empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// withoutParams returns the commands that declare no parameters, logging the
+// others
+func withoutParams(commands []config.Command) []config.Command {
+	selected := make([]config.Command, 0, len(commands))
+	for _, cmd := range commands {
+		if len(cmd.Params) > 0 {
+			log.Printf("Skipping command '%s', its parameters %s aren't supplied", cmd.Name, strings.Join(cmd.Params, ", "))
+			continue
+		}
+		selected = append(selected, cmd)
+	}
+	return selected
+}
+
+// checkFreeze reports whether the commands may run, notifying when protected
+// commands are rejected or forced during a freeze period
+func checkFreeze(freezes *freeze.Calendar, commands []config.Command, force bool, notify notifier.Notifier) bool {
+	name, period, frozen := freezes.Blocks(commands, time.Now())
+	if !frozen {
+		return true
+	}
+
+	msg := i18n.T("🧊 Commands not run: '%s' is protected and %s. Use --force to override.", name, period)
+	if force {
+		msg = i18n.T("⚠️ Protected command **%s** forced during the freeze period (%s)", name, period)
+	}
+	if err := notify.SendMessage(msg); err != nil {
+		log.Printf("Warning: Could not send freeze message: %v", err)
+	}
+	return force
+}
+
+// exitConfigError notifies an error of the loaded configuration and exits
+func exitConfigError(notify notifier.Multi, msg string, err error) {
+	if nerr := notify.SendMessage(i18n.T("❌ Delivr could not start, the configuration of `%s` is invalid:\n```\n%s: %v\n```", config.GetConfigSource(), msg, err)); nerr != nil {
+		log.Printf("Warning: Could not send configuration error message: %v", nerr)
+	}
+	notify.FlushDigests()
+	log.Fatalf("%s: %v", msg, err)
+}
+
+// selfCheck reports the commands that can't be started, e.g. because their
+// program isn't installed, in the log and to the notifiers
+func selfCheck(runner *command.Runner, commands []config.Command, notify notifier.Notifier) {
+	problems := runner.SelfCheck(commands)
+	if len(problems) == 0 {
+		return
+	}
+	for _, problem := range problems {
+		log.Printf("Warning: Self-check: %s", problem)
+	}
+	msg := i18n.T("⚠️ Self-check: these commands can't be started and will fail when they run\n- %s", strings.Join(problems, "\n- "))
+	if err := notify.SendMessage(msg); err != nil {
+		log.Printf("Warning: Could not send self-check message: %v", err)
+	}
+}
+
+// refreshRemoteConfig periodically fetches the remote configuration, updating
+// its local copy so that the drift checker reports its changes. A failing
+// fetch is notified once, until it succeeds again.
+func refreshRemoteConfig(source string, interval time.Duration, notify notifier.Notifier, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failing := false
+	for {
+		select {
+		case <-ticker.C:
+			_, err := config.FetchRemote(source)
+			if err == nil {
+				failing = false
+				continue
+			}
+			log.Printf("Warning: Could not refresh the configuration from %s: %v", source, err)
+			if failing {
+				continue
+			}
+			failing = true
+			if nerr := notify.SendMessage(i18n.T("⚠️ Could not refresh the configuration from `%s`:\n```\n%v\n```", source, err)); nerr != nil {
+				log.Printf("Warning: Could not send configuration refresh message: %v", nerr)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// driftCheckInterval is the delay between two checks of the configuration file
+const driftCheckInterval = time.Minute
+
+// watchConfigDrift periodically compares the configuration file on disk with
+// the loaded one and notifies when it changed but wasn't reloaded. When
+// reload is set, the valid changes are sent to it to be reloaded instead.
+func watchConfigDrift(checker *config.DriftChecker, notify notifier.Notifier, reload chan<- struct{}, stop <-chan struct{}) {
+	ticker := time.NewTicker(driftCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			drift, err := checker.Check()
+			if err != nil {
+				log.Printf("Warning: Could not check configuration drift: %v", err)
+				continue
+			}
+			if drift == nil {
+				continue
+			}
+			if reload != nil && drift.Err == nil {
+				// The valid changes are applied at once
+				select {
+				case reload <- struct{}{}:
+				default:
+				}
+				continue
+			}
+
+			msg := i18n.T("⚠️ Configuration file `%s` changed on disk but hasn't been loaded (hash %.12s → %.12s)", drift.Path, drift.LoadedHash, drift.DiskHash)
+			if drift.LoadedVersion != drift.DiskVersion {
+				msg += i18n.T("\nVersion: running `%s`, on disk `%s`", drift.LoadedVersion, drift.DiskVersion)
+			}
+			if drift.Err != nil {
+				msg += i18n.T("\n❌ The new configuration is invalid and delivr would fail to restart:\n```\n%v\n```", drift.Err)
+			} else {
+				msg += i18n.Text("\nReload delivr with SIGHUP, or restart it, to apply the changes.")
+			}
+			log.Printf("Configuration drift detected for %s", drift.Path)
+			if err := notify.SendMessage(msg); err != nil {
+				log.Printf("Warning: Could not send configuration drift message: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
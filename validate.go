@@ -0,0 +1,345 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+
+	"github.com/ndious/delivr/internal/command"
+	"github.com/ndious/delivr/internal/config"
+	"github.com/ndious/delivr/internal/discord"
+	"github.com/ndious/delivr/internal/freeze"
+	"github.com/ndious/delivr/internal/history"
+	"github.com/ndious/delivr/internal/imagepoll"
+	"github.com/ndious/delivr/internal/k8s"
+	"github.com/ndious/delivr/internal/notifier"
+	"github.com/ndious/delivr/internal/output"
+	"github.com/ndious/delivr/internal/preflight"
+	"github.com/ndious/delivr/internal/redact"
+	"github.com/ndious/delivr/internal/remote"
+	"github.com/ndious/delivr/internal/report"
+	"github.com/ndious/delivr/internal/secrets"
+	"github.com/ndious/delivr/internal/server"
+	"github.com/ndious/delivr/internal/tagging"
+	"github.com/ndious/delivr/internal/watch"
+	"github.com/ndious/delivr/internal/window"
+	"github.com/ndious/delivr/internal/workflow"
+)
+
+// validation collects the problems found in a configuration
+type validation struct {
+	errors   int
+	warnings int
+}
+
+func (v *validation) error(format string, args ...interface{}) {
+	v.errors++
+	fmt.Printf("❌ %s\n", fmt.Sprintf(format, args...))
+}
+
+func (v *validation) warn(format string, args ...interface{}) {
+	v.warnings++
+	fmt.Printf("⚠️  %s\n", fmt.Sprintf(format, args...))
+}
+
+// check reports err as an error of the section, if any
+func (v *validation) check(section string, err error) {
+	if err != nil {
+		v.error("%s: %v", section, err)
+	}
+}
+
+// validateConfig checks a configuration file without running anything and
+// reports whether it's valid. Every unknown field is reported, and the
+// Discord webhook or channel is fetched to verify the credentials.
+func validateConfig(configPath string) bool {
+	var v validation
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		var fieldErrs config.FieldErrors
+		if !errors.As(err, &fieldErrs) {
+			v.error("%v", err)
+			return false
+		}
+		for _, fieldErr := range fieldErrs {
+			v.error("%v", fieldErr)
+		}
+		fmt.Printf("Configuration invalid: %d errors\n", v.errors)
+		return false
+	}
+	fmt.Printf("Validating %s\n", cfg.Source())
+
+	v.checkCommands(cfg)
+	v.checkDirectories(cfg)
+	v.checkPrograms(cfg)
+
+	// The sections checked at startup
+	_, err = notifier.New(cfg)
+	v.check("notifiers", err)
+	_, err = secrets.New(cfg.Secrets)
+	v.check("secrets", err)
+	_, err = redact.New(cfg.Redaction)
+	v.check("redaction", err)
+	if cfg.Redaction != nil {
+		for _, name := range cfg.Redaction.Secrets {
+			if _, ok := cfg.Secrets[name]; !ok {
+				v.error("redaction: unknown secret '%s'", name)
+			}
+		}
+	}
+	freezes, err := freeze.New(cfg.Freezes)
+	v.check("freezes", err)
+	if err == nil {
+		v.check("freezes", freezes.Refresh())
+	}
+	_, err = report.Parse(cfg.Reports)
+	v.check("reports", err)
+	if cfg.Notifications != nil {
+		_, err = notifier.ParseTemplates(cfg.Notifications.Templates)
+		v.check("notifications.templates", err)
+	}
+	if cfg.Server != nil {
+		_, err = server.New(cfg, nil, nil, nil)
+		v.check("server", err)
+	}
+	v.check("hosts", cfg.ValidateHosts())
+	v.check("pipelines", cfg.ValidatePipelines())
+	v.check("failure policies", cfg.ValidateFailurePolicies())
+	v.check("retries", cfg.ValidateRetries())
+	v.check("supersede", cfg.ValidateSupersede())
+	v.check("approvals", cfg.ValidateApprovals())
+	v.check("acl", cfg.ValidateDiscordACL())
+	v.check("outputs", cfg.ValidateOutputs())
+	v.check("patterns", cfg.ValidateOutputPatterns())
+	v.check("stdin", cfg.ValidateStdin())
+	v.check("params", cfg.ValidateParams())
+	v.check("streamThrottle", cfg.ValidateStreamThrottles())
+	v.check("shutdownGracePeriod", cfg.ValidateShutdownGracePeriod())
+	v.check("simulate", cfg.ValidateSimulate())
+	v.check("waitFor", preflight.ValidateWaitFor(cfg.WaitFor))
+	v.check("workflows", workflow.Validate(cfg))
+	_, err = tagging.New(cfg, nil)
+	v.check("tagging", err)
+	v.check("output", output.Validate(cfg))
+	v.check("remote hosts", remote.Validate(cfg))
+	v.check("history", history.Validate(cfg.History))
+	_, err = watch.New(cfg)
+	v.check("watch", err)
+	_, err = imagepoll.New(cfg, nil)
+	v.check("imagePolls", err)
+	for i, update := range cfg.ImageUpdates {
+		_, err := cfg.ResolveCommands(update.Commands)
+		v.check(fmt.Sprintf("imageUpdates[%d]", i), err)
+	}
+	for i, push := range cfg.GitPushes {
+		v.check(fmt.Sprintf("gitPushes[%d]", i), checkGitPush(cfg, push))
+	}
+
+	v.checkDiscord(cfg.Discord)
+	v.checkNotifications(cfg.Notifications)
+
+	if v.errors > 0 {
+		fmt.Printf("Configuration invalid: %d errors, %d warnings\n", v.errors, v.warnings)
+		return false
+	}
+	fmt.Printf("Configuration valid (%d warnings)\n", v.warnings)
+	return true
+}
+
+// checkCommands checks the required fields of the commands
+func (v *validation) checkCommands(cfg *config.Config) {
+	if len(cfg.Commands) == 0 {
+		v.error("commands: no command configured")
+	}
+
+	seen := make(map[string]bool)
+	for i, cmd := range cfg.Commands {
+		field := fmt.Sprintf("commands[%d]", i)
+		if cmd.Name == "" {
+			v.error("%s: name is required", field)
+		} else if seen[cmd.Name] {
+			v.error("%s: duplicate name '%s', triggers only run the first one", field, cmd.Name)
+		}
+		seen[cmd.Name] = true
+
+		switch cmd.Type {
+		case "", config.CommandTypeExec:
+			switch {
+			case cmd.Command == "" && cmd.Shell == "":
+				v.error("%s: command or shell is required", field)
+			case cmd.Command != "" && cmd.Shell != "":
+				v.error("%s: command and shell are exclusive", field)
+			case cmd.Shell != "" && len(cmd.Args) > 0:
+				v.error("%s: args are ignored with shell, write them in the script", field)
+			}
+		case config.CommandTypeDocker:
+			if cmd.Docker == nil || cmd.Docker.Action == "" {
+				v.error("%s: docker.action is required for docker commands", field)
+			}
+		case config.CommandTypeCompose:
+			if cmd.Compose == nil || cmd.Compose.Action == "" {
+				v.error("%s: compose.action is required for compose commands", field)
+			}
+		case config.CommandTypeK8s:
+			if err := k8s.Validate(cmd.K8s); err != nil {
+				v.error("%s: %v", field, err)
+			}
+		default:
+			v.error("%s: unknown type '%s', must be exec, docker, compose or k8s", field, cmd.Type)
+		}
+
+		v.checkHooks(field+".preHooks", cmd.PreHooks, false)
+		v.checkHooks(field+".postHooks", cmd.PostHooks, true)
+
+		if _, err := window.Parse(cmd.AllowedWindows); err != nil {
+			v.error("%s: allowedWindows: %v", field, err)
+		}
+		if err := window.ValidatePolicy(cmd.OutsideWindow); err != nil {
+			v.error("%s: %v", field, err)
+		}
+	}
+}
+
+// checkGitPush checks the patterns and commands of a git push mapping
+func checkGitPush(cfg *config.Config, push config.GitPush) error {
+	for _, pattern := range []string{push.Repository, push.Branch} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+	_, err := cfg.ResolveCommands(push.Commands)
+	return err
+}
+
+// checkHooks checks the hooks of a command. Only post hooks have a condition.
+func (v *validation) checkHooks(field string, hooks []config.Hook, post bool) {
+	for i, hook := range hooks {
+		hookField := fmt.Sprintf("%s[%d]", field, i)
+		switch {
+		case hook.Command == "" && hook.Shell == "":
+			v.error("%s: command or shell is required", hookField)
+		case hook.Command != "" && hook.Shell != "":
+			v.error("%s: command and shell are exclusive", hookField)
+		}
+		switch hook.On {
+		case "", config.HookOnAlways:
+		case config.HookOnSuccess, config.HookOnFailure:
+			if !post {
+				v.error("%s: on only applies to post hooks", hookField)
+			}
+		default:
+			v.error("%s: unknown on '%s', must be success, failure or always", hookField, hook.On)
+		}
+	}
+}
+
+// checkPrograms runs the startup self-check on the commands of this host. Its
+// problems are warnings, the programs may be installed before the commands run.
+func (v *validation) checkPrograms(cfg *config.Config) {
+	dockerHost := ""
+	if cfg.Docker != nil {
+		dockerHost = cfg.Docker.Host
+	}
+	runner := command.NewRunner(nil, nil, cfg.WorkingDir, dockerHost)
+	runner.SetInterpreter(cfg.Interpreter)
+	runner.SetHostGroups(cfg.HostGroups)
+
+	host := notifier.HostFromConfig(cfg.Host)
+	var commands []config.Command
+	for _, cmd := range cfg.Commands {
+		if cmd.RunsOn(host.Name) {
+			commands = append(commands, cmd)
+		}
+	}
+	for _, problem := range runner.SelfCheck(commands) {
+		v.warn("self-check: %s", problem)
+	}
+}
+
+// checkDirectories checks that the working directories exist. The log
+// directory is created when missing.
+func (v *validation) checkDirectories(cfg *config.Config) {
+	v.check("paths", cfg.ValidatePaths())
+	if cfg.Logs != nil && cfg.Logs.Directory != "" {
+		if _, err := os.Stat(cfg.Logs.Directory); errors.Is(err, os.ErrNotExist) {
+			v.warn("logs.directory: %s doesn't exist and will be created", cfg.Logs.Directory)
+		}
+	}
+}
+
+// checkDiscord fetches the Discord webhook or channel, without posting
+func (v *validation) checkDiscord(cfg config.DiscordConfig) {
+	switch {
+	case cfg.Bot != nil:
+		bot, err := discord.NewBot(cfg.Bot.Token)
+		if err == nil {
+			err = bot.CheckChannel(cfg.Bot.ChannelID)
+		}
+		v.check("discord.bot", err)
+		for i, route := range cfg.Routes {
+			if bot != nil && route.ChannelID != "" {
+				v.check(fmt.Sprintf("discord.routes[%d]", i), bot.CheckChannel(route.ChannelID))
+			}
+		}
+		for _, name := range sortedKeys(cfg.Channels) {
+			if bot != nil {
+				v.check("discord.channels."+name, bot.CheckChannel(cfg.Channels[name]))
+			}
+		}
+	case cfg.ChannelID != "":
+		client, err := discord.NewClient(cfg.ChannelID)
+		if err == nil {
+			err = client.Check()
+		}
+		v.check("discord.channelId", err)
+		for i, route := range cfg.Routes {
+			if route.ChannelID == "" {
+				continue
+			}
+			client, err := discord.NewClient(route.ChannelID)
+			if err == nil {
+				err = client.Check()
+			}
+			v.check(fmt.Sprintf("discord.routes[%d]", i), err)
+		}
+		for _, name := range sortedKeys(cfg.Channels) {
+			client, err := discord.NewClient(cfg.Channels[name])
+			if err == nil {
+				err = client.Check()
+			}
+			v.check("discord.channels."+name, err)
+		}
+	}
+}
+
+// checkNotifications connects and authenticates to the SMTP server and
+// fetches the Telegram chat, without sending. The invalid settings are
+// reported with the notifiers.
+func (v *validation) checkNotifications(cfg *config.NotificationsConfig) {
+	if cfg == nil {
+		return
+	}
+	if cfg.Email != nil {
+		if email, err := notifier.NewEmail(*cfg.Email); err == nil {
+			v.check("notifications.email", email.Check())
+		}
+	}
+	if cfg.Telegram != nil {
+		if telegram, err := notifier.NewTelegram(cfg.Telegram.BotToken, cfg.Telegram.ChatID); err == nil {
+			v.check("notifications.telegram", telegram.Check())
+		}
+	}
+}
+
+// sortedKeys returns the keys of a map, sorted
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}